@@ -0,0 +1,360 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/filters"
+)
+
+// dposSimulatedEpoch is the number of blocks between validator set updates of
+// the simulated dpos chain, kept short for tests to run through epochs quickly.
+const dposSimulatedEpoch = 10
+
+// DposSimulatedBackend is a SimulatedBackend sealing its blocks with the dpos
+// engine, run by throwaway validator keys on a chain with the system contracts
+// deployed. On top of the contract bindings it lets tests drive the consensus:
+// advance epochs, miss turns, blacklist addresses and commit proposals.
+type DposSimulatedBackend struct {
+	*SimulatedBackend
+
+	engine *dpos.Dpos
+	keys   map[common.Address]*ecdsa.PrivateKey // Keys of the genesis validators
+	admin  *ecdsa.PrivateKey                    // Key of the system contracts admin
+	signer types.Signer
+
+	missUntil uint64 // Last block sealed out of turn, guarded by the backend lock
+	now       uint64 // Simulated unix time the engine checks block times against
+}
+
+// NewDposSimulatedBackend creates a new binding backend on a simulated dpos
+// chain run by the given number of validators. The chain seals blocks on
+// demand and uses chainID 1337, like the ethash one.
+func NewDposSimulatedBackend(alloc core.GenesisAlloc, gasLimit uint64, validators int) *DposSimulatedBackend {
+	keys := make(map[common.Address]*ecdsa.PrivateKey, validators)
+	addrs := make([]common.Address, 0, validators)
+	for i := 0; i < validators; i++ {
+		key, _ := crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		keys[addr] = key
+		addrs = append(addrs, addr)
+	}
+	admin, _ := crypto.GenerateKey()
+	adminAddr := crypto.PubkeyToAddress(admin.PublicKey)
+
+	allocs := core.GenesisAlloc{adminAddr: {Balance: new(big.Int).Lsh(big.NewInt(1), 128)}}
+	for addr, account := range alloc {
+		allocs[addr] = account
+	}
+	genesis, err := dpos.NewGenesis(&dpos.GenesisSpec{
+		ChainID:    big.NewInt(1337),
+		Epoch:      dposSimulatedEpoch,
+		Admin:      adminAddr,
+		Validators: addrs,
+		GasLimit:   gasLimit,
+		Alloc:      allocs,
+	})
+	if err != nil {
+		panic(err)
+	}
+	database := rawdb.NewMemoryDatabase()
+	block := genesis.MustCommit(database)
+
+	engine := dpos.New(genesis.Config, database, nil, block.Hash())
+	blockchain, _ := core.NewBlockChain(database, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	engine.SetStateFn(blockchain.StateAt)
+
+	backend := &DposSimulatedBackend{
+		SimulatedBackend: &SimulatedBackend{
+			database:   database,
+			blockchain: blockchain,
+			config:     genesis.Config,
+			events:     filters.NewEventSystem(&filterBackend{database, blockchain}, false),
+		},
+		engine: engine,
+		keys:   keys,
+		admin:  admin,
+		signer: types.NewEIP155Signer(genesis.Config.ChainID),
+		now:    block.Time(),
+	}
+	engine.SetClock(func() time.Time { return time.Unix(int64(atomic.LoadUint64(&backend.now)), 0) })
+
+	backend.generate = backend.generateDpos
+	backend.rollback()
+	return backend
+}
+
+// Engine returns the dpos engine sealing the simulated chain.
+func (b *DposSimulatedBackend) Engine() *dpos.Dpos {
+	return b.engine
+}
+
+// Admin returns the address administering the system contracts, pre-funded to
+// send the transactions of the consensus helpers.
+func (b *DposSimulatedBackend) Admin() common.Address {
+	return crypto.PubkeyToAddress(b.admin.PublicKey)
+}
+
+// Validators returns the validators sealing the block on top of the head.
+func (b *DposSimulatedBackend) Validators() ([]common.Address, error) {
+	head := b.blockchain.CurrentHeader()
+	snap, err := b.engine.Snapshot(b.blockchain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	validators := make([]common.Address, 0, len(snap.Validators))
+	for val := range snap.Validators {
+		validators = append(validators, val)
+	}
+	return sortValidators(validators), nil
+}
+
+// AdvanceEpoch commits the pending block, followed by empty blocks until the
+// head is an epoch block, updating the validator set.
+func (b *DposSimulatedBackend) AdvanceEpoch() {
+	b.Commit()
+	for b.blockchain.CurrentHeader().Number.Uint64()%dposSimulatedEpoch != 0 {
+		b.Commit()
+	}
+}
+
+// MissTurns has the in-turn validators of the pending block and of the n-1
+// blocks after it miss their turn, leaving them to out-of-turn validators which
+// get the absent ones punished. It needs at least three validators for an
+// out-of-turn one to be allowed to seal.
+func (b *DposSimulatedBackend) MissTurns(n int) error {
+	validators, err := b.Validators()
+	if err != nil {
+		return err
+	}
+	if len(validators) < 3 {
+		return fmt.Errorf("%d validators can't miss turns, want at least 3", len(validators))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := b.missUntil
+	b.missUntil = b.pendingBlock.NumberU64() + uint64(n) - 1
+	if err := b.setPending(b.pendingBlock.Transactions(), 0); err != nil {
+		b.missUntil = prev
+		return err
+	}
+	return nil
+}
+
+// SetBlacklisted adds addr to or removes it from the blacklist of the given
+// direction in the pending block. The blacklist is enforced from the block
+// after it.
+func (b *DposSimulatedBackend) SetBlacklisted(addr common.Address, direction dpos.BlacklistDirection, blacklisted bool) error {
+	method := "removeBlacklist"
+	if blacklisted {
+		method = "addBlacklist"
+	}
+	data, err := systemcontract.GetInteractiveABI()[systemcontract.AddressListContractName].Pack(method, addr, uint8(direction))
+	if err != nil {
+		return err
+	}
+	return b.sendAdminTx(systemcontract.AddressListContractAddr, data)
+}
+
+// CommitProposal commits a governance proposal calling to from the from
+// address in the pending block. Proposals committed by the admin pass right
+// away and are executed by the consensus engine in the block after it.
+func (b *DposSimulatedBackend) CommitProposal(from, to common.Address, value *big.Int, input []byte) error {
+	if value == nil {
+		value = new(big.Int)
+	}
+	data, err := systemcontract.GetInteractiveABI()[systemcontract.SysGovContractName].Pack("commitProposal", big.NewInt(0), from, to, value, input)
+	if err != nil {
+		return err
+	}
+	return b.sendAdminTx(systemcontract.SysGovContractAddr, data)
+}
+
+// sendAdminTx adds a call to a system contract from the admin to the pending
+// block, failing if the contract rejects it.
+func (b *DposSimulatedBackend) sendAdminTx(to common.Address, data []byte) error {
+	ctx := context.Background()
+	from := b.Admin()
+
+	gas, err := b.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Data: data})
+	if err != nil {
+		return err
+	}
+	nonce, err := b.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+	gasPrice, err := b.SuggestGasPrice(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := types.SignTx(types.NewTransaction(nonce, to, new(big.Int), gas, gasPrice, data), b.signer, b.admin)
+	if err != nil {
+		return err
+	}
+	return b.SendTransaction(ctx, tx)
+}
+
+// generateDpos assembles and seals a block with the dpos engine, as the in-turn
+// validator or as an out-of-turn one if the block misses its turn.
+func (b *DposSimulatedBackend) generateDpos(parent *types.Block, txs []*types.Transaction, offset int64) (*types.Block, error) {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+	}
+	val, err := b.sealer(header)
+	if err != nil {
+		return nil, err
+	}
+	key := b.keys[val]
+	b.engine.Authorize(val, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), key)
+	}, func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		return types.SignTx(tx, b.signer, key)
+	})
+	// The clock never runs ahead of the chain, blocks are timed by the engine only
+	atomic.StoreUint64(&b.now, parent.Time())
+	if err := b.engine.Prepare(b.blockchain, header); err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, errors.New("block time out of range")
+	}
+	header.Time += uint64(offset)
+	atomic.StoreUint64(&b.now, header.Time)
+
+	statedb, err := b.blockchain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	if err := b.engine.PreHandle(b.blockchain, header, statedb); err != nil {
+		return nil, err
+	}
+	var (
+		gasPool  = new(core.GasPool).AddGas(header.GasLimit)
+		pending  = make([]*types.Transaction, 0, len(txs))
+		receipts = make([]*types.Receipt, 0, len(txs))
+	)
+	for _, tx := range txs {
+		// The system transactions of the replaced pending block are made anew
+		if b.pendingBlock != nil {
+			if system, _ := b.engine.IsSystemTransaction(tx, b.pendingBlock.Header()); system {
+				continue
+			}
+		}
+		pending = append(pending, tx)
+	}
+	for i, tx := range pending {
+		if err := b.engine.ValidateTx(tx, header, statedb); err != nil {
+			return nil, fmt.Errorf("invalid transaction %v: %w", tx.Hash(), err)
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+		receipt, err := core.ApplyTransaction(b.config, b.blockchain, &header.Coinbase, gasPool, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction %v: %w", tx.Hash(), err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	block, _, err := b.engine.FinalizeAndAssemble(b.blockchain, header, statedb, pending, nil, receipts)
+	if err != nil {
+		return nil, err
+	}
+	// Write the state changes for the pending state to read them
+	root, err := statedb.Commit(b.config.IsEIP158(header.Number))
+	if err != nil {
+		return nil, err
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false, nil); err != nil {
+		return nil, err
+	}
+	header = block.Header()
+	sig, err := crypto.Sign(b.engine.SealHash(header).Bytes(), key)
+	if err != nil {
+		return nil, err
+	}
+	copy(header.Extra[len(header.Extra)-crypto.SignatureLength:], sig)
+	return block.WithSeal(header), nil
+}
+
+// sealer returns the validator sealing the given header: the in-turn one unless
+// the block misses its turn or the in-turn validator signed too recently, else
+// an out-of-turn one, leaving the validator in turn next for last so that the
+// turns get back to normal.
+func (b *DposSimulatedBackend) sealer(header *types.Header) (common.Address, error) {
+	number := header.Number.Uint64()
+	snap, err := b.engine.Snapshot(b.blockchain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	validators := make([]common.Address, 0, len(snap.Validators))
+	for val := range snap.Validators {
+		validators = append(validators, val)
+	}
+	sortValidators(validators)
+
+	n := len(validators)
+	offset := int(number % uint64(n))
+	candidates := make([]common.Address, 0, n)
+	if number > b.missUntil {
+		candidates = append(candidates, validators[offset])
+	}
+	for i := 2; i <= n+1; i++ {
+		if (offset+i)%n != offset {
+			candidates = append(candidates, validators[(offset+i)%n])
+		}
+	}
+	limit := uint64(n/2 + 1)
+	for _, val := range candidates {
+		recent := false
+		for seen, signer := range snap.Recents {
+			if signer == val && number >= limit && seen > number-limit {
+				recent = true
+			}
+		}
+		if _, ok := b.keys[val]; ok && !recent {
+			return val, nil
+		}
+	}
+	return common.Address{}, fmt.Errorf("no validator can seal block %d", number)
+}
+
+// sortValidators sorts validators in ascending order, the order of their turns.
+func sortValidators(validators []common.Address) []common.Address {
+	sort.Slice(validators, func(i, j int) bool { return bytes.Compare(validators[i][:], validators[j][:]) < 0 })
+	return validators
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the dpos simulated backend seals blocks with transactions and lets
+// tests advance epochs, miss turns, blacklist addresses and commit proposals.
+func TestDposSimulatedBackend(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	recipient := common.HexToAddress("0xb0b")
+
+	sim := NewDposSimulatedBackend(core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}, 10000000, 3)
+	defer sim.Close()
+
+	ctx := context.Background()
+	signer := types.NewEIP155Signer(big.NewInt(1337))
+	transfer := func() error {
+		nonce, err := sim.PendingNonceAt(ctx, addr)
+		if err != nil {
+			t.Fatalf("failed to retrieve nonce: %v", err)
+		}
+		tx, _ := types.SignTx(types.NewTransaction(nonce, recipient, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+		return sim.SendTransaction(ctx, tx)
+	}
+	// Transactions are sealed by the in-turn validators
+	if err := transfer(); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	sim.Commit()
+	if balance, _ := sim.BalanceAt(ctx, recipient, nil); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want 1", balance)
+	}
+	validators, err := sim.Validators()
+	if err != nil {
+		t.Fatalf("failed to retrieve validators: %v", err)
+	}
+	if len(validators) != 3 {
+		t.Fatalf("validator count mismatch: have %d, want 3", len(validators))
+	}
+	if head := sim.Blockchain().CurrentHeader(); head.Difficulty.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("block %d sealed out of turn", head.Number)
+	}
+	// Epochs update the validator set from the system contracts
+	sim.AdvanceEpoch()
+	if head := sim.Blockchain().CurrentHeader(); head.Number.Uint64() != dposSimulatedEpoch {
+		t.Fatalf("epoch block mismatch: have %d, want %d", head.Number, dposSimulatedEpoch)
+	}
+	if have, _ := sim.Validators(); len(have) != 3 {
+		t.Errorf("validator count after epoch mismatch: have %d, want 3", len(have))
+	}
+	// Missed turns are sealed by out-of-turn validators
+	if err := sim.MissTurns(2); err != nil {
+		t.Fatalf("failed to miss turns: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		head := sim.Blockchain().CurrentHeader()
+		inturn, err := sim.Engine().InTurnValidator(sim.Blockchain(), &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)})
+		if err != nil {
+			t.Fatalf("failed to retrieve in-turn validator: %v", err)
+		}
+		sim.Commit()
+		head = sim.Blockchain().CurrentHeader()
+		if missed := head.Coinbase != inturn; missed != (i < 2) {
+			t.Errorf("block %d: missed turn mismatch: have %v, want %v", head.Number, missed, i < 2)
+		}
+	}
+	// Blacklisted senders are denied from the block after the blacklisting
+	if err := sim.SetBlacklisted(addr, dpos.DirectionFrom, true); err != nil {
+		t.Fatalf("failed to blacklist sender: %v", err)
+	}
+	sim.Commit()
+	if err := transfer(); !errors.Is(err, consensus.ErrAddressDenied) {
+		t.Fatalf("blacklisted transfer error mismatch: have %v, want %v", err, consensus.ErrAddressDenied)
+	}
+	if err := sim.SetBlacklisted(addr, dpos.DirectionFrom, false); err != nil {
+		t.Fatalf("failed to unblacklist sender: %v", err)
+	}
+	sim.Commit()
+	if err := transfer(); err != nil {
+		t.Fatalf("failed to send transaction after unblacklisting: %v", err)
+	}
+	sim.Commit()
+
+	// Proposals are executed by the engine in the block after their commit
+	if err := sim.CommitProposal(addr, recipient, big.NewInt(100), nil); err != nil {
+		t.Fatalf("failed to commit proposal: %v", err)
+	}
+	sim.Commit()
+	sim.Commit()
+	if balance, _ := sim.BalanceAt(ctx, recipient, nil); balance.Cmp(big.NewInt(102)) != 0 {
+		t.Errorf("recipient balance after proposal mismatch: have %v, want 102", balance)
+	}
+}
@@ -69,9 +69,14 @@ type SimulatedBackend struct {
 
 	events *filters.EventSystem // Event system for filtering log events live
 
-	config *params.ChainConfig
+	config   *params.ChainConfig
+	generate generateFn // Consensus specific assembly of the pending block
 }
 
+// generateFn assembles a block on top of parent with the given transactions,
+// shifting its timestamp by offset seconds.
+type generateFn func(parent *types.Block, txs []*types.Transaction, offset int64) (*types.Block, error)
+
 // NewSimulatedBackendWithDatabase creates a new binding backend based on the given database
 // and uses a simulated blockchain for testing purposes.
 // A simulated backend always uses chainID 1337.
@@ -86,6 +91,7 @@ func NewSimulatedBackendWithDatabase(database ethdb.Database, alloc core.Genesis
 		config:     genesis.Config,
 		events:     filters.NewEventSystem(&filterBackend{database, blockchain}, false),
 	}
+	backend.generate = backend.generateEthash
 	backend.rollback()
 	return backend
 }
@@ -124,10 +130,35 @@ func (b *SimulatedBackend) Rollback() {
 }
 
 func (b *SimulatedBackend) rollback() {
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(int, *core.BlockGen) {})
+	if err := b.setPending(nil, 0); err != nil {
+		panic(err) // This cannot happen unless the simulator is wrong, fail in that case
+	}
+}
 
-	b.pendingBlock = blocks[0]
-	b.pendingState, _ = state.New(b.pendingBlock.Root(), b.blockchain.StateCache(), nil)
+// setPending replaces the pending block by one holding the given transactions
+// on top of the current head, with its timestamp shifted by offset seconds.
+func (b *SimulatedBackend) setPending(txs []*types.Transaction, offset int64) error {
+	block, err := b.generate(b.blockchain.CurrentBlock(), txs, offset)
+	if err != nil {
+		return err
+	}
+	b.pendingBlock = block
+	b.pendingState, _ = state.New(block.Root(), b.blockchain.StateCache(), nil)
+	return nil
+}
+
+// generateEthash assembles a block with the fake ethash engine. It panics if
+// any of the transactions can't be executed.
+func (b *SimulatedBackend) generateEthash(parent *types.Block, txs []*types.Transaction, offset int64) (*types.Block, error) {
+	blocks, _ := core.GenerateChain(b.config, parent, ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
+		for _, tx := range txs {
+			block.AddTxWithChain(b.blockchain, tx)
+		}
+		if offset != 0 {
+			block.OffsetTime(offset)
+		}
+	})
+	return blocks[0], nil
 }
 
 // stateByBlockNumber retrieves a state by a given blocknumber.
@@ -572,17 +603,8 @@ func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transa
 	}
 
 	// Include tx in chain.
-	blocks, _ := core.GenerateChain(b.config, block, ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
-		for _, tx := range b.pendingBlock.Transactions() {
-			block.AddTxWithChain(b.blockchain, tx)
-		}
-		block.AddTxWithChain(b.blockchain, tx)
-	})
-	stateDB, _ := b.blockchain.State()
-
-	b.pendingBlock = blocks[0]
-	b.pendingState, _ = state.New(b.pendingBlock.Root(), stateDB.Database(), nil)
-	return nil
+	txs := append(types.Transactions{}, b.pendingBlock.Transactions()...)
+	return b.setPending(append(txs, tx), 0)
 }
 
 // FilterLogs executes a log filter operation, blocking during execution and
@@ -690,15 +712,7 @@ func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 		return errors.New("Could not adjust time on non-empty block")
 	}
 
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
-		block.OffsetTime(int64(adjustment.Seconds()))
-	})
-	stateDB, _ := b.blockchain.State()
-
-	b.pendingBlock = blocks[0]
-	b.pendingState, _ = state.New(b.pendingBlock.Root(), stateDB.Database(), nil)
-
-	return nil
+	return b.setPending(nil, int64(adjustment.Seconds()))
 }
 
 // Blockchain returns the underlying blockchain.
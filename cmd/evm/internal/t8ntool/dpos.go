@@ -0,0 +1,155 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// dposEnv is the input of the dpos engine mode: the chain the block is sealed
+// on, its parent and the validator snapshot at the parent.
+type dposEnv struct {
+	Config      *params.ChainConfig `json:"config"`
+	GenesisHash common.Hash         `json:"genesisHash,omitempty"`
+	Parent      *types.Header       `json:"parent"`
+	Snapshot    *dpos.Snapshot      `json:"snapshot"`
+
+	key *ecdsa.PrivateKey // Key of the coinbase signing the system transactions, if any
+}
+
+func (d *dposEnv) UnmarshalJSON(input []byte) error {
+	type env dposEnv
+	var dec struct {
+		env
+		Key *common.Hash `json:"secretKey"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*d = dposEnv(dec.env)
+	if dec.Key != nil {
+		key, err := crypto.ToECDSA(dec.Key[:])
+		if err != nil {
+			return err
+		}
+		d.key = key
+	}
+	return nil
+}
+
+// validate checks that the dpos input describes the parent of the block in env.
+func (d *dposEnv) validate(env *stEnv) error {
+	switch {
+	case d.Config == nil || d.Config.Dpos == nil:
+		return errors.New("missing dpos chain config")
+	case d.Parent == nil:
+		return errors.New("missing parent header")
+	case d.Snapshot == nil:
+		return errors.New("missing parent snapshot")
+	}
+	if d.Parent.Number.Uint64()+1 != env.Number {
+		return fmt.Errorf("parent number %d doesn't precede block %d", d.Parent.Number, env.Number)
+	}
+	if d.Snapshot.Number != d.Parent.Number.Uint64() || d.Snapshot.Hash != d.Parent.Hash() {
+		return fmt.Errorf("snapshot %d [%x] doesn't match parent %d [%x]", d.Snapshot.Number, d.Snapshot.Hash, d.Parent.Number, d.Parent.Hash())
+	}
+	if d.key != nil && crypto.PubkeyToAddress(d.key.PublicKey) != env.Coinbase {
+		return fmt.Errorf("secret key doesn't belong to coinbase %v", env.Coinbase)
+	}
+	return nil
+}
+
+// header assembles the header of the block being finalized.
+func (d *dposEnv) header(env *stEnv) *types.Header {
+	extra := env.ExtraData
+	if len(extra) == 0 {
+		extra = make([]byte, 32+crypto.SignatureLength)
+	}
+	return &types.Header{
+		ParentHash: d.Parent.Hash(),
+		Coinbase:   env.Coinbase,
+		Difficulty: env.Difficulty,
+		GasLimit:   env.GasLimit,
+		Number:     new(big.Int).SetUint64(env.Number),
+		Time:       env.Timestamp,
+		Extra:      extra,
+	}
+}
+
+// engine creates a dpos engine reading the parent state and snapshot from the
+// input instead of a chain database.
+func (d *dposEnv) engine(parentState *state.StateDB) *dpos.Dpos {
+	engine := dpos.New(d.Config, rawdb.NewMemoryDatabase(), nil, d.GenesisHash)
+	engine.ImportSnapshot(d.Snapshot)
+	engine.SetStateFn(func(common.Hash) (*state.StateDB, error) {
+		return parentState.Copy(), nil
+	})
+	if d.key != nil {
+		key := d.key
+		signFn := func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(data), key)
+		}
+		signTxFn := func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+			return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+		}
+		engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), signFn, signTxFn)
+	}
+	return engine
+}
+
+// dposChain is the chain the dpos engine sees, holding the parent header only.
+type dposChain struct {
+	config *params.ChainConfig
+	parent *types.Header
+}
+
+func (c *dposChain) Config() *params.ChainConfig  { return c.config }
+func (c *dposChain) CurrentHeader() *types.Header { return c.parent }
+
+func (c *dposChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if hash != c.parent.Hash() || number != c.parent.Number.Uint64() {
+		return nil
+	}
+	return c.parent
+}
+
+func (c *dposChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number != c.parent.Number.Uint64() {
+		return nil
+	}
+	return c.parent
+}
+
+func (c *dposChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	if hash != c.parent.Hash() {
+		return nil
+	}
+	return c.parent
+}
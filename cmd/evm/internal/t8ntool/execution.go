@@ -22,7 +22,9 @@ import (
 	"os"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -39,20 +41,22 @@ import (
 )
 
 type Prestate struct {
-	Env stEnv             `json:"env"`
-	Pre core.GenesisAlloc `json:"pre"`
+	Env  stEnv             `json:"env"`
+	Pre  core.GenesisAlloc `json:"pre"`
+	Dpos *dposEnv          `json:"dpos,omitempty"`
 }
 
 // ExecutionResult contains the execution status after running a state test, any
 // error that might have occurred and a dump of the final state if requested.
 type ExecutionResult struct {
-	StateRoot   common.Hash    `json:"stateRoot"`
-	TxRoot      common.Hash    `json:"txRoot"`
-	ReceiptRoot common.Hash    `json:"receiptRoot"`
-	LogsHash    common.Hash    `json:"logsHash"`
-	Bloom       types.Bloom    `json:"logsBloom"        gencodec:"required"`
-	Receipts    types.Receipts `json:"receipts"`
-	Rejected    []int          `json:"rejected,omitempty"`
+	StateRoot   common.Hash          `json:"stateRoot"`
+	TxRoot      common.Hash          `json:"txRoot"`
+	ReceiptRoot common.Hash          `json:"receiptRoot"`
+	LogsHash    common.Hash          `json:"logsHash"`
+	Bloom       types.Bloom          `json:"logsBloom"        gencodec:"required"`
+	Receipts    types.Receipts       `json:"receipts"`
+	Rejected    []int                `json:"rejected,omitempty"`
+	SystemTxs   []*types.Transaction `json:"systemTxs,omitempty"`
 }
 
 type ommer struct {
@@ -69,6 +73,7 @@ type stEnv struct {
 	Timestamp   uint64                              `json:"currentTimestamp"  gencodec:"required"`
 	BlockHashes map[math.HexOrDecimal64]common.Hash `json:"blockHashes,omitempty"`
 	Ommers      []ommer                             `json:"ommers,omitempty"`
+	ExtraData   []byte                              `json:"currentExtraData,omitempty"`
 }
 
 type stEnvMarshaling struct {
@@ -77,6 +82,7 @@ type stEnvMarshaling struct {
 	GasLimit   math.HexOrDecimal64
 	Number     math.HexOrDecimal64
 	Timestamp  math.HexOrDecimal64
+	ExtraData  hexutil.Bytes
 }
 
 // Apply applies a set of transactions to a pre-state
@@ -110,6 +116,25 @@ func (pre *Prestate) Apply(vmConfig vm.Config, chainConfig *params.ChainConfig,
 		txIndex     = 0
 	)
 	gaspool.AddGas(pre.Env.GasLimit)
+
+	// In dpos mode the engine filters the transactions and finalizes the block
+	var (
+		engine    *dpos.Dpos
+		chain     *dposChain
+		header    *types.Header
+		systemTxs types.Transactions
+	)
+	if pre.Dpos != nil {
+		if err := pre.Dpos.validate(&pre.Env); err != nil {
+			return nil, nil, NewError(ErrorVMConfig, err)
+		}
+		engine = pre.Dpos.engine(statedb.Copy())
+		chain = &dposChain{config: chainConfig, parent: pre.Dpos.Parent}
+		header = pre.Dpos.header(&pre.Env)
+		if err := engine.PreHandle(chain, header, statedb); err != nil {
+			return nil, nil, NewError(ErrorEVM, fmt.Errorf("could not prepare dpos block: %v", err))
+		}
+	}
 	vmContext := vm.BlockContext{
 		CanTransfer: core.CanTransfer,
 		Transfer:    core.Transfer,
@@ -129,6 +154,21 @@ func (pre *Prestate) Apply(vmConfig vm.Config, chainConfig *params.ChainConfig,
 	}
 
 	for i, tx := range txs {
+		if engine != nil {
+			if isSystemTx, err := engine.IsSystemTransaction(tx, header); err != nil {
+				log.Info("rejected tx", "index", i, "hash", tx.Hash(), "error", err)
+				rejectedTxs = append(rejectedTxs, i)
+				continue
+			} else if isSystemTx {
+				systemTxs = append(systemTxs, tx)
+				continue
+			}
+			if err := engine.ValidateTx(tx, header, statedb); err != nil {
+				log.Info("rejected tx", "index", i, "hash", tx.Hash(), "error", err)
+				rejectedTxs = append(rejectedTxs, i)
+				continue
+			}
+		}
 		msg, err := tx.AsMessage(signer)
 		if err != nil {
 			log.Info("rejected tx", "index", i, "hash", tx.Hash(), "error", err)
@@ -198,8 +238,23 @@ func (pre *Prestate) Apply(vmConfig vm.Config, chainConfig *params.ChainConfig,
 		txIndex++
 	}
 	statedb.IntermediateRoot(chainConfig.IsEIP158(vmContext.BlockNumber))
-	// Add mining reward?
-	if miningReward > 0 {
+	if engine != nil {
+		// Replay the system transactions if given, produce them otherwise
+		header.GasUsed = gasUsed
+		if len(systemTxs) > 0 {
+			given := systemTxs
+			if err := engine.Finalize(chain, header, statedb, (*[]*types.Transaction)(&includedTxs), nil, (*[]*types.Receipt)(&receipts), (*[]*types.Transaction)(&given), &gasUsed); err != nil {
+				return nil, nil, NewError(ErrorEVM, fmt.Errorf("could not finalize dpos block: %v", err))
+			}
+		} else {
+			block, blockReceipts, err := engine.FinalizeAndAssemble(chain, header, statedb, includedTxs, nil, receipts)
+			if err != nil {
+				return nil, nil, NewError(ErrorEVM, fmt.Errorf("could not finalize dpos block: %v", err))
+			}
+			includedTxs, receipts = block.Transactions(), blockReceipts
+		}
+		systemTxs = includedTxs[txIndex:]
+	} else if miningReward > 0 {
 		// Add mining reward. The mining reward may be `0`, which only makes a difference in the cases
 		// where
 		// - the coinbase suicided, or
@@ -236,6 +291,7 @@ func (pre *Prestate) Apply(vmConfig vm.Config, chainConfig *params.ChainConfig,
 		LogsHash:    rlpHash(statedb.Logs()),
 		Receipts:    receipts,
 		Rejected:    rejectedTxs,
+		SystemTxs:   systemTxs,
 	}
 	return statedb, execRs, nil
 }
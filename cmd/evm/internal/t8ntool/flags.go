@@ -83,6 +83,16 @@ var (
 		Usage: "`stdin` or file name of where to find the transactions to apply.",
 		Value: "txs.json",
 	}
+	InputDposFlag = cli.StringFlag{
+		Name:  "input.dpos",
+		Usage: "`stdin` or file name of where to find the dpos chain config, parent header and snapshot to use.",
+		Value: "dpos.json",
+	}
+	EngineFlag = cli.StringFlag{
+		Name:  "state.engine",
+		Usage: "Consensus engine finalizing the block (ethash or dpos). Dpos uses the chain config of the dpos input",
+		Value: "ethash",
+	}
 	RewardFlag = cli.Int64Flag{
 		Name:  "state.reward",
 		Usage: "Mining reward. Set to -1 to disable",
@@ -19,6 +19,7 @@ package t8ntool
 import (
 	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -71,6 +72,7 @@ type input struct {
 	Alloc core.GenesisAlloc `json:"alloc,omitempty"`
 	Env   *stEnv            `json:"env,omitempty"`
 	Txs   []*txWithKey      `json:"txs,omitempty"`
+	Dpos  *dposEnv          `json:"dpos,omitempty"`
 }
 
 func Main(ctx *cli.Context) error {
@@ -137,10 +139,18 @@ func Main(ctx *cli.Context) error {
 
 		envStr    = ctx.String(InputEnvFlag.Name)
 		txStr     = ctx.String(InputTxsFlag.Name)
+		dposStr   = ctx.String(InputDposFlag.Name)
 		inputData = &input{}
 	)
+	switch engine := ctx.String(EngineFlag.Name); engine {
+	case "ethash":
+		dposStr = ""
+	case "dpos":
+	default:
+		return NewError(ErrorVMConfig, fmt.Errorf("unknown consensus engine %q", engine))
+	}
 	// Figure out the prestate alloc
-	if allocStr == stdinSelector || envStr == stdinSelector || txStr == stdinSelector {
+	if allocStr == stdinSelector || envStr == stdinSelector || txStr == stdinSelector || dposStr == stdinSelector {
 		decoder := json.NewDecoder(os.Stdin)
 		decoder.Decode(inputData)
 	}
@@ -173,6 +183,27 @@ func Main(ctx *cli.Context) error {
 	}
 	prestate.Env = *inputData.Env
 
+	// Set the dpos chain the block is finalized on
+	if dposStr != "" && dposStr != stdinSelector {
+		inFile, err := os.Open(dposStr)
+		if err != nil {
+			return NewError(ErrorIO, fmt.Errorf("failed reading dpos file: %v", err))
+		}
+		defer inFile.Close()
+		decoder := json.NewDecoder(inFile)
+		var env dposEnv
+		if err := decoder.Decode(&env); err != nil {
+			return NewError(ErrorJson, fmt.Errorf("Failed unmarshaling dpos-file: %v", err))
+		}
+		inputData.Dpos = &env
+	}
+	if dposStr != "" {
+		if inputData.Dpos == nil {
+			return NewError(ErrorJson, errors.New("missing dpos input"))
+		}
+		prestate.Dpos = inputData.Dpos
+	}
+
 	vmConfig := vm.Config{
 		Tracer: tracer,
 		Debug:  (tracer != nil),
@@ -188,6 +219,11 @@ func Main(ctx *cli.Context) error {
 	// Set the chain id
 	chainConfig.ChainID = big.NewInt(ctx.Int64(ChainIDFlag.Name))
 
+	// Dpos blocks are finalized with the rules of their own chain
+	if prestate.Dpos != nil && prestate.Dpos.Config != nil {
+		chainConfig = prestate.Dpos.Config
+	}
+
 	var txsWithKeys []*txWithKey
 	if txStr != stdinSelector {
 		inFile, err := os.Open(txStr)
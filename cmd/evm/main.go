@@ -153,9 +153,11 @@ var stateTransitionCommand = cli.Command{
 		t8ntool.InputAllocFlag,
 		t8ntool.InputEnvFlag,
 		t8ntool.InputTxsFlag,
+		t8ntool.InputDposFlag,
 		t8ntool.ForknameFlag,
 		t8ntool.ChainIDFlag,
 		t8ntool.RewardFlag,
+		t8ntool.EngineFlag,
 		t8ntool.VerbosityFlag,
 	},
 }
@@ -49,6 +49,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -98,6 +99,7 @@ The dumpgenesis command dumps the genesis block configuration in JSON format to
 		ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
@@ -131,6 +133,7 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 		},
@@ -149,6 +152,7 @@ be gzipped.`,
 		ArgsUsage: "<datafile>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 		},
@@ -163,6 +167,7 @@ be gzipped.`,
 		ArgsUsage: "<dumpfile>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 		},
@@ -177,6 +182,7 @@ The export-preimages command export hash preimages to an RLP encoded stream`,
 		ArgsUsage: "[<blockHash> | <blockNum>]...",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 			utils.IterativeOutputFlag,
@@ -18,6 +18,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -31,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/trie"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -43,6 +45,7 @@ var (
 		ArgsUsage: "",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 		},
 		Category: "DATABASE COMMANDS",
 		Description: `
@@ -62,6 +65,8 @@ Remove blockchain and state databases`,
 			dbPutCmd,
 			dbGetSlotsCmd,
 			dbDumpFreezerIndex,
+			dbMigrateCmd,
+			dbVerifyAncientsCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -70,6 +75,7 @@ Remove blockchain and state databases`,
 		ArgsUsage: "<prefix> <start>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
@@ -83,6 +89,7 @@ Remove blockchain and state databases`,
 		Usage:  "Print leveldb statistics",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
@@ -94,6 +101,7 @@ Remove blockchain and state databases`,
 		Usage:  "Compact leveldb database. WARNING: May take a very long time",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
@@ -111,6 +119,7 @@ corruption if it is aborted during execution'!`,
 		ArgsUsage: "<hex-encoded key>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
@@ -124,6 +133,7 @@ corruption if it is aborted during execution'!`,
 		ArgsUsage: "<hex-encoded key>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
@@ -138,6 +148,7 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		ArgsUsage: "<hex-encoded key> <hex-encoded value>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
@@ -153,6 +164,7 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		ArgsUsage: "<hex-encoded storage trie root> <hex-encoded start (optional)> <int max elements (optional)>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
@@ -167,12 +179,68 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		ArgsUsage: "<type> <start (int)> <end (int)>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.SyncModeFlag,
 			utils.MainnetFlag,
 			utils.TestnetFlag,
 		},
 		Description: "This command displays information about the freezer index.",
 	}
+	dbMigrateToFlag = cli.StringFlag{
+		Name:  "to",
+		Usage: "Database engine to migrate to ('leveldb' or 'pebble')",
+	}
+	dbMigrateCmd = cli.Command{
+		Action: utils.MigrateFlags(dbMigrate),
+		Name:   "migrate",
+		Usage:  "Migrate the key-value database to another database engine",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+			dbMigrateToFlag,
+		},
+		Description: `This command copies every key of the key-value database into a new one
+created with the engine given by --to, next to the original. The copy is
+checkpointed, so running the command again after an interruption resumes it.
+Once copied, the key count of both databases and a sample of the values are
+compared, then the new database replaces the original one, which is kept
+aside for removal by the operator. The ancient chain segments are left as is.
+The node must not be running.`,
+	}
+	dbRepairAncientsFlag = cli.BoolFlag{
+		Name:  "repair",
+		Usage: "Truncate the ancient tables to the last intact item",
+	}
+	dbRecompressAncientsFlag = cli.BoolFlag{
+		Name:  "recompress",
+		Usage: "Rewrite the ancient tables stored with another compression than configured",
+	}
+	dbVerifyAncientsCmd = cli.Command{
+		Action: utils.MigrateFlags(dbVerifyAncients),
+		Name:   "verify-ancients",
+		Usage:  "Verify the integrity of the ancient chain segments",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.AncientFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+			dbRepairAncientsFlag,
+			dbRecompressAncientsFlag,
+		},
+		Description: `This command walks every ancient table, checking that the index points to
+increasing offsets within the data files, that each item decodes, and that
+the headers chain up with their hashes.
+
+With --repair, the tables are truncated to the last intact item, and the head
+of the chain is rewound to it, for the node to sync the rest again. With
+--recompress, the tables stored with another compression than configured,
+which the node can't open, are rewritten. The node must not be running.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -186,13 +254,7 @@ func removeDB(ctx *cli.Context) error {
 		log.Info("Full node state database missing", "path", path)
 	}
 	// Remove the full node ancient database
-	path = config.Eth.DatabaseFreezer
-	switch {
-	case path == "":
-		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
-	case !filepath.IsAbs(path):
-		path = config.Node.ResolvePath(path)
-	}
+	path = ancientPath(stack, config)
 	if common.FileExist(path) {
 		confirmAndRemoveDB(path, "full node ancient database")
 	} else {
@@ -208,6 +270,18 @@ func removeDB(ctx *cli.Context) error {
 	return nil
 }
 
+// ancientPath returns the directory of the full node ancient database.
+func ancientPath(stack *node.Node, config gethConfig) string {
+	path := config.Eth.DatabaseFreezer
+	switch {
+	case path == "":
+		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case !filepath.IsAbs(path):
+		path = config.Node.ResolvePath(path)
+	}
+	return path
+}
+
 // confirmAndRemoveDB prompts the user for a last confirmation and removes the
 // folder if accepted.
 func confirmAndRemoveDB(database string, kind string) {
@@ -485,3 +559,197 @@ func freezerInspect(ctx *cli.Context) error {
 	}
 	return nil
 }
+
+// dbMigrateSampleRate is the ratio of the keys whose values are compared after
+// a database migration.
+const dbMigrateSampleRate = 1000
+
+// dbMigrate copies the key-value database into another database engine, then
+// swaps the copy in place of the original.
+func dbMigrate(ctx *cli.Context) error {
+	engine := ctx.String(dbMigrateToFlag.Name)
+	if engine != "leveldb" && engine != "pebble" {
+		return fmt.Errorf("invalid choice for --%s '%s', allowed 'leveldb' or 'pebble'", dbMigrateToFlag.Name, engine)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	name := "chaindata"
+	if ctx.GlobalString(utils.SyncModeFlag.Name) == "light" {
+		name = "lightchaindata"
+	}
+	var (
+		path    = stack.ResolvePath(name)
+		current = rawdb.PreexistingDatabase(path)
+		target  = path + "." + engine
+		cache   = ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheDatabaseFlag.Name) / 100
+		handles = utils.MakeDatabaseHandles()
+	)
+	switch current {
+	case "":
+		return fmt.Errorf("no database found in %s", path)
+	case engine:
+		return fmt.Errorf("database in %s already uses %s", path, engine)
+	}
+	backup := path + "." + current
+	if common.FileExist(backup) {
+		return fmt.Errorf("previous database kept in %s, remove it first", backup)
+	}
+	// Open the databases bare, without the freezer, which is left untouched
+	src, err := rawdb.Open(rawdb.OpenOptions{Type: current, Directory: path, Cache: cache / 2, Handles: handles / 2, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open %s database: %v", current, err)
+	}
+	defer src.Close()
+
+	dst, err := rawdb.Open(rawdb.OpenOptions{Type: engine, Directory: target, Cache: cache / 2, Handles: handles / 2})
+	if err != nil {
+		return fmt.Errorf("failed to open %s database: %v", engine, err)
+	}
+	defer dst.Close()
+
+	log.Info("Migrating database", "from", current, "to", engine, "path", path, "target", target)
+	if _, err := rawdb.MigrateDatabase(src, dst); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+	if err := rawdb.VerifyMigration(src, dst, dbMigrateSampleRate); err != nil {
+		return fmt.Errorf("migration verification failed: %v", err)
+	}
+	if err := rawdb.DeleteMigrationProgress(dst); err != nil {
+		return err
+	}
+	src.Close()
+	dst.Close()
+
+	// Swap the database files, leaving the subdirectories such as the default
+	// ancient one in place
+	if err := moveDatabaseFiles(path, backup); err != nil {
+		return fmt.Errorf("failed to move %s database aside: %v", current, err)
+	}
+	if err := moveDatabaseFiles(target, path); err != nil {
+		return fmt.Errorf("failed to move %s database in place: %v", engine, err)
+	}
+	if err := os.Remove(target); err != nil {
+		log.Warn("Failed to remove migration directory", "path", target, "err", err)
+	}
+	log.Info("Database migrated", "engine", engine, "path", path, "previous", backup)
+	return nil
+}
+
+// moveDatabaseFiles moves the files of a database directory into another one,
+// leaving the subdirectories in place.
+func moveDatabaseFiles(from, to string) error {
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if err := os.Rename(filepath.Join(from, file.Name()), filepath.Join(to, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbVerifyAncients verifies the ancient tables, optionally repairing the broken
+// ones and recompressing the ones stored with another compression.
+func dbVerifyAncients(ctx *cli.Context) error {
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	path := ancientPath(stack, config)
+	if !common.FileExist(path) {
+		return fmt.Errorf("no ancient database found in %s", path)
+	}
+	report, err := rawdb.VerifyFreezer(path)
+	if err != nil {
+		return err
+	}
+	var mismatch bool
+	fmt.Printf("%-10s %-12s %12s %12s\n", "Table", "Compression", "Items", "Size")
+	for _, table := range report.Tables {
+		compression := "snappy"
+		if !table.Compressed {
+			compression = "none"
+		}
+		if table.Compressed == rawdb.FreezerNoSnappy[table.Name] {
+			compression += " (!)"
+			mismatch = true
+		}
+		fmt.Printf("%-10s %-12s %12d %12s\n", table.Name, compression, table.Items, common.StorageSize(table.Size))
+	}
+	fmt.Println()
+	if report.Err == nil {
+		fmt.Printf("All %d ancient items intact\n", report.Items)
+	} else {
+		fmt.Printf("%d of %d ancient items intact, first broken: %v\n", report.Valid, report.Items, report.Err)
+	}
+	if report.Err != nil && !ctx.Bool(dbRepairAncientsFlag.Name) {
+		return fmt.Errorf("ancient database broken, run with --%s to truncate it to #%d", dbRepairAncientsFlag.Name, report.Valid)
+	}
+	if mismatch {
+		if !ctx.Bool(dbRecompressAncientsFlag.Name) {
+			return fmt.Errorf("ancient tables marked (!) stored with another compression than configured, run with --%s", dbRecompressAncientsFlag.Name)
+		}
+		if err := rawdb.RecompressFreezer(path, report.Valid); err != nil {
+			return err
+		}
+	}
+	if report.Err == nil {
+		return nil
+	}
+	if err := rawdb.RepairFreezer(path, report.Valid); err != nil {
+		return fmt.Errorf("failed to repair ancient database: %v", err)
+	}
+	log.Info("Truncated ancient database", "items", report.Valid)
+
+	// The blocks dropped from the ancients are gone from the key-value database
+	// too, move the head of the chain back to the last one kept
+	db, err := rawdb.Open(rawdb.OpenOptions{
+		Type:      config.Node.DBEngine,
+		Directory: stack.ResolvePath("chaindata"),
+		Cache:     ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheDatabaseFlag.Name) / 100,
+		Handles:   utils.MakeDatabaseHandles(),
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	head := report.Head
+	if report.Valid == 0 {
+		head = rawdb.ReadCanonicalHash(db, 0)
+	}
+	rewindAncientHeads(db, report.Valid, head)
+	return nil
+}
+
+// rewindAncientHeads moves the head markers of the key-value database pointing
+// at or after the given number of ancient items back to the last of them.
+func rewindAncientHeads(db ethdb.KeyValueStore, items uint64, head common.Hash) {
+	for _, marker := range []struct {
+		name  string
+		read  func(ethdb.KeyValueReader) common.Hash
+		write func(ethdb.KeyValueWriter, common.Hash)
+	}{
+		{"header", rawdb.ReadHeadHeaderHash, rawdb.WriteHeadHeaderHash},
+		{"block", rawdb.ReadHeadBlockHash, rawdb.WriteHeadBlockHash},
+		{"fast block", rawdb.ReadHeadFastBlockHash, rawdb.WriteHeadFastBlockHash},
+	} {
+		hash := marker.read(db)
+		if hash == (common.Hash{}) {
+			continue
+		}
+		if number := rawdb.ReadHeaderNumber(db, hash); number != nil && *number < items {
+			continue
+		}
+		marker.write(db, head)
+		log.Info("Rewound chain head", "marker", marker.name, "hash", head)
+	}
+}
@@ -0,0 +1,851 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dposGenesisValidatorsFlag = cli.StringFlag{
+		Name:  "validators",
+		Usage: "Comma separated addresses of the validators sealing the first epoch",
+	}
+	dposGenesisAdminFlag = cli.StringFlag{
+		Name:  "admin",
+		Usage: "Address of the system contracts admin",
+	}
+	dposGenesisChainIDFlag = cli.Uint64Flag{
+		Name:  "chainid",
+		Usage: "Chain id of the network",
+	}
+	dposGenesisPeriodFlag = cli.Uint64Flag{
+		Name:  "period",
+		Usage: "Number of seconds between blocks (0 = seal only on transactions)",
+		Value: 3,
+	}
+	dposGenesisEpochFlag = cli.Uint64Flag{
+		Name:  "epoch",
+		Usage: "Number of blocks between validator set updates",
+		Value: 200,
+	}
+
+	dposEndpointFlag = cli.StringFlag{
+		Name:  "endpoint",
+		Usage: "IPC or HTTP endpoint of the node to query (default = IPC endpoint in the data directory)",
+	}
+	dposBlockFlag = cli.StringFlag{
+		Name:  "block",
+		Usage: "Number or hash of the block to query (default = head)",
+	}
+	dposProposalActionFlag = cli.Uint64Flag{
+		Name:  "action",
+		Usage: "Action of the proposal to simulate (0 = evm call, 1 = erase code)",
+	}
+	dposProposalFromFlag = cli.StringFlag{
+		Name:  "from",
+		Usage: "Sender of the evm call of the proposal to simulate",
+	}
+	dposProposalToFlag = cli.StringFlag{
+		Name:  "to",
+		Usage: "Target of the proposal to simulate",
+	}
+	dposProposalValueFlag = cli.StringFlag{
+		Name:  "value",
+		Usage: "Value in wei sent by the evm call of the proposal to simulate",
+	}
+	dposProposalDataFlag = cli.StringFlag{
+		Name:  "data",
+		Usage: "Hex input of the evm call of the proposal to simulate",
+	}
+
+	dposGenesisCommand = cli.Command{
+		Action:    utils.MigrateFlags(dposGenesis),
+		Name:      "dpos-genesis",
+		Usage:     "Generate the genesis block of a new dpos network",
+		ArgsUsage: "[<genesisPath>]",
+		Flags: []cli.Flag{
+			dposGenesisValidatorsFlag,
+			dposGenesisAdminFlag,
+			dposGenesisChainIDFlag,
+			dposGenesisPeriodFlag,
+			dposGenesisEpochFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The dpos-genesis command generates the genesis JSON of a new dpos network, with
+the system contracts deployed, the validators in the extra-data and the admin
+set up to initialize the system contracts at block 1.
+
+The genesis is written to the given path, or to stdout if none is given. It can
+be passed to init or init-network as is.`,
+	}
+	dposCommand = cli.Command{
+		Name:      "dpos",
+		Usage:     "A set of commands for the dpos consensus engine",
+		ArgsUsage: "",
+		Category:  "MISCELLANEOUS COMMANDS",
+		Subcommands: []cli.Command{
+			dposUpgradesCmd,
+			dposSlashingCmd,
+			dposProposalsCmd,
+			dposSnapshotCmd,
+		},
+	}
+	dposUpgradesCmd = cli.Command{
+		Action: utils.MigrateFlags(dposUpgrades),
+		Name:   "upgrades",
+		Usage:  "List the upcoming system contract upgrades",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+		},
+		Description: `This command lists the system contract upgrades not yet applied to the
+local chain, along with the fork activating them and the hashes of the code
+they would write.`,
+	}
+	dposProposalsCmd = cli.Command{
+		Name:      "proposals",
+		Usage:     "Inspect the system governance proposals of a running node",
+		ArgsUsage: "",
+		Subcommands: []cli.Command{
+			{
+				Action: utils.MigrateFlags(dposProposalsList),
+				Name:   "list",
+				Usage:  "List the passed and pending proposals",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.DBEngineFlag,
+					dposEndpointFlag,
+					dposBlockFlag,
+				},
+				Description: `This command lists the proposals passed at the block, which the next
+block executes, decoding the system contract calls they make. At the head, the
+proposals passed in the pending block are listed as well.`,
+			},
+			{
+				Action:    utils.MigrateFlags(dposProposalsSimulate),
+				Name:      "simulate",
+				Usage:     "Simulate the execution of a proposal",
+				ArgsUsage: "[<id>]",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.DBEngineFlag,
+					dposEndpointFlag,
+					dposBlockFlag,
+					dposProposalActionFlag,
+					dposProposalFromFlag,
+					dposProposalToFlag,
+					dposProposalValueFlag,
+					dposProposalDataFlag,
+				},
+				Description: `This command executes a proposal on top of the block without changing the
+chain, and prints its receipt, logs and the state changes it makes. The proposal
+is either a passed one given by id, or the one described by the --action, --from,
+--to, --value and --data flags, to be checked before it is committed.`,
+			},
+		},
+	}
+	dposSnapshotCmd = cli.Command{
+		Name:      "snapshot",
+		Usage:     "Inspect, verify and rebuild the stored validator set snapshots",
+		ArgsUsage: "",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(dposSnapshotInspect),
+				Name:      "inspect",
+				Usage:     "Print a stored snapshot, or summarize the stored ones",
+				ArgsUsage: "[<number|hash>]",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.DBEngineFlag,
+					utils.SyncModeFlag,
+					utils.MainnetFlag,
+					utils.TestnetFlag,
+				},
+				Description: `This command decodes the snapshot stored at the given block, printing its
+validators, recent validators and fork hashes. Without a block, it counts the
+stored snapshots and lists the ones which are stale or can't be decoded.`,
+			},
+			{
+				Action:    utils.MigrateFlags(dposSnapshotVerify),
+				Name:      "verify",
+				Usage:     "Check the stored snapshots against the headers",
+				ArgsUsage: "[<number>]",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.DBEngineFlag,
+					utils.SyncModeFlag,
+					utils.MainnetFlag,
+					utils.TestnetFlag,
+				},
+				Description: `This command recomputes the checkpoint snapshots of the canonical chain up to
+the given block (default = head) from the headers, and reports the stored ones
+differing from them. Missing checkpoints are reported too, but aren't errors as
+the node recomputes them when needed.`,
+			},
+			{
+				Action:    utils.MigrateFlags(dposSnapshotRebuild),
+				Name:      "rebuild",
+				Usage:     "Rewrite the stored snapshots from the headers",
+				ArgsUsage: "[<number>]",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.DBEngineFlag,
+					utils.SyncModeFlag,
+					utils.MainnetFlag,
+					utils.TestnetFlag,
+				},
+				Description: `This command recomputes the checkpoint snapshots of the canonical chain up to
+the given block (default = head) from the headers, and rewrites the stored ones
+that are missing or differ. Snapshots of blocks which aren't canonical
+checkpoints, or which can't be decoded, are pruned. The node must be stopped.`,
+			},
+		},
+	}
+	dposSlashingCmd = cli.Command{
+		Name:      "slashing-protection",
+		Usage:     "Manage the slashing protection records of the local validators",
+		ArgsUsage: "",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(dposSlashingExport),
+				Name:      "export",
+				Usage:     "Export the slashing protection records to a JSON file",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.DBEngineFlag,
+					utils.MainnetFlag,
+					utils.TestnetFlag,
+				},
+				Description: `This command writes the highest block signed by every local validator
+in the JSON interchange format, to be imported on the machine the validators
+are migrated to. Stop the node before exporting, so that no block is signed
+after the export.`,
+			},
+			{
+				Action:    utils.MigrateFlags(dposSlashingImport),
+				Name:      "import",
+				Usage:     "Import slashing protection records from a JSON file",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.DBEngineFlag,
+					utils.MainnetFlag,
+					utils.TestnetFlag,
+				},
+				Description: `This command merges slashing protection records in the JSON interchange
+format into the local ones. For every validator the highest signed block is
+kept, records of another chain are refused.`,
+			},
+		},
+	}
+)
+
+func dposGenesis(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errors.New("too many arguments")
+	}
+	spec := &dpos.GenesisSpec{
+		ChainID: new(big.Int).SetUint64(ctx.Uint64(dposGenesisChainIDFlag.Name)),
+		Period:  ctx.Uint64(dposGenesisPeriodFlag.Name),
+		Epoch:   ctx.Uint64(dposGenesisEpochFlag.Name),
+	}
+	if admin := ctx.String(dposGenesisAdminFlag.Name); admin != "" {
+		if !common.IsHexAddress(admin) {
+			return fmt.Errorf("invalid admin address %q", admin)
+		}
+		spec.Admin = common.HexToAddress(admin)
+	}
+	for _, val := range strings.Split(ctx.String(dposGenesisValidatorsFlag.Name), ",") {
+		if val = strings.TrimSpace(val); val == "" {
+			continue
+		}
+		if !common.IsHexAddress(val) {
+			return fmt.Errorf("invalid validator address %q", val)
+		}
+		spec.Validators = append(spec.Validators, common.HexToAddress(val))
+	}
+	genesis, err := dpos.NewGenesis(spec)
+	if err != nil {
+		return fmt.Errorf("invalid genesis: %v", err)
+	}
+	out, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() == 0 {
+		fmt.Println(string(out))
+		return nil
+	}
+	if err := ioutil.WriteFile(ctx.Args().First(), append(out, '\n'), 0644); err != nil {
+		return err
+	}
+	log.Info("Wrote dpos genesis", "file", ctx.Args().First(), "hash", genesis.ToBlock(nil).Hash(), "validators", len(spec.Validators))
+	return nil
+}
+
+func dposUpgrades(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, true)
+	defer db.Close()
+
+	genesisHash := rawdb.ReadCanonicalHash(db, 0)
+	if genesisHash == (common.Hash{}) {
+		return errors.New("no genesis block found, is the database initialized?")
+	}
+	config := rawdb.ReadChainConfig(db, genesisHash)
+	if config == nil {
+		return errors.New("no chain config found")
+	}
+	var head uint64
+	if header := rawdb.ReadHeadHeader(db); header != nil {
+		head = header.Number.Uint64()
+	}
+	fmt.Printf("Head block: #%d\n", head)
+
+	var upcoming int
+	for _, upgrade := range systemcontract.Upgrades(config, genesisHash) {
+		if activation := upgrade.Activation(); activation != nil && activation.Uint64() <= head {
+			continue
+		}
+		upcoming++
+
+		activation := "not scheduled"
+		if block := upgrade.Activation(); block != nil {
+			activation = fmt.Sprintf("block #%d", block)
+		}
+		fmt.Printf("\nFork %s, %s\n", upgrade.Fork, activation)
+		for _, contract := range upgrade.Configs {
+			code := "unchanged"
+			if hash := contract.CodeHash(); hash != (common.Hash{}) {
+				code = hash.Hex()
+			}
+			init := "none"
+			if contract.Init != nil {
+				data, err := contract.Init(config)
+				if err != nil {
+					return fmt.Errorf("failed to pack %s init call: %v", contract.ContractName, err)
+				}
+				init = fmt.Sprintf("%d bytes", len(data))
+			}
+			fmt.Printf("  %-16s %s code: %s init call: %s\n", contract.ContractName, contract.ContractAddr.Hex(), code, init)
+		}
+	}
+	if upcoming == 0 {
+		fmt.Println("No upcoming system contract upgrades")
+	}
+	return nil
+}
+
+// openSlashingProtection opens the slashing protection store of the node, along
+// with a function closing the underlying databases.
+func openSlashingProtection(ctx *cli.Context) (*dpos.SlashingProtection, func(), error) {
+	stack, _ := makeConfigNode(ctx)
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, true)
+	genesisHash := rawdb.ReadCanonicalHash(chaindb, 0)
+	chaindb.Close()
+	if genesisHash == (common.Hash{}) {
+		stack.Close()
+		return nil, nil, errors.New("no genesis block found, is the database initialized?")
+	}
+	db, err := stack.OpenDatabase("slashing", 0, 0, "", false)
+	if err != nil {
+		stack.Close()
+		return nil, nil, fmt.Errorf("failed to open slashing protection database: %v", err)
+	}
+	return dpos.NewSlashingProtection(db, genesisHash), func() { db.Close(); stack.Close() }, nil
+}
+
+func dposSlashingExport(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("need the file to export to as argument")
+	}
+	slashing, closeFn, err := openSlashingProtection(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	out, err := os.OpenFile(ctx.Args().First(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := slashing.Export(out); err != nil {
+		return fmt.Errorf("export failed: %v", err)
+	}
+	log.Info("Exported slashing protection records", "file", ctx.Args().First())
+	return nil
+}
+
+func dposSlashingImport(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("need the file to import from as argument")
+	}
+	slashing, closeFn, err := openSlashingProtection(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	in, err := os.Open(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := slashing.Import(in); err != nil {
+		return fmt.Errorf("import failed: %v", err)
+	}
+	log.Info("Imported slashing protection records", "file", ctx.Args().First())
+	return nil
+}
+
+// dialDpos connects to the node the dpos commands query.
+func dialDpos(ctx *cli.Context) (*rpc.Client, error) {
+	endpoint := ctx.String(dposEndpointFlag.Name)
+	if endpoint == "" {
+		endpoint = filepath.Join(utils.MakeDataDir(ctx), "geth.ipc")
+	}
+	client, err := dialRPC(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("unable to attach to node: %v", err)
+	}
+	return client, nil
+}
+
+// dposBlockArgs assembles the block argument of the dpos APIs, none for the head.
+func dposBlockArgs(ctx *cli.Context) ([]interface{}, error) {
+	block := ctx.String(dposBlockFlag.Name)
+	if block == "" {
+		return nil, nil
+	}
+	if len(block) == 2*common.HashLength+2 && strings.HasPrefix(block, "0x") {
+		return []interface{}{block}, nil
+	}
+	number, ok := math.ParseUint64(block)
+	if !ok {
+		return nil, fmt.Errorf("invalid block %q", block)
+	}
+	return []interface{}{hexutil.EncodeUint64(number)}, nil
+}
+
+func dposProposalsList(ctx *cli.Context) error {
+	blockArgs, err := dposBlockArgs(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := dialDpos(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var proposals []*dpos.ProposalInfo
+	if err := client.Call(&proposals, "dpos_getProposals", blockArgs...); err != nil {
+		return err
+	}
+	if len(proposals) == 0 {
+		fmt.Println("No passed or pending proposals")
+		return nil
+	}
+	for _, prop := range proposals {
+		fmt.Printf("Proposal %v (%s)\n", prop.Id.ToInt(), prop.Status)
+		fmt.Printf("  action: %s\n", prop.Action)
+		fmt.Printf("  from:   %s\n", prop.From.Hex())
+		fmt.Printf("  to:     %s\n", prop.To.Hex())
+		fmt.Printf("  value:  %v\n", prop.Value.ToInt())
+		if prop.Method != "" {
+			fmt.Printf("  call:   %s\n", prop.Method)
+			names := make([]string, 0, len(prop.Args))
+			for name := range prop.Args {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("    %s: %v\n", name, prop.Args[name])
+			}
+		} else if len(prop.Data) > 0 {
+			fmt.Printf("  data:   %s\n", prop.Data)
+		}
+	}
+	return nil
+}
+
+func dposProposalsSimulate(ctx *cli.Context) error {
+	var args dpos.ProposalArgs
+	switch {
+	case ctx.NArg() > 1:
+		return errors.New("too many arguments")
+	case ctx.NArg() == 1:
+		id, ok := math.ParseBig256(ctx.Args().First())
+		if !ok {
+			return fmt.Errorf("invalid proposal id %q", ctx.Args().First())
+		}
+		args.Id = (*hexutil.Big)(id)
+	default:
+		if !common.IsHexAddress(ctx.String(dposProposalToFlag.Name)) {
+			return errors.New("need a proposal id, or the proposal target given by --to")
+		}
+		args.Action = (*hexutil.Big)(new(big.Int).SetUint64(ctx.Uint64(dposProposalActionFlag.Name)))
+		args.To = common.HexToAddress(ctx.String(dposProposalToFlag.Name))
+		if from := ctx.String(dposProposalFromFlag.Name); from != "" {
+			if !common.IsHexAddress(from) {
+				return fmt.Errorf("invalid sender %q", from)
+			}
+			args.From = common.HexToAddress(from)
+		}
+		if value := ctx.String(dposProposalValueFlag.Name); value != "" {
+			v, ok := math.ParseBig256(value)
+			if !ok {
+				return fmt.Errorf("invalid value %q", value)
+			}
+			args.Value = (*hexutil.Big)(v)
+		}
+		if data := ctx.String(dposProposalDataFlag.Name); data != "" {
+			input, err := hexutil.Decode(data)
+			if err != nil {
+				return fmt.Errorf("invalid data: %v", err)
+			}
+			args.Data = input
+		}
+	}
+	blockArgs, err := dposBlockArgs(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := dialDpos(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var sim json.RawMessage
+	if err := client.Call(&sim, "dpos_simulateProposal", append([]interface{}{args}, blockArgs...)...); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(sim, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// openDposSnapshots opens the chain database along with a header chain over it,
+// and checks that the chain is sealed by dpos.
+func openDposSnapshots(ctx *cli.Context, readonly bool) (ethdb.Database, *core.HeaderChain, func(), error) {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack, readonly)
+	closeFn := func() { db.Close(); stack.Close() }
+
+	genesisHash := rawdb.ReadCanonicalHash(db, 0)
+	if genesisHash == (common.Hash{}) {
+		closeFn()
+		return nil, nil, nil, errors.New("no genesis block found, is the database initialized?")
+	}
+	config := rawdb.ReadChainConfig(db, genesisHash)
+	if config == nil || config.Dpos == nil {
+		closeFn()
+		return nil, nil, nil, errors.New("not a dpos chain")
+	}
+	// The header chain is only read from, it needs no engine
+	chain, err := core.NewHeaderChain(db, config, nil, func() bool { return false })
+	if err != nil {
+		closeFn()
+		return nil, nil, nil, err
+	}
+	return db, chain, closeFn, nil
+}
+
+// dposSnapshotLast returns the last block whose checkpoint snapshots are checked,
+// given as argument or defaulting to the head.
+func dposSnapshotLast(ctx *cli.Context, db ethdb.Database) (uint64, error) {
+	if ctx.NArg() > 1 {
+		return 0, errors.New("too many arguments")
+	}
+	if ctx.NArg() == 1 {
+		number, ok := math.ParseUint64(ctx.Args().First())
+		if !ok {
+			return 0, fmt.Errorf("invalid block number %q", ctx.Args().First())
+		}
+		return number, nil
+	}
+	head := rawdb.ReadHeadHeader(db)
+	if head == nil {
+		return 0, errors.New("no head header found")
+	}
+	return head.Number.Uint64(), nil
+}
+
+// isCanonicalCheckpoint returns whether the snapshot of the given block is one
+// the node stores for the canonical chain.
+func isCanonicalCheckpoint(db ethdb.Database, hash common.Hash) bool {
+	number := rawdb.ReadHeaderNumber(db, hash)
+	return number != nil && dpos.IsCheckpoint(*number) && rawdb.ReadCanonicalHash(db, *number) == hash
+}
+
+func dposSnapshotInspect(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errors.New("too many arguments")
+	}
+	db, _, closeFn, err := openDposSnapshots(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if ctx.NArg() == 0 {
+		var canonical, first, last uint64
+		var stale, corrupt []common.Hash
+		err := dpos.IterateSnapshots(db, func(hash common.Hash, snap *dpos.Snapshot, err error) bool {
+			switch {
+			case err != nil:
+				corrupt = append(corrupt, hash)
+			case !isCanonicalCheckpoint(db, hash):
+				stale = append(stale, hash)
+			default:
+				if canonical == 0 || snap.Number < first {
+					first = snap.Number
+				}
+				if canonical == 0 || snap.Number > last {
+					last = snap.Number
+				}
+				canonical++
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if canonical > 0 {
+			fmt.Printf("Canonical snapshots: %d, from #%d to #%d\n", canonical, first, last)
+		} else {
+			fmt.Println("Canonical snapshots: 0")
+		}
+		fmt.Printf("Stale snapshots: %d\n", len(stale))
+		for _, hash := range stale {
+			fmt.Printf("  %s\n", hash.Hex())
+		}
+		fmt.Printf("Corrupt snapshots: %d\n", len(corrupt))
+		for _, hash := range corrupt {
+			fmt.Printf("  %s\n", hash.Hex())
+		}
+		return nil
+	}
+	arg := ctx.Args().First()
+	var hash common.Hash
+	if strings.HasPrefix(arg, "0x") && len(arg) == 2+2*common.HashLength {
+		hash = common.HexToHash(arg)
+	} else {
+		number, ok := math.ParseUint64(arg)
+		if !ok {
+			return fmt.Errorf("invalid block %q", arg)
+		}
+		if hash = rawdb.ReadCanonicalHash(db, number); hash == (common.Hash{}) {
+			return fmt.Errorf("block #%d not found", number)
+		}
+	}
+	if !dpos.HasSnapshot(db, hash) {
+		return fmt.Errorf("no snapshot stored for block %s", hash.Hex())
+	}
+	snap, err := dpos.ReadSnapshot(db, hash)
+	if err != nil {
+		return fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+	fmt.Printf("Block: #%d [%s]\n", snap.Number, snap.Hash.Hex())
+
+	validators := make([]common.Address, 0, len(snap.Validators))
+	for val := range snap.Validators {
+		validators = append(validators, val)
+	}
+	sort.Slice(validators, func(i, j int) bool { return bytes.Compare(validators[i][:], validators[j][:]) < 0 })
+	fmt.Printf("Validators: %d\n", len(validators))
+	for _, val := range validators {
+		fmt.Printf("  %s\n", val.Hex())
+	}
+	recents := make([]uint64, 0, len(snap.Recents))
+	for number := range snap.Recents {
+		recents = append(recents, number)
+	}
+	sort.Slice(recents, func(i, j int) bool { return recents[i] < recents[j] })
+	fmt.Printf("Recent validators: %d\n", len(recents))
+	for _, number := range recents {
+		fmt.Printf("  #%d %s\n", number, snap.Recents[number].Hex())
+	}
+	forks := make([]uint64, 0, len(snap.RecentForkHashes))
+	for number := range snap.RecentForkHashes {
+		forks = append(forks, number)
+	}
+	sort.Slice(forks, func(i, j int) bool { return forks[i] < forks[j] })
+	fmt.Printf("Recent fork hashes: %d\n", len(forks))
+	for _, number := range forks {
+		fmt.Printf("  #%d %s\n", number, snap.RecentForkHashes[number])
+	}
+	return nil
+}
+
+func dposSnapshotVerify(ctx *cli.Context) error {
+	db, chain, closeFn, err := openDposSnapshots(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	last, err := dposSnapshotLast(ctx, db)
+	if err != nil {
+		return err
+	}
+	var (
+		checked, missing, bad int
+		start                 = time.Now()
+		logged                = time.Now()
+	)
+	err = dpos.RecomputeSnapshots(chain, last, func(want *dpos.Snapshot) error {
+		checked++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying dpos snapshots", "number", want.Number, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		if !dpos.HasSnapshot(db, want.Hash) {
+			missing++
+			fmt.Printf("Snapshot #%d [%s]: missing\n", want.Number, want.Hash.Hex())
+			return nil
+		}
+		have, err := dpos.ReadSnapshot(db, want.Hash)
+		if err != nil {
+			bad++
+			fmt.Printf("Snapshot #%d [%s]: corrupt: %v\n", want.Number, want.Hash.Hex(), err)
+			return nil
+		}
+		if diffs := have.Diff(want); len(diffs) > 0 {
+			bad++
+			fmt.Printf("Snapshot #%d [%s]: differs\n", want.Number, want.Hash.Hex())
+			for _, diff := range diffs {
+				fmt.Printf("  %s\n", diff)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Verified dpos snapshots", "checked", checked, "missing", missing, "bad", bad, "elapsed", common.PrettyDuration(time.Since(start)))
+	if bad > 0 {
+		return fmt.Errorf("%d bad snapshots found, run rebuild to fix them", bad)
+	}
+	return nil
+}
+
+func dposSnapshotRebuild(ctx *cli.Context) error {
+	db, chain, closeFn, err := openDposSnapshots(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	last, err := dposSnapshotLast(ctx, db)
+	if err != nil {
+		return err
+	}
+	// Prune the snapshots the node would never load, collecting them first as
+	// the database can't be written while iterated
+	var pruned []common.Hash
+	err = dpos.IterateSnapshots(db, func(hash common.Hash, snap *dpos.Snapshot, err error) bool {
+		if err != nil || !isCanonicalCheckpoint(db, hash) {
+			pruned = append(pruned, hash)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	batch := db.NewBatch()
+	for _, hash := range pruned {
+		if err := dpos.DeleteSnapshot(batch, hash); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	batch.Reset()
+
+	var (
+		rewritten int
+		start     = time.Now()
+		logged    = time.Now()
+	)
+	err = dpos.RecomputeSnapshots(chain, last, func(want *dpos.Snapshot) error {
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Rebuilding dpos snapshots", "number", want.Number, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		if have, err := dpos.ReadSnapshot(db, want.Hash); err == nil && len(have.Diff(want)) == 0 {
+			return nil
+		}
+		rewritten++
+		if err := dpos.WriteSnapshot(batch, want); err != nil {
+			return err
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Rebuilt dpos snapshots", "rewritten", rewritten, "pruned", len(pruned), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
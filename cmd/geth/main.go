@@ -60,6 +60,7 @@ var (
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.DBEngineFlag,
 		utils.MinFreeDiskSpaceFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
@@ -128,6 +129,12 @@ var (
 		utils.MinerRecommitIntervalFlag,
 		utils.MinerDelayLeftoverFlag,
 		utils.MinerNoVerfiyFlag,
+		utils.PoREnabledFlag,
+		utils.PoRProviderFlag,
+		utils.PoRTimeoutFlag,
+		utils.PoRCPUFlag,
+		utils.PoRMemoryFlag,
+		utils.PoRStorageFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -139,6 +146,7 @@ var (
 		utils.TestnetFlag,
 		utils.DeveloperFlag,
 		utils.DeveloperPeriodFlag,
+		utils.DeveloperEngineFlag,
 		utils.VMEnableDebugFlag,
 		utils.NetworkIdFlag,
 		utils.EthStatsURLFlag,
@@ -208,6 +216,7 @@ func init() {
 		// See chaincmd.go:
 		initCommand,
 		initNetworkCommand,
+		dposGenesisCommand,
 		importCommand,
 		exportCommand,
 		importPreimagesCommand,
@@ -236,6 +245,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See dposcmd.go
+		dposCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -57,6 +57,7 @@ var (
 				Category:  "MISCELLANEOUS COMMANDS",
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
+					utils.DBEngineFlag,
 					utils.AncientFlag,
 					utils.RopstenFlag,
 					utils.RinkebyFlag,
@@ -88,6 +89,7 @@ the trie clean cache with default directory will be deleted.
 				Category:  "MISCELLANEOUS COMMANDS",
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
+					utils.DBEngineFlag,
 					utils.AncientFlag,
 					utils.RopstenFlag,
 					utils.RinkebyFlag,
@@ -108,6 +110,7 @@ In other words, this command does the snapshot to trie conversion.
 				Category:  "MISCELLANEOUS COMMANDS",
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
+					utils.DBEngineFlag,
 					utils.AncientFlag,
 					utils.RopstenFlag,
 					utils.RinkebyFlag,
@@ -130,6 +133,7 @@ It's also usable without snapshot enabled.
 				Category:  "MISCELLANEOUS COMMANDS",
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
+					utils.DBEngineFlag,
 					utils.AncientFlag,
 					utils.RopstenFlag,
 					utils.RinkebyFlag,
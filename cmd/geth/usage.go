@@ -36,6 +36,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			configFileFlag,
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.MinFreeDiskSpaceFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
@@ -75,6 +76,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Flags: []cli.Flag{
 			utils.DeveloperFlag,
 			utils.DeveloperPeriodFlag,
+			utils.DeveloperEngineFlag,
 		},
 	},
 	{
@@ -190,6 +192,17 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.MinerNoVerfiyFlag,
 		},
 	},
+	{
+		Name: "PROOF OF RESOURCES",
+		Flags: []cli.Flag{
+			utils.PoREnabledFlag,
+			utils.PoRProviderFlag,
+			utils.PoRTimeoutFlag,
+			utils.PoRCPUFlag,
+			utils.PoRMemoryFlag,
+			utils.PoRStorageFlag,
+		},
+	},
 	{
 		Name: "GAS PRICE ORACLE",
 		Flags: []cli.Flag{
@@ -39,6 +39,8 @@ import (
 	"github.com/ethereum/go-ethereum/common/fdlimit"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/consensus/dpos/por"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -125,6 +127,10 @@ var (
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('leveldb' or 'pebble')",
+	}
 	MinFreeDiskSpaceFlag = DirectoryFlag{
 		Name:  "datadir.minfreedisk",
 		Usage: "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -183,6 +189,11 @@ var (
 		Name:  "dev.period",
 		Usage: "Block period to use in developer mode (0 = mine only if transaction pending)",
 	}
+	DeveloperEngineFlag = cli.StringFlag{
+		Name:  "dev.engine",
+		Usage: `Consensus engine to use in developer mode ("clique" or "dpos")`,
+		Value: "clique",
+	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
 		Usage: "Custom node name",
@@ -485,6 +496,32 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	// Proof-of-Resources settings
+	PoREnabledFlag = cli.BoolFlag{
+		Name:  "por",
+		Usage: "Enable the Proof-of-Resources challenge protocol (dpos only)",
+	}
+	PoRProviderFlag = cli.StringFlag{
+		Name:  "por.provider",
+		Usage: "Provider account answering Proof-of-Resources challenges",
+	}
+	PoRTimeoutFlag = cli.DurationFlag{
+		Name:  "por.timeout",
+		Usage: "Time a provider has to answer a Proof-of-Resources challenge",
+		Value: por.DefaultConfig.Timeout,
+	}
+	PoRCPUFlag = cli.Uint64Flag{
+		Name:  "por.cpu",
+		Usage: "Number of cores declared by the Proof-of-Resources provider",
+	}
+	PoRMemoryFlag = cli.Uint64Flag{
+		Name:  "por.memory",
+		Usage: "Memory in MiB declared by the Proof-of-Resources provider",
+	}
+	PoRStorageFlag = cli.Uint64Flag{
+		Name:  "por.storage",
+		Usage: "Disk space in GiB declared by the Proof-of-Resources provider",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 
@@ -1060,6 +1097,43 @@ func setIPC(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setPoR configures the Proof-of-Resources challenge protocol from the command
+// line flags.
+func setPoR(ctx *cli.Context, ks *keystore.KeyStore, cfg *ethconfig.Config) {
+	if !ctx.GlobalBool(PoREnabledFlag.Name) {
+		return
+	}
+	if cfg.PoR == nil {
+		config := por.DefaultConfig
+		cfg.PoR = &config
+	}
+	if ctx.GlobalIsSet(PoRTimeoutFlag.Name) {
+		cfg.PoR.Timeout = ctx.GlobalDuration(PoRTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(PoRProviderFlag.Name) {
+		if ks == nil {
+			Fatalf("Keystore is required for the PoR provider account")
+		}
+		account, err := MakeAddress(ks, ctx.GlobalString(PoRProviderFlag.Name))
+		if err != nil {
+			Fatalf("Invalid PoR provider account: %v", err)
+		}
+		cfg.PoR.Provider = account.Address
+	}
+	if ctx.GlobalIsSet(PoRCPUFlag.Name) {
+		cfg.PoR.Resources.CPU = ctx.GlobalUint64(PoRCPUFlag.Name)
+	}
+	if ctx.GlobalIsSet(PoRMemoryFlag.Name) {
+		cfg.PoR.Resources.Memory = ctx.GlobalUint64(PoRMemoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(PoRStorageFlag.Name) {
+		cfg.PoR.Resources.Storage = ctx.GlobalUint64(PoRStorageFlag.Name)
+	}
+	if cfg.PoR.Resources.CPU > por.MaxCPU || cfg.PoR.Resources.Memory > por.MaxMemory {
+		Fatalf("PoR resources exceed the declarable limits (%d cores, %d MiB)", por.MaxCPU, por.MaxMemory)
+	}
+}
+
 // setLes configures the les server and ultra light client settings from the command line flags.
 func setLes(ctx *cli.Context, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(LightServeFlag.Name) {
@@ -1274,6 +1348,13 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		dbEngine := ctx.GlobalString(DBEngineFlag.Name)
+		if dbEngine != "leveldb" && dbEngine != "pebble" {
+			Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", dbEngine)
+		}
+		cfg.DBEngine = dbEngine
+	}
 	if ctx.GlobalIsSet(LightKDFFlag.Name) {
 		cfg.UseLightweightKDF = ctx.GlobalBool(LightKDFFlag.Name)
 	}
@@ -1543,6 +1624,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	setTxPool(ctx, &cfg.TxPool)
 	setEthash(ctx, cfg)
 	setMiner(ctx, &cfg.Miner)
+	setPoR(ctx, ks, cfg)
 	setWhitelist(ctx, cfg)
 	setLes(ctx, cfg)
 
@@ -1735,7 +1817,18 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		log.Info("Using developer account", "address", developer.Address)
 
 		// Create a new developer genesis block or reuse existing one
-		cfg.Genesis = core.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), developer.Address)
+		period := uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name))
+		switch engine := ctx.GlobalString(DeveloperEngineFlag.Name); engine {
+		case "clique":
+			cfg.Genesis = core.DeveloperGenesisBlock(period, developer.Address)
+		case "dpos":
+			// The developer account is the sole validator, seal with it
+			cfg.Genesis = dpos.DeveloperGenesisBlock(period, developer.Address)
+			cfg.Miner.Etherbase = developer.Address
+			cfg.Miner.PosEtherbase = []common.Address{developer.Address}
+		default:
+			Fatalf("Unknown developer mode engine %q, want clique or dpos", engine)
+		}
 		if ctx.GlobalIsSet(DataDirFlag.Name) {
 			// Check if we have an already initialized chain and fall back to
 			// that if so. Otherwise we need to generate a new genesis spec.
@@ -154,6 +154,18 @@ type PoSA interface {
 	IsLocalBlock(header *types.Header) bool
 }
 
+// Finality is implemented by the consensus engines deriving the finality of a
+// block from the validators that sealed its descendants.
+type Finality interface {
+	// FinalizedHeader returns the highest ancestor of head that can't be
+	// reverted anymore, nil if there is none yet.
+	FinalizedHeader(chain ChainHeaderReader, head *types.Header) *types.Header
+
+	// SafeHeader returns the highest ancestor of head that is unlikely to be
+	// reverted, nil if there is none yet.
+	SafeHeader(chain ChainHeaderReader, head *types.Header) *types.Header
+}
+
 type StateReader interface {
 	GetState(addr common.Address, hash common.Hash) common.Hash
 }
@@ -17,14 +17,30 @@
 package dpos
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/por"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+var (
+	// errStateUnavailable is returned by the APIs decoding system contract state
+	// if the node has no state to read it from.
+	errStateUnavailable = errors.New("state unavailable")
+
+	// errPorDisabled is returned by the Proof-of-Resources APIs if the node
+	// doesn't run the challenge protocol.
+	errPorDisabled = errors.New("proof-of-resources disabled")
+)
+
 // API is a user facing RPC API to allow controlling the validator and voting
 // mechanisms of the proof-of-authority scheme.
 type API struct {
@@ -145,3 +161,368 @@ func (api *API) Status() (*status, error) {
 		NumBlocks:     numBlocks,
 	}, nil
 }
+
+// stateAt retrieves the header and state of the given block, the current one
+// if none requested.
+func (api *API) stateAt(blockNrOrHash *rpc.BlockNumberOrHash) (*types.Header, *state.StateDB, error) {
+	var header *types.Header
+	if blockNrOrHash == nil {
+		header = api.chain.CurrentHeader()
+	} else if hash, ok := blockNrOrHash.Hash(); ok {
+		header = api.chain.GetHeaderByHash(hash)
+		if header != nil && blockNrOrHash.RequireCanonical {
+			if canonical := api.chain.GetHeaderByNumber(header.Number.Uint64()); canonical == nil || canonical.Hash() != hash {
+				return nil, nil, fmt.Errorf("hash %x is not currently canonical", hash)
+			}
+		}
+	} else if number, ok := blockNrOrHash.Number(); ok {
+		if number < 0 {
+			header = api.chain.CurrentHeader()
+		} else {
+			header = api.chain.GetHeaderByNumber(uint64(number))
+		}
+	}
+	if header == nil {
+		return nil, nil, errUnknownBlock
+	}
+	if api.dpos.stateFn == nil {
+		return nil, nil, errStateUnavailable
+	}
+	statedb, err := api.dpos.stateFn(header.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, statedb, nil
+}
+
+// ValidatorInfo is the staking and punishment state of a validator.
+type ValidatorInfo struct {
+	Address      common.Address `json:"address"`
+	Stake        *hexutil.Big   `json:"stake"`
+	Commission   *hexutil.Big   `json:"commission"`
+	AccRewards   *hexutil.Big   `json:"accumulatedRewards"`
+	MissedBlocks *hexutil.Big   `json:"missedBlocks"`
+	Top          bool           `json:"top"`    // Whether the validator is amongst the top validators by stake
+	Active       bool           `json:"active"` // Whether the validator is in the active set sealing blocks
+}
+
+// ValidatorSets are the top validators by stake against the active validator
+// set. The top validators become the active set at the next epoch.
+type ValidatorSets struct {
+	Top     []common.Address `json:"top"`
+	Active  []common.Address `json:"active"`
+	Joining []common.Address `json:"joining"` // Top validators not yet active
+	Leaving []common.Address `json:"leaving"` // Active validators no longer on top
+}
+
+// DeveloperStatus is the state of an address in the developer whitelist, the
+// only addresses allowed to create contracts while verification is enabled.
+type DeveloperStatus struct {
+	Enabled   bool `json:"verificationEnabled"`
+	Developer bool `json:"developer"`
+}
+
+// validatorSets assembles the top and active validators at the given block.
+func (api *API) validatorSets(header *types.Header, statedb *state.StateDB) (*ValidatorSets, error) {
+	top, err := api.dpos.readTopValidators(newChainContext(api.chain, api.dpos), header, statedb)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := api.dpos.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	sets := &ValidatorSets{
+		Top:     top,
+		Active:  snap.validators(),
+		Joining: []common.Address{},
+		Leaving: []common.Address{},
+	}
+	for _, val := range sets.Top {
+		if _, ok := snap.Validators[val]; !ok {
+			sets.Joining = append(sets.Joining, val)
+		}
+	}
+	tops := make(map[common.Address]struct{}, len(top))
+	for _, val := range top {
+		tops[val] = struct{}{}
+	}
+	for _, val := range sets.Active {
+		if _, ok := tops[val]; !ok {
+			sets.Leaving = append(sets.Leaving, val)
+		}
+	}
+	return sets, nil
+}
+
+// validatorInfo decodes the state of a validator kept by the system contracts.
+func (api *API) validatorInfo(header *types.Header, statedb *state.StateDB, sets *ValidatorSets, val common.Address) (*ValidatorInfo, error) {
+	chain := newChainContext(api.chain, api.dpos)
+	economics, err := api.dpos.readValidatorEconomics(chain, header, statedb, val)
+	if err != nil {
+		return nil, err
+	}
+	missed, err := api.dpos.readMissedBlocks(chain, header, statedb, val)
+	if err != nil {
+		return nil, err
+	}
+	info := &ValidatorInfo{
+		Address:      val,
+		Stake:        (*hexutil.Big)(economics.Stake),
+		Commission:   (*hexutil.Big)(economics.Commission),
+		AccRewards:   (*hexutil.Big)(economics.AccRewards),
+		MissedBlocks: (*hexutil.Big)(new(big.Int).Set(missed)),
+	}
+	for _, top := range sets.Top {
+		info.Top = info.Top || top == val
+	}
+	for _, active := range sets.Active {
+		info.Active = info.Active || active == val
+	}
+	return info, nil
+}
+
+// GetValidatorInfo retrieves the stake, commission, accumulated rewards,
+// missed blocks counter and set membership of a validator at the specified
+// block.
+func (api *API) GetValidatorInfo(val common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (*ValidatorInfo, error) {
+	header, statedb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := api.validatorSets(header, statedb)
+	if err != nil {
+		return nil, err
+	}
+	return api.validatorInfo(header, statedb, sets, val)
+}
+
+// GetValidatorInfos retrieves the state of all the top and active validators at
+// the specified block, sorted by address.
+func (api *API) GetValidatorInfos(blockNrOrHash *rpc.BlockNumberOrHash) ([]*ValidatorInfo, error) {
+	header, statedb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := api.validatorSets(header, statedb)
+	if err != nil {
+		return nil, err
+	}
+	vals := append(append([]common.Address{}, sets.Top...), sets.Leaving...)
+	sort.Sort(validatorsAscending(vals))
+
+	infos := make([]*ValidatorInfo, 0, len(vals))
+	for _, val := range vals {
+		info, err := api.validatorInfo(header, statedb, sets, val)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// GetValidatorSets retrieves the top validators by stake against the active
+// validator set at the specified block.
+func (api *API) GetValidatorSets(blockNrOrHash *rpc.BlockNumberOrHash) (*ValidatorSets, error) {
+	header, statedb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return api.validatorSets(header, statedb)
+}
+
+// GetBlacklist retrieves the blacklisted addresses at the specified block, along
+// with the direction of the transactions they are denied: from, to or both.
+func (api *API) GetBlacklist(blockNrOrHash *rpc.BlockNumberOrHash) (map[common.Address]string, error) {
+	header, statedb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	blacklist, err := api.dpos.readBlacklist(newMinimalChainContext(api.dpos), header, statedb)
+	if err != nil {
+		return nil, err
+	}
+	directions := make(map[common.Address]string, len(blacklist))
+	for addr, direction := range blacklist {
+		directions[addr] = direction.String()
+	}
+	return directions, nil
+}
+
+// GetDeveloperStatus retrieves whether developer verification is enabled and
+// whether the address is whitelisted as a developer at the specified block.
+func (api *API) GetDeveloperStatus(addr common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (*DeveloperStatus, error) {
+	header, statedb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	chain := newMinimalChainContext(api.dpos)
+	enabled, err := api.dpos.readBool(chain, header, statedb, "devVerifyEnabled")
+	if err != nil {
+		return nil, err
+	}
+	developer, err := api.dpos.readBool(chain, header, statedb, "isDeveloper", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &DeveloperStatus{Enabled: enabled, Developer: developer}, nil
+}
+
+// errUnknownProposal is returned by the APIs looking up a system governance
+// proposal not passed at the requested block.
+var errUnknownProposal = errors.New("unknown proposal")
+
+// atHead returns whether the block requested from the APIs is the head, or the
+// pending block on top of it.
+func atHead(blockNrOrHash *rpc.BlockNumberOrHash) bool {
+	if blockNrOrHash == nil {
+		return true
+	}
+	number, ok := blockNrOrHash.Number()
+	return ok && number < 0
+}
+
+// pendingState retrieves the pending block and the state after it, if the node
+// has one built on top of the given head.
+func (api *API) pendingState(head *types.Header) (*types.Block, *state.StateDB) {
+	if api.dpos.pendingFn == nil {
+		return nil, nil
+	}
+	block, statedb := api.dpos.pendingFn()
+	if block == nil || statedb == nil || block.ParentHash() != head.Hash() {
+		return nil, nil
+	}
+	return block, statedb
+}
+
+// GetProposals retrieves the system governance proposals passed at the specified
+// block, which the next block executes. At the head, the proposals passed in the
+// pending block are listed as well.
+func (api *API) GetProposals(blockNrOrHash *rpc.BlockNumberOrHash) ([]*ProposalInfo, error) {
+	header, statedb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	props, err := api.dpos.readProposals(api.chain, header, statedb)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*ProposalInfo, 0, len(props))
+	passed := make(map[string]bool)
+	for _, prop := range props {
+		infos = append(infos, api.dpos.proposalInfo(prop, header.Number, ProposalPassed))
+		passed[prop.Id.String()] = true
+	}
+	if !atHead(blockNrOrHash) {
+		return infos, nil
+	}
+	block, pending := api.pendingState(header)
+	if pending == nil {
+		return infos, nil
+	}
+	props, err = api.dpos.readProposals(api.chain, block.Header(), pending)
+	if err != nil {
+		return nil, err
+	}
+	for _, prop := range props {
+		if !passed[prop.Id.String()] {
+			infos = append(infos, api.dpos.proposalInfo(prop, block.Number(), ProposalPending))
+		}
+	}
+	return infos, nil
+}
+
+// GetProposal retrieves a system governance proposal passed at the specified
+// block, or in the pending block on top of the head.
+func (api *API) GetProposal(id *hexutil.Big, blockNrOrHash *rpc.BlockNumberOrHash) (*ProposalInfo, error) {
+	infos, err := api.GetProposals(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.Id.ToInt().Cmp(id.ToInt()) == 0 {
+			return info, nil
+		}
+	}
+	return nil, errUnknownProposal
+}
+
+// SimulateProposal executes a system governance proposal in a block on top of
+// the specified one, without changing the chain. The proposal is either looked
+// up by id, or given in full to be checked before it is committed. At the head,
+// proposals passed in the pending block and the ones given in full are executed
+// after the pending block, as the block following it would.
+func (api *API) SimulateProposal(args ProposalArgs, blockNrOrHash *rpc.BlockNumberOrHash) (*ProposalSimulation, error) {
+	parent, statedb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		block   *types.Block
+		pending *state.StateDB
+	)
+	if atHead(blockNrOrHash) {
+		block, pending = api.pendingState(parent)
+	}
+	prop, status := args.proposal(), ""
+	if args.Id != nil {
+		if prop, err = api.findProposal(parent, statedb, args.Id); err != nil {
+			return nil, err
+		}
+		status = ProposalPassed
+		if prop == nil && pending != nil {
+			if prop, err = api.findProposal(block.Header(), pending, args.Id); err != nil {
+				return nil, err
+			}
+			parent, statedb, status = block.Header(), pending, ProposalPending
+		}
+		if prop == nil {
+			return nil, errUnknownProposal
+		}
+	} else if pending != nil {
+		parent, statedb = block.Header(), pending
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   parent.Coinbase,
+		Difficulty: new(big.Int).Set(diffInTurn),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + api.dpos.config.Period,
+	}
+	sim, err := api.dpos.simulateProposal(api.chain, header, statedb, prop)
+	if err != nil {
+		return nil, err
+	}
+	sim.Proposal.Status = status
+	return sim, nil
+}
+
+// findProposal looks up a system governance proposal passed at the given block,
+// nil if there is none with the given id.
+func (api *API) findProposal(header *types.Header, statedb *state.StateDB, id *hexutil.Big) (*Proposal, error) {
+	props, err := api.dpos.readProposals(api.chain, header, statedb.Copy())
+	if err != nil {
+		return nil, err
+	}
+	for _, prop := range props {
+		if prop.Id.Cmp(id.ToInt()) == 0 {
+			return prop, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetPorResults returns the outcome of the Proof-of-Resources challenges sent
+// by a local validator in the given epoch.
+func (api *API) GetPorResults(epoch hexutil.Uint64, val common.Address) ([]*por.Result, error) {
+	api.dpos.lock.RLock()
+	challenger := api.dpos.challenger
+	api.dpos.lock.RUnlock()
+
+	if challenger == nil {
+		return nil, errPorDisabled
+	}
+	return challenger.Results(uint64(epoch), val), nil
+}
@@ -0,0 +1,363 @@
+package dpos
+
+import (
+	"encoding/binary"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// dispatchCode assembles a contract returning canned outputs for the given
+// method selectors, reverting on any other call.
+func dispatchCode(outputs map[[4]byte][]byte) []byte {
+	const entrySize, fallbackSize = 16, 4
+
+	var (
+		code   []byte
+		bodies []byte
+		dest   = len(outputs)*entrySize + fallbackSize
+	)
+	for selector, output := range outputs {
+		code = append(code, byte(vm.PUSH1), 0, byte(vm.CALLDATALOAD), byte(vm.PUSH1), 0xe0, byte(vm.SHR))
+		code = append(code, byte(vm.PUSH4))
+		code = append(code, selector[:]...)
+		code = append(code, byte(vm.EQ), byte(vm.PUSH2), byte(dest>>8), byte(dest), byte(vm.JUMPI))
+
+		body := []byte{byte(vm.JUMPDEST)}
+		for i := 0; i < len(output); i += 32 {
+			body = append(body, byte(vm.PUSH32))
+			body = append(body, common.RightPadBytes(output[i:], 32)[:32]...)
+			body = append(body, byte(vm.PUSH2), byte(i>>8), byte(i), byte(vm.MSTORE))
+		}
+		size := make([]byte, 2)
+		binary.BigEndian.PutUint16(size, uint16(len(output)))
+		body = append(body, byte(vm.PUSH2), size[0], size[1], byte(vm.PUSH1), 0, byte(vm.RETURN))
+
+		bodies = append(bodies, body...)
+		dest += len(body)
+	}
+	code = append(code, byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.REVERT))
+	return append(code, bodies...)
+}
+
+// cannedOutput packs the outputs of a system contract method.
+func cannedOutput(t *testing.T, contract abi.ABI, method string, outputs ...interface{}) ([4]byte, []byte) {
+	var selector [4]byte
+	copy(selector[:], contract.Methods[method].ID)
+
+	output, err := contract.Methods[method].Outputs.Pack(outputs...)
+	if err != nil {
+		t.Fatalf("failed to pack %s outputs: %v", method, err)
+	}
+	return selector, output
+}
+
+// Tests that the validator economics and sets, punishment state, blacklist and
+// developer whitelist are decoded from the system contracts.
+func TestAPISystemContractState(t *testing.T) {
+	var (
+		abis    = systemcontract.GetInteractiveABI()
+		val     = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		joining = common.HexToAddress("0x0000000000000000000000000000000000000002")
+		leaving = common.HexToAddress("0x0000000000000000000000000000000000000003")
+		blackA  = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		blackB  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		valc    = common.HexToAddress("0x0000000000000000000000000000000000000c0c")
+	)
+	factory, punish, list := make(map[[4]byte][]byte), make(map[[4]byte][]byte), make(map[[4]byte][]byte)
+	contract := make(map[[4]byte][]byte)
+	add := func(outputs map[[4]byte][]byte, name, method string, values ...interface{}) {
+		selector, output := cannedOutput(t, abis[name], method, values...)
+		outputs[selector] = output
+	}
+	add(factory, systemcontract.DposFactoryContractName, "getTopValidators", []common.Address{joining, val})
+	var getContract [4]byte
+	copy(getContract[:], systemcontract.ValidatorContractSelector)
+	factory[getContract] = common.LeftPadBytes(valc.Bytes(), 32)
+	add(contract, systemcontract.ValidatorContractName, "totalVote", big.NewInt(1000))
+	add(contract, systemcontract.ValidatorContractName, "percent", big.NewInt(20))
+	add(contract, systemcontract.ValidatorContractName, "getValidatorPendingReward", big.NewInt(300))
+	add(punish, systemcontract.PunishV1ContractName, "getPunishRecord", big.NewInt(7))
+	add(list, systemcontract.AddressListContractName, "getBlacksFrom", []common.Address{blackA, blackB})
+	add(list, systemcontract.AddressListContractName, "getBlacksTo", []common.Address{blackB})
+	add(list, systemcontract.AddressListContractName, "devVerifyEnabled", true)
+	add(list, systemcontract.AddressListContractName, "isDeveloper", true)
+
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		Dpos:                &params.DposConfig{Period: 3, Epoch: 200},
+	}
+	genspec := &core.Genesis{
+		Config:    config,
+		ExtraData: make([]byte, extraVanity+2*common.AddressLength+extraSeal),
+		Alloc: core.GenesisAlloc{
+			systemcontract.DposFactoryContractAddr: {Balance: new(big.Int), Code: dispatchCode(factory)},
+			systemcontract.PunishV1ContractAddr:    {Balance: new(big.Int), Code: dispatchCode(punish)},
+			systemcontract.AddressListContractAddr: {Balance: new(big.Int), Code: dispatchCode(list)},
+			valc:                                   {Balance: new(big.Int), Code: dispatchCode(contract)},
+		},
+	}
+	copy(genspec.ExtraData[extraVanity:], val[:])
+	copy(genspec.ExtraData[extraVanity+common.AddressLength:], leaving[:])
+
+	// State commits flush contract codes asynchronously, store them upfront
+	db := rawdb.NewMemoryDatabase()
+	for _, account := range genspec.Alloc {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(account.Code), account.Code)
+	}
+	genesis := genspec.MustCommit(db)
+
+	engine := New(config, db, nil, genesis.Hash())
+	engine.SetStateFn(func(root common.Hash) (*state.StateDB, error) {
+		return state.New(root, state.NewDatabase(db), nil)
+	})
+	api := &API{chain: newTestChainReader(config, engine, genesis), dpos: engine}
+	at := rpc.BlockNumberOrHashWithHash(genesis.Hash(), false)
+
+	sets, err := api.GetValidatorSets(&at)
+	if err != nil {
+		t.Fatalf("failed to get validator sets: %v", err)
+	}
+	want := &ValidatorSets{
+		Top:     []common.Address{val, joining},
+		Active:  []common.Address{val, leaving},
+		Joining: []common.Address{joining},
+		Leaving: []common.Address{leaving},
+	}
+	if !reflect.DeepEqual(sets, want) {
+		t.Errorf("validator sets mismatch: have %+v, want %+v", sets, want)
+	}
+	info, err := api.GetValidatorInfo(val, &at)
+	if err != nil {
+		t.Fatalf("failed to get validator info: %v", err)
+	}
+	if info.Stake.ToInt().Int64() != 1000 || info.Commission.ToInt().Int64() != 20 || info.AccRewards.ToInt().Int64() != 300 {
+		t.Errorf("economics mismatch: have %v %v %v, want 1000 20 300", info.Stake, info.Commission, info.AccRewards)
+	}
+	if info.MissedBlocks.ToInt().Int64() != 7 {
+		t.Errorf("missed blocks mismatch: have %v, want 7", info.MissedBlocks)
+	}
+	if !info.Top || !info.Active {
+		t.Errorf("set membership mismatch: have top %v active %v, want both", info.Top, info.Active)
+	}
+	infos, err := api.GetValidatorInfos(&at)
+	if err != nil {
+		t.Fatalf("failed to get validator infos: %v", err)
+	}
+	if len(infos) != 3 || infos[0].Address != val || infos[1].Address != joining || infos[2].Address != leaving {
+		t.Fatalf("validator infos mismatch: have %d entries", len(infos))
+	}
+	if infos[1].Active || !infos[1].Top || infos[2].Top || !infos[2].Active {
+		t.Errorf("set membership mismatch of joining/leaving validators")
+	}
+	blacklist, err := api.GetBlacklist(&at)
+	if err != nil {
+		t.Fatalf("failed to get blacklist: %v", err)
+	}
+	if want := map[common.Address]string{blackA: "from", blackB: "both"}; !reflect.DeepEqual(blacklist, want) {
+		t.Errorf("blacklist mismatch: have %v, want %v", blacklist, want)
+	}
+	status, err := api.GetDeveloperStatus(blackA, &at)
+	if err != nil {
+		t.Fatalf("failed to get developer status: %v", err)
+	}
+	if !status.Enabled || !status.Developer {
+		t.Errorf("developer status mismatch: have %+v, want enabled developer", status)
+	}
+	if _, err := (&API{chain: api.chain, dpos: New(config, db, nil, genesis.Hash())}).GetValidatorSets(&at); err != errStateUnavailable {
+		t.Errorf("stateless error mismatch: have %v, want %v", err, errStateUnavailable)
+	}
+}
+
+// Tests that the validator economics are read from the contracts the genesis
+// factory deploys, and that unregistered validators have none.
+func TestValidatorEconomics(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	pt.useSystemContracts()
+
+	engine := pt.newEngine(true)
+	blocks := pt.generate(engine, 2)
+	statedb, err := state.New(blocks[1].Root(), state.NewDatabase(pt.db), nil)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	chain := newChainContext(newTestChainReader(pt.config, engine, pt.genesis, blocks[0], blocks[1]), engine)
+
+	tests := []struct {
+		val                           common.Address
+		stake, commission, accRewards int64
+	}{
+		{pt.validator, 1000, 1000, 0},
+		{common.HexToAddress("0x1234"), 0, 0, 0},
+	}
+	for i, tt := range tests {
+		info, err := engine.readValidatorEconomics(chain, blocks[1].Header(), statedb, tt.val)
+		if err != nil {
+			t.Fatalf("test %d: failed to read economics: %v", i, err)
+		}
+		if info.Stake.Int64() != tt.stake || info.Commission.Int64() != tt.commission || info.AccRewards.Int64() != tt.accRewards {
+			t.Errorf("test %d: economics mismatch: have %v %v %v, want %d %d %d", i, info.Stake, info.Commission, info.AccRewards, tt.stake, tt.commission, tt.accRewards)
+		}
+	}
+}
+
+// headChainReader is a testChainReader with a head block.
+type headChainReader struct {
+	*testChainReader
+	head *types.Header
+}
+
+func (r *headChainReader) CurrentHeader() *types.Header { return r.head }
+
+// Tests that the passed and pending system governance proposals are decoded, and
+// that proposals are simulated without changing the state.
+func TestAPIProposals(t *testing.T) {
+	var (
+		abis   = systemcontract.GetInteractiveABI()
+		admin  = common.HexToAddress("0x00000000000000000000000000000000000000ad")
+		black  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		target = common.HexToAddress("0x0000000000000000000000000000000000000f00")
+	)
+	blacklist, err := abis[systemcontract.AddressListContractName].Pack("addBlacklist", black, uint8(DirectionFrom))
+	if err != nil {
+		t.Fatalf("failed to pack blacklisting: %v", err)
+	}
+	proposals := func(id int64) []byte {
+		gov := make(map[[4]byte][]byte)
+		selector, output := cannedOutput(t, abis[systemcontract.SysGovContractName], "getPassedProposalCount", uint32(1))
+		gov[selector] = output
+		selector, output = cannedOutput(t, abis[systemcontract.SysGovContractName], "getPassedProposalByIndex",
+			big.NewInt(id), big.NewInt(0), admin, systemcontract.AddressListContractAddr, big.NewInt(0), blacklist)
+		gov[selector] = output
+		return dispatchCode(gov)
+	}
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		Dpos:                &params.DposConfig{Period: 3, Epoch: 200},
+	}
+	genspec := &core.Genesis{
+		Config:    config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: core.GenesisAlloc{
+			systemcontract.SysGovContractAddr: {Balance: new(big.Int), Code: proposals(1)},
+			// Reverts every call
+			systemcontract.AddressListContractAddr: {Balance: new(big.Int), Code: common.FromHex("0x60006000fd")},
+			// Stores 0x2a in slot 1 and emits an empty log
+			target: {Balance: new(big.Int), Code: common.FromHex("0x602a60015560006000a000")},
+		},
+	}
+	db := rawdb.NewMemoryDatabase()
+	for _, account := range genspec.Alloc {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(account.Code), account.Code)
+	}
+	genesis := genspec.MustCommit(db)
+
+	engine := New(config, db, nil, genesis.Hash())
+	engine.SetStateFn(func(root common.Hash) (*state.StateDB, error) {
+		return state.New(root, state.NewDatabase(db), nil)
+	})
+	api := &API{chain: &headChainReader{newTestChainReader(config, engine, genesis), genesis.Header()}, dpos: engine}
+
+	// Passed proposals are decoded, along with the system contract calls they make
+	infos, err := api.GetProposals(nil)
+	if err != nil {
+		t.Fatalf("failed to get proposals: %v", err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("proposal count mismatch: have %d, want 1", len(infos))
+	}
+	if info := infos[0]; info.Id.ToInt().Int64() != 1 || info.Status != ProposalPassed || info.Action != "evmCall" || info.From != admin {
+		t.Errorf("proposal mismatch: have %+v", info)
+	}
+	if info := infos[0]; info.Method != "addBlacklist(address,uint8)" || info.Args["a"] != black || info.Args["d"] != uint8(DirectionFrom) {
+		t.Errorf("proposal call mismatch: have %s %v", info.Method, info.Args)
+	}
+	if _, err := api.GetProposal((*hexutil.Big)(big.NewInt(2)), nil); err != errUnknownProposal {
+		t.Errorf("unknown proposal error mismatch: have %v, want %v", err, errUnknownProposal)
+	}
+	// Proposals passed in the pending block are listed at the head only
+	pending, _ := state.New(genesis.Root(), state.NewDatabase(db), nil)
+	pending.SetCode(systemcontract.SysGovContractAddr, proposals(2))
+	engine.SetPendingFn(func() (*types.Block, *state.StateDB) {
+		return types.NewBlockWithHeader(&types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), GasLimit: genesis.GasLimit()}), pending.Copy()
+	})
+	if infos, err = api.GetProposals(nil); err != nil {
+		t.Fatalf("failed to get proposals: %v", err)
+	}
+	if len(infos) != 2 || infos[1].Id.ToInt().Int64() != 2 || infos[1].Status != ProposalPending {
+		t.Errorf("pending proposals mismatch: have %d proposals", len(infos))
+	}
+	at := rpc.BlockNumberOrHashWithHash(genesis.Hash(), false)
+	if infos, err = api.GetProposals(&at); err != nil || len(infos) != 1 {
+		t.Errorf("proposals below the head mismatch: have %d, %v, want 1", len(infos), err)
+	}
+	if info, err := api.GetProposal((*hexutil.Big)(big.NewInt(2)), nil); err != nil || info.Status != ProposalPending {
+		t.Errorf("pending proposal mismatch: have %+v, %v", info, err)
+	}
+	// Reverted proposals are reported as failed
+	sim, err := api.SimulateProposal(ProposalArgs{Id: (*hexutil.Big)(big.NewInt(1))}, nil)
+	if err != nil {
+		t.Fatalf("failed to simulate proposal: %v", err)
+	}
+	if sim.Receipt.Status != types.ReceiptStatusFailed || sim.Error != vm.ErrExecutionReverted.Error() || sim.Proposal.Status != ProposalPassed {
+		t.Errorf("failed simulation mismatch: status %d, error %q, proposal %s", sim.Receipt.Status, sim.Error, sim.Proposal.Status)
+	}
+	if len(sim.StateDiff) != 0 {
+		t.Errorf("failed simulation changed %d accounts", len(sim.StateDiff))
+	}
+	// Proposals yet to be committed are simulated with their logs and state changes
+	sim, err = api.SimulateProposal(ProposalArgs{From: admin, To: target}, nil)
+	if err != nil {
+		t.Fatalf("failed to simulate proposal: %v", err)
+	}
+	if sim.Receipt.Status != types.ReceiptStatusSuccessful || sim.Error != "" || len(sim.Receipt.Logs) != 1 {
+		t.Errorf("simulation mismatch: status %d, error %q, %d logs", sim.Receipt.Status, sim.Error, len(sim.Receipt.Logs))
+	}
+	slot := common.BigToHash(big.NewInt(1))
+	if diff := sim.StateDiff[target]; len(sim.StateDiff) != 1 || diff == nil || diff.Storage[slot] != [2]common.Hash{{}, common.BigToHash(big.NewInt(0x2a))} {
+		t.Errorf("state diff mismatch: have %+v", sim.StateDiff)
+	}
+	sim, err = api.SimulateProposal(ProposalArgs{Action: (*hexutil.Big)(big.NewInt(1)), To: target}, nil)
+	if err != nil {
+		t.Fatalf("failed to simulate erasure: %v", err)
+	}
+	if diff := sim.StateDiff[target]; diff == nil || !diff.Erased || diff.Code == nil || len(diff.Code[1]) != 0 {
+		t.Errorf("erasure diff mismatch: have %+v", diff)
+	}
+	// Simulations leave the state untouched
+	statedb, _ := state.New(genesis.Root(), state.NewDatabase(db), nil)
+	if statedb.GetState(target, slot) != (common.Hash{}) || len(statedb.GetCode(target)) == 0 {
+		t.Errorf("simulation changed the state")
+	}
+}
@@ -0,0 +1,194 @@
+package dpos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// snapshotPrefix + hash -> JSON encoded checkpoint snapshot
+var snapshotPrefix = []byte("dpos-")
+
+// snapshotKey = snapshotPrefix + hash
+func snapshotKey(hash common.Hash) []byte {
+	return append(append([]byte{}, snapshotPrefix...), hash.Bytes()...)
+}
+
+// IsCheckpoint returns whether the snapshot of the given block is stored on disk.
+func IsCheckpoint(number uint64) bool {
+	return number%checkpointInterval == 0
+}
+
+// HasSnapshot returns whether a snapshot is stored for the given block.
+func HasSnapshot(db ethdb.KeyValueReader, hash common.Hash) bool {
+	ok, _ := db.Has(snapshotKey(hash))
+	return ok
+}
+
+// ReadSnapshot decodes the snapshot stored for the given block. The snapshot is
+// only meant to be inspected, it can't be applied headers to.
+func ReadSnapshot(db ethdb.KeyValueReader, hash common.Hash) (*Snapshot, error) {
+	blob, err := db.Get(snapshotKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	snap := new(Snapshot)
+	if err := json.Unmarshal(blob, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// WriteSnapshot stores the snapshot as the checkpoint of its block.
+func WriteSnapshot(db ethdb.KeyValueWriter, snap *Snapshot) error {
+	blob, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return db.Put(snapshotKey(snap.Hash), blob)
+}
+
+// DeleteSnapshot removes the snapshot stored for the given block.
+func DeleteSnapshot(db ethdb.KeyValueWriter, hash common.Hash) error {
+	return db.Delete(snapshotKey(hash))
+}
+
+// IterateSnapshots iterates over the snapshots stored in the database, calling
+// fn with the block hash of each of them and either the decoded snapshot or the
+// error decoding it. The iteration stops if fn returns false.
+func IterateSnapshots(db ethdb.Iteratee, fn func(hash common.Hash, snap *Snapshot, err error) bool) error {
+	it := db.NewIterator(snapshotPrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(snapshotPrefix)+common.HashLength {
+			continue
+		}
+		snap := new(Snapshot)
+		err := json.Unmarshal(it.Value(), snap)
+		if err != nil {
+			snap = nil
+		}
+		if !fn(common.BytesToHash(key[len(snapshotPrefix):]), snap, err) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// RecomputeSnapshots recomputes the checkpoint snapshots of the canonical chain
+// up to the given block from the headers alone, ignoring the stored ones, and
+// calls fn with each of them in ascending order. The blocks before the switch
+// of chains migrated from parlia have no dpos snapshot, and are skipped.
+func RecomputeSnapshots(chain consensus.ChainHeaderReader, last uint64, fn func(snap *Snapshot) error) error {
+	config := chain.Config()
+	if config.Dpos == nil {
+		return errors.New("not a dpos chain")
+	}
+	genesis := chain.GetHeaderByNumber(0)
+	if genesis == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	// Compute the snapshots on engines of their own, which don't see the stored
+	// ones, each checkpoint starting from the previous one kept in memory
+	engine := New(config, rawdb.NewMemoryDatabase(), nil, genesis.Hash())
+	if config.Parlia != nil {
+		engine.SetPredecessor(parlia.New(config, rawdb.NewMemoryDatabase(), nil, genesis.Hash()))
+	}
+	for number := uint64(0); number <= last; number += checkpointInterval {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return fmt.Errorf("missing header #%d", number)
+		}
+		if engine.isPredecessor(header.Number) {
+			if _, err := engine.predecessor.Snapshot(chain, number, header.Hash(), nil); err != nil {
+				return fmt.Errorf("failed to compute parlia snapshot #%d: %v", number, err)
+			}
+			continue
+		}
+		snap, err := engine.snapshot(chain, number, header.Hash(), nil)
+		if err != nil {
+			return fmt.Errorf("failed to compute snapshot #%d: %v", number, err)
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff lists the differences of the snapshot against the expected one, one line
+// per validator, recent validator or fork hash differing.
+func (s *Snapshot) Diff(want *Snapshot) []string {
+	var diffs []string
+	if s.Number != want.Number || s.Hash != want.Hash {
+		diffs = append(diffs, fmt.Sprintf("block: have #%d [%x], want #%d [%x]", s.Number, s.Hash, want.Number, want.Hash))
+	}
+	for _, val := range want.validators() {
+		if _, ok := s.Validators[val]; !ok {
+			diffs = append(diffs, fmt.Sprintf("validator %s: missing", val.Hex()))
+		}
+	}
+	for _, val := range s.validators() {
+		if _, ok := want.Validators[val]; !ok {
+			diffs = append(diffs, fmt.Sprintf("validator %s: unexpected", val.Hex()))
+		}
+	}
+	var numbers []uint64
+	for number := range s.Recents {
+		numbers = append(numbers, number)
+	}
+	for number := range want.Recents {
+		numbers = append(numbers, number)
+	}
+	for _, number := range sortedUnique(numbers) {
+		have, haveOk := s.Recents[number]
+		wanted, wantOk := want.Recents[number]
+		if have != wanted || haveOk != wantOk {
+			diffs = append(diffs, fmt.Sprintf("recent #%d: have %s, want %s", number, diffValue(have.Hex(), haveOk), diffValue(wanted.Hex(), wantOk)))
+		}
+	}
+	numbers = numbers[:0]
+	for number := range s.RecentForkHashes {
+		numbers = append(numbers, number)
+	}
+	for number := range want.RecentForkHashes {
+		numbers = append(numbers, number)
+	}
+	for _, number := range sortedUnique(numbers) {
+		have, haveOk := s.RecentForkHashes[number]
+		wanted, wantOk := want.RecentForkHashes[number]
+		if have != wanted || haveOk != wantOk {
+			diffs = append(diffs, fmt.Sprintf("fork hash #%d: have %s, want %s", number, diffValue(have, haveOk), diffValue(wanted, wantOk)))
+		}
+	}
+	return diffs
+}
+
+// sortedUnique sorts the block numbers in ascending order, dropping duplicates.
+func sortedUnique(numbers []uint64) []uint64 {
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	unique := numbers[:0]
+	for _, number := range numbers {
+		if len(unique) == 0 || number != unique[len(unique)-1] {
+			unique = append(unique, number)
+		}
+	}
+	return unique
+}
+
+// diffValue formats a value of a snapshot diff, which may be missing.
+func diffValue(value string, ok bool) string {
+	if !ok {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,132 @@
+package dpos
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the checkpoint snapshots are recomputed from the headers, and that
+// the stored ones are told apart from them.
+func TestRecomputeSnapshots(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+
+	config := &params.ChainConfig{ChainID: big.NewInt(1), Dpos: &params.DposConfig{Period: 3, Epoch: 200}}
+	reader := newTestChainReader(config, nil)
+
+	parent := epochHeader(0, common.Hash{}, validator)
+	reader.headers[parent.Hash()] = parent
+	for i := uint64(1); i <= checkpointInterval+10; i++ {
+		header := epochHeader(i, parent.Hash())
+		if i%config.Dpos.Epoch == 0 {
+			header = epochHeader(i, parent.Hash(), validator)
+		}
+		sig, err := crypto.Sign(SealHash(header, config.ChainID).Bytes(), key)
+		if err != nil {
+			t.Fatalf("failed to sign block %d: %v", i, err)
+		}
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+		reader.headers[header.Hash()] = header
+		parent = header
+	}
+	var snaps []*Snapshot
+	err := RecomputeSnapshots(reader, parent.Number.Uint64(), func(snap *Snapshot) error {
+		snaps = append(snaps, snap)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to recompute snapshots: %v", err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("snapshot count mismatch: have %d, want 2", len(snaps))
+	}
+	for i, number := range []uint64{0, checkpointInterval} {
+		if snaps[i].Number != number || snaps[i].Hash != reader.GetHeaderByNumber(number).Hash() {
+			t.Errorf("snapshot %d block mismatch: have #%d [%x], want #%d", i, snaps[i].Number, snaps[i].Hash, number)
+		}
+		if want := []common.Address{validator}; !reflect.DeepEqual(snaps[i].validators(), want) {
+			t.Errorf("snapshot %d validators mismatch: have %v, want %v", i, snaps[i].validators(), want)
+		}
+	}
+	if want := map[uint64]common.Address{checkpointInterval: validator}; !reflect.DeepEqual(snaps[1].Recents, want) {
+		t.Errorf("recents mismatch: have %v, want %v", snaps[1].Recents, want)
+	}
+	// Store the snapshots, corrupting one of them along with a stale one
+	db := rawdb.NewMemoryDatabase()
+	for _, snap := range snaps {
+		if err := WriteSnapshot(db, snap); err != nil {
+			t.Fatalf("failed to write snapshot: %v", err)
+		}
+	}
+	corrupt := snaps[1].copy()
+	corrupt.Validators[common.HexToAddress("0x01")] = struct{}{}
+	corrupt.Recents[checkpointInterval] = common.HexToAddress("0x02")
+	corrupt.Recents[checkpointInterval-1] = validator
+	corrupt.RecentForkHashes[checkpointInterval] = "deadbeef"
+	if err := WriteSnapshot(db, corrupt); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	stale := common.HexToHash("0x03")
+	if err := db.Put(snapshotKey(stale), []byte("{")); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	stored := make(map[common.Hash]bool)
+	err = IterateSnapshots(db, func(hash common.Hash, snap *Snapshot, err error) bool {
+		stored[hash] = err == nil
+		if snap != nil && snap.Hash != hash {
+			t.Errorf("snapshot hash mismatch: have %x, want %x", snap.Hash, hash)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate snapshots: %v", err)
+	}
+	if want := map[common.Hash]bool{snaps[0].Hash: true, snaps[1].Hash: true, stale: false}; !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored snapshots mismatch: have %v, want %v", stored, want)
+	}
+	for i, snap := range snaps {
+		have, err := ReadSnapshot(db, snap.Hash)
+		if err != nil {
+			t.Fatalf("failed to read snapshot %d: %v", i, err)
+		}
+		diffs := have.Diff(snap)
+		if i == 0 && len(diffs) != 0 {
+			t.Errorf("intact snapshot differs: %v", diffs)
+		}
+		if i == 1 {
+			want := []string{
+				"validator 0x0000000000000000000000000000000000000001: unexpected",
+				"recent #1023: have " + validator.Hex() + ", want none",
+				"recent #1024: have 0x0000000000000000000000000000000000000002, want " + validator.Hex(),
+				"fork hash #1024: have deadbeef, want none",
+			}
+			if !reflect.DeepEqual(diffs, want) {
+				t.Errorf("corrupt snapshot diff mismatch: have %v, want %v", diffs, want)
+			}
+		}
+	}
+	if err := DeleteSnapshot(db, stale); err != nil {
+		t.Fatalf("failed to delete snapshot: %v", err)
+	}
+	if _, err := ReadSnapshot(db, stale); err == nil {
+		t.Errorf("deleted snapshot still stored")
+	}
+}
+
+// Tests that snapshots of other blocks are reported as such.
+func TestSnapshotDiffBlock(t *testing.T) {
+	config := &params.DposConfig{Period: 3, Epoch: 200}
+	a := newSnapshot(config, nil, 1024, common.HexToHash("0x01"), nil, nil)
+	b := newSnapshot(config, nil, 2048, common.HexToHash("0x02"), nil, nil)
+
+	want := []string{"block: have #1024 [" + common.HexToHash("0x01").Hex()[2:] + "], want #2048 [" + common.HexToHash("0x02").Hex()[2:] + "]"}
+	if diffs := a.Diff(b); !reflect.DeepEqual(diffs, want) {
+		t.Errorf("diff mismatch: have %v, want %v", diffs, want)
+	}
+}
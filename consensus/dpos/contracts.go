@@ -0,0 +1,215 @@
+package dpos
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// callContract runs a read-only call of a system contract method on top of the
+// given state, returning the unpacked outputs.
+func (p *Dpos) callContract(chain core.ChainContext, header *types.Header, state *state.StateDB, name string, contract common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	abi := p.abi[name]
+	data, err := abi.Pack(method, args...)
+	if err != nil {
+		log.Error("Can't pack data", "method", method, "err", err)
+		return nil, err
+	}
+	msg := types.NewMessage(header.Coinbase, &contract, 0, new(big.Int), math.MaxUint64, new(big.Int), data, nil, false)
+	result, err := vmcaller.ExecuteMsg(msg, state, header, chain, p.chainConfig)
+	if err != nil {
+		return nil, err
+	}
+	return abi.Unpack(method, result)
+}
+
+// readAddresses calls a system contract method returning a list of addresses.
+func (p *Dpos) readAddresses(chain core.ChainContext, header *types.Header, state *state.StateDB, name string, contract common.Address, method string) ([]common.Address, error) {
+	ret, err := p.callContract(chain, header, state, name, contract, method)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 1 {
+		return nil, errors.New("invalid params length")
+	}
+	addrs, ok := ret[0].([]common.Address)
+	if !ok {
+		return nil, errors.New("invalid addresses format")
+	}
+	return addrs, nil
+}
+
+// readTopValidators returns the validators with the most stake, sorted by
+// address, which become the active set at the next epoch.
+func (p *Dpos) readTopValidators(chain core.ChainContext, header *types.Header, state *state.StateDB) ([]common.Address, error) {
+	validators, err := p.readAddresses(chain, header, state, systemcontract.DposFactoryContractName, *systemcontract.GetValidatorAddr(header.Number, p.chainConfig), "getTopValidators")
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(validatorsAscending(validators))
+	return validators, nil
+}
+
+// readBlacklist returns the blacklisted addresses along with the directions of
+// the transactions they are denied.
+func (p *Dpos) readBlacklist(chain core.ChainContext, header *types.Header, state *state.StateDB) (map[common.Address]BlacklistDirection, error) {
+	froms, err := p.readAddresses(chain, header, state, systemcontract.AddressListContractName, systemcontract.AddressListContractAddr, "getBlacksFrom")
+	if err != nil {
+		return nil, err
+	}
+	tos, err := p.readAddresses(chain, header, state, systemcontract.AddressListContractName, systemcontract.AddressListContractAddr, "getBlacksTo")
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[common.Address]BlacklistDirection)
+	for _, from := range froms {
+		m[from] = DirectionFrom
+	}
+	for _, to := range tos {
+		if _, exist := m[to]; exist {
+			m[to] = DirectionBoth
+		} else {
+			m[to] = DirectionTo
+		}
+	}
+	return m, nil
+}
+
+// validatorEconomics is the staking state of a validator kept by its own
+// contract, deployed by the factory.
+type validatorEconomics struct {
+	Stake      *big.Int
+	Commission *big.Int
+	AccRewards *big.Int
+}
+
+// readValidatorContract returns the contract the factory deployed for the
+// validator, the zero address if it never registered.
+func (p *Dpos) readValidatorContract(chain core.ChainContext, header *types.Header, state *state.StateDB, val common.Address) (common.Address, error) {
+	data := append(append([]byte{}, systemcontract.ValidatorContractSelector...), common.LeftPadBytes(val.Bytes(), 32)...)
+	msg := types.NewMessage(header.Coinbase, systemcontract.GetValidatorAddr(header.Number, p.chainConfig), 0, new(big.Int), math.MaxUint64, new(big.Int), data, nil, false)
+	result, err := vmcaller.ExecuteMsg(msg, state, header, chain, p.chainConfig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(result) != 32 {
+		return common.Address{}, errors.New("invalid validator contract format")
+	}
+	return common.BytesToAddress(result), nil
+}
+
+// readUint calls a validator contract method returning a single uint256.
+func (p *Dpos) readUint(chain core.ChainContext, header *types.Header, state *state.StateDB, contract common.Address, method string) (*big.Int, error) {
+	ret, err := p.callContract(chain, header, state, systemcontract.ValidatorContractName, contract, method)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 1 {
+		return nil, errors.New("invalid params length")
+	}
+	value, ok := ret[0].(*big.Int)
+	if !ok {
+		return nil, errors.New("invalid uint format")
+	}
+	return value, nil
+}
+
+// readValidatorEconomics returns the votes staked on a validator, its
+// commission and the rewards it accumulated and not withdrawn yet. Validators
+// without a contract have none.
+func (p *Dpos) readValidatorEconomics(chain core.ChainContext, header *types.Header, state *state.StateDB, val common.Address) (*validatorEconomics, error) {
+	contract, err := p.readValidatorContract(chain, header, state, val)
+	if err != nil {
+		return nil, err
+	}
+	info := &validatorEconomics{Stake: new(big.Int), Commission: new(big.Int), AccRewards: new(big.Int)}
+	if contract == (common.Address{}) {
+		return info, nil
+	}
+	if info.Stake, err = p.readUint(chain, header, state, contract, "totalVote"); err != nil {
+		return nil, err
+	}
+	if info.Commission, err = p.readUint(chain, header, state, contract, "percent"); err != nil {
+		return nil, err
+	}
+	if info.AccRewards, err = p.readUint(chain, header, state, contract, "getValidatorPendingReward"); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// readValidatorState returns the state of a validator contract, telling
+// whether the validator is ready or paused.
+func (p *Dpos) readValidatorState(chain core.ChainContext, header *types.Header, state *state.StateDB, contract common.Address) (uint8, error) {
+	ret, err := p.callContract(chain, header, state, systemcontract.ValidatorContractName, contract, "state")
+	if err != nil {
+		return 0, err
+	}
+	if len(ret) != 1 {
+		return 0, errors.New("invalid params length")
+	}
+	value, ok := ret[0].(uint8)
+	if !ok {
+		return 0, errors.New("invalid validator state format")
+	}
+	return value, nil
+}
+
+// readFactoryAdmin returns the admin of the factory contract, the only account
+// allowed to pause and resume validators.
+func (p *Dpos) readFactoryAdmin(chain core.ChainContext, header *types.Header, state *state.StateDB) (common.Address, error) {
+	ret, err := p.callContract(chain, header, state, systemcontract.DposFactoryContractName, *systemcontract.GetValidatorAddr(header.Number, p.chainConfig), "admin")
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(ret) != 1 {
+		return common.Address{}, errors.New("invalid params length")
+	}
+	admin, ok := ret[0].(common.Address)
+	if !ok {
+		return common.Address{}, errors.New("invalid admin format")
+	}
+	return admin, nil
+}
+
+// readMissedBlocks returns the missed blocks counter of a validator, reset
+// whenever the validator is punished.
+func (p *Dpos) readMissedBlocks(chain core.ChainContext, header *types.Header, state *state.StateDB, val common.Address) (*big.Int, error) {
+	ret, err := p.callContract(chain, header, state, systemcontract.PunishV1ContractName, *systemcontract.GetPunishAddr(header.Number, p.chainConfig), "getPunishRecord", val)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 1 {
+		return nil, errors.New("invalid params length")
+	}
+	missed, ok := ret[0].(*big.Int)
+	if !ok {
+		return nil, errors.New("invalid punish record format")
+	}
+	return missed, nil
+}
+
+// readBool calls an address list contract method returning a single bool.
+func (p *Dpos) readBool(chain core.ChainContext, header *types.Header, state *state.StateDB, method string, args ...interface{}) (bool, error) {
+	ret, err := p.callContract(chain, header, state, systemcontract.AddressListContractName, systemcontract.AddressListContractAddr, method, args...)
+	if err != nil {
+		return false, err
+	}
+	if len(ret) != 1 {
+		return false, errors.New("invalid params length")
+	}
+	value, ok := ret[0].(bool)
+	if !ok {
+		return false, errors.New("invalid bool format")
+	}
+	return value, nil
+}
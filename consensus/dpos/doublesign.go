@@ -0,0 +1,346 @@
+package dpos
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	inMemorySealedHeaders = 4096 // Number of recent (height, signer) pairs tracked to detect double signs
+	maxEvidenceAge        = 1024 // Number of blocks a double sign remains punishable
+)
+
+var (
+	// errInvalidEvidence is returned if a double sign evidence doesn't prove
+	// that a validator sealed two different headers at the same height.
+	errInvalidEvidence = errors.New("invalid double sign evidence")
+
+	// errInvalidEvidenceCount is returned if a block contains more than one
+	// double sign evidence transaction.
+	errInvalidEvidenceCount = errors.New("invalid double sign evidence tx count")
+
+	// errInvalidEvidenceTx is returned if a double sign evidence transaction
+	// doesn't match the evidence it carries.
+	errInvalidEvidenceTx = errors.New("invalid double sign evidence tx")
+)
+
+// Evidence proves that a validator sealed two different headers at the same
+// height.
+type Evidence struct {
+	HeaderA *types.Header
+	HeaderB *types.Header
+}
+
+// newEvidence creates an evidence from two conflicting headers, ordering them
+// by hash so the same double sign always yields the same evidence.
+func newEvidence(a, b *types.Header) *Evidence {
+	if bytes.Compare(a.Hash().Bytes(), b.Hash().Bytes()) > 0 {
+		a, b = b, a
+	}
+	return &Evidence{HeaderA: a, HeaderB: b}
+}
+
+// Hash returns the hash identifying the evidence.
+func (e *Evidence) Hash() common.Hash {
+	enc, _ := rlp.EncodeToBytes(e)
+	return crypto.Keccak256Hash(enc)
+}
+
+// Number returns the height of the double signed headers.
+func (e *Evidence) Number() uint64 {
+	return e.HeaderA.Number.Uint64()
+}
+
+// verify checks that the evidence proves a double sign, returning the double
+// signer. The check only depends on the evidence itself, so it yields the same
+// result on every node.
+func (e *Evidence) verify(sigCache *lru.ARCCache, chainId *big.Int) (common.Address, error) {
+	if e.HeaderA == nil || e.HeaderB == nil || e.HeaderA.Number == nil || e.HeaderB.Number == nil {
+		return common.Address{}, errInvalidEvidence
+	}
+	if e.HeaderA.Number.Cmp(e.HeaderB.Number) != 0 || e.HeaderA.Hash() == e.HeaderB.Hash() {
+		return common.Address{}, errInvalidEvidence
+	}
+	signerA, err := ecrecover(e.HeaderA, sigCache, chainId)
+	if err != nil {
+		return common.Address{}, errInvalidEvidence
+	}
+	signerB, err := ecrecover(e.HeaderB, sigCache, chainId)
+	if err != nil {
+		return common.Address{}, errInvalidEvidence
+	}
+	if signerA != signerB || signerA != e.HeaderA.Coinbase || signerB != e.HeaderB.Coinbase {
+		return common.Address{}, errInvalidEvidence
+	}
+	return signerA, nil
+}
+
+// sealedKey identifies the header a validator sealed at a given height.
+type sealedKey struct {
+	number uint64
+	signer common.Address
+}
+
+// doubleSignMonitor tracks the recently sealed headers and collects evidences
+// of validators sealing two different headers at the same height.
+type doubleSignMonitor struct {
+	sealed    *lru.ARCCache             // Recently sealed headers keyed by height and signer
+	evidences map[common.Hash]*Evidence // Evidences waiting to be submitted
+	included  map[common.Hash]uint64    // Height of the local block each evidence was submitted in
+	lock      sync.Mutex
+}
+
+func newDoubleSignMonitor() *doubleSignMonitor {
+	sealed, err := lru.NewARC(inMemorySealedHeaders)
+	if err != nil {
+		panic(err)
+	}
+	return &doubleSignMonitor{
+		sealed:    sealed,
+		evidences: make(map[common.Hash]*Evidence),
+		included:  make(map[common.Hash]uint64),
+	}
+}
+
+// observe records a header sealed by signer, creating an evidence if the signer
+// already sealed a different header at the same height.
+func (m *doubleSignMonitor) observe(signer common.Address, header *types.Header) {
+	key := sealedKey{number: header.Number.Uint64(), signer: signer}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	seen, ok := m.sealed.Get(key)
+	if !ok {
+		m.sealed.Add(key, types.CopyHeader(header))
+		return
+	}
+	if prev := seen.(*types.Header); prev.Hash() != header.Hash() {
+		evidence := newEvidence(prev, types.CopyHeader(header))
+		if _, known := m.evidences[evidence.Hash()]; !known {
+			log.Warn("Detected double sign", "validator", signer, "number", key.number, "hashA", evidence.HeaderA.Hash(), "hashB", evidence.HeaderB.Hash())
+			m.evidences[evidence.Hash()] = evidence
+		}
+	}
+}
+
+// pending returns the evidences waiting to be submitted, ordered by height.
+func (m *doubleSignMonitor) pending() []*Evidence {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	evidences := make([]*Evidence, 0, len(m.evidences))
+	for _, evidence := range m.evidences {
+		evidences = append(evidences, evidence)
+	}
+	sort.Slice(evidences, func(i, j int) bool {
+		if evidences[i].Number() != evidences[j].Number() {
+			return evidences[i].Number() < evidences[j].Number()
+		}
+		return bytes.Compare(evidences[i].HeaderA.Hash().Bytes(), evidences[j].HeaderA.Hash().Bytes()) < 0
+	})
+	return evidences
+}
+
+// submit records that the evidence was submitted in a local block at the given
+// height.
+func (m *doubleSignMonitor) submit(evidence *Evidence, number uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.included[evidence.Hash()] = number
+}
+
+// submitted returns whether the evidence was already submitted in a local block
+// below the given height. Blocks reassembled at the same height submit it again.
+func (m *doubleSignMonitor) submitted(evidence *Evidence, number uint64) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	included, ok := m.included[evidence.Hash()]
+	return ok && included < number
+}
+
+// drop discards an evidence that was punished or expired.
+func (m *doubleSignMonitor) drop(evidence *Evidence) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.evidences, evidence.Hash())
+	delete(m.included, evidence.Hash())
+}
+
+// evidenceData returns the input of the system transaction punishing a double
+// signer. The punish contract only takes the validator, so the evidence is
+// appended after the call arguments for the verifiers to check it.
+func (p *Dpos) evidenceData(signer common.Address, evidence *Evidence) ([]byte, error) {
+	data, err := p.abi[systemcontract.PunishV1ContractName].Pack("punish", signer)
+	if err != nil {
+		log.Error("Can't pack data for punish", "error", err)
+		return nil, err
+	}
+	enc, err := rlp.EncodeToBytes(evidence)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, enc...), nil
+}
+
+// verifyEvidence checks that the evidence proves a double sign punishable in
+// the given block, returning the double signer. The signer must have been a
+// validator when sealing the double signed height.
+func (p *Dpos) verifyEvidence(chain consensus.ChainHeaderReader, header *types.Header, evidence *Evidence) (common.Address, error) {
+	signer, err := evidence.verify(p.signatures, p.chainConfig.ChainID)
+	if err != nil {
+		return common.Address{}, err
+	}
+	// Only past double signs which are recent enough can be punished
+	number := evidence.Number()
+	if number == 0 || number >= header.Number.Uint64() || number+maxEvidenceAge < header.Number.Uint64() {
+		return common.Address{}, errInvalidEvidence
+	}
+	// Resolve the ancestor the double signed height was sealed upon
+	ancestor := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	for ancestor != nil && ancestor.Number.Uint64() >= number {
+		ancestor = chain.GetHeader(ancestor.ParentHash, ancestor.Number.Uint64()-1)
+	}
+	if ancestor == nil {
+		return common.Address{}, consensus.ErrUnknownAncestor
+	}
+	snap, err := p.snapshot(chain, ancestor.Number.Uint64(), ancestor.Hash(), nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if _, ok := snap.Validators[signer]; !ok {
+		return common.Address{}, errInvalidEvidence
+	}
+	return signer, nil
+}
+
+// submitDoubleSignEvidence creates the system transaction punishing the double
+// signer of the oldest pending evidence. The punish contract takes a single
+// punishment per block, so at most one evidence is submitted, and only in the
+// blocks where no missed block is punished. Evidences are dropped once too old
+// to be punished. It returns a nil transaction if there is nothing to submit.
+func (p *Dpos) submitDoubleSignEvidence(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, totalTxIndex int) (*types.Transaction, *types.Receipt, error) {
+	p.lock.RLock()
+	sealing := p.signTxFn != nil
+	p.lock.RUnlock()
+
+	number := header.Number.Uint64()
+	for _, evidence := range p.doubleSigns.pending() {
+		if evidence.Number() >= number || p.doubleSigns.submitted(evidence, number) {
+			continue
+		}
+		signer, err := p.verifyEvidence(chain, header, evidence)
+		if err == consensus.ErrUnknownAncestor {
+			continue
+		}
+		if err != nil {
+			p.doubleSigns.drop(evidence)
+			continue
+		}
+		data, err := p.evidenceData(signer, evidence)
+		if err != nil {
+			return nil, nil, err
+		}
+		// make double sign evidence transaction
+		nonce := state.GetNonce(header.Coinbase)
+		tx := types.NewTransaction(nonce, *systemcontract.GetPunishAddr(header.Number, p.chainConfig), new(big.Int), header.GasLimit, new(big.Int), data)
+		tx, err = p.signSystemTx(chain, tx)
+		if err != nil {
+			return nil, nil, err
+		}
+		//add nonce for validator
+		state.SetNonce(header.Coinbase, nonce+1)
+		receipt := p.executeEvidenceMsg(chain, header, state, data, totalTxIndex, tx.Hash(), common.Hash{})
+
+		// Blocks assembled without a validator key are never sealed, the
+		// evidence is left for the next sealed block
+		if sealing {
+			p.doubleSigns.submit(evidence, number)
+		}
+
+		return tx, receipt, nil
+	}
+	return nil, nil, nil
+}
+
+// replayDoubleSignEvidence checks and applies a double sign evidence
+// transaction of an imported block.
+func (p *Dpos) replayDoubleSignEvidence(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, totalTxIndex int, tx *types.Transaction) (*types.Receipt, error) {
+	sender, err := types.Sender(p.signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != header.Coinbase {
+		return nil, errors.New("invalid sender for double sign evidence transaction")
+	}
+	// The evidence follows the selector and the validator argument of punish
+	data := tx.Data()
+	if len(data) < 4+32 {
+		return nil, errInvalidEvidenceTx
+	}
+	evidence := new(Evidence)
+	if err := rlp.DecodeBytes(data[4+32:], evidence); err != nil {
+		return nil, errInvalidEvidence
+	}
+	signer, err := p.verifyEvidence(chain, header, evidence)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := p.evidenceData(signer, evidence)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(data, expected) {
+		return nil, errInvalidEvidenceTx
+	}
+	nonce := state.GetNonce(sender)
+	//add nonce for validator
+	state.SetNonce(sender, nonce+1)
+	receipt := p.executeEvidenceMsg(chain, header, state, data, totalTxIndex, tx.Hash(), header.Hash())
+
+	// The double sign is punished, don't submit it again locally
+	p.doubleSigns.drop(evidence)
+
+	return receipt, nil
+}
+
+// executeEvidenceMsg submits a double sign evidence to the punish contract. The
+// returned receipt is never nil.
+func (p *Dpos) executeEvidenceMsg(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, data []byte, totalTxIndex int, txHash, bHash common.Hash) *types.Receipt {
+	msg := types.NewMessage(header.Coinbase, systemcontract.GetPunishAddr(header.Number, p.chainConfig), 0, new(big.Int), header.GasLimit, new(big.Int), data, nil, false)
+	state.Prepare(txHash, bHash, totalTxIndex)
+	_, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig)
+	state.Finalise(true)
+
+	// double sign evidence transaction will not actually consumes gas
+	receipt := types.NewReceipt([]byte{}, err != nil, header.GasUsed)
+	// Set the receipt logs and create a bloom for filtering
+	receipt.Logs = state.GetLogs(txHash)
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	receipt.TxHash = txHash
+	receipt.BlockHash = state.BlockHash()
+	receipt.BlockNumber = header.Number
+	receipt.TransactionIndex = uint(state.TxIndex())
+
+	log.Info("executeEvidenceMsg", "number", header.Number, "validator", header.Coinbase, "txHash", txHash.String(), "err", err)
+
+	return receipt
+}
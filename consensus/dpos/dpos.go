@@ -28,9 +28,11 @@ import (
 	"github.com/ethereum/go-ethereum/common/gopool"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/por"
 	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
 	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
 	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/forkid"
 	"github.com/ethereum/go-ethereum/core/state"
@@ -66,14 +68,28 @@ const (
 	inmemoryBlacklist   = 21 // Number of recent blacklist snapshots to keep in memory
 )
 
-type blacklistDirection uint
+// BlacklistDirection tells which transactions of a blacklisted address are denied.
+type BlacklistDirection uint
 
 const (
-	DirectionFrom blacklistDirection = iota
+	DirectionFrom BlacklistDirection = iota
 	DirectionTo
 	DirectionBoth
 )
 
+func (d BlacklistDirection) String() string {
+	switch d {
+	case DirectionFrom:
+		return "from"
+	case DirectionTo:
+		return "to"
+	case DirectionBoth:
+		return "both"
+	default:
+		return "unknown"
+	}
+}
+
 var (
 	uncleHash  = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
 	diffInTurn = big.NewInt(2)            // Block difficulty for in-turn signatures
@@ -86,6 +102,7 @@ var (
 		systemcontract.AddressListContractAddr: true,
 		systemcontract.PunishV1ContractAddr:    true,
 		systemcontract.SysGovContractAddr:      true,
+		systemcontract.SysGovToAddr:            true,
 	}
 )
 
@@ -171,6 +188,10 @@ var (
 	errInvalidCoinbase = errors.New("Invalid coin base")
 
 	errInvalidSysGovCount = errors.New("invalid system governance tx count")
+
+	// errSignerUnavailable is returned if the validator key can't be used to sign,
+	// e.g. because the external signer holding it is down or denies the request.
+	errSignerUnavailable = errors.New("validator signer unavailable")
 )
 
 var (
@@ -181,6 +202,9 @@ var (
 // backing account.
 type StateFn func(hash common.Hash) (*state.StateDB, error)
 
+// PendingFn returns the pending block and the state after it, nil if there is none.
+type PendingFn func() (*types.Block, *state.StateDB)
+
 type SignerFn func(accounts.Account, string, []byte) ([]byte, error)
 type SignerTxFn func(accounts.Account, *types.Transaction, *big.Int) (*types.Transaction, error)
 
@@ -253,7 +277,16 @@ type Dpos struct {
 	ethAPI          *ethapi.PublicBlockChainAPI
 	validatorSetABI abi.ABI
 	slashABI        abi.ABI
-	stateFn         StateFn // Function to get state by state root
+	stateFn         StateFn             // Function to get state by state root
+	pendingFn       PendingFn           // Function to get the pending block and state
+	light           bool                // Whether headers are verified without state, as light clients do
+	headerFn        HeaderFn            // Function to get the canonical headers missing in light mode
+	proofFn         ValidatorProofFn    // Function to get the proofs of the epoch validators in light mode
+	challenger      *por.Challenger     // Proof-of-Resources challenger of the local validators
+	doubleSigns     *doubleSignMonitor  // Double signs waiting to be punished
+	slashing        *SlashingProtection // Highest blocks signed by the local validators
+	predecessor     *parlia.Parlia      // Engine sealing the blocks before the dpos switch, nil if none
+	now             func() time.Time    // Clock the block times are checked against
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
 }
@@ -308,12 +341,17 @@ func New(
 		signer:          types.NewEIP155Signer(chainConfig.ChainID),
 		signTxFns:       make(map[common.Address]SignerTxFn, 0),
 		signFns:         make(map[common.Address]SignerFn, 0),
+		doubleSigns:     newDoubleSignMonitor(),
+		now:             time.Now,
 	}
 
 	return c
 }
 
 func (p *Dpos) IsSystemTransaction(tx *types.Transaction, header *types.Header) (bool, error) {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.IsSystemTransaction(tx, header)
+	}
 	// deploy a contract
 	if tx.To() == nil {
 		return false, nil
@@ -332,12 +370,34 @@ func (p *Dpos) IsSystemContract(to *common.Address) bool {
 	if to == nil {
 		return false
 	}
+	if p.predecessor != nil && p.predecessor.IsSystemContract(to) {
+		return true
+	}
 	return isToSystemContract(*to)
 }
 
 // SetStateFn sets the function to get state.
 func (p *Dpos) SetStateFn(fn StateFn) {
 	p.stateFn = fn
+	if p.predecessor != nil {
+		p.predecessor.SetStateFn(parlia.StateFn(fn))
+	}
+}
+
+// SetPendingFn sets the function to get the pending block and state.
+func (p *Dpos) SetPendingFn(fn PendingFn) {
+	p.pendingFn = fn
+}
+
+// SetClock replaces the wall clock the engine checks block times against, which
+// lets simulated chains seal blocks on a timeline of their own.
+func (p *Dpos) SetClock(now func() time.Time) {
+	p.now = now
+}
+
+// SetSlashingProtection sets the store refusing to seal conflicting headers.
+func (p *Dpos) SetSlashingProtection(slashing *SlashingProtection) {
+	p.slashing = slashing
 }
 
 // Author implements consensus.Engine, returning the SystemAddress
@@ -347,6 +407,9 @@ func (p *Dpos) Author(header *types.Header) (common.Address, error) {
 
 // VerifyHeader checks whether a header conforms to the consensus rules.
 func (p *Dpos) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.VerifyHeader(chain, header, seal)
+	}
 	return p.verifyHeader(chain, header, nil)
 }
 
@@ -359,8 +422,12 @@ func (p *Dpos) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types
 
 	gopool.Submit(func() {
 		for i, header := range headers {
-			err := p.verifyHeader(chain, header, headers[:i])
-
+			var err error
+			if p.isPredecessor(header.Number) {
+				err = p.predecessor.VerifyHeaderWithParents(chain, header, headers[:i])
+			} else {
+				err = p.verifyHeader(chain, header, headers[:i])
+			}
 			select {
 			case <-abort:
 				return
@@ -382,7 +449,7 @@ func (p *Dpos) verifyHeader(chain consensus.ChainHeaderReader, header *types.Hea
 	number := header.Number.Uint64()
 
 	// Don't waste time checking blocks from the future
-	if header.Time > uint64(time.Now().Unix()) {
+	if header.Time > uint64(p.now().Unix()) {
 		return consensus.ErrFutureBlock
 	}
 	// Check that the extra-data contains the vanity, validators and signature.
@@ -480,8 +547,32 @@ func (p *Dpos) verifyCascadingFields(chain consensus.ChainHeaderReader, header *
 		return fmt.Errorf("invalid gas limit: have %d, want %d += %d", header.GasLimit, parent.GasLimit, limit)
 	}
 
-	// All basic checks passed, verify the seal and return
-	return p.verifySeal(chain, header, parents)
+	// All basic checks passed, verify the seal
+	if err := p.verifySeal(chain, header, parents); err != nil {
+		return err
+	}
+	// Without state, epoch validators can only be checked against their proof
+	if p.light && number%p.config.Epoch == 0 {
+		return p.verifyEpochValidators(chain, header, parent)
+	}
+	return nil
+}
+
+// Snapshot retrieves the validator set snapshot at the given block, looking up
+// the headers missing from the database in parents (ascending order).
+func (p *Dpos) Snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	return p.snapshot(chain, number, hash, parents)
+}
+
+// ImportSnapshot makes the engine use the given snapshot for the block it was
+// taken at, instead of deriving it from the chain. This lets blocks be processed
+// on top of a parent whose ancestors are unknown.
+func (p *Dpos) ImportSnapshot(snap *Snapshot) {
+	snap = snap.copy()
+	snap.config = p.config
+	snap.sigCache = p.signatures
+	snap.ethAPI = p.ethAPI
+	p.recentSnaps.Add(snap.Hash, snap)
 }
 
 // snapshot retrieves the authorization snapshot at a given point in time.
@@ -508,6 +599,17 @@ func (p *Dpos) snapshot(chain consensus.ChainHeaderReader, number uint64, hash c
 			}
 		}
 
+		// If we're before the dpos switch, carry over the validators of the
+		// predecessor engine
+		if p.isPredecessor(new(big.Int).SetUint64(number)) {
+			s, err := p.predecessorSnapshot(chain, number, hash, parents)
+			if err != nil {
+				return nil, err
+			}
+			snap = s
+			break
+		}
+
 		// If we're at the genesis, snapshot the initial state.
 		if number == 0 {
 			checkpoint := chain.GetHeaderByNumber(number)
@@ -544,6 +646,16 @@ func (p *Dpos) snapshot(chain consensus.ChainHeaderReader, number uint64, hash c
 		} else {
 			// No explicit parents (or no more left), reach out to the database
 			header = chain.GetHeader(hash, number)
+			if header == nil && p.light {
+				// Light clients sync from a trusted checkpoint, without the
+				// headers before it
+				s, err := p.lightSnapshot(number, hash)
+				if err != nil {
+					return nil, err
+				}
+				snap = s
+				break
+			}
 			if header == nil {
 				return nil, consensus.ErrUnknownAncestor
 			}
@@ -590,6 +702,9 @@ func (p *Dpos) VerifyUncles(chain consensus.ChainReader, block *types.Block) err
 // VerifySeal implements consensus.Engine, checking whether the signature contained
 // in the header satisfies the consensus protocol requirements.
 func (p *Dpos) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.VerifySeal(chain, header)
+	}
 	return p.verifySeal(chain, header, nil)
 }
 
@@ -622,6 +737,8 @@ func (p *Dpos) verifySeal(chain consensus.ChainHeaderReader, header *types.Heade
 	if _, ok := snap.Validators[signer]; !ok {
 		return errUnauthorizedValidator
 	}
+	// Track the sealed header to catch validators signing conflicting blocks
+	p.doubleSigns.observe(signer, header)
 
 	for seen, recent := range snap.Recents {
 		if recent == signer {
@@ -668,6 +785,9 @@ func (p *Dpos) CheckHasInTurn(chain consensus.ChainHeaderReader, coinbases []com
 // Prepare implements consensus.Engine, preparing all the consensus fields of the
 // header for running the transactions on top.
 func (p *Dpos) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.Prepare(chain, header)
+	}
 	//fmt.Println("prepare1")
 	header.Coinbase = p.val
 	//log.Info(header.Coinbase.String())
@@ -714,28 +834,19 @@ func (p *Dpos) Prepare(chain consensus.ChainHeaderReader, header *types.Header)
 		return consensus.ErrUnknownAncestor
 	}
 	header.Time = p.blockTimeForRamanujanFork(snap, header, parent)
-	if header.Time < uint64(time.Now().Unix()) {
-		header.Time = uint64(time.Now().Unix())
+	if now := uint64(p.now().Unix()); header.Time < now {
+		header.Time = now
 	}
 
 	return nil
 }
 
-// Finalize implements consensus.Engine, ensuring no uncles are set, nor block
-// rewards given.
+// Finalize implements consensus.Engine, replaying the system calls of the block
+// and ensuring no uncles are set.
 func (p *Dpos) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs *[]*types.Transaction,
 	uncles []*types.Header, receipts *[]*types.Receipt, systemTxs *[]*types.Transaction, usedGas *uint64) error {
-	// Initialize all system contracts at block 1.
-	if header.Number.Cmp(common.Big1) == 0 {
-		if err := p.initializeSystemContracts(chain, header, state); err != nil {
-			log.Error("Initialize system contracts failed", "err", err)
-			return err
-		}
-	}
-	if header.Difficulty.Cmp(diffInTurn) != 0 {
-		if err := p.tryPunishValidator(chain, header, state); err != nil {
-			return err
-		}
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.Finalize(chain, header, state, txs, uncles, receipts, systemTxs, usedGas)
 	}
 	// avoid nil pointer
 	if txs == nil {
@@ -747,16 +858,6 @@ func (p *Dpos) Finalize(chain consensus.ChainHeaderReader, header *types.Header,
 		receipts = &rs
 	}
 
-	// execute block reward tx.
-	//if len(*txs) > 0 {
-	if header.Number.Cmp(common.Big3) > 0 {
-		if err := p.trySendBlockReward(chain, header, state); err != nil {
-			return err
-		}
-	}
-
-	//}
-
 	// warn if not in majority fork
 	number := header.Number.Uint64()
 	snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
@@ -767,106 +868,21 @@ func (p *Dpos) Finalize(chain consensus.ChainHeaderReader, header *types.Header,
 	if !snap.isMajorityFork(hex.EncodeToString(nextForkHash[:])) {
 		log.Debug("there is a possible fork, and your client is not the majority. Please check...", "nextForkHash", hex.EncodeToString(nextForkHash[:]))
 	}
-	// If the block is a epoch end block, verify the validator list
-	// The verification can only be done when the state is ready, it can't be done in VerifyHeader.
-	if header.Number.Uint64()%p.config.Epoch == 0 {
 
-		newValidators, err := p.doSomethingAtEpoch(chain, header, state)
-		if err != nil {
-			return err
-		}
-
-		validatorsBytes := make([]byte, len(newValidators)*common.AddressLength)
-
-		//newValidators, err := p.getCurrentValidators(header.ParentHash)
-		//if err != nil {
-		//	return err
-		//}
-		// sort validator by address
-		//sort.Sort(validatorsAscending(newValidators))
-		//validatorsBytes := make([]byte, len(newValidators)*validatorBytesLength)
-		for i, validator := range newValidators {
-			copy(validatorsBytes[i*validatorBytesLength:], validator.Bytes())
-		}
-
-		extraSuffix := len(header.Extra) - extraSeal
-		if !bytes.Equal(header.Extra[extraVanity:extraSuffix], validatorsBytes) {
-			return errMismatchingEpochValidators
-		}
+	ctx := &systemContext{
+		chain:    chain,
+		header:   header,
+		state:    state,
+		txs:      txs,
+		receipts: receipts,
 	}
-	// No block rewards in PoA, so the state remains as is and uncles are dropped
-	//cx := chainContext{Chain: chain, dpos: p}
-	//if header.Number.Cmp(common.Big1) == 0 {
-	//	err := p.initContract(state, header, cx, txs, receipts, systemTxs, usedGas, false)
-	//	if err != nil {
-	//		log.Error("init contract failed")
-	//	}
-	//}
-
-	//handle system governance Proposal
-	if chain.Config().IsRedCoast(header.Number) {
-		proposalCount, err := p.getPassedProposalCount(chain, header, state)
-		if err != nil {
-			return err
-		}
-		if proposalCount != uint32(len(*systemTxs)) {
-			return errInvalidSysGovCount
-		}
-		// Due to the logics of the finish operation of contract `governance`, when finishing a proposal which
-		// is not the last passed proposal, it will change the sequence. So in here we must first executes all
-		// passed proposals, and then finish then all.
-		pIds := make([]*big.Int, 0, proposalCount)
-		for i := uint32(0); i < proposalCount; i++ {
-			prop, err := p.getPassedProposalByIndex(chain, header, state, i)
-			if err != nil {
-				return err
-			}
-			// execute the system governance Proposal
-			tx := (*systemTxs)[int(i)]
-			receipt, err := p.replayProposal(chain, header, state, prop, len(*txs), tx)
-			if err != nil {
-				return err
-			}
-			*txs = append(*txs, tx)
-			*receipts = append(*receipts, receipt)
-			// set
-			pIds = append(pIds, prop.Id)
-		}
-		// Finish all proposal
-		for i := uint32(0); i < proposalCount; i++ {
-			err = p.finishProposalById(chain, header, state, pIds[i])
-			if err != nil {
-				return err
-			}
-		}
+	if systemTxs != nil {
+		ctx.pending = *systemTxs
+	}
+	if err := p.runSystemActions(ctx); err != nil {
+		return err
 	}
 
-	//if header.Difficulty.Cmp(diffInTurn) != 0 {
-	//		spoiledVal := snap.supposeValidator()
-	//		signedRecently := false
-	//		for _, recent := range snap.Recents {
-	//			if recent == spoiledVal {
-	//				signedRecently = true
-	//				break
-	//			}
-	//		}
-	//		if !signedRecently {
-	//			log.Trace("slash validator", "block hash", header.Hash(), "address", spoiledVal)
-	//			err = p.slash(spoiledVal, state, header, cx, txs, receipts, systemTxs, usedGas, false)
-	//			if err != nil {
-	//				// it is possible that slash validator failed because of the slash channel is disabled.
-	//				log.Error("slash validator failed", "block hash", header.Hash(), "address", spoiledVal)
-	//			}
-	//		}
-	//	}
-	//	val := header.Coinbase
-	//	err = p.distributeIncoming(val, state, header, cx, txs, receipts, systemTxs, usedGas, false)
-	//	if err != nil {
-	//		return err
-	//	}
-	//	if len(*systemTxs) > 0 {
-	//		return errors.New("the length of systemTxs do not match")
-	//	}
 	// No block rewards in PoA, so the state remains as is and uncles are dropped
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
@@ -874,92 +890,29 @@ func (p *Dpos) Finalize(chain consensus.ChainHeaderReader, header *types.Header,
 	return nil
 }
 
-// FinalizeAndAssemble implements consensus.Engine, ensuring no uncles are set,
-// nor block rewards given, and returns the final block.
+// FinalizeAndAssemble implements consensus.Engine, running the system calls of
+// the block, ensuring no uncles are set, and returns the final block.
 func (p *Dpos) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB,
 	txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (b *types.Block, rs []*types.Receipt, err error) {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.FinalizeAndAssemble(chain, header, state, txs, uncles, receipts)
+	}
 	defer func() {
 		if err != nil {
 			log.Warn("FinalizeAndAssemble failed", "err", err)
 		}
 	}()
-	// Initialize all system contracts at block 1.
-	if header.Number.Cmp(common.Big1) == 0 {
-		if err := p.initializeSystemContracts(chain, header, state); err != nil {
 
-			panic(err)
-		}
+	ctx := &systemContext{
+		chain:    chain,
+		header:   header,
+		state:    state,
+		mining:   true,
+		txs:      &txs,
+		receipts: &receipts,
 	}
-
-	// punish validator if necessary
-	if header.Difficulty.Cmp(diffInTurn) != 0 {
-		if err := p.tryPunishValidator(chain, header, state); err != nil {
-
-			panic(err)
-		}
-	}
-
-	// deposit block reward if any tx exists.
-	//if len(txs) > 0 {
-	if header.Number.Cmp(common.Big3) > 0 {
-		if err := p.trySendBlockReward(chain, header, state); err != nil {
-
-			panic(err)
-		}
-	}
-
-	//}
-
-	// do epoch thing at the end, because it will update active validators
-	if header.Number.Uint64()%p.config.Epoch == 0 {
-		if _, err := p.doSomethingAtEpoch(chain, header, state); err != nil {
-
-			panic(err)
-		}
-	}
-
-	//handle system governance Proposal
-	//
-	// Note:
-	// Even if the miner is not `running`, it's still working,
-	// the 'miner.worker' will try to FinalizeAndAssemble a block,
-	// in this case, the signTxFn is not set. A `non-miner node` can't execute system governance proposal.
-	if p.signTxFn != nil && chain.Config().IsRedCoast(header.Number) {
-		proposalCount, err := p.getPassedProposalCount(chain, header, state)
-		if err != nil {
-
-			return nil, nil, err
-		}
-
-		// Due to the logics of the finish operation of contract `governance`, when finishing a proposal which
-		// is not the last passed proposal, it will change the sequence. So in here we must first executes all
-		// passed proposals, and then finish then all.
-		pIds := make([]*big.Int, 0, proposalCount)
-		for i := uint32(0); i < proposalCount; i++ {
-			prop, err := p.getPassedProposalByIndex(chain, header, state, i)
-			if err != nil {
-
-				return nil, nil, err
-			}
-			// execute the system governance Proposal
-			tx, receipt, err := p.executeProposal(chain, header, state, prop, len(txs))
-			if err != nil {
-
-				return nil, nil, err
-			}
-			txs = append(txs, tx)
-			receipts = append(receipts, receipt)
-			// set
-			pIds = append(pIds, prop.Id)
-		}
-		// Finish all proposal
-		for i := uint32(0); i < proposalCount; i++ {
-			err = p.finishProposalById(chain, header, state, pIds[i])
-			if err != nil {
-
-				return nil, nil, err
-			}
-		}
+	if err := p.runSystemActions(ctx); err != nil {
+		return nil, nil, err
 	}
 
 	// No block rewards in PoA, so the state remains as is and uncles are dropped
@@ -967,80 +920,23 @@ func (p *Dpos) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *ty
 	header.UncleHash = types.CalcUncleHash(nil)
 
 	// Assemble and return the final block for sealing
-
 	return types.NewBlock(header, txs, nil, receipts, new(trie.Trie)), receipts, nil
-	// No block rewards in PoA, so the state remains as is and uncles are dropped
-	//	cx := chainContext{Chain: chain, dpos: p}
-	//	if txs == nil {
-	//		txs = make([]*types.Transaction, 0)
-	//	}
-	//	if receipts == nil {
-	//		receipts = make([]*types.Receipt, 0)
-	//	}
-	//	if header.Number.Cmp(common.Big1) == 0 {
-	//		err := p.initContract(state, header, cx, &txs, &receipts, nil, &header.GasUsed, true)
-	//		if err != nil {
-	//			log.Error("init contract failed")
-	//		}
-	//	}
-	//	if header.Difficulty.Cmp(diffInTurn) != 0 {
-	//		number := header.Number.Uint64()
-	//		snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
-	//		if err != nil {
-	//			return nil, nil, err
-	//		}
-	//		spoiledVal := snap.supposeValidator()
-	//		signedRecently := false
-	//		for _, recent := range snap.Recents {
-	//			if recent == spoiledVal {
-	//				signedRecently = true
-	//				break
-	//			}
-	//		}
-	//		if !signedRecently {
-	//			err = p.slash(spoiledVal, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true)
-	//			if err != nil {
-	//				// it is possible that slash validator failed because of the slash channel is disabled.
-	//				log.Error("slash validator failed", "block hash", header.Hash(), "address", spoiledVal)
-	//			}
-	//		}
-	//	}
-	//	err := p.distributeIncoming(p.val, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true)
-	//	if err != nil {
-	//		return nil, nil, err
-	//	}
-	//	// should not happen. Once happen, stop the node is better than broadcast the block
-	//	if header.GasLimit < header.GasUsed {
-	//		return nil, nil, errors.New("gas consumption of system txs exceed the gas limit")
-	//	}
-	//	header.UncleHash = types.CalcUncleHash(nil)
-	//	var blk *types.Block
-	//	var rootHash common.Hash
-	//	wg := sync.WaitGroup{}
-	//	wg.Add(2)
-	//	go func() {
-	//		rootHash = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
-	//		wg.Done()
-	//	}()
-	//	go func() {
-	//		blk = types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil))
-	//		wg.Done()
-	//	}()
-	//	wg.Wait()
-	//	blk.SetRoot(rootHash)
-	//	// Assemble and return the final block for sealing
-	//	return blk, receipts, nil
-}
-
-func (p *Dpos) trySendBlockReward(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
+}
+
+func (p *Dpos) trySendBlockReward(ctx *systemContext) error {
+	header, state := ctx.header, ctx.state
 	fee := state.GetBalance(consensus.SystemAddress)
 	/*
 		if fee.Cmp(common.Big0) <= 0 {
 			return nil
 		}
 	*/
+	subsidy, fee, poolFee := p.blockRewards(header.Number, fee)
+	if poolFee.Sign() > 0 {
+		state.AddBalance(p.config.Reward.SystemPool, poolFee)
+	}
 	// Miner will send tx to deposit block fees to contract, add to his balance first.
-	reward := new(big.Int).Add(fee, new(big.Int).Mul(big.NewInt(10), big.NewInt(params.Ether)))
+	reward := new(big.Int).Add(fee, subsidy)
 	state.AddBalance(header.Coinbase, reward)
 	// reset fee
 	state.SetBalance(consensus.SystemAddress, common.Big0)
@@ -1052,19 +948,12 @@ func (p *Dpos) trySendBlockReward(chain consensus.ChainHeaderReader, header *typ
 		return err
 	}
 
-	nonce := state.GetNonce(header.Coinbase)
-	msg := types.NewMessage(header.Coinbase, systemcontract.GetValidatorAddr(header.Number, p.chainConfig), nonce, reward, math.MaxUint64, new(big.Int), data, nil, true)
-
-	if _, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig); err != nil {
-		return err
-	}
-
-	return nil
+	return p.systemCall(ctx, *systemcontract.GetValidatorAddr(header.Number, p.chainConfig), reward, data)
 }
 
-func (p *Dpos) tryPunishValidator(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
-	number := header.Number.Uint64()
-	snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
+func (p *Dpos) tryPunishValidator(ctx *systemContext) error {
+	number := ctx.header.Number.Uint64()
+	snap, err := p.snapshot(ctx.chain, number-1, ctx.header.ParentHash, nil)
 	if err != nil {
 		return err
 	}
@@ -1079,7 +968,7 @@ func (p *Dpos) tryPunishValidator(chain consensus.ChainHeaderReader, header *typ
 		}
 	}
 	if !signedRecently {
-		if err := p.punishValidator(outTurnValidator, chain, header, state); err != nil {
+		if err := p.punishValidator(outTurnValidator, ctx); err != nil {
 			return err
 		}
 	}
@@ -1087,18 +976,18 @@ func (p *Dpos) tryPunishValidator(chain consensus.ChainHeaderReader, header *typ
 	return nil
 }
 
-func (p *Dpos) doSomethingAtEpoch(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) ([]common.Address, error) {
-	newSortedValidators, err := p.getTopValidators(chain, header)
+func (p *Dpos) doSomethingAtEpoch(ctx *systemContext) ([]common.Address, error) {
+	newSortedValidators, err := p.getTopValidators(ctx.chain, ctx.header)
 	if err != nil {
 		return []common.Address{}, err
 	}
 
 	// update contract new validators if new set exists
-	if err := p.updateValidators(newSortedValidators, chain, header, state); err != nil {
+	if err := p.updateValidators(newSortedValidators, ctx); err != nil {
 		return []common.Address{}, err
 	}
 	//  decrease validator missed blocks counter at epoch
-	if err := p.decreaseMissedBlocksCounter(chain, header, state); err != nil {
+	if err := p.decreaseMissedBlocksCounter(ctx); err != nil {
 		return []common.Address{}, err
 	}
 
@@ -1118,6 +1007,12 @@ func (p *Dpos) initializeSystemContracts(chain consensus.ChainHeaderReader, head
 		return errInvalidValidatorsLength
 	}
 
+	// Chains configuring their own admin hand it the address list as well,
+	// others have it initialized out of band
+	admin := systemcontract.FactoryAdminAddr
+	if p.config.Admin != (common.Address{}) {
+		admin = p.config.Admin
+	}
 	method := "initialize"
 	contracts := []struct {
 		addr    common.Address
@@ -1125,12 +1020,20 @@ func (p *Dpos) initializeSystemContracts(chain consensus.ChainHeaderReader, head
 	}{
 		{systemcontract.PunishV1ContractAddr, func() ([]byte, error) { return p.abi[systemcontract.PunishV1ContractName].Pack(method) }},
 		{systemcontract.SysGovContractAddr, func() ([]byte, error) {
-			return p.abi[systemcontract.SysGovContractName].Pack(method, systemcontract.FactoryAdminAddr)
+			return p.abi[systemcontract.SysGovContractName].Pack(method, admin)
 		}},
 		{systemcontract.DposFactoryContractAddr, func() ([]byte, error) {
-			return p.abi[systemcontract.DposFactoryContractName].Pack(method, genesisValidators, systemcontract.FactoryAdminAddr)
+			return p.abi[systemcontract.DposFactoryContractName].Pack(method, genesisValidators, admin)
 		}},
 	}
+	if p.config.Admin != (common.Address{}) {
+		contracts = append(contracts, struct {
+			addr    common.Address
+			packFun func() ([]byte, error)
+		}{systemcontract.AddressListContractAddr, func() ([]byte, error) {
+			return p.abi[systemcontract.AddressListContractName].Pack(method, admin)
+		}})
+	}
 	i := 0
 	for _, contract := range contracts {
 		i += 1
@@ -1141,10 +1044,8 @@ func (p *Dpos) initializeSystemContracts(chain consensus.ChainHeaderReader, head
 		nonce := state.GetNonce(header.Coinbase)
 		msg := types.NewMessage(header.Coinbase, &contract.addr, nonce, new(big.Int), math.MaxUint64, new(big.Int), data, nil, true)
 		//fmt.Println("init",contract.addr,data)
-		if result, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig); err != nil {
+		if _, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig); err != nil {
 			return err
-		} else {
-			fmt.Println("vv is ", hex.EncodeToString(result))
 		}
 
 	}
@@ -1163,38 +1064,15 @@ func (p *Dpos) getTopValidators(chain consensus.ChainHeaderReader, header *types
 		return []common.Address{}, err
 	}
 
-	method := "getTopValidators"
-	data, err := p.abi[systemcontract.DposFactoryContractName].Pack(method)
-	if err != nil {
-		log.Error("Can't pack data for getTopValidators", "error", err)
-		return []common.Address{}, err
-	}
-
-	msg := types.NewMessage(header.Coinbase, systemcontract.GetValidatorAddr(parent.Number, p.chainConfig), 0, new(big.Int), math.MaxUint64, new(big.Int), data, nil, false)
-
 	// use parent
-	result, err := vmcaller.ExecuteMsg(msg, statedb, parent, newChainContext(chain, p), p.chainConfig)
+	validators, err := p.readTopValidators(newChainContext(chain, p), parent, statedb)
 	if err != nil {
 		return []common.Address{}, err
 	}
-
-	// unpack data
-	ret, err := p.abi[systemcontract.DposFactoryContractName].Unpack(method, result)
-	if err != nil {
-		return []common.Address{}, err
-	}
-	if len(ret) != 1 {
-		return []common.Address{}, errors.New("Invalid params length")
-	}
-	validators, ok := ret[0].([]common.Address)
-	if !ok {
-		return []common.Address{}, errors.New("Invalid validators format")
-	}
-	sort.Sort(validatorsAscending(validators))
-	return validators, err
+	return validators, nil
 }
 
-func (p *Dpos) updateValidators(vals []common.Address, chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
+func (p *Dpos) updateValidators(vals []common.Address, ctx *systemContext) error {
 	// method
 	method := "updateActiveValidatorSet"
 	data, err := p.abi[systemcontract.DposFactoryContractName].Pack(method, vals, new(big.Int).SetUint64(p.config.Epoch))
@@ -1204,9 +1082,7 @@ func (p *Dpos) updateValidators(vals []common.Address, chain consensus.ChainHead
 	}
 
 	// call contract
-	nonce := state.GetNonce(header.Coinbase)
-	msg := types.NewMessage(header.Coinbase, systemcontract.GetValidatorAddr(header.Number, p.chainConfig), nonce, new(big.Int), math.MaxUint64, new(big.Int), data, nil, true)
-	if _, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig); err != nil {
+	if err := p.systemCall(ctx, *systemcontract.GetValidatorAddr(ctx.header.Number, p.chainConfig), new(big.Int), data); err != nil {
 		log.Error("Can't update validators to contract", "err", err)
 		return err
 	}
@@ -1214,7 +1090,7 @@ func (p *Dpos) updateValidators(vals []common.Address, chain consensus.ChainHead
 	return nil
 }
 
-func (p *Dpos) punishValidator(val common.Address, chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
+func (p *Dpos) punishValidator(val common.Address, ctx *systemContext) error {
 	// method
 	method := "punish"
 	data, err := p.abi[systemcontract.PunishV1ContractName].Pack(method, val)
@@ -1224,9 +1100,7 @@ func (p *Dpos) punishValidator(val common.Address, chain consensus.ChainHeaderRe
 	}
 
 	// call contract
-	nonce := state.GetNonce(header.Coinbase)
-	msg := types.NewMessage(header.Coinbase, systemcontract.GetPunishAddr(header.Number, p.chainConfig), nonce, new(big.Int), math.MaxUint64, new(big.Int), data, nil, true)
-	if _, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig); err != nil {
+	if err := p.systemCall(ctx, *systemcontract.GetPunishAddr(ctx.header.Number, p.chainConfig), new(big.Int), data); err != nil {
 		log.Error("Can't punish validator", "err", err)
 		return err
 	}
@@ -1234,7 +1108,7 @@ func (p *Dpos) punishValidator(val common.Address, chain consensus.ChainHeaderRe
 	return nil
 }
 
-func (p *Dpos) decreaseMissedBlocksCounter(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
+func (p *Dpos) decreaseMissedBlocksCounter(ctx *systemContext) error {
 	// method
 	method := "decreaseMissedBlocksCounter"
 	data, err := p.abi[systemcontract.PunishV1ContractName].Pack(method, new(big.Int).SetUint64(p.config.Epoch))
@@ -1244,9 +1118,7 @@ func (p *Dpos) decreaseMissedBlocksCounter(chain consensus.ChainHeaderReader, he
 	}
 
 	// call contract
-	nonce := state.GetNonce(header.Coinbase)
-	msg := types.NewMessage(header.Coinbase, systemcontract.GetPunishAddr(header.Number, p.chainConfig), nonce, new(big.Int), math.MaxUint64, new(big.Int), data, nil, true)
-	if _, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig); err != nil {
+	if err := p.systemCall(ctx, *systemcontract.GetPunishAddr(ctx.header.Number, p.chainConfig), new(big.Int), data); err != nil {
 		log.Error("Can't decrease missed blocks counter for validator", "err", err)
 		return err
 	}
@@ -1260,31 +1132,76 @@ func (p *Dpos) Authorize(val common.Address, signFn SignerFn, signTxFn SignerTxF
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	p.val = val
 	if signFn != nil {
+		p.val = val
 		p.signFn = signFn
 		p.signTxFn = signTxFn
 		p.signFns[val] = signFn
 		p.signTxFns[val] = signTxFn
 
 	} else {
-		if signFn, ok := p.signFns[val]; ok {
-			p.signFn = signFn
-		} else {
+		// Switching to a key dropped meanwhile must not leave the previous
+		// key's signer behind the new validator address
+		signFn, ok := p.signFns[val]
+		if !ok {
 			return false
 		}
-		if signTxFn, ok := p.signTxFns[val]; ok {
-			p.signTxFn = signTxFn
-		} else {
+		signTxFn, ok := p.signTxFns[val]
+		if !ok {
 			return false
 		}
+		p.val = val
+		p.signFn = signFn
+		p.signTxFn = signTxFn
+	}
+	// Blocks before the dpos switch are sealed by the predecessor engine
+	if p.predecessor != nil {
+		p.predecessor.Authorize(p.val, parlia.SignerFn(p.signFn), parlia.SignerTxFn(p.signTxFn))
+	}
+	return true
+}
+
+// Deauthorize drops the signing key of a validator from the consensus engine,
+// which stops minting blocks with it.
+func (p *Dpos) Deauthorize(val common.Address) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
+	delete(p.signFns, val)
+	delete(p.signTxFns, val)
+	if p.val == val {
+		p.val = common.Address{}
+		p.signFn = nil
+		p.signTxFn = nil
+		if p.predecessor != nil {
+			p.predecessor.Authorize(common.Address{}, nil, nil)
+		}
 	}
+}
 
-	return true
+// InTurnValidator returns the validator expected to seal the given header in
+// turn.
+func (p *Dpos) InTurnValidator(chain consensus.ChainHeaderReader, header *types.Header) (common.Address, error) {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return common.Address{}, errUnknownBlock
+	}
+	snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	validators := snap.validators()
+	return validators[(snap.Number+1)%uint64(len(validators))], nil
 }
 
 func (p *Dpos) Delay(chain consensus.ChainReader, header *types.Header) *time.Duration {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.Delay(chain, header)
+	}
+	// 0-period chains seal as soon as transactions arrive, there is no deadline
+	if p.config.Period == 0 {
+		return nil
+	}
 	number := header.Number.Uint64()
 	snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
 	if err != nil {
@@ -1298,7 +1215,9 @@ func (p *Dpos) Delay(chain consensus.ChainReader, header *types.Header) *time.Du
 // the local signing credentials.
 func (p *Dpos) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
 	header := block.Header()
-
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.Seal(chain, block, results, stop)
+	}
 	// Sealing the genesis block is not supported
 	number := header.Number.Uint64()
 	if number == 0 {
@@ -1348,9 +1267,19 @@ func (p *Dpos) Seal(chain consensus.ChainHeaderReader, block *types.Block, resul
 	}
 
 	// Sign all the things!
+	if signFn == nil {
+		return errSignerUnavailable
+	}
+	sealHash := SealHash(header, p.chainConfig.ChainID)
+	if p.slashing != nil {
+		if err := p.slashing.Check(val, number, sealHash); err != nil {
+			return err
+		}
+	}
 	sig, err := signFn(accounts.Account{Address: val}, accounts.MimetypeDpos, DposRLP(header, p.chainConfig.ChainID))
 	if err != nil {
-		return err
+		log.Error("Failed to sign dpos header", "number", number, "val", val, "err", err)
+		return fmt.Errorf("%w: %v", errSignerUnavailable, err)
 	}
 	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
 
@@ -1362,11 +1291,20 @@ func (p *Dpos) Seal(chain consensus.ChainHeaderReader, block *types.Block, resul
 			return
 		case <-time.After(delay):
 		}
-
+		// Record the header before handing it out, so that racing seals of the
+		// same height cannot both get through and a crash after publishing
+		// cannot lose the record. A recorded header that was never published
+		// only blocks its own height.
+		if p.slashing != nil {
+			if err := p.slashing.CheckAndRecord(val, number, sealHash); err != nil {
+				return
+			}
+		}
 		select {
 		case results <- block.WithSeal(header):
+			p.doubleSigns.observe(val, header)
 		default:
-			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header, p.chainConfig.ChainID))
+			log.Warn("Sealing result is not read by miner", "sealhash", sealHash)
 		}
 	}()
 
@@ -1374,6 +1312,9 @@ func (p *Dpos) Seal(chain consensus.ChainHeaderReader, block *types.Block, resul
 }
 
 func (p *Dpos) EnoughDistance(chain consensus.ChainReader, header *types.Header) bool {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.EnoughDistance(chain, header)
+	}
 	snap, err := p.snapshot(chain, header.Number.Uint64()-1, header.ParentHash, nil)
 	if err != nil {
 		return true
@@ -1386,6 +1327,9 @@ func (p *Dpos) IsLocalBlock(header *types.Header) bool {
 }
 
 func (p *Dpos) SignRecently(chain consensus.ChainReader, parent *types.Header) (bool, error) {
+	if p.isPredecessor(new(big.Int).Add(parent.Number, common.Big1)) {
+		return p.predecessor.SignRecently(chain, parent)
+	}
 	snap, err := p.snapshot(chain, parent.Number.Uint64(), parent.ParentHash, nil)
 	if err != nil {
 		return true, err
@@ -1413,6 +1357,9 @@ func (p *Dpos) SignRecently(chain consensus.ChainReader, parent *types.Header) (
 // that a new block should have based on the previous blocks in the chain and the
 // current signer.
 func (p *Dpos) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	if p.isPredecessor(new(big.Int).Add(parent.Number, common.Big1)) {
+		return p.predecessor.CalcDifficulty(chain, time, parent)
+	}
 	snap, err := p.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
 	if err != nil {
 		return nil
@@ -1432,29 +1379,42 @@ func CalcDifficulty(snap *Snapshot, signer common.Address) *big.Int {
 
 // SealHash returns the hash of a block prior to it being sealed.
 func (p *Dpos) SealHash(header *types.Header) common.Hash {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.SealHash(header)
+	}
 	return SealHash(header, p.chainConfig.ChainID)
 }
 
 // APIs implements consensus.Engine, returning the user facing RPC API to query snapshot.
 func (p *Dpos) APIs(chain consensus.ChainHeaderReader) []rpc.API {
-	return []rpc.API{{
+	apis := []rpc.API{{
 		Namespace: "dpos",
 		Version:   "1.0",
 		Service:   &API{chain: chain, dpos: p},
 		Public:    false,
 	}}
+	// Keep serving the history sealed before the dpos switch
+	if p.predecessor != nil {
+		apis = append(apis, p.predecessor.APIs(chain)...)
+	}
+	return apis
 }
 
 // Close implements consensus.Engine. It's a noop for dpos as there are no background threads.
 func (p *Dpos) Close() error {
+	if p.predecessor != nil {
+		return p.predecessor.Close()
+	}
 	return nil
 }
 
 func (p *Dpos) PreHandle(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
-	//if p.chainConfig.RedCoastBlock != nil && p.chainConfig.RedCoastBlock.Cmp(header.Number) == 0 {
-	//	//fmt.Println("PreHandle")
-	//	return systemcontract.ApplySystemContractUpgrade(state, header, newChainContext(chain, p), p.chainConfig)
-	//}
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.PreHandle(chain, header, state)
+	}
+	if err := systemcontract.ApplySystemContractUpgrade(state, header, newChainContext(chain, p), p.chainConfig, p.genesisHash); err != nil {
+		return err
+	}
 	if p.chainConfig.IsBerlin(header.Number) {
 		p.signer = types.NewEIP2930Signer(p.chainConfig.ChainID)
 	}
@@ -1487,6 +1447,9 @@ func (p *Dpos) IsSysTransaction(tx *types.Transaction, header *types.Header) (bo
 // This will queries the system Developers contract, by DIRECTLY to get the target slot value of the contract,
 // it means that it's strongly relative to the layout of the Developers contract's state variables
 func (p *Dpos) CanCreate(state consensus.StateReader, addr common.Address, height *big.Int) bool {
+	if p.isPredecessor(height) {
+		return p.predecessor.CanCreate(state, addr, height)
+	}
 	if p.chainConfig.IsRedCoast(height) && p.config.EnableDevVerification {
 		if isDeveloperVerificationEnabled(state) {
 			slot := calcSlotOfDevMappingKey(addr)
@@ -1501,6 +1464,9 @@ func (p *Dpos) CanCreate(state consensus.StateReader, addr common.Address, heigh
 // ValidateTx do a consensus-related validation on the given transaction at the given header and state.
 // the parentState must be the state of the header's parent block.
 func (p *Dpos) ValidateTx(tx *types.Transaction, header *types.Header, parentState *state.StateDB) error {
+	if p.isPredecessor(header.Number) {
+		return p.predecessor.ValidateTx(tx, header, parentState)
+	}
 	// Must use the parent state for current validation,
 	// so we must starting the validation after redCoastBlock
 	if p.chainConfig.RedCoastBlock != nil && p.chainConfig.RedCoastBlock.Cmp(header.Number) < 0 {
@@ -1514,82 +1480,39 @@ func (p *Dpos) ValidateTx(tx *types.Transaction, header *types.Header, parentSta
 			return err
 		}
 		if d, exist := m[from]; exist && (d != DirectionTo) {
-			return errors.New("address denied")
+			return consensus.ErrAddressDenied
 		}
 		if to := tx.To(); to != nil {
 			if d, exist := m[*to]; exist && (d != DirectionFrom) {
-				return errors.New("address denied")
+				return consensus.ErrAddressDenied
 			}
 		}
 	}
 	return nil
 }
 
-func (p *Dpos) getBlacklist(header *types.Header, parentState *state.StateDB) (map[common.Address]blacklistDirection, error) {
+func (p *Dpos) getBlacklist(header *types.Header, parentState *state.StateDB) (map[common.Address]BlacklistDirection, error) {
 	defer func(start time.Time) {
 		getblacklistTimer.UpdateSince(start)
 	}(time.Now())
 
 	if v, ok := p.blacklists.Get(header.ParentHash); ok {
-		return v.(map[common.Address]blacklistDirection), nil
+		return v.(map[common.Address]BlacklistDirection), nil
 	}
 
 	p.blLock.Lock()
 	defer p.blLock.Unlock()
 	if v, ok := p.blacklists.Get(header.ParentHash); ok {
-		return v.(map[common.Address]blacklistDirection), nil
+		return v.(map[common.Address]BlacklistDirection), nil
 	}
 
-	abi := p.abi[systemcontract.AddressListContractName]
-	get := func(method string) ([]common.Address, error) {
-		data, err := abi.Pack(method)
-		if err != nil {
-			log.Error("Can't pack data ", "method", method, "err", err)
-			return []common.Address{}, err
-		}
-
-		msg := types.NewMessage(header.Coinbase, &systemcontract.AddressListContractAddr, 0, new(big.Int), math.MaxUint64, new(big.Int), data, nil, false)
-
-		// Note: It's safe to use minimalChainContext for executing AddressListContract
-		result, err := vmcaller.ExecuteMsg(msg, parentState, header, newMinimalChainContext(p), p.chainConfig)
-		if err != nil {
-			return []common.Address{}, err
-		}
-
-		// unpack data
-		ret, err := abi.Unpack(method, result)
-		if err != nil {
-			return []common.Address{}, err
-		}
-		if len(ret) != 1 {
-			return []common.Address{}, errors.New("invalid params length")
-		}
-		blacks, ok := ret[0].([]common.Address)
-		if !ok {
-			return []common.Address{}, errors.New("invalid blacklist format")
-		}
-		return blacks, nil
-	}
-	froms, err := get("getBlacksFrom")
-	if err != nil {
-		return nil, err
-	}
-	tos, err := get("getBlacksTo")
+	// Note: It's safe to use minimalChainContext for executing AddressListContract.
+	// The call touches the state, run it on a copy for the cached blacklist not to
+	// leave the state of the first caller diverged from the later ones.
+	m, err := p.readBlacklist(newMinimalChainContext(p), header, parentState.Copy())
 	if err != nil {
 		return nil, err
 	}
-
-	m := make(map[common.Address]blacklistDirection)
-	for _, from := range froms {
-		m[from] = DirectionFrom
-	}
-	for _, to := range tos {
-		if _, exist := m[to]; exist {
-			m[to] = DirectionBoth
-		} else {
-			m[to] = DirectionTo
-		}
-	}
 	p.blacklists.Add(header.ParentHash, m)
 	return m, nil
 }
@@ -1,11 +1,22 @@
 package dpos
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func TestImpactOfValidatorOutOfService(t *testing.T) {
@@ -144,3 +155,257 @@ func randomAddress() common.Address {
 	rand.Read(addrBytes)
 	return common.BytesToAddress(addrBytes)
 }
+
+func TestCanCreate(t *testing.T) {
+	var (
+		admin     = randomAddress()
+		developer = randomAddress()
+		stranger  = randomAddress()
+	)
+	// Mock the AddressList storage layout, slot 0 packs the initialized and enabled
+	// flags with the admin address, the devs mapping lives at DevMappingPosition.
+	newState := func(enabled bool) *state.StateDB {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		slot0 := make([]byte, common.HashLength)
+		copy(slot0[10:30], admin.Bytes())
+		if enabled {
+			slot0[30] = 0x01
+		}
+		slot0[31] = 0x01
+		statedb.SetState(systemcontract.AddressListContractAddr, common.Hash{}, common.BytesToHash(slot0))
+		statedb.SetState(systemcontract.AddressListContractAddr, calcSlotOfDevMappingKey(developer), common.BigToHash(common.Big1))
+		return statedb
+	}
+	testCases := []struct {
+		redCoast   *big.Int
+		verifyDevs bool
+		enabled    bool
+		addr       common.Address
+		allowed    bool
+	}{
+		{big.NewInt(0), true, true, developer, true},
+		{big.NewInt(0), true, true, stranger, false},
+		{big.NewInt(0), true, false, stranger, true},
+		{big.NewInt(0), false, true, stranger, true},
+		{big.NewInt(100), true, true, stranger, true},
+		{nil, true, true, stranger, true},
+	}
+	for i, tc := range testCases {
+		config := &params.ChainConfig{
+			ChainID:       big.NewInt(1),
+			RedCoastBlock: tc.redCoast,
+			Dpos:          &params.DposConfig{Period: 3, Epoch: 200, EnableDevVerification: tc.verifyDevs},
+		}
+		engine := New(config, rawdb.NewMemoryDatabase(), nil, common.Hash{})
+		if allowed := engine.CanCreate(newState(tc.enabled), tc.addr, big.NewInt(1)); allowed != tc.allowed {
+			t.Errorf("test %d: creation permission mismatch: have %v, want %v", i, allowed, tc.allowed)
+		}
+	}
+}
+
+// signHeader creates a header at the given height sealed by key.
+func signHeader(t *testing.T, key *ecdsa.PrivateKey, chainId *big.Int, number int64, time uint64) *types.Header {
+	header := &types.Header{
+		Number:     big.NewInt(number),
+		Time:       time,
+		Coinbase:   crypto.PubkeyToAddress(key.PublicKey),
+		Difficulty: diffInTurn,
+		GasLimit:   8000000,
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	sig, err := crypto.Sign(SealHash(header, chainId).Bytes(), key)
+	if err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	copy(header.Extra[extraVanity:], sig)
+	return header
+}
+
+func TestDoubleSignDetection(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+
+	config := &params.ChainConfig{
+		ChainID: big.NewInt(1),
+		Dpos:    &params.DposConfig{Period: 3, Epoch: 200},
+	}
+	engine := New(config, rawdb.NewMemoryDatabase(), nil, common.Hash{})
+
+	var (
+		headerA = signHeader(t, key, config.ChainID, 10, 100)
+		headerB = signHeader(t, key, config.ChainID, 10, 101)
+		headerC = signHeader(t, key, config.ChainID, 11, 102)
+	)
+	// Sealing the same header twice or different heights isn't a double sign
+	engine.doubleSigns.observe(validator, headerA)
+	engine.doubleSigns.observe(validator, headerA)
+	engine.doubleSigns.observe(validator, headerC)
+	if pending := engine.doubleSigns.pending(); len(pending) != 0 {
+		t.Fatalf("pending evidences mismatch: have %d, want %d", len(pending), 0)
+	}
+	// Sealing two different headers at the same height is
+	engine.doubleSigns.observe(validator, headerB)
+	engine.doubleSigns.observe(validator, headerB)
+	pending := engine.doubleSigns.pending()
+	if len(pending) != 1 {
+		t.Fatalf("pending evidences mismatch: have %d, want %d", len(pending), 1)
+	}
+	if want := newEvidence(headerB, headerA); pending[0].Hash() != want.Hash() {
+		t.Fatalf("evidence mismatch: have %x, want %x", pending[0].Hash(), want.Hash())
+	}
+	if signer, err := pending[0].verify(engine.signatures, config.ChainID); err != nil || signer != validator {
+		t.Fatalf("evidence verification failed: have %x (err %v), want %x", signer, err, validator)
+	}
+	engine.doubleSigns.drop(pending[0])
+	if pending := engine.doubleSigns.pending(); len(pending) != 0 {
+		t.Fatalf("pending evidences mismatch after drop: have %d, want %d", len(pending), 0)
+	}
+
+	// Evidences must prove two different headers of the same height and signer
+	invalid := []*Evidence{
+		{HeaderA: headerA, HeaderB: headerA},
+		{HeaderA: headerA, HeaderB: headerC},
+		{HeaderA: headerA, HeaderB: signHeader(t, other, config.ChainID, 10, 100)},
+		{HeaderA: headerA},
+	}
+	for i, evidence := range invalid {
+		if _, err := evidence.verify(engine.signatures, config.ChainID); err != errInvalidEvidence {
+			t.Errorf("test %d: verification error mismatch: have %v, want %v", i, err, errInvalidEvidence)
+		}
+	}
+}
+
+func TestReplayDoubleSignEvidence(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	offenderKey, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	offender := crypto.PubkeyToAddress(offenderKey.PublicKey)
+
+	config := &params.ChainConfig{
+		ChainID:         big.NewInt(1),
+		DoubleSignBlock: big.NewInt(0),
+		Dpos:            &params.DposConfig{Period: 3, Epoch: 200},
+	}
+	engine := New(config, rawdb.NewMemoryDatabase(), nil, common.Hash{})
+	punishABI := engine.abi[systemcontract.PunishV1ContractName]
+
+	// Build the chain the evidences are replayed upon. The offender is only a
+	// validator when sealing blocks 1000 and 2000.
+	reader := newTestChainReader(config, engine)
+	parent := &types.Header{Number: new(big.Int), Difficulty: diffInTurn}
+	for number := int64(1); number < 2024; number++ {
+		reader.headers[parent.Hash()] = parent
+		parent = &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(number), Difficulty: diffInTurn}
+	}
+	reader.headers[parent.Hash()] = parent
+	for _, number := range []uint64{999, 1499, 1999} {
+		ancestor := reader.GetHeaderByNumber(number)
+		validators := []common.Address{validator, offender}
+		if number == 1499 {
+			validators = validators[:1]
+		}
+		engine.recentSnaps.Add(ancestor.Hash(), newSnapshot(config.Dpos, engine.signatures, number, ancestor.Hash(), validators, nil))
+	}
+	evidence := func(number int64) *Evidence {
+		return newEvidence(
+			signHeader(t, offenderKey, config.ChainID, number, 100),
+			signHeader(t, offenderKey, config.ChainID, number, 101),
+		)
+	}
+	encode := func(number int64) []byte {
+		enc, err := rlp.EncodeToBytes(evidence(number))
+		if err != nil {
+			t.Fatalf("failed to encode evidence: %v", err)
+		}
+		return enc
+	}
+	pack := func(method string, args ...interface{}) []byte {
+		data, err := punishABI.Pack(method, args...)
+		if err != nil {
+			t.Fatalf("failed to pack %s: %v", method, err)
+		}
+		return data
+	}
+	newTx := func(signer *ecdsa.PrivateKey, data ...[]byte) *types.Transaction {
+		tx := types.NewTransaction(0, systemcontract.PunishV1ContractAddr, new(big.Int), 1000000, new(big.Int), bytes.Join(data, nil))
+		tx, _ = types.SignTx(tx, engine.signer, signer)
+		return tx
+	}
+	testCases := []struct {
+		tx    *types.Transaction
+		valid bool
+	}{
+		{newTx(key, pack("punish", offender), encode(2000)), true},                               // recent double sign
+		{newTx(key, pack("punish", offender), encode(1000)), true},                               // oldest punishable double sign
+		{newTx(key, pack("punish", offender), encode(999)), false},                               // expired double sign
+		{newTx(key, pack("punish", offender), encode(2024)), false},                              // double sign of the block itself
+		{newTx(key, pack("punish", offender), encode(1500)), false},                              // not a validator at that height
+		{newTx(key, pack("punish", validator), encode(2000)), false},                             // validator mismatch
+		{newTx(key, pack("punish", offender), []byte{0x01}), false},                              // malformed evidence
+		{newTx(key, pack("punish", offender)), false},                                            // missing evidence
+		{newTx(key, pack("decreaseMissedBlocksCounter", big.NewInt(2000)), encode(2000)), false}, // wrong method
+		{newTx(offenderKey, pack("punish", offender), encode(2000)), false},                      // not the block author
+	}
+	engine.doubleSigns.observe(offender, evidence(2000).HeaderA)
+	engine.doubleSigns.observe(offender, evidence(2000).HeaderB)
+
+	for i, tc := range testCases {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     big.NewInt(2024),
+			Coinbase:   validator,
+			Difficulty: diffInTurn,
+			GasLimit:   8000000,
+		}
+		receipt, err := engine.replayDoubleSignEvidence(reader, header, statedb, 0, tc.tx)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("test %d: validity mismatch: have %v (err %v), want %v", i, valid, err, tc.valid)
+			continue
+		}
+		if !tc.valid {
+			continue
+		}
+		if receipt.TxHash != tc.tx.Hash() {
+			t.Errorf("test %d: receipt tx hash mismatch: have %x, want %x", i, receipt.TxHash, tc.tx.Hash())
+		}
+		if nonce := statedb.GetNonce(validator); nonce != 1 {
+			t.Errorf("test %d: validator nonce mismatch: have %d, want %d", i, nonce, 1)
+		}
+	}
+	// Evidences punished by imported blocks must not be submitted again
+	if pending := engine.doubleSigns.pending(); len(pending) != 0 {
+		t.Errorf("punished evidences still pending: %d", len(pending))
+	}
+}
+
+// Tests that dropping a validator key clears its signers and that switching to
+// a dropped key does not keep sealing with the previous one.
+func TestDeauthorize(t *testing.T) {
+	engine := New(&params.ChainConfig{ChainID: big.NewInt(1), Dpos: &params.DposConfig{Period: 3, Epoch: 200}}, rawdb.NewMemoryDatabase(), nil, common.Hash{})
+
+	var (
+		valA, valB = randomAddress(), randomAddress()
+		signFn     = func(accounts.Account, string, []byte) ([]byte, error) { return nil, nil }
+	)
+	engine.Authorize(valA, signFn, nil)
+	engine.Authorize(valB, signFn, nil)
+	if engine.val != valB {
+		t.Fatalf("signer mismatch: have %x, want %x", engine.val, valB)
+	}
+	engine.Deauthorize(valB)
+	if engine.val != (common.Address{}) || engine.signFn != nil {
+		t.Fatalf("removed signer still in use: %x", engine.val)
+	}
+	if engine.Authorize(valB, nil, nil) {
+		t.Fatalf("removed signer re-authorized")
+	}
+	if !engine.Authorize(valA, nil, nil) || engine.val != valA || engine.signFn == nil {
+		t.Fatalf("remaining signer not authorized")
+	}
+	engine.Deauthorize(valB)
+	if engine.val != valA {
+		t.Fatalf("signer mismatch after unrelated removal: have %x, want %x", engine.val, valA)
+	}
+}
@@ -0,0 +1,54 @@
+package dpos
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// maxFinalityDepth is the number of blocks searched below the head for enough
+// distinct validators to have sealed on top of a block. Finality stalls if the
+// online validators can't reach the quorum within it.
+const maxFinalityDepth = 4 * maxValidators
+
+// FinalizedHeader implements consensus.Finality, returning the highest ancestor
+// of head with descendants sealed by more than 2/3 of the validators of the
+// snapshot at head.
+func (p *Dpos) FinalizedHeader(chain consensus.ChainHeaderReader, head *types.Header) *types.Header {
+	return p.confirmedHeader(chain, head, 2, 3)
+}
+
+// SafeHeader implements consensus.Finality, returning the highest ancestor of
+// head with descendants sealed by more than half of the validators of the
+// snapshot at head.
+func (p *Dpos) SafeHeader(chain consensus.ChainHeaderReader, head *types.Header) *types.Header {
+	return p.confirmedHeader(chain, head, 1, 2)
+}
+
+// confirmedHeader walks back from head to the highest ancestor with descendants
+// sealed by more than num/den of the validators of the snapshot at head.
+func (p *Dpos) confirmedHeader(chain consensus.ChainHeaderReader, head *types.Header, num, den int) *types.Header {
+	if head == nil || head.Number.Sign() == 0 {
+		return nil
+	}
+	snap, err := p.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		return nil
+	}
+	signers := make(map[common.Address]struct{})
+	for header, depth := head, 0; header.Number.Sign() > 0 && depth < maxFinalityDepth; depth++ {
+		// Dpos headers are sealed by their coinbase
+		if _, ok := snap.Validators[header.Coinbase]; ok {
+			signers[header.Coinbase] = struct{}{}
+		}
+		parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return nil
+		}
+		if len(signers)*den > len(snap.Validators)*num {
+			return parent
+		}
+		header = parent
+	}
+	return nil
+}
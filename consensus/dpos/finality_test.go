@@ -0,0 +1,180 @@
+package dpos
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newFinalityChain creates a dpos chain run by the given number of validators,
+// along with the keys of its validators.
+func newFinalityChain(t *testing.T, n int) (*core.BlockChain, *Dpos, map[common.Address]*ecdsa.PrivateKey) {
+	keys := make(map[common.Address]*ecdsa.PrivateKey)
+	validators := make([]common.Address, 0, n)
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		keys[addr] = key
+		validators = append(validators, addr)
+	}
+	sort.Slice(validators, func(i, j int) bool { return bytes.Compare(validators[i][:], validators[j][:]) < 0 })
+
+	top, err := systemcontract.GetInteractiveABI()[systemcontract.DposFactoryContractName].Methods["getTopValidators"].Outputs.Pack(validators)
+	if err != nil {
+		t.Fatalf("failed to pack top validators: %v", err)
+	}
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		Dpos:                &params.DposConfig{Period: 0, Epoch: 4},
+	}
+	alloc := core.GenesisAlloc{}
+	for _, addr := range validators {
+		alloc[addr] = core.GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	for _, addr := range []common.Address{systemcontract.SysGovContractAddr, systemcontract.AddressListContractAddr, systemcontract.PunishV1ContractAddr} {
+		alloc[addr] = core.GenesisAccount{Balance: new(big.Int), Code: stubContractCode}
+	}
+	alloc[systemcontract.DposFactoryContractAddr] = core.GenesisAccount{Balance: new(big.Int), Code: returnCode(top)}
+
+	genspec := &core.Genesis{
+		Config:    config,
+		GasLimit:  8000000,
+		ExtraData: make([]byte, extraVanity+n*common.AddressLength+extraSeal),
+		Alloc:     alloc,
+	}
+	for i, addr := range validators {
+		copy(genspec.ExtraData[extraVanity+i*common.AddressLength:], addr[:])
+	}
+	chain, engine := newGenesisChain(t, genspec)
+	return chain, engine, keys
+}
+
+// newGenesisChain creates a dpos chain from the given genesis specification.
+func newGenesisChain(t *testing.T, genspec *core.Genesis) (*core.BlockChain, *Dpos) {
+	// State commits flush contract codes asynchronously, store them upfront
+	db := rawdb.NewMemoryDatabase()
+	for _, account := range genspec.Alloc {
+		if len(account.Code) > 0 {
+			rawdb.WriteCode(db, crypto.Keccak256Hash(account.Code), account.Code)
+		}
+	}
+	genesis := genspec.MustCommit(db)
+
+	engine := New(genspec.Config, db, nil, genesis.Hash())
+	chain, err := core.NewBlockChain(db, nil, genspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	engine.SetStateFn(chain.StateAt)
+	return chain, engine
+}
+
+// sealInTurn assembles, signs and imports n blocks on top of the head of the
+// chain, each sealed by its in-turn validator.
+func sealInTurn(t *testing.T, chain *core.BlockChain, engine *Dpos, keys map[common.Address]*ecdsa.PrivateKey, n int) {
+	signer := types.NewEIP155Signer(chain.Config().ChainID)
+	for i := 0; i < n; i++ {
+		parent := chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+		}
+		val, err := engine.InTurnValidator(chain, header)
+		if err != nil {
+			t.Fatalf("failed to retrieve in-turn validator of block %d: %v", header.Number, err)
+		}
+		key := keys[val]
+		engine.Authorize(val, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(data), key)
+		}, func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+			return types.SignTx(tx, signer, key)
+		})
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("failed to prepare block %d: %v", header.Number, err)
+		}
+		statedb, err := chain.StateAt(parent.Root())
+		if err != nil {
+			t.Fatalf("failed to retrieve parent state: %v", err)
+		}
+		block, _, err := engine.FinalizeAndAssemble(chain, header, statedb, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to assemble block %d: %v", header.Number, err)
+		}
+		header = block.Header()
+		sig, err := crypto.Sign(engine.SealHash(header).Bytes(), key)
+		if err != nil {
+			t.Fatalf("failed to sign block %d: %v", header.Number, err)
+		}
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+
+		if _, err := chain.InsertChain(types.Blocks{block.WithSeal(header)}); err != nil {
+			t.Fatalf("failed to import block %d: %v", header.Number, err)
+		}
+	}
+}
+
+// Tests that the finalized and safe blocks trail the head by the number of
+// blocks needed for a quorum of distinct validators to seal on top of them.
+func TestFinality(t *testing.T) {
+	chain, engine, keys := newFinalityChain(t, 5)
+	defer chain.Stop()
+
+	events := make(chan core.ChainFinalizedEvent, 16)
+	sub := chain.SubscribeChainFinalizedEvent(events)
+	defer sub.Unsubscribe()
+
+	// Nothing is final until enough validators sealed blocks
+	sealInTurn(t, chain, engine, keys, 3)
+	if block := chain.CurrentFinalizedBlock(); block != nil {
+		t.Errorf("finalized block before quorum: have %d", block.NumberU64())
+	}
+	if block := chain.CurrentSafeBlock(); block == nil || block.NumberU64() != 0 {
+		t.Errorf("safe block mismatch: have %v, want 0", block)
+	}
+	// More than 2/3 of the validators finalize, more than half make it safe
+	sealInTurn(t, chain, engine, keys, 7)
+	if block := chain.CurrentFinalizedBlock(); block == nil || block.NumberU64() != 6 {
+		t.Errorf("finalized block mismatch: have %v, want 6", block)
+	}
+	if block := chain.CurrentSafeBlock(); block == nil || block.NumberU64() != 7 {
+		t.Errorf("safe block mismatch: have %v, want 7", block)
+	}
+	// Every advance of the finalized block is announced
+	for want := uint64(0); want <= 6; want++ {
+		select {
+		case ev := <-events:
+			if ev.Header.Number.Uint64() != want {
+				t.Fatalf("finalized event mismatch: have %d, want %d", ev.Header.Number, want)
+			}
+		default:
+			t.Fatalf("missing finalized event for block %d", want)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected finalized event for block %d", ev.Header.Number)
+	default:
+	}
+}
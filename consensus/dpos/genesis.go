@@ -0,0 +1,162 @@
+package dpos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// GenesisSpec declares a dpos network to assemble the genesis block of.
+type GenesisSpec struct {
+	ChainID    *big.Int          // Chain identifier used for replay protection
+	Period     uint64            // Number of seconds between blocks (0 = seal on transactions)
+	Epoch      uint64            // Number of blocks between validator set updates
+	Admin      common.Address    // Admin of the system contracts
+	Validators []common.Address  // Validators sealing the first epoch
+	GasLimit   uint64            // Gas limit of the genesis block (0 = default)
+	Alloc      core.GenesisAlloc // Accounts funded besides the system contracts
+}
+
+// NewGenesis assembles the genesis block of a dpos network, with the system
+// contracts deployed and the validators in the extra-data. The contracts are
+// initialized by the engine at block 1.
+func NewGenesis(spec *GenesisSpec) (*core.Genesis, error) {
+	if spec.ChainID == nil || spec.ChainID.Sign() <= 0 {
+		return nil, errors.New("chain id must be positive")
+	}
+	if spec.Admin == (common.Address{}) {
+		return nil, errors.New("system contract admin missing")
+	}
+	if len(spec.Validators) == 0 || len(spec.Validators) > maxValidators {
+		return nil, fmt.Errorf("%d validators, want 1 to %d", len(spec.Validators), maxValidators)
+	}
+	validators := append([]common.Address{}, spec.Validators...)
+	sort.Slice(validators, func(i, j int) bool { return bytes.Compare(validators[i][:], validators[j][:]) < 0 })
+	for i, val := range validators {
+		if val == (common.Address{}) {
+			return nil, errors.New("zero validator address")
+		}
+		if i > 0 && val == validators[i-1] {
+			return nil, fmt.Errorf("duplicate validator %v", val)
+		}
+	}
+	config := &params.ChainConfig{
+		ChainID:             new(big.Int).Set(spec.ChainID),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		MuirGlacierBlock:    big.NewInt(0),
+		RamanujanBlock:      big.NewInt(0),
+		NielsBlock:          big.NewInt(0),
+		MirrorSyncBlock:     big.NewInt(0),
+		BerlinBlock:         big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		SystemTxBlock:       big.NewInt(0),
+		DevVerifyBlock:      big.NewInt(0),
+		Dpos: &params.DposConfig{
+			Period: spec.Period,
+			Epoch:  spec.Epoch,
+			Admin:  spec.Admin,
+		},
+	}
+	alloc := systemcontract.GenesisAlloc()
+	for addr, account := range spec.Alloc {
+		if _, ok := alloc[addr]; ok {
+			return nil, fmt.Errorf("account %v overrides a system contract", addr)
+		}
+		alloc[addr] = account
+	}
+	extra := make([]byte, extraVanity+len(validators)*common.AddressLength+extraSeal)
+	for i, val := range validators {
+		copy(extra[extraVanity+i*common.AddressLength:], val[:])
+	}
+	gasLimit := spec.GasLimit
+	if gasLimit == 0 {
+		gasLimit = params.GenesisGasLimit
+	}
+	genesis := &core.Genesis{
+		Config:     config,
+		ExtraData:  extra,
+		GasLimit:   gasLimit,
+		Difficulty: big.NewInt(1),
+		Alloc:      alloc,
+	}
+	if err := ValidateGenesis(genesis); err != nil {
+		return nil, err
+	}
+	return genesis, nil
+}
+
+// ValidateGenesis checks that a genesis block can start a dpos network: the
+// validators in its extra-data fit the engine limits and the system contracts
+// are deployed.
+func ValidateGenesis(genesis *core.Genesis) error {
+	if genesis.Config == nil || genesis.Config.Dpos == nil {
+		return errors.New("not a dpos genesis")
+	}
+	if err := genesis.Config.CheckConfigForkOrder(); err != nil {
+		return err
+	}
+	if genesis.Config.Dpos.Epoch == 0 {
+		return errors.New("epoch must be positive")
+	}
+	// Chains switching from parlia pick their validators up from it
+	if genesis.Config.Parlia != nil {
+		return nil
+	}
+	if len(genesis.ExtraData) < extraVanity+extraSeal {
+		return errMissingSignature
+	}
+	validatorsBytes := len(genesis.ExtraData) - extraVanity - extraSeal
+	if validatorsBytes%common.AddressLength != 0 {
+		return errInvalidCheckpointValidators
+	}
+	if n := validatorsBytes / common.AddressLength; n == 0 || n > maxValidators {
+		return fmt.Errorf("%d validators, want 1 to %d", n, maxValidators)
+	}
+	for addr := range systemcontract.GenesisAlloc() {
+		if len(genesis.Alloc[addr].Code) == 0 {
+			return fmt.Errorf("system contract %v not deployed", addr)
+		}
+	}
+	return nil
+}
+
+// DeveloperGenesisBlock returns the 'geth --dev --dev.engine=dpos' genesis block,
+// with the faucet as both the sole validator and the admin of the system
+// contracts.
+func DeveloperGenesisBlock(period uint64, faucet common.Address) *core.Genesis {
+	// Assemble and return the genesis with the precompiles and faucet pre-funded
+	alloc := core.GenesisAlloc{}
+	for i := byte(1); i <= 9; i++ {
+		alloc[common.BytesToAddress([]byte{i})] = core.GenesisAccount{Balance: big.NewInt(1)}
+	}
+	// Unlike clique the faucet also collects the block rewards, leave it headroom
+	alloc[faucet] = core.GenesisAccount{Balance: new(big.Int).Lsh(big.NewInt(1), 128)}
+
+	genesis, err := NewGenesis(&GenesisSpec{
+		ChainID:    big.NewInt(1337),
+		Period:     period,
+		Epoch:      200,
+		Admin:      faucet,
+		Validators: []common.Address{faucet},
+		GasLimit:   11500000,
+		Alloc:      alloc,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return genesis
+}
@@ -0,0 +1,100 @@
+package dpos
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that a developer chain seals blocks with its system contracts set up
+// and administered by the faucet.
+func TestDeveloperGenesisBlock(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	faucet := crypto.PubkeyToAddress(key.PublicKey)
+
+	chain, engine := newGenesisChain(t, DeveloperGenesisBlock(0, faucet))
+	defer chain.Stop()
+	sealInTurn(t, chain, engine, map[common.Address]*ecdsa.PrivateKey{faucet: key}, 5)
+
+	head := chain.CurrentBlock()
+	statedb, err := chain.StateAt(head.Root())
+	if err != nil {
+		t.Fatalf("failed to retrieve head state: %v", err)
+	}
+	// The factory was initialized with the faucet as sole validator
+	validators, err := engine.readTopValidators(newChainContext(chain, engine), head.Header(), statedb)
+	if err != nil {
+		t.Fatalf("failed to read top validators: %v", err)
+	}
+	if want := []common.Address{faucet}; !reflect.DeepEqual(validators, want) {
+		t.Errorf("top validators mismatch: have %v, want %v", validators, want)
+	}
+	// The address list was initialized with the faucet as admin
+	slot := statedb.GetState(systemcontract.AddressListContractAddr, common.Hash{})
+	if admin := common.BytesToAddress(slot[10:30]); admin != faucet {
+		t.Errorf("address list admin mismatch: have %v, want %v", admin, faucet)
+	}
+	if slot[31] != 1 {
+		t.Errorf("address list not initialized")
+	}
+}
+
+// Tests that genesis specs are validated and the assembled genesis survives a
+// round trip through its JSON encoding.
+func TestNewGenesis(t *testing.T) {
+	validators := make([]common.Address, maxValidators+1)
+	for i := range validators {
+		validators[i] = common.BytesToAddress([]byte{byte(i + 1)})
+	}
+	admin := common.HexToAddress("0xad")
+
+	tests := []struct {
+		spec GenesisSpec
+		err  string
+	}{
+		{GenesisSpec{ChainID: big.NewInt(1), Epoch: 200, Admin: admin, Validators: validators[:maxValidators]}, ""},
+		{GenesisSpec{ChainID: big.NewInt(1), Epoch: 200, Admin: admin, Validators: validators}, "22 validators"},
+		{GenesisSpec{ChainID: big.NewInt(1), Epoch: 200, Admin: admin}, "0 validators"},
+		{GenesisSpec{ChainID: big.NewInt(1), Epoch: 200, Admin: admin, Validators: []common.Address{validators[0], validators[0]}}, "duplicate validator"},
+		{GenesisSpec{ChainID: big.NewInt(1), Epoch: 200, Validators: validators[:1]}, "admin missing"},
+		{GenesisSpec{ChainID: big.NewInt(1), Admin: admin, Validators: validators[:1]}, "epoch must be positive"},
+		{GenesisSpec{Epoch: 200, Admin: admin, Validators: validators[:1]}, "chain id must be positive"},
+		{GenesisSpec{ChainID: big.NewInt(1), Epoch: 200, Admin: admin, Validators: validators[:1], Alloc: core.GenesisAlloc{
+			systemcontract.SysGovContractAddr: {Balance: big.NewInt(1)},
+		}}, "overrides a system contract"},
+	}
+	for i, tt := range tests {
+		genesis, err := NewGenesis(&tt.spec)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("test %d: error mismatch: have %v, want %q", i, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to assemble genesis: %v", i, err)
+		}
+		blob, err := json.Marshal(genesis)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode genesis: %v", i, err)
+		}
+		decoded := new(core.Genesis)
+		if err := json.Unmarshal(blob, decoded); err != nil {
+			t.Fatalf("test %d: failed to decode genesis: %v", i, err)
+		}
+		if err := ValidateGenesis(decoded); err != nil {
+			t.Errorf("test %d: decoded genesis invalid: %v", i, err)
+		}
+		if decoded.ToBlock(nil).Hash() != genesis.ToBlock(nil).Hash() {
+			t.Errorf("test %d: genesis hash changed by the round trip", i)
+		}
+	}
+}
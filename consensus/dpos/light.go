@@ -0,0 +1,199 @@
+package dpos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// errNotEpochBlock is returned when the validators are proven for a block that
+// doesn't list them.
+var errNotEpochBlock = errors.New("not an epoch block")
+
+// HeaderFn retrieves the canonical header with the given number, fetching it
+// from the network if it's missing locally.
+type HeaderFn func(number uint64) (*types.Header, error)
+
+// ValidatorProofFn retrieves the proof of the validators listed in an epoch header.
+type ValidatorProofFn func(header *types.Header) (*ValidatorProof, error)
+
+// ValidatorProof proves the validators listed in an epoch header against the
+// state of its parent. It holds everything the DposFactory contract reads while
+// picking them, so a light client can pick them again.
+type ValidatorProof struct {
+	Code  [][]byte // Code of the contracts run
+	Nodes [][]byte // Trie nodes of the accounts and storage slots read
+}
+
+// SetLightMode makes the engine verify headers without any state, as light
+// clients do. The validators listed in the epoch headers are trusted, and the
+// validator set of the first epoch synced is taken from its header, retrieved
+// with headerFn. Epoch headers are also checked against the validator proofs
+// retrieved with proofFn, if any.
+func (p *Dpos) SetLightMode(headerFn HeaderFn, proofFn ValidatorProofFn) {
+	p.light = true
+	p.headerFn = headerFn
+	p.proofFn = proofFn
+}
+
+// lightSnapshot creates the snapshot at a block whose ancestors are unknown,
+// taking the validators from the header of its epoch. The recent validators
+// can't be known, so none are set.
+func (p *Dpos) lightSnapshot(number uint64, hash common.Hash) (*Snapshot, error) {
+	if p.headerFn == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	checkpoint, err := p.headerFn(number - number%p.config.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Number.Uint64() == number && checkpoint.Hash() != hash {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	if len(checkpoint.Extra) < extraVanity+extraSeal {
+		return nil, errMissingSignature
+	}
+	validators, err := ParseValidators(checkpoint.Extra[extraVanity : len(checkpoint.Extra)-extraSeal])
+	if err != nil {
+		return nil, err
+	}
+	if len(validators) == 0 {
+		return nil, errInvalidCheckpointValidators
+	}
+	log.Info("Trusted epoch validators", "epoch", checkpoint.Number, "hash", checkpoint.Hash(), "validators", len(validators))
+	return newSnapshot(p.config, p.signatures, number, hash, validators, p.ethAPI), nil
+}
+
+// verifyEpochValidators checks the validators listed in an epoch header against
+// its validator proof. Light servers only keep the recent states, so headers
+// whose proof can't be retrieved are trusted, as are the ones with an invalid
+// proof which a server could forge to get a valid header rejected.
+func (p *Dpos) verifyEpochValidators(chain consensus.ChainHeaderReader, header *types.Header, parent *types.Header) error {
+	if p.proofFn == nil {
+		return nil
+	}
+	proof, err := p.proofFn(header)
+	if err != nil {
+		log.Debug("Validator proof unavailable", "number", header.Number, "hash", header.Hash(), "err", err)
+		return nil
+	}
+	validators, err := p.verifyValidatorProof(chain, parent, proof)
+	if err != nil {
+		log.Warn("Invalid validator proof", "number", header.Number, "hash", header.Hash(), "err", err)
+		return nil
+	}
+	validatorsBytes := make([]byte, len(validators)*common.AddressLength)
+	for i, validator := range validators {
+		copy(validatorsBytes[i*validatorBytesLength:], validator.Bytes())
+	}
+	if !bytes.Equal(header.Extra[extraVanity:len(header.Extra)-extraSeal], validatorsBytes) {
+		return errMismatchingEpochValidators
+	}
+	return nil
+}
+
+// ProveValidators proves the validators listed in the given epoch header, from
+// the state of its parent.
+func (p *Dpos) ProveValidators(chain consensus.ChainHeaderReader, header *types.Header, parentState *state.StateDB) (*ValidatorProof, error) {
+	number := header.Number.Uint64()
+	if number == 0 || number%p.config.Epoch != 0 {
+		return nil, errNotEpochBlock
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	// Pick the validators as readTopValidators does, recording what is read
+	contract := *systemcontract.GetValidatorAddr(parent.Number, p.chainConfig)
+	data, err := p.abi[systemcontract.DposFactoryContractName].Pack("getTopValidators")
+	if err != nil {
+		return nil, err
+	}
+	tracer := newAccessTracer()
+	msg := types.NewMessage(parent.Coinbase, &contract, 0, new(big.Int), math.MaxUint64, new(big.Int), data, nil, false)
+	if _, err := vmcaller.ExecuteMsgWithConfig(msg, parentState.Copy(), parent, newChainContext(chain, p), p.chainConfig, vm.Config{Debug: true, Tracer: tracer}); err != nil {
+		return nil, err
+	}
+	addrs := make([]common.Address, 0, len(tracer.touched))
+	for addr := range tracer.touched {
+		addrs = append(addrs, addr)
+	}
+	sort.Sort(validatorsAscending(addrs))
+
+	var (
+		proof = new(ValidatorProof)
+		seen  = make(map[common.Hash]struct{})
+	)
+	add := func(nodes [][]byte) {
+		for _, node := range nodes {
+			hash := crypto.Keccak256Hash(node)
+			if _, ok := seen[hash]; !ok {
+				seen[hash] = struct{}{}
+				proof.Nodes = append(proof.Nodes, node)
+			}
+		}
+	}
+	for _, addr := range addrs {
+		nodes, err := parentState.GetProof(addr)
+		if err != nil {
+			return nil, err
+		}
+		add(nodes)
+		if !parentState.Exist(addr) {
+			continue
+		}
+		if code := parentState.GetCode(addr); len(code) > 0 {
+			proof.Code = append(proof.Code, code)
+		}
+		for slot := range tracer.touched[addr] {
+			nodes, err := parentState.GetStorageProof(addr, slot)
+			if err != nil {
+				return nil, err
+			}
+			add(nodes)
+		}
+	}
+	return proof, nil
+}
+
+// verifyValidatorProof picks the validators again from the state in the proof,
+// which must be the state of the given parent header.
+func (p *Dpos) verifyValidatorProof(chain consensus.ChainHeaderReader, parent *types.Header, proof *ValidatorProof) ([]common.Address, error) {
+	db := rawdb.NewMemoryDatabase()
+	for _, node := range proof.Nodes {
+		if err := db.Put(crypto.Keccak256(node), node); err != nil {
+			return nil, err
+		}
+	}
+	for _, code := range proof.Code {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(code), code)
+	}
+	statedb, err := state.New(parent.Root, state.NewDatabase(db), nil)
+	if err != nil {
+		return nil, err
+	}
+	validators, err := p.readTopValidators(newChainContext(chain, p), parent, statedb)
+	// Missing nodes or code only surface as a state error, the contract reads
+	// empty values instead
+	if err := statedb.Error(); err != nil {
+		return nil, fmt.Errorf("incomplete validator proof: %v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return validators, nil
+}
@@ -0,0 +1,174 @@
+package dpos
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// epochHeader assembles an epoch header listing the given validators.
+func epochHeader(number uint64, parent common.Hash, validators ...common.Address) *types.Header {
+	extra := make([]byte, extraVanity, extraVanity+len(validators)*common.AddressLength+extraSeal)
+	for _, validator := range validators {
+		extra = append(extra, validator.Bytes()...)
+	}
+	return &types.Header{
+		ParentHash: parent,
+		Number:     new(big.Int).SetUint64(number),
+		Difficulty: new(big.Int).Set(diffInTurn),
+		Extra:      append(extra, make([]byte, extraSeal)...),
+	}
+}
+
+// Tests that the validators listed in epoch headers are proven from the state of
+// their parent, and checked against the proofs by light clients.
+func TestValidatorProof(t *testing.T) {
+	var (
+		abis = systemcontract.GetInteractiveABI()
+		valA = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		valB = common.HexToAddress("0x0000000000000000000000000000000000000002")
+		valC = common.HexToAddress("0x0000000000000000000000000000000000000003")
+	)
+	factory := make(map[[4]byte][]byte)
+	selector, output := cannedOutput(t, abis[systemcontract.DposFactoryContractName], "getTopValidators", []common.Address{valB, valA})
+	factory[selector] = output
+
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		Dpos:                &params.DposConfig{Period: 3, Epoch: 200},
+	}
+	genspec := &core.Genesis{
+		Config:    config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: core.GenesisAlloc{
+			systemcontract.DposFactoryContractAddr: {Balance: new(big.Int), Code: dispatchCode(factory)},
+		},
+	}
+	db := rawdb.NewMemoryDatabase()
+	for _, account := range genspec.Alloc {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(account.Code), account.Code)
+	}
+	genesis := genspec.MustCommit(db)
+
+	// The parent of the epoch header shares the genesis state
+	parent := types.CopyHeader(genesis.Header())
+	parent.Number = big.NewInt(199)
+	reader := newTestChainReader(config, nil, genesis)
+	reader.headers[parent.Hash()] = parent
+
+	engine := New(config, db, nil, genesis.Hash())
+	reader.engine = engine
+
+	statedb, err := state.New(parent.Root, state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open parent state: %v", err)
+	}
+	if _, err := engine.ProveValidators(reader, epochHeader(199, parent.ParentHash), statedb); err != errNotEpochBlock {
+		t.Errorf("non-epoch proof error mismatch: have %v, want %v", err, errNotEpochBlock)
+	}
+	header := epochHeader(200, parent.Hash(), valA, valB)
+	proof, err := engine.ProveValidators(reader, header, statedb)
+	if err != nil {
+		t.Fatalf("failed to prove validators: %v", err)
+	}
+	validators, err := engine.verifyValidatorProof(reader, parent, proof)
+	if err != nil {
+		t.Fatalf("failed to verify validator proof: %v", err)
+	}
+	if want := []common.Address{valA, valB}; !reflect.DeepEqual(validators, want) {
+		t.Errorf("proven validators mismatch: have %v, want %v", validators, want)
+	}
+	incomplete := &ValidatorProof{Nodes: proof.Nodes}
+	if _, err := engine.verifyValidatorProof(reader, parent, incomplete); err == nil {
+		t.Errorf("proof without code verified")
+	}
+	// Light clients reject the epoch headers listing other validators than the
+	// proven ones, trusting them if they can't be proven
+	proofs := map[common.Hash]*ValidatorProof{}
+	engine.SetLightMode(nil, func(header *types.Header) (*ValidatorProof, error) {
+		if proof, ok := proofs[header.Hash()]; ok {
+			return proof, nil
+		}
+		return nil, errors.New("no proof")
+	})
+	forged := epochHeader(200, parent.Hash(), valA, valC)
+	for _, test := range []struct {
+		header *types.Header
+		proof  *ValidatorProof
+		err    error
+	}{
+		{header, proof, nil},
+		{forged, proof, errMismatchingEpochValidators},
+		{forged, nil, nil},
+		{forged, incomplete, nil},
+	} {
+		delete(proofs, test.header.Hash())
+		if test.proof != nil {
+			proofs[test.header.Hash()] = test.proof
+		}
+		if err := engine.verifyEpochValidators(reader, test.header, parent); err != test.err {
+			t.Errorf("epoch %v verification error mismatch: have %v, want %v", test.header.Hash(), err, test.err)
+		}
+	}
+}
+
+// Tests that light clients take the validators of the epoch a sync starts in
+// from its header, as the ones before it are unknown.
+func TestLightSnapshot(t *testing.T) {
+	var (
+		valA = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		valB = common.HexToAddress("0x0000000000000000000000000000000000000002")
+	)
+	config := &params.ChainConfig{ChainID: big.NewInt(1), Dpos: &params.DposConfig{Period: 3, Epoch: 200}}
+	engine := New(config, rawdb.NewMemoryDatabase(), nil, common.Hash{})
+	reader := newTestChainReader(config, engine)
+
+	checkpoint := epochHeader(400, common.HexToHash("0x01"), valA, valB)
+	engine.SetLightMode(nil, nil)
+	if _, err := engine.snapshot(reader, 450, common.HexToHash("0x02"), nil); err != consensus.ErrUnknownAncestor {
+		t.Errorf("snapshot error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+	engine.SetLightMode(func(number uint64) (*types.Header, error) {
+		if number != 400 {
+			t.Errorf("retrieved header mismatch: have %d, want 400", number)
+		}
+		return checkpoint, nil
+	}, nil)
+	snap, err := engine.snapshot(reader, 450, common.HexToHash("0x02"), nil)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	if snap.Number != 450 || snap.Hash != common.HexToHash("0x02") {
+		t.Errorf("snapshot block mismatch: have %d [%x]", snap.Number, snap.Hash)
+	}
+	if want := []common.Address{valA, valB}; !reflect.DeepEqual(snap.validators(), want) {
+		t.Errorf("snapshot validators mismatch: have %v, want %v", snap.validators(), want)
+	}
+	if len(snap.Recents) != 0 {
+		t.Errorf("snapshot has %d recent validators", len(snap.Recents))
+	}
+	// The epoch header itself must be the one asked for
+	if _, err := engine.snapshot(reader, 400, common.HexToHash("0x03"), nil); err != consensus.ErrUnknownAncestor {
+		t.Errorf("mismatching epoch error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
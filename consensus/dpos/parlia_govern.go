@@ -4,14 +4,14 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
-	"github.com/ethereum/go-ethereum/consensus/parlia/systemcontract"
-	"github.com/ethereum/go-ethereum/consensus/parlia/vmcaller"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 	"math"
@@ -110,27 +110,23 @@ func (c *Dpos) finishProposalById(chain consensus.ChainHeaderReader, header *typ
 }
 
 func (c *Dpos) executeProposal(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, prop *Proposal, totalTxIndex int) (*types.Transaction, *types.Receipt, error) {
-	// Even if the miner is not `running`, it's still working,
-	// the 'miner.worker' will try to FinalizeAndAssemble a block,
-	// in this case, the signTxFn is not set. A `non-miner node` can't execute system governance proposal.
-	if c.signTxFn == nil {
-		return nil, nil, errors.New("signTxFn not set")
-	}
-
 	propRLP, err := rlp.EncodeToBytes(prop)
 	if err != nil {
 		return nil, nil, err
 	}
 	//make system governance transaction
-	nonce := state.GetNonce(c.val)
+	// Even if the miner is not `running`, it's still working, the 'miner.worker'
+	// will try to FinalizeAndAssemble a block without signTxFn, in which case
+	// the transaction is left unsigned.
+	nonce := state.GetNonce(header.Coinbase)
 	tx := types.NewTransaction(nonce, systemcontract.SysGovToAddr, prop.Value, header.GasLimit, new(big.Int), propRLP)
-	tx, err = c.signTxFn(accounts.Account{Address: c.val}, tx, chain.Config().ChainID)
+	tx, err = c.signSystemTx(chain, tx)
 	if err != nil {
 		return nil, nil, err
 	}
 	//add nonce for validator
-	state.SetNonce(c.val, nonce+1)
-	receipt := c.executeProposalMsg(chain, header, state, prop, totalTxIndex, tx.Hash(), common.Hash{})
+	state.SetNonce(header.Coinbase, nonce+1)
+	receipt := c.executeProposalMsg(chain, header, state, prop, totalTxIndex, tx.Hash(), common.Hash{}, nil)
 
 	return tx, receipt, nil
 }
@@ -154,18 +150,20 @@ func (c *Dpos) replayProposal(chain consensus.ChainHeaderReader, header *types.H
 	nonce := state.GetNonce(sender)
 	//add nonce for validator
 	state.SetNonce(sender, nonce+1)
-	receipt := c.executeProposalMsg(chain, header, state, prop, totalTxIndex, tx.Hash(), header.Hash())
+	receipt := c.executeProposalMsg(chain, header, state, prop, totalTxIndex, tx.Hash(), header.Hash(), nil)
 
 	return receipt, nil
 }
 
-func (c *Dpos) executeProposalMsg(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, prop *Proposal, totalTxIndex int, txHash, bHash common.Hash) *types.Receipt {
+// executeProposalMsg runs a passed proposal, the tracer is only set when the
+// proposal is simulated.
+func (c *Dpos) executeProposalMsg(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, prop *Proposal, totalTxIndex int, txHash, bHash common.Hash, tracer vm.Tracer) *types.Receipt {
 	var receipt *types.Receipt
 	action := prop.Action.Uint64()
 	switch action {
 	case 0:
 		// evm action.
-		receipt = c.executeEvmCallProposal(chain, header, state, prop, totalTxIndex, txHash, bHash)
+		receipt = c.executeEvmCallProposal(chain, header, state, prop, totalTxIndex, txHash, bHash, tracer)
 	case 1:
 		// delete code action
 		ok := state.Erase(prop.To)
@@ -185,11 +183,11 @@ func (c *Dpos) executeProposalMsg(chain consensus.ChainHeaderReader, header *typ
 }
 
 // the returned value should not nil.
-func (c *Dpos) executeEvmCallProposal(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, prop *Proposal, totalTxIndex int, txHash, bHash common.Hash) *types.Receipt {
+func (c *Dpos) executeEvmCallProposal(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, prop *Proposal, totalTxIndex int, txHash, bHash common.Hash, tracer vm.Tracer) *types.Receipt {
 	// actually run the governance message
 	msg := types.NewMessage(prop.From, &prop.To, 0, prop.Value, header.GasLimit, new(big.Int), prop.Data, nil, false)
 	state.Prepare(txHash, bHash, totalTxIndex)
-	_, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, c), c.chainConfig)
+	_, err := vmcaller.ExecuteMsgWithConfig(msg, state, header, newChainContext(chain, c), c.chainConfig, vm.Config{Debug: tracer != nil, Tracer: tracer})
 	state.Finalise(true)
 
 	// governance message will not actually consumes gas
@@ -0,0 +1,379 @@
+package dpos
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// errUnexpectedSystemTx is returned if a block contains system transactions
+	// which aren't produced by any system action.
+	errUnexpectedSystemTx = errors.New("unexpected system transaction")
+
+	// errMissingSystemTx is returned if a block lacks the system transaction
+	// recording a system call.
+	errMissingSystemTx = errors.New("missing system transaction")
+)
+
+// systemContext carries a block through the system call pipeline.
+type systemContext struct {
+	chain    consensus.ChainHeaderReader
+	header   *types.Header
+	state    *state.StateDB
+	mining   bool                  // Whether the block is assembled rather than verified
+	txs      *[]*types.Transaction // Transactions of the block, system ones are appended in order
+	receipts *[]*types.Receipt     // Receipts of the block, system ones are appended in order
+	pending  []*types.Transaction  // System transactions of the verified block not replayed yet
+}
+
+// peek returns the next system transaction of the verified block if it is sent
+// to the given address, nil otherwise.
+func (ctx *systemContext) peek(to common.Address) *types.Transaction {
+	if len(ctx.pending) == 0 || ctx.pending[0].To() == nil || *ctx.pending[0].To() != to {
+		return nil
+	}
+	return ctx.pending[0]
+}
+
+// pop removes and returns the next system transaction of the verified block,
+// nil if there are none left.
+func (ctx *systemContext) pop() *types.Transaction {
+	if len(ctx.pending) == 0 {
+		return nil
+	}
+	tx := ctx.pending[0]
+	ctx.pending = ctx.pending[1:]
+	return tx
+}
+
+// append adds a system transaction and its receipt to the block.
+func (ctx *systemContext) append(tx *types.Transaction, receipt *types.Receipt) {
+	*ctx.txs = append(*ctx.txs, tx)
+	*ctx.receipts = append(*ctx.receipts, receipt)
+}
+
+// systemAction is a step of the system call pipeline. The mine function runs
+// when the local node assembles a block, the verify function when a block is
+// imported, both must leave the state in the same shape.
+type systemAction struct {
+	name   string
+	active func(p *Dpos, header *types.Header) bool
+	mine   func(p *Dpos, ctx *systemContext) error
+	verify func(p *Dpos, ctx *systemContext) error
+}
+
+// systemActions is the ordered list of system calls run at the end of every
+// block, whether it is assembled or verified.
+var systemActions = []systemAction{
+	{
+		name:   "initialize",
+		active: func(p *Dpos, header *types.Header) bool { return header.Number.Cmp(common.Big1) == 0 },
+		mine:   (*Dpos).initializeAction,
+		verify: (*Dpos).initializeAction,
+	},
+	{
+		name:   "punish",
+		active: func(p *Dpos, header *types.Header) bool { return header.Difficulty.Cmp(diffInTurn) != 0 },
+		mine:   (*Dpos).tryPunishValidator,
+		verify: (*Dpos).tryPunishValidator,
+	},
+	{
+		name:   "reward",
+		active: func(p *Dpos, header *types.Header) bool { return p.isRewardBlock(header.Number) },
+		mine:   (*Dpos).trySendBlockReward,
+		verify: (*Dpos).trySendBlockReward,
+	},
+	{
+		// do epoch thing after the rewards, because it will update active validators
+		name:   "epoch",
+		active: func(p *Dpos, header *types.Header) bool { return header.Number.Uint64()%p.config.Epoch == 0 },
+		mine:   (*Dpos).mineEpoch,
+		verify: (*Dpos).verifyEpoch,
+	},
+	{
+		// the punish contract takes a single punishment per block, so evidences
+		// only go into the blocks where no missed block is punished
+		name: "evidence",
+		active: func(p *Dpos, header *types.Header) bool {
+			return p.chainConfig.IsDoubleSign(header.Number) && header.Difficulty.Cmp(diffInTurn) == 0
+		},
+		mine:   (*Dpos).mineDoubleSignEvidence,
+		verify: (*Dpos).verifyDoubleSignEvidence,
+	},
+	{
+		name:   "governance",
+		active: func(p *Dpos, header *types.Header) bool { return p.chainConfig.IsRedCoast(header.Number) },
+		mine:   (*Dpos).mineProposals,
+		verify: (*Dpos).verifyProposals,
+	},
+	{
+		// the factory takes the reward and epoch calls first, so results come
+		// last to be told apart from them
+		name:   "por",
+		active: func(p *Dpos, header *types.Header) bool { return p.chainConfig.IsPor(header.Number) },
+		mine:   (*Dpos).minePorResult,
+		verify: (*Dpos).verifyPorResult,
+	},
+}
+
+// runSystemActions runs the system call pipeline over a block. When verifying,
+// every system transaction of the block must be consumed by an action. Every
+// action runs whether a validator key is set or not, so that pending blocks
+// end up in the same state as sealed ones.
+func (p *Dpos) runSystemActions(ctx *systemContext) error {
+	for _, action := range systemActions {
+		if !action.active(p, ctx.header) {
+			continue
+		}
+		run := action.verify
+		if ctx.mining {
+			run = action.mine
+		}
+		if err := run(p, ctx); err != nil {
+			log.Warn("Dpos system action failed", "action", action.name, "number", ctx.header.Number, "mining", ctx.mining, "err", err)
+			return err
+		}
+	}
+	if !ctx.mining && len(ctx.pending) > 0 {
+		return errUnexpectedSystemTx
+	}
+	return nil
+}
+
+// signSystemTx signs a system transaction with the local validator key. Blocks
+// assembled without a validator key are never sealed, so their system
+// transactions are left unsigned, keeping the pending state identical to the
+// one validators produce.
+func (p *Dpos) signSystemTx(chain consensus.ChainHeaderReader, tx *types.Transaction) (*types.Transaction, error) {
+	p.lock.RLock()
+	signTxFn, val := p.signTxFn, p.val
+	p.lock.RUnlock()
+
+	if signTxFn == nil {
+		return tx, nil
+	}
+	signed, err := signTxFn(accounts.Account{Address: val}, tx, chain.Config().ChainID)
+	if err != nil {
+		log.Error("Failed to sign dpos system transaction", "val", val, "to", tx.To(), "err", err)
+		return nil, fmt.Errorf("%w: %v", errSignerUnavailable, err)
+	}
+	return signed, nil
+}
+
+// systemCall calls a system contract from the coinbase. Before the SystemTx fork
+// the call only changes the state. Afterwards it is recorded as a zero gas price
+// system transaction with its receipt: assembled blocks get it appended, while
+// verified blocks must carry the very same transaction next.
+func (p *Dpos) systemCall(ctx *systemContext, to common.Address, value *big.Int, data []byte) error {
+	header, state := ctx.header, ctx.state
+	nonce := state.GetNonce(header.Coinbase)
+
+	if !p.chainConfig.IsSystemTx(header.Number) {
+		msg := types.NewMessage(header.Coinbase, &to, nonce, value, math.MaxUint64, new(big.Int), data, nil, true)
+		_, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(ctx.chain, p), p.chainConfig)
+		return err
+	}
+	tx := types.NewTransaction(nonce, to, value, header.GasLimit, new(big.Int), data)
+	bHash := common.Hash{}
+	if ctx.mining {
+		signed, err := p.signSystemTx(ctx.chain, tx)
+		if err != nil {
+			return err
+		}
+		tx = signed
+	} else {
+		actual := ctx.pop()
+		if actual == nil {
+			return errMissingSystemTx
+		}
+		if sender, err := types.Sender(p.signer, actual); err != nil || sender != header.Coinbase {
+			return fmt.Errorf("invalid sender for system transaction %v", actual.Hash())
+		}
+		if expected := p.signer.Hash(tx); p.signer.Hash(actual) != expected {
+			return fmt.Errorf("expected system tx hash %v, get %v, nonce %d, to %s, value %s, data %s", expected.String(), actual.Hash().String(),
+				tx.Nonce(), to.String(), value.String(), hex.EncodeToString(data))
+		}
+		tx = actual
+		bHash = header.Hash()
+	}
+	//add nonce for coinbase
+	state.SetNonce(header.Coinbase, nonce+1)
+
+	msg := types.NewMessage(header.Coinbase, &to, nonce, value, header.GasLimit, new(big.Int), data, nil, false)
+	state.Prepare(tx.Hash(), bHash, len(*ctx.txs))
+	if _, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(ctx.chain, p), p.chainConfig); err != nil {
+		return err
+	}
+	state.Finalise(true)
+
+	// system transaction will not actually consumes gas
+	receipt := types.NewReceipt([]byte{}, false, header.GasUsed)
+	// Set the receipt logs and create a bloom for filtering
+	receipt.Logs = state.GetLogs(tx.Hash())
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	receipt.TxHash = tx.Hash()
+	receipt.BlockHash = state.BlockHash()
+	receipt.BlockNumber = header.Number
+	receipt.TransactionIndex = uint(state.TxIndex())
+
+	ctx.append(tx, receipt)
+	return nil
+}
+
+func (p *Dpos) initializeAction(ctx *systemContext) error {
+	return p.initializeSystemContracts(ctx.chain, ctx.header, ctx.state)
+}
+
+func (p *Dpos) mineEpoch(ctx *systemContext) error {
+	_, err := p.doSomethingAtEpoch(ctx)
+	return err
+}
+
+// verifyEpoch updates the active validators, checking them against the ones
+// listed in the header. The check can only be done when the state is ready, it
+// can't be done in VerifyHeader.
+func (p *Dpos) verifyEpoch(ctx *systemContext) error {
+	newValidators, err := p.doSomethingAtEpoch(ctx)
+	if err != nil {
+		return err
+	}
+	validatorsBytes := make([]byte, len(newValidators)*common.AddressLength)
+	for i, validator := range newValidators {
+		copy(validatorsBytes[i*validatorBytesLength:], validator.Bytes())
+	}
+	extraSuffix := len(ctx.header.Extra) - extraSeal
+	if !bytes.Equal(ctx.header.Extra[extraVanity:extraSuffix], validatorsBytes) {
+		return errMismatchingEpochValidators
+	}
+	return nil
+}
+
+func (p *Dpos) mineDoubleSignEvidence(ctx *systemContext) error {
+	tx, receipt, err := p.submitDoubleSignEvidence(ctx.chain, ctx.header, ctx.state, len(*ctx.txs))
+	if err != nil {
+		return err
+	}
+	if tx != nil {
+		ctx.append(tx, receipt)
+	}
+	return nil
+}
+
+// verifyDoubleSignEvidence replays the double sign evidence transaction of the
+// block, if any.
+func (p *Dpos) verifyDoubleSignEvidence(ctx *systemContext) error {
+	if ctx.peek(*systemcontract.GetPunishAddr(ctx.header.Number, p.chainConfig)) == nil {
+		return nil
+	}
+	tx := ctx.pop()
+	receipt, err := p.replayDoubleSignEvidence(ctx.chain, ctx.header, ctx.state, len(*ctx.txs), tx)
+	if err != nil {
+		return err
+	}
+	ctx.append(tx, receipt)
+
+	if ctx.peek(*systemcontract.GetPunishAddr(ctx.header.Number, p.chainConfig)) != nil {
+		return errInvalidEvidenceCount
+	}
+	return nil
+}
+
+func (p *Dpos) minePorResult(ctx *systemContext) error {
+	tx, receipt, err := p.submitPorResult(ctx.chain, ctx.header, ctx.state, len(*ctx.txs))
+	if err != nil {
+		return err
+	}
+	if tx != nil {
+		ctx.append(tx, receipt)
+	}
+	return nil
+}
+
+// verifyPorResult replays the PoR result transaction of the block, if any.
+func (p *Dpos) verifyPorResult(ctx *systemContext) error {
+	if ctx.peek(*systemcontract.GetValidatorAddr(ctx.header.Number, p.chainConfig)) == nil {
+		return nil
+	}
+	tx := ctx.pop()
+	receipt, err := p.replayPorResult(ctx.chain, ctx.header, ctx.state, len(*ctx.txs), tx)
+	if err != nil {
+		return err
+	}
+	ctx.append(tx, receipt)
+
+	if ctx.peek(*systemcontract.GetValidatorAddr(ctx.header.Number, p.chainConfig)) != nil {
+		return errInvalidPorCount
+	}
+	return nil
+}
+
+// mineProposals executes the passed system governance proposals. Due to the
+// logics of the finish operation of contract `governance`, when finishing a
+// proposal which is not the last passed proposal, it will change the sequence.
+// So all passed proposals are executed first, and only then finished.
+func (p *Dpos) mineProposals(ctx *systemContext) error {
+	return p.runProposals(ctx, func(prop *Proposal) error {
+		tx, receipt, err := p.executeProposal(ctx.chain, ctx.header, ctx.state, prop, len(*ctx.txs))
+		if err != nil {
+			return err
+		}
+		ctx.append(tx, receipt)
+		return nil
+	})
+}
+
+// verifyProposals replays the system governance transactions of the block,
+// which must match the passed proposals one by one.
+func (p *Dpos) verifyProposals(ctx *systemContext) error {
+	return p.runProposals(ctx, func(prop *Proposal) error {
+		tx := ctx.pop()
+		if tx == nil {
+			return errInvalidSysGovCount
+		}
+		receipt, err := p.replayProposal(ctx.chain, ctx.header, ctx.state, prop, len(*ctx.txs), tx)
+		if err != nil {
+			return err
+		}
+		ctx.append(tx, receipt)
+		return nil
+	})
+}
+
+// runProposals runs the given function over every passed proposal, finishing
+// all of them afterwards.
+func (p *Dpos) runProposals(ctx *systemContext, execute func(prop *Proposal) error) error {
+	proposalCount, err := p.getPassedProposalCount(ctx.chain, ctx.header, ctx.state)
+	if err != nil {
+		return err
+	}
+	pIds := make([]*big.Int, 0, proposalCount)
+	for i := uint32(0); i < proposalCount; i++ {
+		prop, err := p.getPassedProposalByIndex(ctx.chain, ctx.header, ctx.state, i)
+		if err != nil {
+			return err
+		}
+		if err := execute(prop); err != nil {
+			return err
+		}
+		pIds = append(pIds, prop.Id)
+	}
+	for _, id := range pIds {
+		if err := p.finishProposalById(ctx.chain, ctx.header, ctx.state, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,412 @@
+package dpos
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// stubContractCode emits an empty log and returns 32 zero bytes to any call,
+// standing in for the system contracts.
+var stubContractCode = common.FromHex("0x60006000a060206000f3")
+
+// alternatingTestEngine seals blocks alternately in and out of turn, so that
+// the generated chain doesn't need signed headers to compute the difficulties.
+type alternatingTestEngine struct {
+	*Dpos
+}
+
+func (e *alternatingTestEngine) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	if parent.Number.Uint64()%2 == 0 {
+		return new(big.Int).Set(diffNoTurn)
+	}
+	return new(big.Int).Set(diffInTurn)
+}
+
+// testChainReader serves the headers of a generated chain.
+type testChainReader struct {
+	config  *params.ChainConfig
+	engine  consensus.Engine
+	headers map[common.Hash]*types.Header
+}
+
+func newTestChainReader(config *params.ChainConfig, engine consensus.Engine, blocks ...*types.Block) *testChainReader {
+	reader := &testChainReader{config: config, engine: engine, headers: make(map[common.Hash]*types.Header)}
+	for _, block := range blocks {
+		reader.headers[block.Hash()] = block.Header()
+	}
+	return reader
+}
+
+func (r *testChainReader) Config() *params.ChainConfig  { return r.config }
+func (r *testChainReader) Engine() consensus.Engine     { return r.engine }
+func (r *testChainReader) CurrentHeader() *types.Header { return nil }
+
+func (r *testChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return r.headers[hash]
+}
+
+func (r *testChainReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	return r.headers[hash]
+}
+
+func (r *testChainReader) GetHeaderByNumber(number uint64) *types.Header {
+	for _, header := range r.headers {
+		if header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+// pipelineTester generates dpos chains sealed by a single validator.
+type pipelineTester struct {
+	config    *params.ChainConfig
+	db        ethdb.Database
+	genesis   *types.Block
+	key       *ecdsa.PrivateKey
+	validator common.Address
+}
+
+func newPipelineTester(t *testing.T, systemTxBlock *big.Int) *pipelineTester {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		SystemTxBlock:       systemTxBlock,
+		DoubleSignBlock:     big.NewInt(0),
+		Dpos:                &params.DposConfig{Period: 3, Epoch: 200},
+	}
+	genspec := &core.Genesis{
+		Config:    config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: core.GenesisAlloc{
+			validator:                              {Balance: big.NewInt(params.Ether)},
+			systemcontract.SysGovContractAddr:      {Balance: new(big.Int), Code: stubContractCode},
+			systemcontract.AddressListContractAddr: {Balance: new(big.Int), Code: stubContractCode},
+			systemcontract.DposFactoryContractAddr: {Balance: new(big.Int), Code: stubContractCode},
+			systemcontract.PunishV1ContractAddr:    {Balance: new(big.Int), Code: stubContractCode},
+		},
+	}
+	copy(genspec.ExtraData[extraVanity:], validator[:])
+
+	// State commits flush contract codes asynchronously, store the stub upfront
+	db := rawdb.NewMemoryDatabase()
+	rawdb.WriteCode(db, crypto.Keccak256Hash(stubContractCode), stubContractCode)
+
+	return &pipelineTester{
+		config:    config,
+		db:        db,
+		genesis:   genspec.MustCommit(db),
+		key:       key,
+		validator: validator,
+	}
+}
+
+// useSystemContracts recreates the genesis with the real system contracts in
+// place of the stubs.
+func (pt *pipelineTester) useSystemContracts() {
+	alloc := systemcontract.GenesisAlloc()
+	alloc[pt.validator] = core.GenesisAccount{Balance: big.NewInt(params.Ether)}
+	genspec := &core.Genesis{Config: pt.config, ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal), Alloc: alloc}
+	copy(genspec.ExtraData[extraVanity:], pt.validator[:])
+
+	pt.db = rawdb.NewMemoryDatabase()
+	pt.genesis = genspec.MustCommit(pt.db)
+}
+
+// newEngine creates an engine trusting the local validator as the signer of
+// every generated header, optionally authorized to sign with its key.
+func (pt *pipelineTester) newEngine(authorize bool) *Dpos {
+	engine := New(pt.config, pt.db, nil, pt.genesis.Hash())
+	if authorize {
+		signer := types.NewEIP155Signer(pt.config.ChainID)
+		engine.Authorize(pt.validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(data), pt.key)
+		}, func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+			return types.SignTx(tx, signer, pt.key)
+		})
+	}
+	return engine
+}
+
+// generate assembles n blocks with the given engine.
+func (pt *pipelineTester) generate(engine *Dpos, n int) []*types.Block {
+	blocks, _ := core.GenerateChain(pt.config, pt.genesis, &alternatingTestEngine{engine}, pt.db, n, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(pt.validator)
+		if i > 0 {
+			engine.signatures.Add(b.PrevBlock(i-1).Hash(), pt.validator)
+		}
+	})
+	return blocks
+}
+
+// verify replays the given block on top of its parent with the given engine,
+// returning the resulting header and receipts.
+func (pt *pipelineTester) verify(engine *Dpos, parent *types.Block, block *types.Block, reader *testChainReader, systemTxs []*types.Transaction) (*types.Header, types.Receipts, error) {
+	engine.signatures.Add(parent.Hash(), pt.validator)
+
+	statedb, err := state.New(parent.Root(), state.NewDatabase(pt.db), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		header   = types.CopyHeader(block.Header())
+		gasPool  = new(core.GasPool).AddGas(header.GasLimit)
+		usedGas  = new(uint64)
+		txs      []*types.Transaction
+		receipts []*types.Receipt
+	)
+	for i, tx := range block.Transactions() {
+		if isSystemTx, _ := engine.IsSystemTransaction(tx, header); isSystemTx {
+			systemTxs = append(systemTxs, tx)
+			continue
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		receipt, err := core.ApplyTransaction(pt.config, reader, nil, gasPool, statedb, header, tx, usedGas, vm.Config{})
+		if err != nil {
+			return nil, nil, err
+		}
+		txs, receipts = append(txs, tx), append(receipts, receipt)
+	}
+	if err := engine.Finalize(reader, header, statedb, &txs, nil, &receipts, &systemTxs, usedGas); err != nil {
+		return nil, nil, err
+	}
+	return header, receipts, nil
+}
+
+// Tests that verifying a block replays the very same system calls that were
+// run when it was assembled.
+func TestSystemActionsMineVerify(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+
+	miner := pt.newEngine(true)
+	miner.doubleSigns.observe(pt.validator, signHeader(t, pt.key, pt.config.ChainID, 1, 100))
+	miner.doubleSigns.observe(pt.validator, signHeader(t, pt.key, pt.config.ChainID, 1, 101))
+
+	blocks := pt.generate(miner, 6)
+
+	verifier := pt.newEngine(false)
+	reader := newTestChainReader(pt.config, verifier, append([]*types.Block{pt.genesis}, blocks...)...)
+
+	parent := pt.genesis
+	for _, block := range blocks {
+		header, receipts, err := pt.verify(verifier, parent, block, reader, nil)
+		if err != nil {
+			t.Fatalf("block %d: verification failed: %v", block.NumberU64(), err)
+		}
+		if header.Root != block.Root() {
+			t.Errorf("block %d: state root mismatch: have %x, want %x", block.NumberU64(), header.Root, block.Root())
+		}
+		if hash := types.DeriveSha(receipts, new(trie.Trie)); hash != block.ReceiptHash() {
+			t.Errorf("block %d: receipt root mismatch: have %x, want %x", block.NumberU64(), hash, block.ReceiptHash())
+		}
+		if bloom := types.CreateBloom(receipts); bloom != block.Bloom() {
+			t.Errorf("block %d: bloom mismatch", block.NumberU64())
+		}
+		parent = block
+	}
+	// The double sign evidence must have been submitted once, in the first
+	// punishable block sealed in turn
+	for i, block := range blocks {
+		want := 0
+		if i == 1 {
+			want = 1
+		}
+		if txs := block.Transactions(); len(txs) != want || (want == 1 && *txs[0].To() != systemcontract.PunishV1ContractAddr) {
+			t.Fatalf("block %d: evidence transaction count mismatch: have %d, want %d", block.NumberU64(), len(txs), want)
+		}
+	}
+}
+
+// Tests that double sign evidences are only submitted from the DoubleSign fork
+// on, and that blocks carrying them before are rejected.
+func TestDoubleSignEvidenceFork(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	pt.config.DoubleSignBlock = nil
+
+	miner := pt.newEngine(true)
+	miner.doubleSigns.observe(pt.validator, signHeader(t, pt.key, pt.config.ChainID, 1, 100))
+	miner.doubleSigns.observe(pt.validator, signHeader(t, pt.key, pt.config.ChainID, 1, 101))
+
+	blocks := pt.generate(miner, 4)
+	for _, block := range blocks {
+		if txs := block.Transactions(); len(txs) != 0 {
+			t.Fatalf("block %d: evidence submitted before the fork", block.NumberU64())
+		}
+	}
+	evidence := miner.doubleSigns.pending()[0]
+	data, err := miner.evidenceData(pt.validator, evidence)
+	if err != nil {
+		t.Fatalf("failed to pack evidence: %v", err)
+	}
+	tx := types.NewTransaction(0, systemcontract.PunishV1ContractAddr, new(big.Int), 100000, new(big.Int), data)
+	tx, _ = types.SignTx(tx, types.NewEIP155Signer(pt.config.ChainID), pt.key)
+
+	verifier := pt.newEngine(false)
+	reader := newTestChainReader(pt.config, verifier, pt.genesis, blocks[0], blocks[1])
+	if _, _, err := pt.verify(verifier, blocks[0], blocks[1], reader, []*types.Transaction{tx}); err != errUnexpectedSystemTx {
+		t.Fatalf("verification error mismatch: have %v, want %v", err, errUnexpectedSystemTx)
+	}
+}
+
+// Tests that blocks carrying system transactions no system action accounts for
+// are rejected.
+func TestSystemActionsUnexpectedTx(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	blocks := pt.generate(pt.newEngine(false), 2)
+
+	verifier := pt.newEngine(false)
+	reader := newTestChainReader(pt.config, verifier, pt.genesis, blocks[0], blocks[1])
+
+	tx := types.NewTransaction(0, systemcontract.AddressListContractAddr, new(big.Int), 100000, new(big.Int), nil)
+	tx, _ = types.SignTx(tx, types.NewEIP155Signer(pt.config.ChainID), pt.key)
+
+	if _, _, err := pt.verify(verifier, blocks[0], blocks[1], reader, []*types.Transaction{tx}); err != errUnexpectedSystemTx {
+		t.Fatalf("verification error mismatch: have %v, want %v", err, errUnexpectedSystemTx)
+	}
+}
+
+// Tests that nodes assembling blocks without a validator key produce the same
+// state as the validators, both before and after system calls are recorded as
+// transactions.
+func TestSystemActionsWithoutSigner(t *testing.T) {
+	pt := newPipelineTester(t, big.NewInt(4))
+
+	signed := pt.generate(pt.newEngine(true), 5)
+	unsigned := pt.generate(pt.newEngine(false), 5)
+
+	for i := range signed {
+		if signed[i].Root() != unsigned[i].Root() {
+			t.Errorf("block %d: state root mismatch: signer %x, no signer %x", i+1, signed[i].Root(), unsigned[i].Root())
+		}
+		if have, want := len(unsigned[i].Transactions()), len(signed[i].Transactions()); have != want {
+			t.Errorf("block %d: system transaction count mismatch: have %d, want %d", i+1, have, want)
+		}
+	}
+	if len(signed[4].Transactions()) == 0 {
+		t.Errorf("no system transactions recorded after the fork")
+	}
+}
+
+// Tests that system calls are recorded as system transactions with receipts
+// once the SystemTx fork activates, and only afterwards.
+func TestSystemCallTransactions(t *testing.T) {
+	pt := newPipelineTester(t, big.NewInt(4))
+	blocks := pt.generate(pt.newEngine(true), 8)
+
+	verifier := pt.newEngine(false)
+	reader := newTestChainReader(pt.config, verifier, append([]*types.Block{pt.genesis}, blocks...)...)
+
+	parent := pt.genesis
+	for _, block := range blocks {
+		header, receipts, err := pt.verify(verifier, parent, block, reader, nil)
+		if err != nil {
+			t.Fatalf("block %d: verification failed: %v", block.NumberU64(), err)
+		}
+		if header.Root != block.Root() {
+			t.Errorf("block %d: state root mismatch: have %x, want %x", block.NumberU64(), header.Root, block.Root())
+		}
+		if hash := types.DeriveSha(receipts, new(trie.Trie)); hash != block.ReceiptHash() {
+			t.Errorf("block %d: receipt root mismatch: have %x, want %x", block.NumberU64(), hash, block.ReceiptHash())
+		}
+		parent = block
+
+		txs := block.Transactions()
+		if block.NumberU64() < 4 {
+			if len(txs) != 0 {
+				t.Errorf("block %d: system transactions before the fork: have %d, want 0", block.NumberU64(), len(txs))
+			}
+			continue
+		}
+		// Every block after the fork distributes its rewards
+		if len(txs) == 0 {
+			t.Fatalf("block %d: system transactions missing after the fork", block.NumberU64())
+		}
+		for i, tx := range txs {
+			if isSystemTx, _ := verifier.IsSystemTransaction(tx, block.Header()); !isSystemTx {
+				t.Errorf("block %d: transaction %d is not a system transaction", block.NumberU64(), i)
+			}
+			if len(receipts[i].Logs) != 1 || receipts[i].Logs[0].Address != *tx.To() {
+				t.Errorf("block %d: transaction %d: logs not recorded", block.NumberU64(), i)
+			}
+		}
+		if !types.BloomLookup(block.Bloom(), systemcontract.DposFactoryContractAddr) {
+			t.Errorf("block %d: reward logs missing from bloom", block.NumberU64())
+		}
+	}
+}
+
+// Tests that blocks dropping or altering the system transactions recording the
+// system calls are rejected after the SystemTx fork.
+func TestSystemCallTransactionsEnforced(t *testing.T) {
+	pt := newPipelineTester(t, big.NewInt(0))
+	blocks := pt.generate(pt.newEngine(true), 4)
+
+	verifier := pt.newEngine(false)
+	reader := newTestChainReader(pt.config, verifier, pt.genesis, blocks[0], blocks[1], blocks[2], blocks[3])
+	for _, block := range blocks[:3] {
+		verifier.signatures.Add(block.Hash(), pt.validator)
+	}
+	txs := blocks[3].Transactions()
+	if len(txs) == 0 {
+		t.Fatalf("system transactions missing")
+	}
+	missing := types.NewBlockWithHeader(blocks[3].Header()).WithBody(txs[:len(txs)-1], nil)
+	if _, _, err := pt.verify(verifier, blocks[2], missing, reader, nil); err != errMissingSystemTx {
+		t.Fatalf("missing transaction error mismatch: have %v, want %v", err, errMissingSystemTx)
+	}
+	last := txs[len(txs)-1]
+	forged, _ := types.SignTx(types.NewTransaction(last.Nonce(), *last.To(), big.NewInt(1), last.Gas(), new(big.Int), last.Data()), types.NewEIP155Signer(pt.config.ChainID), pt.key)
+	altered := types.NewBlockWithHeader(blocks[3].Header()).WithBody(append(append([]*types.Transaction{}, txs[:len(txs)-1]...), forged), nil)
+	if _, _, err := pt.verify(verifier, blocks[2], altered, reader, nil); err == nil || !strings.HasPrefix(err.Error(), "expected system tx hash") {
+		t.Fatalf("altered transaction error mismatch: have %v, want hash mismatch", err)
+	}
+}
+
+// Tests that sealing fails with a clear error when the validator key can't be
+// used, e.g. because the remote signer holding it is down.
+func TestSealSignerUnavailable(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	blocks := pt.generate(pt.newEngine(false), 1)
+
+	engine := pt.newEngine(false)
+	engine.Authorize(pt.validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return nil, errors.New("connection refused")
+	}, nil)
+	reader := newTestChainReader(pt.config, engine, pt.genesis, blocks[0])
+
+	header := blocks[0].Header()
+	header.Extra = make([]byte, extraVanity+extraSeal)
+
+	err := engine.Seal(reader, blocks[0].WithSeal(header), make(chan *types.Block, 1), make(chan struct{}))
+	if !errors.Is(err, errSignerUnavailable) {
+		t.Fatalf("seal error mismatch: have %v, want %v", err, errSignerUnavailable)
+	}
+}
@@ -0,0 +1,201 @@
+package dpos
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/por"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	validatorReady  = 1 // State of a validator contract taking part in the elections
+	validatorPaused = 2 // State of a validator contract paused by the factory admin
+)
+
+var (
+	// errInvalidPorCount is returned if a block contains more than one
+	// Proof-of-Resources system transaction.
+	errInvalidPorCount = errors.New("invalid PoR results tx count")
+
+	// errInvalidPorTx is returned if a Proof-of-Resources system transaction
+	// doesn't pause or resume a validator.
+	errInvalidPorTx = errors.New("invalid PoR results tx")
+)
+
+// SetChallenger sets the Proof-of-Resources challenger of the local validators,
+// whose results are recorded on chain in the blocks they seal.
+func (p *Dpos) SetChallenger(challenger *por.Challenger) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.challenger = challenger
+}
+
+// PorValidators implements por.Registry, returning the validators taking part
+// in the epoch starting at the given block.
+func (p *Dpos) PorValidators(chain consensus.ChainHeaderReader, header *types.Header) ([]common.Address, error) {
+	snap, err := p.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.validators(), nil
+}
+
+// IsPorValidator returns whether the account is a validator at the head of the
+// chain. Local providers only answer the challenges of such accounts.
+func (p *Dpos) IsPorValidator(chain consensus.ChainHeaderReader, val common.Address) bool {
+	head := chain.CurrentHeader()
+	if head == nil {
+		return false
+	}
+	snap, err := p.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		return false
+	}
+	_, ok := snap.Validators[val]
+	return ok
+}
+
+// porResult returns the first challenge result of the block author which isn't
+// reflected by the state of the provider's validator contract yet: failed
+// providers get paused, paused providers passing again get resumed. Results of
+// the current epoch take priority over the ones of the previous epoch. It
+// returns nil if there is nothing to record.
+func (p *Dpos) porResult(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) (*por.Result, error) {
+	p.lock.RLock()
+	challenger := p.challenger
+	p.lock.RUnlock()
+
+	if challenger == nil {
+		return nil, nil
+	}
+	epochs := []uint64{header.Number.Uint64() / p.config.Epoch}
+	if epochs[0] > 0 {
+		epochs = append(epochs, epochs[0]-1)
+	}
+	var (
+		ctx  = newChainContext(chain, p)
+		seen = make(map[common.Address]bool)
+	)
+	for _, epoch := range epochs {
+		for _, res := range challenger.Results(epoch, header.Coinbase) {
+			if seen[res.Provider] {
+				continue
+			}
+			seen[res.Provider] = true
+
+			contract, err := p.readValidatorContract(ctx, header, state, res.Provider)
+			if err != nil {
+				return nil, err
+			}
+			if contract == (common.Address{}) {
+				continue
+			}
+			valState, err := p.readValidatorState(ctx, header, state, contract)
+			if err != nil {
+				return nil, err
+			}
+			if (res.Passed && valState == validatorPaused) || (!res.Passed && valState == validatorReady) {
+				return res, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// submitPorResult creates the system transaction recording a challenge result
+// of the local validator, pausing or resuming the provider in the factory
+// contract. At most one result is recorded per block. It returns a nil
+// transaction if there is nothing to record.
+func (p *Dpos) submitPorResult(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, totalTxIndex int) (*types.Transaction, *types.Receipt, error) {
+	res, err := p.porResult(chain, header, state)
+	if err != nil || res == nil {
+		return nil, nil, err
+	}
+	data, err := p.abi[systemcontract.DposFactoryContractName].Pack("updateValidatorState", res.Provider, !res.Passed)
+	if err != nil {
+		log.Error("Can't pack data for updateValidatorState", "error", err)
+		return nil, nil, err
+	}
+	admin, err := p.readFactoryAdmin(newChainContext(chain, p), header, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	// make PoR result transaction
+	nonce := state.GetNonce(header.Coinbase)
+	tx := types.NewTransaction(nonce, *systemcontract.GetValidatorAddr(header.Number, p.chainConfig), new(big.Int), header.GasLimit, new(big.Int), data)
+	tx, err = p.signSystemTx(chain, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	//add nonce for validator
+	state.SetNonce(header.Coinbase, nonce+1)
+	receipt := p.executePorResultMsg(chain, header, state, admin, data, totalTxIndex, tx.Hash(), common.Hash{})
+
+	return tx, receipt, nil
+}
+
+// replayPorResult checks and applies a PoR result transaction of an imported
+// block.
+func (p *Dpos) replayPorResult(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, totalTxIndex int, tx *types.Transaction) (*types.Receipt, error) {
+	sender, err := types.Sender(p.signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != header.Coinbase {
+		return nil, errors.New("invalid sender for PoR result transaction")
+	}
+	data := tx.Data()
+	if len(data) < 4 || tx.Value().Sign() != 0 {
+		return nil, errInvalidPorTx
+	}
+	factoryABI := p.abi[systemcontract.DposFactoryContractName]
+	method, err := factoryABI.MethodById(data[:4])
+	if err != nil || method.Name != "updateValidatorState" {
+		return nil, errInvalidPorTx
+	}
+	if args, err := method.Inputs.Unpack(data[4:]); err != nil || len(args) != 2 {
+		return nil, errInvalidPorTx
+	}
+	admin, err := p.readFactoryAdmin(newChainContext(chain, p), header, state)
+	if err != nil {
+		return nil, err
+	}
+	nonce := state.GetNonce(sender)
+	//add nonce for validator
+	state.SetNonce(sender, nonce+1)
+	receipt := p.executePorResultMsg(chain, header, state, admin, data, totalTxIndex, tx.Hash(), header.Hash())
+
+	return receipt, nil
+}
+
+// executePorResultMsg pauses or resumes a provider in the factory contract on
+// behalf of its admin, like a governance proposal. The returned receipt is
+// never nil.
+func (p *Dpos) executePorResultMsg(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, admin common.Address, data []byte, totalTxIndex int, txHash, bHash common.Hash) *types.Receipt {
+	msg := types.NewMessage(admin, systemcontract.GetValidatorAddr(header.Number, p.chainConfig), 0, new(big.Int), header.GasLimit, new(big.Int), data, nil, false)
+	state.Prepare(txHash, bHash, totalTxIndex)
+	_, err := vmcaller.ExecuteMsg(msg, state, header, newChainContext(chain, p), p.chainConfig)
+	state.Finalise(true)
+
+	// PoR result transaction will not actually consumes gas
+	receipt := types.NewReceipt([]byte{}, err != nil, header.GasUsed)
+	// Set the receipt logs and create a bloom for filtering
+	receipt.Logs = state.GetLogs(txHash)
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	receipt.TxHash = txHash
+	receipt.BlockHash = state.BlockHash()
+	receipt.BlockNumber = header.Number
+	receipt.TransactionIndex = uint(state.TxIndex())
+
+	log.Info("executePorResultMsg", "number", header.Number, "validator", header.Coinbase, "txHash", txHash.String(), "err", err)
+
+	return receipt
+}
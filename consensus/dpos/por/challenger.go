@@ -0,0 +1,242 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package por
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// keepEpochs is the number of epochs whose results are retained after being
+// scheduled, giving the local validators time to record them on chain.
+const keepEpochs = 2
+
+// Transport delivers challenges to providers.
+type Transport interface {
+	// Providers returns the declarations of the reachable providers.
+	Providers() []Declaration
+
+	// Challenge sends the challenge to its provider and waits for the answer
+	// until the timeout expires.
+	Challenge(c *Challenge, timeout time.Duration) (*Response, error)
+}
+
+// Registry resolves the validators of an epoch from the chain.
+type Registry interface {
+	// PorValidators returns the validators taking part in the epoch starting
+	// at the given block.
+	PorValidators(chain consensus.ChainHeaderReader, header *types.Header) ([]common.Address, error)
+}
+
+// Chain is the chain view the challenger needs to schedule epochs.
+type Chain interface {
+	consensus.ChainHeaderReader
+
+	// SubscribeChainHeadEvent subscribes to new canonical chain heads.
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// Challenger is the validator side of the challenge protocol. At every epoch
+// block it challenges the providers assigned to the local validators and keeps
+// the results until they are recorded on chain.
+type Challenger struct {
+	transport Transport
+	config    *Config
+
+	validators map[common.Address]SignerFn             // Local validators challenging providers
+	results    map[uint64]map[common.Address][]*Result // Epoch -> validator -> results
+	lock       sync.RWMutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewChallenger creates a challenger sending its challenges through transport.
+func NewChallenger(transport Transport, config *Config) *Challenger {
+	return &Challenger{
+		transport:  transport,
+		config:     config,
+		validators: make(map[common.Address]SignerFn),
+		results:    make(map[uint64]map[common.Address][]*Result),
+		quit:       make(chan struct{}),
+	}
+}
+
+// Authorize adds a local validator on whose behalf providers are challenged,
+// signing the challenges with signFn.
+func (c *Challenger) Authorize(validator common.Address, signFn SignerFn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.validators[validator] = signFn
+}
+
+// Deauthorize stops challenging providers on behalf of a local validator.
+func (c *Challenger) Deauthorize(validator common.Address) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.validators, validator)
+}
+
+// Start schedules a challenge round at every epoch block imported into chain.
+func (c *Challenger) Start(chain Chain, registry Registry) {
+	c.wg.Add(1)
+	go c.loop(chain, registry)
+}
+
+// Stop terminates the scheduling loop and waits for running rounds to finish.
+func (c *Challenger) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+func (c *Challenger) loop(chain Chain, registry Registry) {
+	defer c.wg.Done()
+
+	// Rounds are tracked apart so that only Start touches the outer wait group
+	var rounds sync.WaitGroup
+	defer rounds.Wait()
+
+	heads := make(chan core.ChainHeadEvent, 10)
+	sub := chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-heads:
+			header := ev.Block.Header()
+			epoch := chain.Config().Dpos.Epoch
+			if header.Number.Uint64()%epoch != 0 {
+				continue
+			}
+			validators, err := registry.PorValidators(chain, header)
+			if err != nil {
+				log.Warn("Failed to retrieve PoR validators", "number", header.Number, "err", err)
+				continue
+			}
+			providers := c.transport.Providers()
+
+			rounds.Add(1)
+			go func() {
+				defer rounds.Done()
+				c.Run(header.Number.Uint64()/epoch, header.Hash(), validators, providers)
+			}()
+
+		case <-sub.Err():
+			return
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Run challenges all providers assigned to the local validators in the given
+// epoch and stores the results. It blocks until every challenge is answered or
+// timed out.
+func (c *Challenger) Run(epoch uint64, seed common.Hash, validators []common.Address, providers []Declaration) {
+	c.lock.RLock()
+	local := make(map[common.Address]SignerFn, len(c.validators))
+	for val, signFn := range c.validators {
+		local[val] = signFn
+	}
+	c.lock.RUnlock()
+
+	var (
+		assigned = Assign(seed, validators, providers)
+		results  = make(chan *Result)
+		pending  int
+	)
+	for val, signFn := range local {
+		for _, decl := range assigned[val] {
+			challenge := &Challenge{
+				Epoch:     epoch,
+				Validator: val,
+				Provider:  decl.Provider,
+				Seed:      seed,
+				Resources: decl.Resources,
+			}
+			id := challenge.ID()
+			sig, err := signFn(accounts.Account{Address: val}, accounts.MimetypeTextPlain, id[:])
+			if err != nil {
+				log.Warn("Failed to sign PoR challenge", "validator", val, "err", err)
+				continue
+			}
+			challenge.Signature = sig
+			pending++
+			go func() {
+				results <- c.challenge(challenge)
+			}()
+		}
+	}
+	collected := make(map[common.Address][]*Result)
+	for ; pending > 0; pending-- {
+		res := <-results
+		collected[res.Validator] = append(collected[res.Validator], res)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.results[epoch] = collected
+	for old := range c.results {
+		if old+keepEpochs < epoch {
+			delete(c.results, old)
+		}
+	}
+}
+
+// challenge sends a single challenge and verifies the answer.
+func (c *Challenger) challenge(challenge *Challenge) *Result {
+	result := &Result{
+		Epoch:     challenge.Epoch,
+		Validator: challenge.Validator,
+		Provider:  challenge.Provider,
+	}
+	res, err := c.transport.Challenge(challenge, c.config.Timeout)
+	if err == nil {
+		err = Verify(challenge, res, c.config)
+	}
+	if err != nil {
+		log.Debug("Provider failed PoR challenge", "epoch", challenge.Epoch, "provider", challenge.Provider, "err", err)
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// Results returns the results the validator gathered in the given epoch, sorted
+// by provider address.
+func (c *Challenger) Results(epoch uint64, validator common.Address) []*Result {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	results := append([]*Result{}, c.results[epoch][validator]...)
+	sort.Slice(results, func(i, j int) bool {
+		return bytes.Compare(results[i].Provider[:], results[j].Provider[:]) < 0
+	})
+	return results
+}
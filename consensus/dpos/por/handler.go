@@ -0,0 +1,318 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package por
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// handshakeTimeout is the maximum allowed time for the `por` handshake to
+// complete before dropping the connection as malicious.
+const handshakeTimeout = 5 * time.Second
+
+// Peer is a collection of relevant information we have about a `por` peer.
+type Peer struct {
+	id string // Unique ID for the peer, cached
+
+	*p2p.Peer                   // The embedded P2P package peer
+	rw        p2p.MsgReadWriter // Input/output streams for por
+	version   uint              // Protocol version negotiated
+
+	provider  common.Address // Provider account proven during the handshake
+	resources Resources      // Resources declared by the provider during the handshake
+	busy      int32          // Flag whether a challenge is being answered
+
+	logger log.Logger // Contextual logger with the peer id injected
+}
+
+// newPeer create a wrapper for a network connection and negotiated protocol
+// version.
+func newPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
+	id := p.ID().String()
+	return &Peer{
+		id:      id,
+		Peer:    p,
+		rw:      rw,
+		version: version,
+		logger:  log.New("peer", id[:8]),
+	}
+}
+
+// Provider returns the provider account of the peer, empty if the peer is not
+// a provider.
+func (p *Peer) Provider() common.Address {
+	return p.provider
+}
+
+// Handler runs the `por` protocol, answering challenges with the local
+// responder and delivering the challenges of the local challenger. It
+// implements Transport.
+type Handler struct {
+	self      enode.ID   // Local node id, signed by providers during the handshake
+	responder *Responder // Local provider, nil if the node isn't a provider
+
+	providers map[common.Address]*Peer       // Connected providers
+	pending   map[common.Hash]*Peer          // Providers of the challenges waiting for an answer
+	answers   map[common.Hash]chan *Response // Delivery channels of the pending challenges
+	lock      sync.Mutex
+}
+
+// NewHandler creates a `por` protocol handler. The responder may be nil if the
+// local node doesn't act as a provider.
+func NewHandler(self enode.ID, responder *Responder) *Handler {
+	return &Handler{
+		self:      self,
+		responder: responder,
+		providers: make(map[common.Address]*Peer),
+		pending:   make(map[common.Hash]*Peer),
+		answers:   make(map[common.Hash]chan *Response),
+	}
+}
+
+// MakeProtocols constructs the P2P protocol definitions for `por`.
+func (h *Handler) MakeProtocols() []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure
+
+		protocols[i] = p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  protocolLengths[version],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return h.runPeer(newPeer(version, p, rw))
+			},
+		}
+	}
+	return protocols
+}
+
+// runPeer manages the life cycle of a `por` peer. When this function
+// terminates, the peer is disconnected.
+func (h *Handler) runPeer(peer *Peer) error {
+	if err := h.handshake(peer); err != nil {
+		peer.logger.Debug("PoR handshake failed", "err", err)
+		return err
+	}
+	if peer.provider != (common.Address{}) {
+		h.lock.Lock()
+		h.providers[peer.provider] = peer
+		h.lock.Unlock()
+
+		defer func() {
+			h.lock.Lock()
+			if h.providers[peer.provider] == peer {
+				delete(h.providers, peer.provider)
+			}
+			h.lock.Unlock()
+		}()
+	}
+	for {
+		if err := h.handleMessage(peer); err != nil {
+			peer.logger.Debug("Message handling failed in `por`", "err", err)
+			return err
+		}
+	}
+}
+
+// handshake exchanges the status packets and validates the provider proof of
+// the remote peer.
+func (h *Handler) handshake(peer *Peer) error {
+	status := new(StatusPacket)
+	if h.responder != nil {
+		decl := h.responder.Declaration()
+		sig, err := h.responder.Sign(statusSigData(h.self, decl.Resources))
+		if err != nil {
+			return err
+		}
+		status.Provider, status.Resources, status.Signature = decl.Provider, decl.Resources, sig
+	}
+	errc := make(chan error, 2)
+	go func() {
+		errc <- p2p.Send(peer.rw, StatusMsg, status)
+	}()
+	go func() {
+		errc <- h.readStatus(peer)
+	}()
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+		case <-timeout.C:
+			return p2p.DiscReadTimeout
+		}
+	}
+	return nil
+}
+
+// readStatus reads the remote status packet and verifies the provider proof.
+func (h *Handler) readStatus(peer *Peer) error {
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+
+	if msg.Code != StatusMsg {
+		return fmt.Errorf("%w: first msg has code %x (!= %x)", errNoStatusMsg, msg.Code, StatusMsg)
+	}
+	if msg.Size > maxMessageSize {
+		return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
+	}
+	var status StatusPacket
+	if err := msg.Decode(&status); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	if status.Provider == (common.Address{}) {
+		return nil
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(statusSigData(peer.ID(), status.Resources)), status.Signature)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != status.Provider {
+		return errBadProvider
+	}
+	if err := status.Resources.validate(); err != nil {
+		return fmt.Errorf("%w: %v", errBadProvider, err)
+	}
+	peer.provider, peer.resources = status.Provider, status.Resources
+	return nil
+}
+
+// handleMessage is invoked whenever an inbound message is received from a
+// remote peer on the `por` protocol. The remote connection is torn down upon
+// returning any error.
+func (h *Handler) handleMessage(peer *Peer) error {
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > maxMessageSize {
+		return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case ChallengeMsg:
+		var challenge Challenge
+		if err := msg.Decode(&challenge); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		// Solving is expensive, answer a single challenge per peer at a time
+		// and drop anything else arriving meanwhile.
+		if h.responder == nil || !atomic.CompareAndSwapInt32(&peer.busy, 0, 1) {
+			return nil
+		}
+		go func() {
+			defer atomic.StoreInt32(&peer.busy, 0)
+
+			res, err := h.responder.Respond(&challenge)
+			if err != nil {
+				peer.logger.Debug("Failed to answer PoR challenge", "err", err)
+				return
+			}
+			p2p.Send(peer.rw, ResponseMsg, res)
+		}()
+		return nil
+
+	case ResponseMsg:
+		var res Response
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		// Only accept answers from the provider the challenge was sent to
+		h.lock.Lock()
+		ch, ok := h.answers[res.ID]
+		ok = ok && h.pending[res.ID] == peer
+		h.lock.Unlock()
+		if ok {
+			select {
+			case ch <- &res:
+			default:
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %v", errInvalidMsgCode, msg.Code)
+	}
+}
+
+// Providers implements Transport, returning the declarations of the connected
+// providers sorted by account.
+func (h *Handler) Providers() []Declaration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	decls := make([]Declaration, 0, len(h.providers))
+	for provider, peer := range h.providers {
+		decls = append(decls, Declaration{Provider: provider, Resources: peer.resources})
+	}
+	sort.Slice(decls, func(i, j int) bool {
+		return bytes.Compare(decls[i].Provider[:], decls[j].Provider[:]) < 0
+	})
+	return decls
+}
+
+// Challenge implements Transport, sending the challenge to the connected
+// provider and waiting for its answer.
+func (h *Handler) Challenge(c *Challenge, timeout time.Duration) (*Response, error) {
+	id := c.ID()
+	ch := make(chan *Response, 1)
+
+	h.lock.Lock()
+	peer := h.providers[c.Provider]
+	if peer != nil {
+		h.pending[id], h.answers[id] = peer, ch
+	}
+	h.lock.Unlock()
+
+	if peer == nil {
+		return nil, errUnknownProvider
+	}
+	defer func() {
+		h.lock.Lock()
+		delete(h.pending, id)
+		delete(h.answers, id)
+		h.lock.Unlock()
+	}()
+	if err := p2p.Send(peer.rw, ChallengeMsg, c); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-timer.C:
+		return nil, errTimeout
+	}
+}
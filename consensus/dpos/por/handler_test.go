@@ -0,0 +1,122 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package por
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// connect runs the `por` protocol between two handlers over an in-memory pipe,
+// returning the channels the protocol errors of both sides are reported on.
+func connect(local *Handler, remote *Handler) (chan error, chan error) {
+	app, net := p2p.MsgPipe()
+
+	localErr, remoteErr := make(chan error, 1), make(chan error, 1)
+	go func() {
+		localErr <- local.runPeer(newPeer(por1, p2p.NewPeer(remote.self, "remote", nil), app))
+	}()
+	go func() {
+		remoteErr <- remote.runPeer(newPeer(por1, p2p.NewPeer(local.self, "local", nil), net))
+	}()
+	return localErr, remoteErr
+}
+
+// waitProvider waits until the handler sees the provider connected.
+func waitProvider(t *testing.T, h *Handler, provider common.Address) {
+	for i := 0; i < 100; i++ {
+		h.lock.Lock()
+		_, ok := h.providers[provider]
+		h.lock.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("provider %x never connected", provider)
+}
+
+// Tests that challenges are carried to remote providers and answered, and that
+// the providers' declarations are learnt during the handshake.
+func TestHandlerChallenge(t *testing.T) {
+	var (
+		provider, signFn = newTestSigner()
+		validator, valFn = newTestSigner()
+		declared         = Resources{CPU: 2, Memory: 128}
+	)
+	local := NewHandler(enode.ID{0x01}, nil)
+	remote := NewHandler(enode.ID{0x02}, NewResponder(provider, signFn, onlyValidator(validator), providerConfig(declared)))
+	connect(local, remote)
+	waitProvider(t, local, provider)
+
+	if decls := local.Providers(); len(decls) != 1 || decls[0] != (Declaration{Provider: provider, Resources: declared}) {
+		t.Fatalf("provider declarations mismatch: have %v", decls)
+	}
+	challenge := signChallenge(&Challenge{
+		Epoch:     7,
+		Validator: validator,
+		Provider:  provider,
+		Seed:      common.HexToHash("0x07"),
+		Resources: declared,
+	}, valFn)
+	res, err := local.Challenge(challenge, time.Second)
+	if err != nil {
+		t.Fatalf("challenge failed: %v", err)
+	}
+	if err := Verify(challenge, res, testConfig); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	// Challenges not signed by a validator must be left unanswered
+	unsigned := *challenge
+	unsigned.Epoch, unsigned.Signature = 8, nil
+	if _, err := local.Challenge(&unsigned, 200*time.Millisecond); err != errTimeout {
+		t.Fatalf("unsigned challenge error mismatch: have %v, want %v", err, errTimeout)
+	}
+	// The provider has no challenger, so it knows no providers to reach
+	if _, err := remote.Challenge(challenge, time.Second); err != errUnknownProvider {
+		t.Fatalf("challenge error mismatch: have %v, want %v", err, errUnknownProvider)
+	}
+}
+
+// Tests that peers claiming a provider account they can't prove, or declaring
+// more resources than can be challenged, are dropped.
+func TestHandlerBadProvider(t *testing.T) {
+	provider, signFn := newTestSigner()
+	_, otherFn := newTestSigner()
+
+	tests := []*Responder{
+		NewResponder(provider, otherFn, onlyValidator(common.Address{}), providerConfig(Resources{CPU: 1})),
+		NewResponder(provider, signFn, onlyValidator(common.Address{}), providerConfig(Resources{CPU: MaxCPU + 1})),
+	}
+	for i, responder := range tests {
+		localErr, _ := connect(NewHandler(enode.ID{0x01}, nil), NewHandler(enode.ID{0x02}, responder))
+
+		select {
+		case err := <-localErr:
+			if !errors.Is(err, errBadProvider) {
+				t.Fatalf("test %d: handshake error mismatch: have %v, want %v", i, err, errBadProvider)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: bad provider not dropped", i)
+		}
+	}
+}
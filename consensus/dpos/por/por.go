@@ -0,0 +1,267 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package por implements the Proof-of-Resources challenge protocol.
+//
+// Providers declare an amount of cloud resources, signed with their account when
+// connecting to the validators. Every epoch each provider is assigned to one of
+// the active validators, which challenges it to prove that the declared
+// resources are really available. The outcomes are kept by the validator node.
+package por
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// errUnknownProvider is returned if a challenge is addressed to a provider
+	// that is not reachable by the transport.
+	errUnknownProvider = errors.New("unknown provider")
+
+	// errWrongProvider is returned if a responder is asked to answer a challenge
+	// addressed to somebody else.
+	errWrongProvider = errors.New("challenge addressed to another provider")
+
+	// errTimeout is returned if a provider failed to answer a challenge in time.
+	errTimeout = errors.New("challenge timed out")
+
+	// errInvalidDigest is returned if a provider answered with a wrong digest.
+	errInvalidDigest = errors.New("invalid challenge digest")
+
+	// errInvalidSignature is returned if a response is not signed by the
+	// challenged provider.
+	errInvalidSignature = errors.New("invalid response signature")
+
+	// errUnauthorizedValidator is returned if a challenge is not signed by one
+	// of the current validators.
+	errUnauthorizedValidator = errors.New("challenge not signed by a current validator")
+
+	// errResourcesMismatch is returned if a challenge asks for other resources
+	// than the ones declared by the provider.
+	errResourcesMismatch = errors.New("challenged resources differ from the declared ones")
+
+	// errResourcesTooLarge is returned if resources exceed the amount that can
+	// be challenged.
+	errResourcesTooLarge = errors.New("resources too large")
+)
+
+const (
+	// MaxCPU is the maximum number of cores a provider may declare.
+	MaxCPU = 1024
+
+	// MaxMemory is the maximum amount of memory in MiB a provider may declare.
+	MaxMemory = 256 * 1024
+
+	// maxScratchpad is the maximum number of scratchpad items a challenge may
+	// require, bounding the memory spent by both the provider and the validator.
+	maxScratchpad = 64 * 1024 * 1024 / common.HashLength
+
+	// maxRounds is the maximum number of mixing rounds a challenge may require.
+	maxRounds = 16 * 1024 * 1024
+)
+
+// SignerFn is a signer callback function to request a challenge or a response
+// to be signed by the backing validator or provider account.
+type SignerFn func(accounts.Account, string, []byte) ([]byte, error)
+
+// Config contains the tunables of the challenge protocol.
+type Config struct {
+	Timeout          time.Duration  // Time a provider has to answer a challenge
+	RoundsPerCore    uint64         // Number of scratchpad mixing rounds required per declared core
+	ScratchpadPerMiB uint64         // Scratchpad bytes required per declared MiB of memory
+	Provider         common.Address // Account answering challenges, empty if not a provider
+	Resources        Resources      // Resources declared by the provider account
+}
+
+// DefaultConfig contains the default settings of the challenge protocol.
+var DefaultConfig = Config{
+	Timeout:          5 * time.Second,
+	RoundsPerCore:    4096,
+	ScratchpadPerMiB: 1024,
+}
+
+// Resources is the amount of cloud resources a provider declares.
+type Resources struct {
+	CPU     uint64 // Number of virtual cores
+	Memory  uint64 // Memory in MiB
+	Storage uint64 // Disk space in GiB, declared only and not challenged yet
+}
+
+// work returns the scratchpad size and the number of mixing rounds required to
+// prove the resources, failing if they exceed the challengeable limits.
+func (r Resources) work(config *Config) (uint64, uint64, error) {
+	if err := r.validate(); err != nil {
+		return 0, 0, err
+	}
+	bytes, overflow := mul(r.Memory, config.ScratchpadPerMiB)
+	if overflow || bytes/common.HashLength > maxScratchpad {
+		return 0, 0, fmt.Errorf("%w: %d MiB scratchpad", errResourcesTooLarge, r.Memory)
+	}
+	rounds, overflow := mul(r.CPU, config.RoundsPerCore)
+	if overflow || rounds > maxRounds {
+		return 0, 0, fmt.Errorf("%w: %d cores mixing", errResourcesTooLarge, r.CPU)
+	}
+	items := bytes / common.HashLength
+	if items == 0 {
+		items = 1
+	}
+	if rounds == 0 {
+		rounds = 1
+	}
+	return items, rounds, nil
+}
+
+// validate checks that the resources don't exceed the declarable limits.
+func (r Resources) validate() error {
+	if r.CPU > MaxCPU || r.Memory > MaxMemory {
+		return fmt.Errorf("%w: %d cores, %d MiB", errResourcesTooLarge, r.CPU, r.Memory)
+	}
+	return nil
+}
+
+// mul multiplies two integers, reporting whether the product overflowed.
+func mul(x, y uint64) (uint64, bool) {
+	if x == 0 || y == 0 {
+		return 0, false
+	}
+	z := x * y
+	return z, z/y != x
+}
+
+// Declaration is the record of a provider and the resources it declared.
+type Declaration struct {
+	Provider  common.Address
+	Resources Resources
+}
+
+// Challenge is sent by a validator to a provider to request a proof of the
+// declared resources.
+type Challenge struct {
+	Epoch     uint64
+	Validator common.Address
+	Provider  common.Address
+	Seed      common.Hash
+	Resources Resources
+	Signature []byte // Validator signature over the challenge id
+}
+
+// ID returns the unique identifier of the challenge, used to match responses.
+// The validator signature is not part of it.
+func (c *Challenge) ID() common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{c.Epoch, c.Validator, c.Provider, c.Seed, c.Resources})
+	return crypto.Keccak256Hash(enc)
+}
+
+// signer recovers the account that signed the challenge.
+func (c *Challenge) signer() (common.Address, error) {
+	id := c.ID()
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(id[:]), c.Signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// Response is the answer of a provider to a challenge.
+type Response struct {
+	ID        common.Hash // Identifier of the answered challenge
+	Digest    common.Hash // Outcome of the scratchpad mixing
+	Signature []byte      // Provider signature over the id and digest
+}
+
+// sigData returns the data signed by the provider for the response.
+func (r *Response) sigData() []byte {
+	return append(append([]byte{}, r.ID[:]...), r.Digest[:]...)
+}
+
+// Result is the outcome of a challenge.
+type Result struct {
+	Epoch     uint64
+	Validator common.Address
+	Provider  common.Address
+	Passed    bool
+}
+
+// Solve computes the digest answering a challenge. The provider has to keep a
+// scratchpad proportional to the declared memory and mix it a number of times
+// proportional to the declared cores. Verifying a digest costs as much as
+// computing it, which is fine since validators are assumed to have the spare
+// resources. Resources above the challengeable limits are rejected.
+func Solve(c *Challenge, config *Config) (common.Hash, error) {
+	items, rounds, err := c.Resources.work(config)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	pad := make([]common.Hash, items)
+	pad[0] = crypto.Keccak256Hash(c.Seed[:], c.Provider[:])
+	for i := uint64(1); i < items; i++ {
+		pad[i] = crypto.Keccak256Hash(pad[i-1][:])
+	}
+	mix := pad[items-1]
+	for i := uint64(0); i < rounds; i++ {
+		idx := binary.BigEndian.Uint64(mix[:8]) % items
+		mix = crypto.Keccak256Hash(mix[:], pad[idx][:])
+		pad[idx] = mix
+	}
+	return mix, nil
+}
+
+// Verify checks that a response correctly answers the challenge and is signed
+// by the challenged provider.
+func Verify(c *Challenge, res *Response, config *Config) error {
+	if res.ID != c.ID() {
+		return errInvalidDigest
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(res.sigData()), res.Signature)
+	if err != nil {
+		return errInvalidSignature
+	}
+	if crypto.PubkeyToAddress(*pubkey) != c.Provider {
+		return errInvalidSignature
+	}
+	digest, err := Solve(c, config)
+	if err != nil {
+		return err
+	}
+	if res.Digest != digest {
+		return errInvalidDigest
+	}
+	return nil
+}
+
+// Assign maps every provider to the validator responsible for challenging it
+// in the epoch identified by seed. The assignment is deterministic, so every
+// node derives the same schedule from the same epoch block.
+func Assign(seed common.Hash, validators []common.Address, providers []Declaration) map[common.Address][]Declaration {
+	assigned := make(map[common.Address][]Declaration)
+	if len(validators) == 0 {
+		return assigned
+	}
+	for _, decl := range providers {
+		hash := crypto.Keccak256(seed[:], decl.Provider[:])
+		val := validators[binary.BigEndian.Uint64(hash[:8])%uint64(len(validators))]
+		assigned[val] = append(assigned[val], decl)
+	}
+	return assigned
+}
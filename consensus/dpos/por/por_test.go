@@ -0,0 +1,307 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package por
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testConfig keeps the challenges cheap enough for the tests.
+var testConfig = &Config{
+	Timeout:          100 * time.Millisecond,
+	RoundsPerCore:    16,
+	ScratchpadPerMiB: 64,
+}
+
+// newTestSigner creates a signer callback backed by a fresh private key.
+func newTestSigner() (common.Address, SignerFn) {
+	key, _ := crypto.GenerateKey()
+	return crypto.PubkeyToAddress(key.PublicKey), signerFn(key)
+}
+
+func signerFn(key *ecdsa.PrivateKey) SignerFn {
+	return func(_ accounts.Account, _ string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), key)
+	}
+}
+
+// providerConfig returns the test config of a provider declaring resources.
+func providerConfig(resources Resources) *Config {
+	config := *testConfig
+	config.Resources = resources
+	return &config
+}
+
+// onlyValidator returns a validator callback accepting a single account.
+func onlyValidator(validator common.Address) ValidatorFn {
+	return func(addr common.Address) bool { return addr == validator }
+}
+
+// signChallenge signs the challenge with the given validator signer.
+func signChallenge(c *Challenge, signFn SignerFn) *Challenge {
+	id := c.ID()
+	c.Signature, _ = signFn(accounts.Account{Address: c.Validator}, accounts.MimetypeTextPlain, id[:])
+	return c
+}
+
+// simulatedProvider is an in-process provider with a configurable behaviour.
+type simulatedProvider struct {
+	signFn SignerFn
+	actual Resources     // Resources really available, used to answer challenges
+	delay  time.Duration // Latency added before answering
+}
+
+// simulatedNetwork is an in-process Transport connecting a challenger to a set
+// of simulated providers.
+type simulatedNetwork map[common.Address]*simulatedProvider
+
+func (n simulatedNetwork) Providers() []Declaration {
+	return nil
+}
+
+func (n simulatedNetwork) Challenge(c *Challenge, timeout time.Duration) (*Response, error) {
+	provider, ok := n[c.Provider]
+	if !ok {
+		return nil, errUnknownProvider
+	}
+	if signer, err := c.signer(); err != nil || signer != c.Validator {
+		return nil, errUnauthorizedValidator
+	}
+	answered := *c
+	answered.Resources = provider.actual
+
+	digest, err := Solve(&answered, testConfig)
+	if err != nil {
+		return nil, err
+	}
+	res := &Response{ID: c.ID(), Digest: digest}
+	if res.Signature, err = provider.signFn(accounts.Account{}, accounts.MimetypeTextPlain, res.sigData()); err != nil {
+		return nil, err
+	}
+	if provider.delay > timeout {
+		time.Sleep(timeout)
+		return nil, errTimeout
+	}
+	time.Sleep(provider.delay)
+	return res, nil
+}
+
+// Tests that responses are verified against the challenge and the signer.
+func TestVerify(t *testing.T) {
+	var (
+		provider, signFn = newTestSigner()
+		validator, valFn = newTestSigner()
+		declared         = Resources{CPU: 4, Memory: 512}
+		responder        = NewResponder(provider, signFn, onlyValidator(validator), providerConfig(declared))
+	)
+	challenge := signChallenge(&Challenge{
+		Epoch:     1,
+		Validator: validator,
+		Provider:  provider,
+		Seed:      common.HexToHash("0x01"),
+		Resources: declared,
+	}, valFn)
+	res, err := responder.Respond(challenge)
+	if err != nil {
+		t.Fatalf("failed to respond: %v", err)
+	}
+	if err := Verify(challenge, res, testConfig); err != nil {
+		t.Fatalf("valid response rejected: %v", err)
+	}
+	// A response for different resources must be rejected
+	weaker := *challenge
+	weaker.Resources.Memory = 256
+	digest, _ := Solve(&weaker, testConfig)
+	cheat := &Response{ID: challenge.ID(), Digest: digest}
+	cheat.Signature, _ = responder.Sign(cheat.sigData())
+	if err := Verify(challenge, cheat, testConfig); err != errInvalidDigest {
+		t.Fatalf("cheating response error mismatch: have %v, want %v", err, errInvalidDigest)
+	}
+	// A response signed by somebody else must be rejected
+	_, otherFn := newTestSigner()
+	forged := *res
+	forged.Signature, _ = otherFn(accounts.Account{}, accounts.MimetypeTextPlain, forged.sigData())
+	if err := Verify(challenge, &forged, testConfig); err != errInvalidSignature {
+		t.Fatalf("forged response error mismatch: have %v, want %v", err, errInvalidSignature)
+	}
+	// Responders must refuse challenges addressed to others
+	other := *challenge
+	other.Provider = common.HexToAddress("0xdeadbeef")
+	if _, err := responder.Respond(&other); err != errWrongProvider {
+		t.Fatalf("foreign challenge error mismatch: have %v, want %v", err, errWrongProvider)
+	}
+}
+
+// Tests that providers only answer challenges signed by current validators
+// and asking for the declared resources.
+func TestRespondAuthorization(t *testing.T) {
+	var (
+		provider, signFn     = newTestSigner()
+		validator, valFn     = newTestSigner()
+		stranger, strangerFn = newTestSigner()
+		declared             = Resources{CPU: 2, Memory: 128}
+		responder            = NewResponder(provider, signFn, onlyValidator(validator), providerConfig(declared))
+	)
+	newChallenge := func(val common.Address, resources Resources) *Challenge {
+		return &Challenge{Epoch: 1, Validator: val, Provider: provider, Seed: common.HexToHash("0x01"), Resources: resources}
+	}
+	tests := []struct {
+		challenge *Challenge
+		err       error
+	}{
+		{signChallenge(newChallenge(validator, declared), valFn), nil},                                              // Current validator
+		{newChallenge(validator, declared), errUnauthorizedValidator},                                               // Unsigned
+		{signChallenge(newChallenge(validator, declared), strangerFn), errUnauthorizedValidator},                    // Impersonated validator
+		{signChallenge(newChallenge(stranger, declared), strangerFn), errUnauthorizedValidator},                     // Not a validator
+		{signChallenge(newChallenge(validator, Resources{CPU: 2, Memory: MaxMemory}), valFn), errResourcesMismatch}, // Not the declared resources
+	}
+	for i, tt := range tests {
+		if _, err := responder.Respond(tt.challenge); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that challenges requiring more work than the limits are rejected
+// rather than allocated, including when the required work overflows.
+func TestSolveLimits(t *testing.T) {
+	overflowing := *testConfig
+	overflowing.ScratchpadPerMiB, overflowing.RoundsPerCore = math.MaxUint64, math.MaxUint64
+
+	tests := []struct {
+		resources Resources
+		config    *Config
+	}{
+		{Resources{CPU: MaxCPU + 1, Memory: 1}, testConfig},
+		{Resources{CPU: 1, Memory: MaxMemory + 1}, testConfig},
+		{Resources{CPU: 0, Memory: 2}, &overflowing},
+		{Resources{CPU: 2, Memory: 0}, &overflowing},
+		{Resources{CPU: 1, Memory: MaxMemory}, &Config{ScratchpadPerMiB: 1 << 20, RoundsPerCore: 1}},
+	}
+	for i, tt := range tests {
+		c := &Challenge{Seed: common.HexToHash("0x01"), Resources: tt.resources}
+		if _, err := Solve(c, tt.config); !errors.Is(err, errResourcesTooLarge) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, errResourcesTooLarge)
+		}
+	}
+	if _, err := Solve(&Challenge{Resources: Resources{CPU: 1, Memory: 1}}, &overflowing); !errors.Is(err, errResourcesTooLarge) {
+		t.Errorf("oversized work error mismatch: have %v, want %v", err, errResourcesTooLarge)
+	}
+}
+
+// Tests that providers are assigned deterministically and exactly once.
+func TestAssign(t *testing.T) {
+	validators := []common.Address{{0x01}, {0x02}, {0x03}}
+	var providers []Declaration
+	for i := 0; i < 32; i++ {
+		providers = append(providers, Declaration{Provider: common.Address{0xff, byte(i)}})
+	}
+	seed := common.HexToHash("0xcafe")
+
+	first, second := Assign(seed, validators, providers), Assign(seed, validators, providers)
+	assigned := 0
+	for _, val := range validators {
+		if len(first[val]) != len(second[val]) {
+			t.Fatalf("validator %x: assignment not deterministic", val)
+		}
+		for i := range first[val] {
+			if first[val][i] != second[val][i] {
+				t.Fatalf("validator %x: assignment not deterministic", val)
+			}
+		}
+		assigned += len(first[val])
+	}
+	if assigned != len(providers) {
+		t.Fatalf("assigned providers mismatch: have %d, want %d", assigned, len(providers))
+	}
+	if len(Assign(seed, nil, providers)) != 0 {
+		t.Fatalf("providers assigned without validators")
+	}
+}
+
+// Tests that the challenger records the outcome of challenging a set of
+// honest and misbehaving simulated providers.
+func TestChallenger(t *testing.T) {
+	var (
+		validator, valFn = newTestSigner()
+		declared         = Resources{CPU: 2, Memory: 128}
+		network          = make(simulatedNetwork)
+		providers        []Declaration
+		expect           = make(map[common.Address]bool)
+	)
+	for _, behaviour := range []struct {
+		actual Resources
+		delay  time.Duration
+		online bool
+		passed bool
+	}{
+		{declared, 0, true, true},                        // Honest provider
+		{Resources{CPU: 2, Memory: 64}, 0, true, false},  // Less memory than declared
+		{Resources{CPU: 1, Memory: 128}, 0, true, false}, // Less cores than declared
+		{declared, 2 * testConfig.Timeout, true, false},  // Too slow
+		{declared, 0, false, false},                      // Offline
+		{declared, testConfig.Timeout / 10, true, true},  // Slow but in time
+	} {
+		provider, signFn := newTestSigner()
+		if behaviour.online {
+			network[provider] = &simulatedProvider{
+				signFn: signFn,
+				actual: behaviour.actual,
+				delay:  behaviour.delay,
+			}
+		}
+		providers = append(providers, Declaration{Provider: provider, Resources: declared})
+		expect[provider] = behaviour.passed
+	}
+	challenger := NewChallenger(network, testConfig)
+	challenger.Authorize(validator, valFn)
+	challenger.Run(3, common.HexToHash("0x03"), []common.Address{validator}, providers)
+
+	results := challenger.Results(3, validator)
+	if len(results) != len(providers) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(providers))
+	}
+	for i, res := range results {
+		if i > 0 && string(results[i-1].Provider[:]) >= string(res.Provider[:]) {
+			t.Errorf("results not sorted by provider")
+		}
+		if res.Epoch != 3 || res.Validator != validator {
+			t.Errorf("provider %x: result metadata mismatch: have %d/%x", res.Provider, res.Epoch, res.Validator)
+		}
+		if res.Passed != expect[res.Provider] {
+			t.Errorf("provider %x: outcome mismatch: have %v, want %v", res.Provider, res.Passed, expect[res.Provider])
+		}
+	}
+	// Providers assigned to remote validators must not be challenged
+	challenger.Run(4, common.HexToHash("0x04"), []common.Address{{0x02}}, providers)
+	if results := challenger.Results(4, validator); len(results) != 0 {
+		t.Fatalf("challenged providers of remote validators: %d results", len(results))
+	}
+	// Old epochs are eventually dropped
+	challenger.Run(3+keepEpochs+1, common.HexToHash("0x05"), []common.Address{validator}, nil)
+	if results := challenger.Results(3, validator); len(results) != 0 {
+		t.Fatalf("stale results retained: %d results", len(results))
+	}
+}
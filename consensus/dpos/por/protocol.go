@@ -0,0 +1,75 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package por
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	por1 = 1
+)
+
+// ProtocolName is the official short name of the `por` protocol used during
+// devp2p capability negotiation.
+const ProtocolName = "por"
+
+// ProtocolVersions are the supported versions of the `por` protocol (first
+// is primary).
+var ProtocolVersions = []uint{por1}
+
+// protocolLengths are the number of implemented message corresponding to
+// different protocol versions.
+var protocolLengths = map[uint]uint64{por1: 3}
+
+// maxMessageSize is the maximum cap on the size of a protocol message.
+const maxMessageSize = 64 * 1024
+
+const (
+	StatusMsg    = 0x00
+	ChallengeMsg = 0x01
+	ResponseMsg  = 0x02
+)
+
+var (
+	errMsgTooLarge    = errors.New("message too long")
+	errDecode         = errors.New("invalid message")
+	errInvalidMsgCode = errors.New("invalid message code")
+	errNoStatusMsg    = errors.New("no status message")
+	errBadProvider    = errors.New("invalid provider proof")
+)
+
+// StatusPacket is the network packet exchanged when a `por` connection is
+// established. Providers announce their account and declared resources along
+// with a signature over both and their own node id, proving that the connection
+// and the declaration belong to the provider.
+type StatusPacket struct {
+	Provider  common.Address // Provider account, empty if the node isn't a provider
+	Resources Resources      // Resources declared by the provider
+	Signature []byte         // Provider signature over the node id and the resources
+}
+
+// statusSigData returns the data a provider signs in its status packet.
+func statusSigData(id enode.ID, resources Resources) []byte {
+	enc, _ := rlp.EncodeToBytes(resources)
+	return append(append([]byte{}, id[:]...), enc...)
+}
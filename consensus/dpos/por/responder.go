@@ -0,0 +1,91 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package por
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ValidatorFn reports whether an account is one of the current validators.
+type ValidatorFn func(common.Address) bool
+
+// Responder is the provider side of the challenge protocol, answering the
+// challenges validators send to the local provider account.
+type Responder struct {
+	provider    common.Address
+	signFn      SignerFn
+	isValidator ValidatorFn
+	config      *Config
+}
+
+// NewResponder creates a responder answering challenges on behalf of provider.
+// Only challenges signed by an account isValidator accepts are answered, proving
+// the resources declared in config.
+func NewResponder(provider common.Address, signFn SignerFn, isValidator ValidatorFn, config *Config) *Responder {
+	return &Responder{
+		provider:    provider,
+		signFn:      signFn,
+		isValidator: isValidator,
+		config:      config,
+	}
+}
+
+// Provider returns the provider account the responder answers for.
+func (r *Responder) Provider() common.Address {
+	return r.provider
+}
+
+// Declaration returns the resources the provider declares.
+func (r *Responder) Declaration() Declaration {
+	return Declaration{Provider: r.provider, Resources: r.config.Resources}
+}
+
+// Sign signs arbitrary data with the provider account.
+func (r *Responder) Sign(data []byte) ([]byte, error) {
+	return r.signFn(accounts.Account{Address: r.provider}, accounts.MimetypeTextPlain, data)
+}
+
+// Respond solves the challenge and signs the result. The challenge must be
+// signed by a current validator and ask for exactly the declared resources, so
+// nobody else can make the provider spend more than it declared.
+func (r *Responder) Respond(c *Challenge) (*Response, error) {
+	if c.Provider != r.provider {
+		return nil, errWrongProvider
+	}
+	signer, err := c.signer()
+	if err != nil || signer != c.Validator || !r.isValidator(signer) {
+		return nil, errUnauthorizedValidator
+	}
+	if c.Resources != r.config.Resources {
+		return nil, errResourcesMismatch
+	}
+	digest, err := Solve(c, r.config)
+	if err != nil {
+		return nil, err
+	}
+	res := &Response{
+		ID:     c.ID(),
+		Digest: digest,
+	}
+	sig, err := r.Sign(res.sigData())
+	if err != nil {
+		return nil, err
+	}
+	res.Signature = sig
+	return res, nil
+}
@@ -0,0 +1,145 @@
+package dpos
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/por"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// unreachableProviders is a PoR transport whose providers never answer, so
+// every challenge fails.
+type unreachableProviders struct{}
+
+func (unreachableProviders) Providers() []por.Declaration { return nil }
+
+func (unreachableProviders) Challenge(c *por.Challenge, timeout time.Duration) (*por.Response, error) {
+	return nil, errors.New("provider unreachable")
+}
+
+// failedChallenger creates a challenger of the local validator whose single
+// provider failed its challenge in epoch 0.
+func (pt *pipelineTester) failedChallenger(provider common.Address) *por.Challenger {
+	challenger := por.NewChallenger(unreachableProviders{}, &por.Config{Timeout: time.Second})
+	challenger.Authorize(pt.validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), pt.key)
+	})
+	challenger.Run(0, common.Hash{}, []common.Address{pt.validator}, []por.Declaration{{Provider: provider}})
+	return challenger
+}
+
+// Tests that PoR results are recorded from the PoR fork on, pausing the failed
+// providers in the factory contract once, and that verifiers replay them.
+func TestPorResultsMineVerify(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	pt.config.PorBlock = big.NewInt(2)
+	pt.useSystemContracts()
+
+	miner := pt.newEngine(true)
+	miner.SetChallenger(pt.failedChallenger(pt.validator))
+	blocks := pt.generate(miner, 3)
+
+	for i, block := range blocks {
+		want := 0
+		if block.NumberU64() == 2 {
+			want = 1
+		}
+		if txs := block.Transactions(); len(txs) != want || (want == 1 && *txs[0].To() != systemcontract.DposFactoryContractAddr) {
+			t.Fatalf("block %d: PoR transaction count mismatch: have %d, want %d", i+1, len(txs), want)
+		}
+	}
+	verifier := pt.newEngine(false)
+	reader := newTestChainReader(pt.config, verifier, pt.genesis, blocks[0], blocks[1], blocks[2])
+
+	parent := pt.genesis
+	for _, block := range blocks {
+		header, _, err := pt.verify(verifier, parent, block, reader, nil)
+		if err != nil {
+			t.Fatalf("block %d: verification failed: %v", block.NumberU64(), err)
+		}
+		if header.Root != block.Root() {
+			t.Errorf("block %d: state root mismatch: have %x, want %x", block.NumberU64(), header.Root, block.Root())
+		}
+		parent = block
+	}
+	statedb, err := state.New(blocks[2].Root(), state.NewDatabase(pt.db), nil)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	ctx := newChainContext(reader, verifier)
+	contract, err := verifier.readValidatorContract(ctx, blocks[2].Header(), statedb, pt.validator)
+	if err != nil {
+		t.Fatalf("failed to read validator contract: %v", err)
+	}
+	if valState, err := verifier.readValidatorState(ctx, blocks[2].Header(), statedb, contract); err != nil || valState != validatorPaused {
+		t.Errorf("validator state mismatch: have %d (err %v), want %d", valState, err, validatorPaused)
+	}
+}
+
+// Tests that only PoR result transactions of the block author pausing or
+// resuming a validator are accepted.
+func TestReplayPorResult(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	pt.useSystemContracts()
+
+	engine := pt.newEngine(false)
+	blocks := pt.generate(engine, 1)
+	reader := newTestChainReader(pt.config, engine, pt.genesis, blocks[0])
+	factoryABI := engine.abi[systemcontract.DposFactoryContractName]
+
+	newTx := func(signer *ecdsa.PrivateKey, value int64, method string, args ...interface{}) *types.Transaction {
+		data, err := factoryABI.Pack(method, args...)
+		if err != nil {
+			t.Fatalf("failed to pack %s: %v", method, err)
+		}
+		tx := types.NewTransaction(0, systemcontract.DposFactoryContractAddr, big.NewInt(value), 1000000, new(big.Int), data)
+		tx, _ = types.SignTx(tx, engine.signer, signer)
+		return tx
+	}
+	stranger, _ := crypto.GenerateKey()
+
+	testCases := []struct {
+		tx    *types.Transaction
+		valid bool
+	}{
+		{newTx(pt.key, 0, "updateValidatorState", pt.validator, true), true},
+		{newTx(pt.key, 0, "updateValidatorState", pt.validator, false), true},   // reverts, still recorded
+		{newTx(stranger, 0, "updateValidatorState", pt.validator, true), false}, // not the block author
+		{newTx(pt.key, 1, "updateValidatorState", pt.validator, true), false},   // value transfer
+		{newTx(pt.key, 0, "distributeBlockReward"), false},                      // wrong method
+	}
+	for i, tc := range testCases {
+		statedb, _ := state.New(blocks[0].Root(), state.NewDatabase(pt.db), nil)
+		header := &types.Header{
+			ParentHash: blocks[0].Hash(),
+			Number:     big.NewInt(2),
+			Coinbase:   pt.validator,
+			Difficulty: diffInTurn,
+			GasLimit:   blocks[0].GasLimit(),
+			Time:       blocks[0].Time() + pt.config.Dpos.Period,
+		}
+		receipt, err := engine.replayPorResult(reader, header, statedb, 0, tc.tx)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("test %d: validity mismatch: have %v (err %v), want %v", i, valid, err, tc.valid)
+			continue
+		}
+		if !tc.valid {
+			continue
+		}
+		if receipt.TxHash != tc.tx.Hash() {
+			t.Errorf("test %d: receipt tx hash mismatch: have %x, want %x", i, receipt.TxHash, tc.tx.Hash())
+		}
+		if nonce := statedb.GetNonce(pt.validator); nonce != 1 {
+			t.Errorf("test %d: validator nonce mismatch: have %d, want %d", i, nonce, 1)
+		}
+	}
+}
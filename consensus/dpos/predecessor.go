@@ -0,0 +1,44 @@
+package dpos
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// SetPredecessor sets the parlia engine sealing the chain before the dpos switch
+// block. Blocks before the switch are handed over to it, while the validator set
+// of the first dpos blocks is carried over from its last snapshot.
+func (p *Dpos) SetPredecessor(predecessor *parlia.Parlia) {
+	p.predecessor = predecessor
+}
+
+// isPredecessor returns whether the given block is sealed by the engine the
+// chain switched to dpos from.
+func (p *Dpos) isPredecessor(number *big.Int) bool {
+	return p.predecessor != nil && !p.chainConfig.IsDpos(number)
+}
+
+// predecessorSnapshot converts the parlia snapshot at the given block, which
+// must precede the switch, into a dpos one.
+func (p *Dpos) predecessorSnapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	parent, err := p.predecessor.Snapshot(chain, number, hash, parents)
+	if err != nil {
+		return nil, err
+	}
+	validators := make([]common.Address, 0, len(parent.Validators))
+	for val := range parent.Validators {
+		validators = append(validators, val)
+	}
+	snap := newSnapshot(p.config, p.signatures, number, hash, validators, p.ethAPI)
+	for block, val := range parent.Recents {
+		snap.Recents[block] = val
+	}
+	for block, forkHash := range parent.RecentForkHashes {
+		snap.RecentForkHashes[block] = forkHash
+	}
+	return snap, nil
+}
@@ -0,0 +1,217 @@
+package dpos
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	parliasc "github.com/ethereum/go-ethereum/consensus/parlia/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// returnCode assembles a contract returning the given output to any call.
+func returnCode(output []byte) []byte {
+	var code []byte
+	for i := 0; i < len(output); i += 32 {
+		code = append(code, byte(vm.PUSH32))
+		code = append(code, common.RightPadBytes(output[i:], 32)[:32]...)
+		code = append(code, byte(vm.PUSH2), byte(i>>8), byte(i), byte(vm.MSTORE))
+	}
+	return append(code, byte(vm.PUSH2), byte(len(output)>>8), byte(len(output)), byte(vm.PUSH1), 0, byte(vm.RETURN))
+}
+
+// switchTester runs chains sealed by parlia up to the dpos switch block and by
+// dpos from there on.
+type switchTester struct {
+	t         *testing.T
+	config    *params.ChainConfig
+	genspec   *core.Genesis
+	key       *ecdsa.PrivateKey
+	validator common.Address
+}
+
+func newSwitchTester(t *testing.T) *switchTester {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+
+	// Both engines read the single validator from their factory contracts
+	top, err := systemcontract.GetInteractiveABI()[systemcontract.DposFactoryContractName].Methods["getTopValidators"].Outputs.Pack([]common.Address{validator})
+	if err != nil {
+		t.Fatalf("failed to pack top validators: %v", err)
+	}
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		DposBlock:           big.NewInt(6),
+		Parlia:              &params.ParliaConfig{Period: 0, Epoch: 4},
+		Dpos:                &params.DposConfig{Period: 0, Epoch: 4},
+	}
+	alloc := core.GenesisAlloc{validator: {Balance: big.NewInt(params.Ether)}}
+	for _, addr := range []common.Address{
+		systemcontract.SysGovContractAddr, systemcontract.AddressListContractAddr, systemcontract.PunishV1ContractAddr,
+		parliasc.ValidatorsContractAddr, parliasc.PunishContractAddr, parliasc.PunishV1ContractAddr,
+	} {
+		alloc[addr] = core.GenesisAccount{Balance: new(big.Int), Code: stubContractCode}
+	}
+	alloc[systemcontract.DposFactoryContractAddr] = core.GenesisAccount{Balance: new(big.Int), Code: returnCode(top)}
+	alloc[parliasc.ValidatorsV1ContractAddr] = core.GenesisAccount{Balance: new(big.Int), Code: returnCode(top)}
+
+	genspec := &core.Genesis{
+		Config:    config,
+		GasLimit:  8000000,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc:     alloc,
+	}
+	copy(genspec.ExtraData[extraVanity:], validator[:])
+
+	return &switchTester{t: t, config: config, genspec: genspec, key: key, validator: validator}
+}
+
+// newChain creates a fresh chain of the tester, sealed by an engine switching
+// from parlia to dpos.
+func (st *switchTester) newChain() (*core.BlockChain, *Dpos) {
+	// State commits flush contract codes asynchronously, store them upfront
+	db := rawdb.NewMemoryDatabase()
+	for _, account := range st.genspec.Alloc {
+		if len(account.Code) > 0 {
+			rawdb.WriteCode(db, crypto.Keccak256Hash(account.Code), account.Code)
+		}
+	}
+	genesis := st.genspec.MustCommit(db)
+
+	engine := New(st.config, db, nil, genesis.Hash())
+	engine.SetPredecessor(parlia.New(st.config, db, nil, genesis.Hash()))
+
+	chain, err := core.NewBlockChain(db, nil, st.config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		st.t.Fatalf("failed to create chain: %v", err)
+	}
+	engine.SetStateFn(chain.StateAt)
+
+	signer := types.NewEIP155Signer(st.config.ChainID)
+	engine.Authorize(st.validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), st.key)
+	}, func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		return types.SignTx(tx, signer, st.key)
+	})
+	return chain, engine
+}
+
+// seal assembles, signs and imports n blocks on top of the head of the chain,
+// tagging them with the given vanity to tell forks apart.
+func (st *switchTester) seal(chain *core.BlockChain, engine *Dpos, n int, vanity string) []*types.Block {
+	var blocks []*types.Block
+	for i := 0; i < n; i++ {
+		parent := chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+			Extra:      []byte(vanity),
+		}
+		if err := engine.Prepare(chain, header); err != nil {
+			st.t.Fatalf("failed to prepare block %d: %v", header.Number, err)
+		}
+		statedb, err := chain.StateAt(parent.Root())
+		if err != nil {
+			st.t.Fatalf("failed to retrieve parent state: %v", err)
+		}
+		block, _, err := engine.FinalizeAndAssemble(chain, header, statedb, nil, nil, nil)
+		if err != nil {
+			st.t.Fatalf("failed to assemble block %d: %v", header.Number, err)
+		}
+		header = block.Header()
+		sig, err := crypto.Sign(engine.SealHash(header).Bytes(), st.key)
+		if err != nil {
+			st.t.Fatalf("failed to sign block %d: %v", header.Number, err)
+		}
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+
+		block = block.WithSeal(header)
+		if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+			st.t.Fatalf("failed to import block %d: %v", header.Number, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// Tests that a chain switching from parlia to dpos is sealed, imported,
+// reorganised and rewound across the switch block.
+func TestParliaToDposSwitch(t *testing.T) {
+	st := newSwitchTester(t)
+
+	chain, engine := st.newChain()
+	defer chain.Stop()
+	blocks := st.seal(chain, engine, 10, "")
+
+	// The validator set and recent signers carry over from parlia
+	last := blocks[4].Header()
+	parent, err := engine.predecessor.Snapshot(chain, last.Number.Uint64(), last.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve parlia snapshot: %v", err)
+	}
+	snap, err := engine.snapshot(chain, last.Number.Uint64(), last.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve dpos snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(snap.Validators, parent.Validators) || !reflect.DeepEqual(snap.Recents, parent.Recents) {
+		t.Errorf("carried over snapshot mismatch: have %v %v, want %v %v", snap.Validators, snap.Recents, parent.Validators, parent.Recents)
+	}
+	// Import the chain on a fresh node, in a single batch straddling the switch
+	imported, _ := st.newChain()
+	defer imported.Stop()
+	if n, err := imported.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block %d: %v", n, err)
+	}
+	if head := imported.CurrentBlock(); head.Hash() != blocks[9].Hash() {
+		t.Fatalf("imported head mismatch: have %d, want %d", head.NumberU64(), blocks[9].NumberU64())
+	}
+	// Reorg onto a longer fork branching off before the switch
+	forked, forkEngine := st.newChain()
+	defer forked.Stop()
+	if _, err := forked.InsertChain(blocks[:3]); err != nil {
+		t.Fatalf("failed to import shared blocks: %v", err)
+	}
+	fork := st.seal(forked, forkEngine, 9, "fork")
+	if n, err := imported.InsertChain(fork); err != nil {
+		t.Fatalf("failed to import fork block %d: %v", n, err)
+	}
+	if head := imported.CurrentBlock(); head.Hash() != fork[8].Hash() {
+		t.Fatalf("reorged head mismatch: have %d, want %d", head.NumberU64(), fork[8].NumberU64())
+	}
+	// Rewind below the switch and import the original chain back
+	if err := imported.SetHead(3); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if n, err := imported.InsertChain(blocks[3:]); err != nil {
+		t.Fatalf("failed to reimport block %d: %v", n, err)
+	}
+	if head := imported.CurrentBlock(); head.Hash() != blocks[9].Hash() {
+		t.Fatalf("reimported head mismatch: have %d, want %d", head.NumberU64(), blocks[9].NumberU64())
+	}
+	// Blocks on both sides of the switch are sealed by their own engine
+	for _, block := range blocks {
+		if want := block.NumberU64() < 6; engine.isPredecessor(block.Number()) != want {
+			t.Errorf("block %d: predecessor mismatch, want %v", block.NumberU64(), want)
+		}
+	}
+}
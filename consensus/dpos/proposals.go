@@ -0,0 +1,213 @@
+package dpos
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Statuses of the system governance proposals.
+const (
+	ProposalPassed  = "passed"  // Passed at the block, executed by the next one
+	ProposalPending = "pending" // Passed in the pending block, executed by the one after it
+)
+
+// ProposalInfo is a system governance proposal decoded from the SysGov contract.
+type ProposalInfo struct {
+	Id     *hexutil.Big           `json:"id"`
+	Status string                 `json:"status,omitempty"`
+	Action string                 `json:"action"` // evmCall, erase or unsupported
+	From   common.Address         `json:"from"`
+	To     common.Address         `json:"to"`
+	Value  *hexutil.Big           `json:"value"`
+	Data   hexutil.Bytes          `json:"data"`
+	Method string                 `json:"method,omitempty"` // System contract method called by the data, if known
+	Args   map[string]interface{} `json:"args,omitempty"`   // Arguments of the system contract method
+}
+
+// ProposalArgs selects the proposal to simulate: either a passed one by id, or
+// one yet to be committed.
+type ProposalArgs struct {
+	Id     *hexutil.Big   `json:"id"`
+	Action *hexutil.Big   `json:"action"`
+	From   common.Address `json:"from"`
+	To     common.Address `json:"to"`
+	Value  *hexutil.Big   `json:"value"`
+	Data   hexutil.Bytes  `json:"data"`
+}
+
+// proposal assembles the proposal committed with the given arguments.
+func (args *ProposalArgs) proposal() *Proposal {
+	prop := &Proposal{
+		Id:     new(big.Int),
+		Action: new(big.Int),
+		From:   args.From,
+		To:     args.To,
+		Value:  new(big.Int),
+		Data:   common.CopyBytes(args.Data),
+	}
+	if args.Action != nil {
+		prop.Action.Set(args.Action.ToInt())
+	}
+	if args.Value != nil {
+		prop.Value.Set(args.Value.ToInt())
+	}
+	return prop
+}
+
+// ProposalSimulation is the outcome of executing a proposal on top of a block.
+type ProposalSimulation struct {
+	Proposal  *ProposalInfo                   `json:"proposal"`
+	Receipt   *types.Receipt                  `json:"receipt"`
+	Error     string                          `json:"error,omitempty"` // Why the execution failed, if it did
+	StateDiff map[common.Address]*AccountDiff `json:"stateDiff"`
+}
+
+// AccountDiff is the change a proposal makes to an account, with unchanged fields
+// left out. The pairs hold the values before and after the proposal.
+type AccountDiff struct {
+	Balance *[2]*hexutil.Big               `json:"balance,omitempty"`
+	Nonce   *[2]hexutil.Uint64             `json:"nonce,omitempty"`
+	Code    *[2]hexutil.Bytes              `json:"code,omitempty"`
+	Storage map[common.Hash][2]common.Hash `json:"storage,omitempty"`
+	Erased  bool                           `json:"erased,omitempty"` // Whether the code and storage were wiped
+}
+
+// readProposals reads the passed system governance proposals at the given block.
+func (p *Dpos) readProposals(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) ([]*Proposal, error) {
+	count, err := p.getPassedProposalCount(chain, header, state)
+	if err != nil {
+		return nil, err
+	}
+	props := make([]*Proposal, 0, count)
+	for i := uint32(0); i < count; i++ {
+		prop, err := p.getPassedProposalByIndex(chain, header, state, i)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+	return props, nil
+}
+
+// proposalInfo decodes a proposal, along with the system contract method it
+// calls if it targets one.
+func (p *Dpos) proposalInfo(prop *Proposal, number *big.Int, status string) *ProposalInfo {
+	info := &ProposalInfo{
+		Id:     (*hexutil.Big)(new(big.Int).Set(prop.Id)),
+		Status: status,
+		From:   prop.From,
+		To:     prop.To,
+		Value:  (*hexutil.Big)(new(big.Int).Set(prop.Value)),
+		Data:   common.CopyBytes(prop.Data),
+	}
+	switch prop.Action.Uint64() {
+	case 0:
+		info.Action = "evmCall"
+	case 1:
+		info.Action = "erase"
+	}
+	if !prop.Action.IsUint64() || info.Action == "" {
+		info.Action = "unsupported"
+	}
+	if info.Action != "evmCall" || len(prop.Data) < 4 {
+		return info
+	}
+	var name string
+	switch prop.To {
+	case *systemcontract.GetValidatorAddr(number, p.chainConfig):
+		name = systemcontract.DposFactoryContractName
+	case *systemcontract.GetPunishAddr(number, p.chainConfig):
+		name = systemcontract.PunishV1ContractName
+	case systemcontract.SysGovContractAddr:
+		name = systemcontract.SysGovContractName
+	case systemcontract.AddressListContractAddr:
+		name = systemcontract.AddressListContractName
+	default:
+		return info
+	}
+	contract := p.abi[name]
+	method, err := contract.MethodById(prop.Data[:4])
+	if err != nil {
+		return info
+	}
+	info.Method = method.Sig
+	args := make(map[string]interface{})
+	if err := method.Inputs.UnpackIntoMap(args, prop.Data[4:]); err == nil {
+		info.Args = args
+	}
+	return info
+}
+
+// simulateProposal executes a proposal on the given state as the block with the
+// given header would, returning its receipt and the changes it makes.
+func (p *Dpos) simulateProposal(chain consensus.ChainHeaderReader, header *types.Header, statedb *state.StateDB, prop *Proposal) (*ProposalSimulation, error) {
+	propRLP, err := rlp.EncodeToBytes(prop)
+	if err != nil {
+		return nil, err
+	}
+	// The proposal runs in a system transaction of the coinbase, whose nonce
+	// bump is left out of the diff
+	tx := types.NewTransaction(statedb.GetNonce(header.Coinbase), systemcontract.SysGovToAddr, prop.Value, header.GasLimit, new(big.Int), propRLP)
+
+	pre := statedb.Copy()
+	tracer := newAccessTracer()
+	receipt := p.executeProposalMsg(chain, header, statedb, prop, 0, tx.Hash(), common.Hash{}, tracer)
+
+	sim := &ProposalSimulation{
+		Proposal:  p.proposalInfo(prop, header.Number, ""),
+		Receipt:   receipt,
+		StateDiff: make(map[common.Address]*AccountDiff),
+	}
+	switch sim.Proposal.Action {
+	case "evmCall":
+		if tracer.err != nil {
+			sim.Error = tracer.err.Error()
+			if reason, err := abi.UnpackRevert(tracer.output); err == nil {
+				sim.Error += ": " + reason
+			}
+		}
+	case "erase":
+		tracer.touch(prop.To)
+		if receipt.Status == types.ReceiptStatusSuccessful {
+			sim.StateDiff[prop.To] = &AccountDiff{Erased: true}
+		}
+	default:
+		sim.Error = "unsupported proposal action"
+	}
+	for addr, slots := range tracer.touched {
+		diff := sim.StateDiff[addr]
+		if diff == nil {
+			diff = new(AccountDiff)
+		}
+		if before, after := pre.GetBalance(addr), statedb.GetBalance(addr); before.Cmp(after) != 0 {
+			diff.Balance = &[2]*hexutil.Big{(*hexutil.Big)(new(big.Int).Set(before)), (*hexutil.Big)(new(big.Int).Set(after))}
+		}
+		if before, after := pre.GetNonce(addr), statedb.GetNonce(addr); before != after {
+			diff.Nonce = &[2]hexutil.Uint64{hexutil.Uint64(before), hexutil.Uint64(after)}
+		}
+		if before, after := pre.GetCode(addr), statedb.GetCode(addr); !bytes.Equal(before, after) {
+			diff.Code = &[2]hexutil.Bytes{before, after}
+		}
+		for slot := range slots {
+			if before, after := pre.GetState(addr, slot), statedb.GetState(addr, slot); before != after {
+				if diff.Storage == nil {
+					diff.Storage = make(map[common.Hash][2]common.Hash)
+				}
+				diff.Storage[slot] = [2]common.Hash{before, after}
+			}
+		}
+		if diff.Balance != nil || diff.Nonce != nil || diff.Code != nil || diff.Storage != nil || diff.Erased {
+			sim.StateDiff[addr] = diff
+		}
+	}
+	return sim, nil
+}
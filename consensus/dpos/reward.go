@@ -0,0 +1,35 @@
+package dpos
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// legacyBlockReward is the block subsidy paid until the reward schedule of the
+// chain config activates.
+var legacyBlockReward = new(big.Int).Mul(big.NewInt(10), big.NewInt(params.Ether))
+
+// isRewardBlock returns whether the block at the given height pays out a block
+// reward. Legacy rules only reward blocks past the third one.
+func (p *Dpos) isRewardBlock(number *big.Int) bool {
+	if p.config.Reward.IsActive(number) {
+		return true
+	}
+	return number.Cmp(common.Big3) > 0
+}
+
+// blockRewards splits the rewards of the block at the given height into the
+// subsidy and the fees paid to the validators, and the fees paid to the system
+// pool. Legacy rules pay the fixed subsidy and all the fees to the validators.
+func (p *Dpos) blockRewards(number *big.Int, fee *big.Int) (subsidy, validatorFee, poolFee *big.Int) {
+	schedule := p.config.Reward
+	if !schedule.IsActive(number) {
+		return new(big.Int).Set(legacyBlockReward), new(big.Int).Set(fee), new(big.Int)
+	}
+	poolFee = new(big.Int).Mul(fee, new(big.Int).SetUint64(schedule.SystemPoolShare))
+	poolFee.Div(poolFee, big.NewInt(100))
+
+	return schedule.BlockReward(number), new(big.Int).Sub(fee, poolFee), poolFee
+}
@@ -0,0 +1,151 @@
+package dpos
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// rewardTestEngine seals every block in turn, so that the generated chain
+// doesn't need signed headers to compute the difficulties.
+type rewardTestEngine struct {
+	*Dpos
+}
+
+func (e *rewardTestEngine) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(diffInTurn)
+}
+
+// generateRewardChain generates n dpos blocks sealed by a single validator,
+// with a fee paying transaction in every block.
+func generateRewardChain(t *testing.T, reward *params.DposRewardConfig, n int) ([]*types.Block, ethdb.Database) {
+	var (
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		validator = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		db        = rawdb.NewMemoryDatabase()
+	)
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		Dpos:                &params.DposConfig{Period: 3, Epoch: 200, Reward: reward},
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		t.Fatalf("invalid chain config: %v", err)
+	}
+	genspec := &core.Genesis{
+		Config:    config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: core.GenesisAlloc{
+			sender: {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))},
+		},
+	}
+	copy(genspec.ExtraData[extraVanity:], validator[:])
+	genesis := genspec.MustCommit(db)
+
+	engine := &rewardTestEngine{New(config, db, nil, genesis.Hash())}
+	signer := types.NewEIP155Signer(config.ChainID)
+	blocks, _ := core.GenerateChain(config, genesis, engine, db, n, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(validator)
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(sender), common.Address{0x01}, big.NewInt(1), params.TxGas, big.NewInt(params.GWei), nil), signer, key)
+		b.AddTx(tx)
+	})
+	return blocks, db
+}
+
+// Tests that the block rewards follow the legacy rules until the reward
+// schedule activates, and the schedule afterwards.
+func TestBlockRewardSchedule(t *testing.T) {
+	var (
+		pool  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		ether = big.NewInt(params.Ether)
+		fee   = new(big.Int).Mul(big.NewInt(int64(params.TxGas)), big.NewInt(params.GWei))
+	)
+	reward := &params.DposRewardConfig{
+		Block:           big.NewInt(6),
+		BaseReward:      new(big.Int).Mul(big.NewInt(4), ether),
+		HalvingInterval: 2,
+		Overrides:       []params.DposRewardOverride{{Block: big.NewInt(9), Reward: ether}},
+		SystemPool:      pool,
+		SystemPoolShare: 25,
+	}
+	blocks, db := generateRewardChain(t, reward, 11)
+
+	poolFee := new(big.Int).Div(fee, big.NewInt(4))
+	validatorFee := new(big.Int).Sub(fee, poolFee)
+
+	// paid returns the subsidy in thousandths of ether plus the given fees
+	paid := func(milli int64, fees *big.Int) *big.Int {
+		subsidy := new(big.Int).Mul(big.NewInt(milli), ether)
+		return subsidy.Div(subsidy, big.NewInt(1000)).Add(subsidy, fees)
+	}
+	tests := []struct {
+		validator *big.Int // Rewards sent to the validator contract by the block
+		pool      *big.Int // Fees sent to the system pool by the block
+	}{
+		{new(big.Int), new(big.Int)},                                      // 1: no rewards before block 4
+		{new(big.Int), new(big.Int)},                                      // 2
+		{new(big.Int), new(big.Int)},                                      // 3
+		{paid(10000, new(big.Int).Mul(fee, big.NewInt(4))), new(big.Int)}, // 4: legacy subsidy, fees of blocks 1-4
+		{paid(10000, fee), new(big.Int)},                                  // 5: legacy subsidy
+		{paid(4000, validatorFee), poolFee},                               // 6: schedule activation
+		{paid(4000, validatorFee), poolFee},                               // 7
+		{paid(2000, validatorFee), poolFee},                               // 8: first halving
+		{paid(1000, validatorFee), poolFee},                               // 9: override
+		{paid(1000, validatorFee), poolFee},                               // 10
+		{paid(500, validatorFee), poolFee},                                // 11: halving of the override
+	}
+	prevValidator, prevPool := new(big.Int), new(big.Int)
+	for i, block := range blocks {
+		statedb, err := state.New(block.Root(), state.NewDatabase(db), nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to open state: %v", block.NumberU64(), err)
+		}
+		validatorBalance := statedb.GetBalance(systemcontract.DposFactoryContractAddr)
+		poolBalance := statedb.GetBalance(pool)
+
+		if have := new(big.Int).Sub(validatorBalance, prevValidator); have.Cmp(tests[i].validator) != 0 {
+			t.Errorf("block %d: validator reward mismatch: have %v, want %v", block.NumberU64(), have, tests[i].validator)
+		}
+		if have := new(big.Int).Sub(poolBalance, prevPool); have.Cmp(tests[i].pool) != 0 {
+			t.Errorf("block %d: pool reward mismatch: have %v, want %v", block.NumberU64(), have, tests[i].pool)
+		}
+		prevValidator, prevPool = validatorBalance, poolBalance
+	}
+}
+
+// Tests that scheduling the block rewards doesn't change the blocks generated
+// before the schedule activates.
+func TestBlockRewardScheduleCompatibility(t *testing.T) {
+	legacy, _ := generateRewardChain(t, nil, 6)
+	scheduled, _ := generateRewardChain(t, &params.DposRewardConfig{
+		Block:      big.NewInt(6),
+		BaseReward: big.NewInt(params.Ether),
+	}, 6)
+
+	for i := 0; i < 5; i++ {
+		if legacy[i].Root() != scheduled[i].Root() {
+			t.Errorf("block %d: state root mismatch before activation: legacy %x, scheduled %x", i+1, legacy[i].Root(), scheduled[i].Root())
+		}
+	}
+	if legacy[5].Root() == scheduled[5].Root() {
+		t.Errorf("block 6: state root unchanged after activation")
+	}
+}
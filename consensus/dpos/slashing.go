@@ -0,0 +1,216 @@
+package dpos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// slashingInterchangeVersion is the version of the JSON interchange format of
+// the slashing protection records.
+const slashingInterchangeVersion = "1"
+
+var (
+	// slashingPrefix is the database key prefix of the slashing protection
+	// records, followed by the validator address.
+	slashingPrefix = []byte("dpos-slashing-")
+
+	// errSlashableSeal is returned if sealing a header would sign two different
+	// blocks at the same height, or a block below the highest one signed.
+	errSlashableSeal = errors.New("refusing slashable seal")
+
+	// errInterchangeGenesis is returned if slashing protection records of
+	// another chain are imported.
+	errInterchangeGenesis = errors.New("slashing protection records of another chain")
+
+	// errInterchangeVersion is returned if the slashing protection records to
+	// import are in an unknown format.
+	errInterchangeVersion = errors.New("unsupported slashing protection interchange version")
+)
+
+// SignedBlock is the highest block signed by a validator.
+type SignedBlock struct {
+	Number   uint64
+	SealHash common.Hash
+}
+
+// SlashingProtection persistently tracks the highest block signed by every
+// local validator, refusing to seal conflicting headers. Headers are recorded
+// right before being handed out to the network, so a header may be recorded
+// but never published, in which case its height is skipped. It keeps a
+// validator from signing twice at the same height when restarted with an old
+// datadir or run as an active/standby pair.
+type SlashingProtection struct {
+	db          ethdb.KeyValueStore
+	genesisHash common.Hash
+	lock        sync.Mutex
+}
+
+// NewSlashingProtection creates the slashing protection store of the chain with
+// the given genesis hash.
+func NewSlashingProtection(db ethdb.KeyValueStore, genesisHash common.Hash) *SlashingProtection {
+	return &SlashingProtection{db: db, genesisHash: genesisHash}
+}
+
+func slashingKey(val common.Address) []byte {
+	return append(append([]byte{}, slashingPrefix...), val.Bytes()...)
+}
+
+// LastSigned returns the highest block signed by the validator, nil if none.
+func (s *SlashingProtection) LastSigned(val common.Address) (*SignedBlock, error) {
+	blob, err := s.db.Get(slashingKey(val))
+	if err != nil {
+		if has, _ := s.db.Has(slashingKey(val)); !has {
+			return nil, nil
+		}
+		return nil, err
+	}
+	signed := new(SignedBlock)
+	if err := rlp.DecodeBytes(blob, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+func (s *SlashingProtection) record(val common.Address, signed *SignedBlock) error {
+	blob, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(slashingKey(val), blob)
+}
+
+// Check checks that the validator may seal the header with the given number
+// and seal hash. Sealing the very same header again is permitted, any other
+// header at or below the highest recorded height is refused.
+func (s *SlashingProtection) Check(val common.Address, number uint64, sealHash common.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.check(val, number, sealHash)
+}
+
+// CheckAndRecord checks that the validator may seal the header with the given
+// number and seal hash, and records it as the highest one signed.
+func (s *SlashingProtection) CheckAndRecord(val common.Address, number uint64, sealHash common.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.check(val, number, sealHash); err != nil {
+		return err
+	}
+	return s.record(val, &SignedBlock{Number: number, SealHash: sealHash})
+}
+
+func (s *SlashingProtection) check(val common.Address, number uint64, sealHash common.Hash) error {
+	last, err := s.LastSigned(val)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		if number == last.Number && sealHash == last.SealHash {
+			return nil
+		}
+		if number <= last.Number {
+			log.Error("Refusing slashable seal", "val", val, "number", number, "hash", sealHash, "lastNumber", last.Number, "lastHash", last.SealHash)
+			return fmt.Errorf("%w: block %d, already signed block %d [%x]", errSlashableSeal, number, last.Number, last.SealHash)
+		}
+	}
+	return nil
+}
+
+// slashingInterchange is the JSON interchange format of the slashing protection
+// records.
+type slashingInterchange struct {
+	Metadata struct {
+		Version     string      `json:"interchange_format_version"`
+		GenesisHash common.Hash `json:"genesis_hash"`
+	} `json:"metadata"`
+	Data []slashingInterchangeRecord `json:"data"`
+}
+
+type slashingInterchangeRecord struct {
+	Validator common.Address      `json:"validator"`
+	Number    math.HexOrDecimal64 `json:"number"`
+	SealHash  common.Hash         `json:"seal_hash"`
+}
+
+// Export writes the slashing protection records in the JSON interchange format.
+func (s *SlashingProtection) Export(w io.Writer) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var out slashingInterchange
+	out.Metadata.Version = slashingInterchangeVersion
+	out.Metadata.GenesisHash = s.genesisHash
+	out.Data = []slashingInterchangeRecord{}
+
+	it := s.db.NewIterator(slashingPrefix, nil)
+	defer it.Release()
+	for it.Next() {
+		if len(it.Key()) != len(slashingPrefix)+common.AddressLength {
+			continue
+		}
+		signed := new(SignedBlock)
+		if err := rlp.DecodeBytes(it.Value(), signed); err != nil {
+			return err
+		}
+		out.Data = append(out.Data, slashingInterchangeRecord{
+			Validator: common.BytesToAddress(it.Key()[len(slashingPrefix):]),
+			Number:    math.HexOrDecimal64(signed.Number),
+			SealHash:  signed.SealHash,
+		})
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	sort.Slice(out.Data, func(i, j int) bool {
+		return bytes.Compare(out.Data[i].Validator[:], out.Data[j].Validator[:]) < 0
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&out)
+}
+
+// Import merges slashing protection records in the JSON interchange format into
+// the store. For every validator the highest signed block is kept, so that
+// importing stale records never lowers the protection.
+func (s *SlashingProtection) Import(r io.Reader) error {
+	var in slashingInterchange
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return err
+	}
+	if in.Metadata.Version != slashingInterchangeVersion {
+		return fmt.Errorf("%w: %q", errInterchangeVersion, in.Metadata.Version)
+	}
+	if in.Metadata.GenesisHash != s.genesisHash {
+		return fmt.Errorf("%w: genesis %x, want %x", errInterchangeGenesis, in.Metadata.GenesisHash, s.genesisHash)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, rec := range in.Data {
+		last, err := s.LastSigned(rec.Validator)
+		if err != nil {
+			return err
+		}
+		if last != nil && last.Number >= uint64(rec.Number) {
+			continue
+		}
+		if err := s.record(rec.Validator, &SignedBlock{Number: uint64(rec.Number), SealHash: rec.SealHash}); err != nil {
+			return err
+		}
+		log.Info("Imported slashing protection record", "val", rec.Validator, "number", uint64(rec.Number), "hash", rec.SealHash)
+	}
+	return nil
+}
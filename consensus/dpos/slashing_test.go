@@ -0,0 +1,186 @@
+package dpos
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that only headers above the highest signed one, or that very header
+// again, are permitted to be sealed.
+func TestSlashingProtection(t *testing.T) {
+	var (
+		val      = common.HexToAddress("0x01")
+		other    = common.HexToAddress("0x02")
+		slashing = NewSlashingProtection(rawdb.NewMemoryDatabase(), common.HexToHash("0x11"))
+	)
+	tests := []struct {
+		val    common.Address
+		number uint64
+		hash   common.Hash
+		err    error
+	}{
+		{val, 10, common.HexToHash("0xa"), nil},
+		{val, 10, common.HexToHash("0xa"), nil},              // same header again
+		{val, 10, common.HexToHash("0xb"), errSlashableSeal}, // conflicting header
+		{val, 9, common.HexToHash("0xc"), errSlashableSeal},  // below the highest
+		{other, 9, common.HexToHash("0xc"), nil},             // another validator
+		{val, 11, common.HexToHash("0xd"), nil},
+		{val, 10, common.HexToHash("0xa"), errSlashableSeal}, // superseded header
+	}
+	for i, tt := range tests {
+		if err := slashing.CheckAndRecord(tt.val, tt.number, tt.hash); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if last, _ := slashing.LastSigned(val); last == nil || last.Number != 11 || last.SealHash != common.HexToHash("0xd") {
+		t.Errorf("last signed mismatch: have %v, want 11 [0xd]", last)
+	}
+	if last, _ := slashing.LastSigned(common.HexToAddress("0x03")); last != nil {
+		t.Errorf("unknown validator has signed %v", last)
+	}
+}
+
+// Tests that slashing protection records survive an export and import, that
+// imports never lower the protection and that records of other chains are
+// refused.
+func TestSlashingInterchange(t *testing.T) {
+	var (
+		genesis = common.HexToHash("0x1234")
+		val1    = common.HexToAddress("0x01")
+		val2    = common.HexToAddress("0x02")
+		src     = NewSlashingProtection(rawdb.NewMemoryDatabase(), genesis)
+		dst     = NewSlashingProtection(rawdb.NewMemoryDatabase(), genesis)
+	)
+	src.CheckAndRecord(val1, 100, common.HexToHash("0xa"))
+	src.CheckAndRecord(val2, 50, common.HexToHash("0xb"))
+	dst.CheckAndRecord(val2, 60, common.HexToHash("0xc"))
+
+	var buf bytes.Buffer
+	if err := src.Export(&buf); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	exported := buf.String()
+	if err := dst.Import(strings.NewReader(exported)); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if last, _ := dst.LastSigned(val1); last == nil || last.Number != 100 || last.SealHash != common.HexToHash("0xa") {
+		t.Errorf("imported record mismatch: have %v, want 100 [0xa]", last)
+	}
+	if last, _ := dst.LastSigned(val2); last == nil || last.Number != 60 || last.SealHash != common.HexToHash("0xc") {
+		t.Errorf("stale import lowered protection: have %v, want 60 [0xc]", last)
+	}
+	if err := dst.CheckAndRecord(val1, 100, common.HexToHash("0xd")); !errors.Is(err, errSlashableSeal) {
+		t.Errorf("conflicting seal after import: have %v, want %v", err, errSlashableSeal)
+	}
+	other := NewSlashingProtection(rawdb.NewMemoryDatabase(), common.HexToHash("0x5678"))
+	if err := other.Import(strings.NewReader(exported)); !errors.Is(err, errInterchangeGenesis) {
+		t.Errorf("foreign import error mismatch: have %v, want %v", err, errInterchangeGenesis)
+	}
+	future := strings.Replace(exported, `"interchange_format_version": "1"`, `"interchange_format_version": "2"`, 1)
+	if err := dst.Import(strings.NewReader(future)); !errors.Is(err, errInterchangeVersion) {
+		t.Errorf("unknown version error mismatch: have %v, want %v", err, errInterchangeVersion)
+	}
+}
+
+// Tests that the engine refuses to sign a header conflicting with one it
+// already handed out, without ever handing it to the signer, while headers
+// interrupted before their slot may be resealed.
+func TestSealSlashingProtection(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	blocks := pt.generate(pt.newEngine(false), 1)
+
+	var signs int
+	engine := pt.newEngine(false)
+	engine.Authorize(pt.validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		signs++
+		return make([]byte, extraSeal), nil
+	}, nil)
+	engine.SetSlashingProtection(NewSlashingProtection(rawdb.NewMemoryDatabase(), pt.genesis.Hash()))
+	reader := newTestChainReader(pt.config, engine, pt.genesis, blocks[0])
+
+	header := blocks[0].Header()
+	header.Extra = make([]byte, extraVanity+extraSeal)
+	header.Difficulty = new(big.Int).Set(diffInTurn)
+
+	// A seal interrupted before its slot, e.g. by a recommit, publishes nothing
+	header.Time = uint64(time.Now().Add(time.Hour).Unix())
+	stop := make(chan struct{})
+	if err := engine.Seal(reader, blocks[0].WithSeal(header), make(chan *types.Block, 1), stop); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	close(stop)
+
+	// Resealing the height with another header is thus permitted
+	header.Time = blocks[0].Time()
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(reader, blocks[0].WithSeal(header), results, make(chan struct{})); err != nil {
+		t.Fatalf("failed to reseal unpublished block: %v", err)
+	}
+	select {
+	case <-results:
+	case <-time.After(time.Second):
+		t.Fatalf("sealed block not published")
+	}
+	// Once published, no other header of the height may be sealed
+	header.Time++
+	err := engine.Seal(reader, blocks[0].WithSeal(header), make(chan *types.Block, 1), make(chan struct{}))
+	if !errors.Is(err, errSlashableSeal) {
+		t.Fatalf("seal error mismatch: have %v, want %v", err, errSlashableSeal)
+	}
+	if signs != 2 {
+		t.Errorf("signer invocations mismatch: have %d, want 2", signs)
+	}
+}
+
+// Tests that sealed headers are recorded before being handed out, so a header
+// the miner never picked up still blocks its height.
+func TestSealRecordsUnpublished(t *testing.T) {
+	pt := newPipelineTester(t, nil)
+	blocks := pt.generate(pt.newEngine(false), 1)
+
+	engine := pt.newEngine(false)
+	engine.Authorize(pt.validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return make([]byte, extraSeal), nil
+	}, nil)
+	slashing := NewSlashingProtection(rawdb.NewMemoryDatabase(), pt.genesis.Hash())
+	engine.SetSlashingProtection(slashing)
+	reader := newTestChainReader(pt.config, engine, pt.genesis, blocks[0])
+
+	header := blocks[0].Header()
+	header.Extra = make([]byte, extraVanity+extraSeal)
+	header.Difficulty = new(big.Int).Set(diffInTurn)
+
+	// Nobody reads the results, the header is dropped after being recorded
+	if err := engine.Seal(reader, blocks[0].WithSeal(header), make(chan *types.Block), make(chan struct{})); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		last, err := slashing.LastSigned(pt.validator)
+		if err != nil {
+			t.Fatalf("failed to read slashing protection: %v", err)
+		}
+		if last != nil {
+			if last.Number != header.Number.Uint64() {
+				t.Fatalf("recorded number mismatch: have %d, want %d", last.Number, header.Number.Uint64())
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sealed block not recorded")
+		}
+	}
+	header.Time++
+	err := engine.Seal(reader, blocks[0].WithSeal(header), make(chan *types.Block, 1), make(chan struct{}))
+	if !errors.Is(err, errSlashableSeal) {
+		t.Fatalf("seal error mismatch: have %v, want %v", err, errSlashableSeal)
+	}
+}
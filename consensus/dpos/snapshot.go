@@ -82,7 +82,7 @@ func (s validatorsAscending) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 // loadSnapshot loads an existing snapshot from the database.
 func loadSnapshot(config *params.DposConfig, sigCache *lru.ARCCache, db ethdb.Database, hash common.Hash, ethAPI *ethapi.PublicBlockChainAPI) (*Snapshot, error) {
-	blob, err := db.Get(append([]byte("dpos-"), hash[:]...))
+	blob, err := db.Get(snapshotKey(hash))
 	if err != nil {
 		return nil, err
 	}
@@ -99,11 +99,7 @@ func loadSnapshot(config *params.DposConfig, sigCache *lru.ARCCache, db ethdb.Da
 
 // store inserts the snapshot into the database.
 func (s *Snapshot) store(db ethdb.Database) error {
-	blob, err := json.Marshal(s)
-	if err != nil {
-		return err
-	}
-	return db.Put(append([]byte("dpos-"), s.Hash[:]...), blob)
+	return WriteSnapshot(db, s)
 }
 
 // copy creates a deep copy of the snapshot
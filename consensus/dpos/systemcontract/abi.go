@@ -44,12 +44,64 @@ const PunishInteractiveABI = `
 		"outputs": [],
 		"stateMutability": "nonpayable",
 		"type": "function"
-	  }
+	  },
+	{
+		"inputs": [
+		  {
+			"internalType": "address",
+			"name": "val",
+			"type": "address"
+		  }
+		],
+		"name": "getPunishRecord",
+		"outputs": [
+		  {
+			"internalType": "uint256",
+			"name": "",
+			"type": "uint256"
+		  }
+		],
+		"stateMutability": "view",
+		"type": "function"
+	}
 ]
 `
 
 const SysGovInteractiveABI = `
 [
+	{
+		"inputs": [
+			{
+				"internalType": "uint256",
+				"name": "action",
+				"type": "uint256"
+			},
+			{
+				"internalType": "address",
+				"name": "from",
+				"type": "address"
+			},
+			{
+				"internalType": "address",
+				"name": "to",
+				"type": "address"
+			},
+			{
+				"internalType": "uint256",
+				"name": "value",
+				"type": "uint256"
+			},
+			{
+				"internalType": "bytes",
+				"name": "input",
+				"type": "bytes"
+			}
+		],
+		"name": "commitProposal",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
     {
 		"inputs": [
 			{
@@ -137,6 +189,24 @@ const SysGovInteractiveABI = `
 
 const AddrListInteractiveABI = `
 [
+    {
+        "inputs": [
+            {
+                "internalType": "address",
+                "name": "a",
+                "type": "address"
+            },
+            {
+                "internalType": "enum AddressList.Direction",
+                "name": "d",
+                "type": "uint8"
+            }
+        ],
+        "name": "addBlacklist",
+        "outputs": [],
+        "stateMutability": "nonpayable",
+        "type": "function"
+    },
     {
         "inputs": [],
         "name": "devVerifyEnabled",
@@ -207,24 +277,36 @@ const AddrListInteractiveABI = `
         ],
         "stateMutability": "view",
         "type": "function"
-    }
-]`
-
-const DposFactoryInteractiveABI = `[
+    },
     {
         "inputs": [
             {
-                "internalType": "uint256",
-                "name": "",
-                "type": "uint256"
+                "internalType": "address",
+                "name": "a",
+                "type": "address"
+            },
+            {
+                "internalType": "enum AddressList.Direction",
+                "name": "d",
+                "type": "uint8"
             }
         ],
+        "name": "removeBlacklist",
+        "outputs": [],
+        "stateMutability": "nonpayable",
+        "type": "function"
+    }
+]`
+
+const DposFactoryInteractiveABI = `[
+    {
+        "inputs": [],
         "name": "getActiveValidators",
         "outputs": [
             {
-                "internalType": "address",
+                "internalType": "address[]",
                 "name": "",
-                "type": "address"
+                "type": "address[]"
             }
         ],
         "stateMutability": "view",
@@ -285,6 +367,94 @@ const DposFactoryInteractiveABI = `[
         "outputs": [],
         "stateMutability": "nonpayable",
         "type": "function"
+    },
+    {
+        "inputs": [],
+        "name": "admin",
+        "outputs": [
+            {
+                "internalType": "address",
+                "name": "",
+                "type": "address"
+            }
+        ],
+        "stateMutability": "view",
+        "type": "function"
+    },
+    {
+        "inputs": [
+            {
+                "internalType": "address",
+                "name": "_val",
+                "type": "address"
+            },
+            {
+                "internalType": "bool",
+                "name": "pause",
+                "type": "bool"
+            }
+        ],
+        "name": "updateValidatorState",
+        "outputs": [],
+        "stateMutability": "nonpayable",
+        "type": "function"
+    }
+]`
+
+// ValidatorInteractiveABI is the ABI of the contract the factory deploys for
+// every validator, keeping its state, votes, commission and rewards.
+const ValidatorInteractiveABI = `[
+    {
+        "inputs": [],
+        "name": "totalVote",
+        "outputs": [
+            {
+                "internalType": "uint256",
+                "name": "",
+                "type": "uint256"
+            }
+        ],
+        "stateMutability": "view",
+        "type": "function"
+    },
+    {
+        "inputs": [],
+        "name": "percent",
+        "outputs": [
+            {
+                "internalType": "uint256",
+                "name": "",
+                "type": "uint256"
+            }
+        ],
+        "stateMutability": "view",
+        "type": "function"
+    },
+    {
+        "inputs": [],
+        "name": "getValidatorPendingReward",
+        "outputs": [
+            {
+                "internalType": "uint256",
+                "name": "",
+                "type": "uint256"
+            }
+        ],
+        "stateMutability": "view",
+        "type": "function"
+    },
+    {
+        "inputs": [],
+        "name": "state",
+        "outputs": [
+            {
+                "internalType": "uint8",
+                "name": "",
+                "type": "uint8"
+            }
+        ],
+        "stateMutability": "view",
+        "type": "function"
     }
 ]`
 
@@ -317,12 +487,16 @@ var (
 	AddressListContractName = "address_list"
 	DposFactoryContractName = "dpos_factory"
 	PunishV1ContractName    = "punish_v1"
+	ValidatorContractName   = "validator"
 	SysGovContractAddr      = common.HexToAddress("0x000000000000000000000000000000000000c000")
 	AddressListContractAddr = common.HexToAddress("0x000000000000000000000000000000000000c001")
 	DposFactoryContractAddr = common.HexToAddress("0x000000000000000000000000000000000000c002")
 	PunishV1ContractAddr    = common.HexToAddress("0x000000000000000000000000000000000000c003")
 	// SysGovToAddr is the To address for the system governance transaction, NOT contract address
 	SysGovToAddr = common.HexToAddress("0x000000000000000000000000000000000000cccc")
+	// ValidatorContractSelector is the selector of the factory getter returning
+	// the contract deployed for the validator given as its only argument.
+	ValidatorContractSelector = common.FromHex("0xd86768e9")
 
 	abiMap map[string]abi.ABI
 )
@@ -337,6 +511,8 @@ func init() {
 	abiMap[SysGovContractName] = tmpABI
 	tmpABI, _ = abi.JSON(strings.NewReader(AddrListInteractiveABI))
 	abiMap[AddressListContractName] = tmpABI
+	tmpABI, _ = abi.JSON(strings.NewReader(ValidatorInteractiveABI))
+	abiMap[ValidatorContractName] = tmpABI
 }
 
 func GetInteractiveABI() map[string]abi.ABI {
@@ -1,15 +1,46 @@
 package systemcontract
 
 import (
+	"bytes"
+
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/stretchr/testify/require"
 	"strings"
 	"testing"
 )
 
 func TestJsonUnmarshalABI(t *testing.T) {
-	for _, abiStr := range []string{DposFactoryInteractiveABI, PunishInteractiveABI, SysGovInteractiveABI, AddrListInteractiveABI} {
+	for _, abiStr := range []string{DposFactoryInteractiveABI, PunishInteractiveABI, SysGovInteractiveABI, AddrListInteractiveABI, ValidatorInteractiveABI} {
 		_, err := abi.JSON(strings.NewReader(DposFactoryInteractiveABI))
 		require.NoError(t, err, abiStr)
 	}
 }
+
+// Tests that every method of the interactive ABIs is dispatched by the runtime
+// code of its system contract, so that no call targets a missing function.
+func TestInteractiveABIMethodsDeployed(t *testing.T) {
+	codes := map[string]string{
+		DposFactoryContractName: validatorV1Code,
+		PunishV1ContractName:    punishV1Code,
+		SysGovContractName:      govCode,
+		AddressListContractName: addressListCode,
+		// The validator contracts are deployed from the factory code
+		ValidatorContractName: validatorV1Code,
+	}
+	for name, contract := range GetInteractiveABI() {
+		code := common.FromHex(codes[name])
+		for _, method := range contract.Methods {
+			// Solidity dispatchers compare the calldata against PUSH4 selectors
+			push := append([]byte{byte(vm.PUSH4)}, method.ID...)
+			if !bytes.Contains(code, push) {
+				t.Errorf("%s: method %s (%x) not in runtime code", name, method.Sig, method.ID)
+			}
+		}
+	}
+	push := append([]byte{byte(vm.PUSH4)}, ValidatorContractSelector...)
+	if !bytes.Contains(common.FromHex(validatorV1Code), push) {
+		t.Errorf("validator contract getter (%x) not in factory code", ValidatorContractSelector)
+	}
+}
@@ -0,0 +1,20 @@
+package systemcontract
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// GenesisAlloc returns the system contracts with their runtime code, for chains
+// deploying them in the genesis block rather than through a hard fork. They are
+// initialized by the engine at block 1.
+func GenesisAlloc() core.GenesisAlloc {
+	return core.GenesisAlloc{
+		SysGovContractAddr:      {Balance: new(big.Int), Code: common.FromHex(govCode)},
+		AddressListContractAddr: {Balance: new(big.Int), Code: common.FromHex(addressListCode)},
+		DposFactoryContractAddr: {Balance: new(big.Int), Code: common.FromHex(validatorV1Code)},
+		PunishV1ContractAddr:    {Balance: new(big.Int), Code: common.FromHex(punishV1Code)},
+	}
+}
@@ -1,12 +1,18 @@
 package systemcontract
 
 import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos/vmcaller"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
-	"math/big"
 )
 
 type IUpgradeAction interface {
@@ -15,39 +21,169 @@ type IUpgradeAction interface {
 	Execute(state *state.StateDB, header *types.Header, chainContext core.ChainContext, config *params.ChainConfig) error
 }
 
-var (
-	sysContracts []IUpgradeAction
+const (
+	mainNet    = "Mainnet"
+	testNet    = "Testnet"
+	defaultNet = "Default"
 )
 
-func init() {
-	sysContracts = []IUpgradeAction{}
+// UpgradeConfig declares the upgrade of a system contract: the code written to
+// the contract and an optional init call run right after.
+type UpgradeConfig struct {
+	ContractName string
+	ContractAddr common.Address
+	Code         string                                           // Hex encoded runtime code, empty to keep the current one
+	Init         func(config *params.ChainConfig) ([]byte, error) // Packs the init call data, nil for no init call
+}
+
+func (u *UpgradeConfig) GetName() string {
+	return u.ContractName
+}
+
+// CodeHash returns the hash of the code written by the upgrade, the zero hash
+// if the code is kept.
+func (u *UpgradeConfig) CodeHash() common.Hash {
+	if u.Code == "" {
+		return common.Hash{}
+	}
+	return crypto.Keccak256Hash(common.FromHex(u.Code))
+}
+
+func (u *UpgradeConfig) Update(config *params.ChainConfig, height *big.Int, state *state.StateDB) error {
+	if u.Code == "" {
+		return nil
+	}
+	//write code to sys contract
+	state.SetCode(u.ContractAddr, common.FromHex(u.Code))
+	log.Debug("Write code to system contract account", "addr", u.ContractAddr.String(), "hash", u.CodeHash())
+
+	return nil
+}
+
+func (u *UpgradeConfig) Execute(state *state.StateDB, header *types.Header, chainContext core.ChainContext, config *params.ChainConfig) error {
+	if u.Init == nil {
+		return nil
+	}
+	data, err := u.Init(config)
+	if err != nil {
+		log.Error("Can't pack data for upgrade init call", "name", u.ContractName, "error", err)
+		return err
+	}
+	msg := types.NewMessage(header.Coinbase, &u.ContractAddr, 0, new(big.Int), math.MaxUint64, new(big.Int), data, nil, false)
+	_, err = vmcaller.ExecuteMsg(msg, state, header, chainContext, config)
+
+	return err
 }
 
-func ApplySystemContractUpgrade(state *state.StateDB, header *types.Header, chainContext core.ChainContext, config *params.ChainConfig) (err error) {
+// Upgrade is the set of system contract upgrades activated by a fork.
+type Upgrade struct {
+	Fork    string   // Name of the ChainConfig fork activating the upgrade
+	Block   *big.Int // Activation block of the fork, nil if not scheduled
+	Configs []*UpgradeConfig
+}
+
+// Activation returns the block the upgrade is applied in, nil if not scheduled.
+// The genesis state is never processed by the engine, so the upgrades of forks
+// active from genesis are applied in block 1, ahead of the system contract
+// initialization.
+func (u *Upgrade) Activation() *big.Int {
+	if u.Block == nil || u.Block.Sign() > 0 {
+		return u.Block
+	}
+	return big.NewInt(1)
+}
+
+// upgradeForks lists, in activation order, the ChainConfig forks which system
+// contract upgrades can be keyed by.
+var upgradeForks = []struct {
+	name  string
+	block func(config *params.ChainConfig) *big.Int
+}{
+	{"redCoast", func(config *params.ChainConfig) *big.Int { return config.RedCoastBlock }},
+	{"systemTx", func(config *params.ChainConfig) *big.Int { return config.SystemTxBlock }},
+}
+
+// upgrades holds the system contract upgrades keyed by fork name, then by
+// network. Networks without an entry of their own run the defaultNet one.
+var upgrades = map[string]map[string][]*UpgradeConfig{
+	"redCoast": {
+		mainNet:    {},
+		testNet:    {},
+		defaultNet: {},
+	},
+	"systemTx": {
+		mainNet:    {},
+		testNet:    {},
+		defaultNet: {},
+	},
+}
+
+// network returns the name of the network with the given genesis hash.
+func network(genesisHash common.Hash) string {
+	switch genesisHash {
+	case params.MainnetGenesisHash:
+		return mainNet
+	case params.TestnetGenesisHash:
+		return testNet
+	default:
+		return defaultNet
+	}
+}
+
+// Upgrades returns the system contract upgrades of the network with the given
+// genesis hash, in activation order. Forks without upgrades are skipped.
+func Upgrades(config *params.ChainConfig, genesisHash common.Hash) []*Upgrade {
+	net := network(genesisHash)
+
+	var list []*Upgrade
+	for _, fork := range upgradeForks {
+		configs, ok := upgrades[fork.name][net]
+		if !ok {
+			configs = upgrades[fork.name][defaultNet]
+		}
+		if len(configs) == 0 {
+			continue
+		}
+		list = append(list, &Upgrade{Fork: fork.name, Block: fork.block(config), Configs: configs})
+	}
+	return list
+}
+
+// ApplySystemContractUpgrade runs the system contract upgrades activated at the
+// height of the given header, if any.
+func ApplySystemContractUpgrade(state *state.StateDB, header *types.Header, chainContext core.ChainContext, config *params.ChainConfig, genesisHash common.Hash) (err error) {
 	if config == nil || header == nil || state == nil {
 		return
 	}
 	height := header.Number
 
-	for _, contract := range sysContracts {
-		log.Info("system contract upgrade", "name", contract.GetName(), "height", height, "chainId", config.ChainID.String())
-
-		err = contract.Update(config, height, state)
-		if err != nil {
-			log.Error("Upgrade system contract update error", "name", contract.GetName(), "err", err)
-			return
+	var applied bool
+	for _, upgrade := range Upgrades(config, genesisHash) {
+		if activation := upgrade.Activation(); activation == nil || activation.Cmp(height) != 0 {
+			continue
 		}
+		for _, contract := range upgrade.Configs {
+			log.Info("system contract upgrade", "fork", upgrade.Fork, "name", contract.GetName(), "height", height, "chainId", config.ChainID.String())
+
+			err = contract.Update(config, height, state)
+			if err != nil {
+				log.Error("Upgrade system contract update error", "name", contract.GetName(), "err", err)
+				return fmt.Errorf("%s upgrade of %s failed: %v", upgrade.Fork, contract.GetName(), err)
+			}
 
-		log.Info("system contract upgrade execution", "name", contract.GetName(), "height", header.Number, "chainId", config.ChainID.String())
+			log.Info("system contract upgrade execution", "fork", upgrade.Fork, "name", contract.GetName(), "height", header.Number, "chainId", config.ChainID.String())
 
-		err = contract.Execute(state, header, chainContext, config)
-		if err != nil {
-			log.Error("Upgrade system contract execute error", "name", contract.GetName(), "err", err)
-			return
+			err = contract.Execute(state, header, chainContext, config)
+			if err != nil {
+				log.Error("Upgrade system contract execute error", "name", contract.GetName(), "err", err)
+				return fmt.Errorf("%s upgrade of %s failed: %v", upgrade.Fork, contract.GetName(), err)
+			}
 		}
+		applied = true
+	}
+	if applied {
+		// Update the state with pending changes
+		state.Finalise(true)
 	}
-	// Update the state with pending changes
-	state.Finalise(true)
-
 	return
 }
@@ -0,0 +1,124 @@
+package systemcontract
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+type testChainContext struct{}
+
+func (c *testChainContext) Engine() consensus.Engine { return ethash.NewFaker() }
+
+func (c *testChainContext) GetHeader(common.Hash, uint64) *types.Header { return nil }
+
+// withUpgrades replaces the upgrade registry for the duration of a test.
+func withUpgrades(t *testing.T, registry map[string]map[string][]*UpgradeConfig) {
+	saved := upgrades
+	upgrades = registry
+	t.Cleanup(func() { upgrades = saved })
+}
+
+// Tests that the upgrades are applied at the height of their fork only, and
+// that network specific upgrades override the default ones.
+func TestApplySystemContractUpgrade(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		code     = "0x600160005500" // stores 1 in slot 0
+	)
+	withUpgrades(t, map[string]map[string][]*UpgradeConfig{
+		"redCoast": {},
+		"systemTx": {
+			defaultNet: {{
+				ContractName: "Test",
+				ContractAddr: contract,
+				Code:         code,
+				Init:         func(config *params.ChainConfig) ([]byte, error) { return nil, nil },
+			}},
+			mainNet: {},
+		},
+	})
+	config := &params.ChainConfig{ChainID: big.NewInt(1), RedCoastBlock: big.NewInt(0), SystemTxBlock: big.NewInt(5)}
+
+	list := Upgrades(config, common.Hash{})
+	if len(list) != 1 || list[0].Fork != "systemTx" || list[0].Block.Cmp(config.SystemTxBlock) != 0 {
+		t.Fatalf("upgrade list mismatch: %v", list)
+	}
+	if have, want := list[0].Configs[0].CodeHash(), crypto.Keccak256Hash(common.FromHex(code)); have != want {
+		t.Fatalf("code hash mismatch: have %x, want %x", have, want)
+	}
+	if list := Upgrades(config, params.MainnetGenesisHash); len(list) != 0 {
+		t.Fatalf("mainnet override ignored: have %d upgrades, want 0", len(list))
+	}
+	for _, number := range []int64{4, 5, 6} {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		header := &types.Header{Number: big.NewInt(number), Difficulty: new(big.Int), GasLimit: 8000000}
+
+		if err := ApplySystemContractUpgrade(statedb, header, &testChainContext{}, config, common.Hash{}); err != nil {
+			t.Fatalf("block %d: upgrade failed: %v", number, err)
+		}
+		upgraded := statedb.GetCodeHash(contract) == crypto.Keccak256Hash(common.FromHex(code))
+		initialized := statedb.GetState(contract, common.Hash{}) == common.BigToHash(common.Big1)
+		if want := number == 5; upgraded != want || initialized != want {
+			t.Errorf("block %d: upgrade mismatch: upgraded %v, initialized %v, want %v", number, upgraded, initialized, want)
+		}
+	}
+}
+
+// Tests that the upgrades of forks active from genesis are applied in block 1,
+// the genesis state being never processed by the engine.
+func TestApplyGenesisUpgrade(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		code     = "0x600160005500" // stores 1 in slot 0
+	)
+	withUpgrades(t, map[string]map[string][]*UpgradeConfig{
+		"redCoast": {defaultNet: {{ContractName: "Test", ContractAddr: contract, Code: code}}},
+	})
+	config := &params.ChainConfig{ChainID: big.NewInt(1), RedCoastBlock: big.NewInt(0)}
+
+	if list := Upgrades(config, common.Hash{}); len(list) != 1 || list[0].Activation().Cmp(common.Big1) != 0 {
+		t.Fatalf("upgrade activation mismatch: %v", list)
+	}
+	for _, number := range []int64{0, 1, 2} {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		header := &types.Header{Number: big.NewInt(number), Difficulty: new(big.Int), GasLimit: 8000000}
+
+		if err := ApplySystemContractUpgrade(statedb, header, &testChainContext{}, config, common.Hash{}); err != nil {
+			t.Fatalf("block %d: upgrade failed: %v", number, err)
+		}
+		upgraded := statedb.GetCodeHash(contract) == crypto.Keccak256Hash(common.FromHex(code))
+		if want := number == 1; upgraded != want {
+			t.Errorf("block %d: upgrade mismatch: have %v, want %v", number, upgraded, want)
+		}
+	}
+}
+
+// Tests that the mainnet genesis carries the current system contracts, so no
+// upgrade is needed before their initialization in block 1.
+func TestMainnetGenesisContracts(t *testing.T) {
+	genesis := core.DefaultGenesisBlock()
+	db := rawdb.NewMemoryDatabase()
+	block := genesis.MustCommit(db)
+
+	for _, upgrade := range Upgrades(genesis.Config, block.Hash()) {
+		if activation := upgrade.Activation(); activation != nil && activation.Cmp(common.Big1) == 0 {
+			t.Errorf("%s upgrade applied in block 1", upgrade.Fork)
+		}
+	}
+	statedb, _ := state.New(block.Root(), state.NewDatabase(db), nil)
+	for addr, account := range GenesisAlloc() {
+		if have, want := statedb.GetCodeHash(addr), crypto.Keccak256Hash(account.Code); have != want {
+			t.Errorf("code hash mismatch of %x: have %x, want %x", addr, have, want)
+		}
+	}
+}
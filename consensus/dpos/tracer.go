@@ -0,0 +1,63 @@
+package dpos
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// accessTracer records the accounts and storage slots an execution touches, to
+// diff them against the state before it or to prove them.
+type accessTracer struct {
+	touched map[common.Address]map[common.Hash]struct{}
+	output  []byte // Output of the top call
+	err     error  // Error of the top call
+}
+
+func newAccessTracer() *accessTracer {
+	return &accessTracer{touched: make(map[common.Address]map[common.Hash]struct{})}
+}
+
+// touch marks an account as touched, returning its touched storage slots.
+func (t *accessTracer) touch(addr common.Address) map[common.Hash]struct{} {
+	slots, ok := t.touched[addr]
+	if !ok {
+		slots = make(map[common.Hash]struct{})
+		t.touched[addr] = slots
+	}
+	return slots
+}
+
+func (t *accessTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.touch(from)
+	t.touch(to)
+}
+
+func (t *accessTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	slots := t.touch(scope.Contract.Address())
+
+	stack := scope.Stack
+	switch op {
+	case vm.SLOAD, vm.SSTORE:
+		if len(stack.Data()) >= 1 {
+			slots[common.Hash(stack.Back(0).Bytes32())] = struct{}{}
+		}
+	case vm.BALANCE, vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH, vm.SELFDESTRUCT:
+		if len(stack.Data()) >= 1 {
+			t.touch(common.Address(stack.Back(0).Bytes20()))
+		}
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		if len(stack.Data()) >= 2 {
+			t.touch(common.Address(stack.Back(1).Bytes20()))
+		}
+	}
+}
+
+func (t *accessTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *accessTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.output, t.err = common.CopyBytes(output), err
+}
@@ -12,11 +12,17 @@ import (
 
 // ExecuteMsg executes transaction sent to system contracts.
 func ExecuteMsg(msg core.Message, state *state.StateDB, header *types.Header, chainContext core.ChainContext, chainConfig *params.ChainConfig) (ret []byte, err error) {
+	return ExecuteMsgWithConfig(msg, state, header, chainContext, chainConfig, vm.Config{})
+}
+
+// ExecuteMsgWithConfig executes transaction sent to system contracts with the
+// given EVM configuration, which allows tracing it.
+func ExecuteMsgWithConfig(msg core.Message, state *state.StateDB, header *types.Header, chainContext core.ChainContext, chainConfig *params.ChainConfig, vmConfig vm.Config) (ret []byte, err error) {
 	// Set gas price to zero
 	context := core.NewEVMBlockContext(header, chainContext, nil)
 	// Create a new environment which holds all relevant information
 	// about the transaction and calling mechanisms.
-	vmenv := vm.NewEVM(context, vm.TxContext{Origin: msg.From(), GasPrice: big.NewInt(0)}, state, chainConfig, vm.Config{})
+	vmenv := vm.NewEVM(context, vm.TxContext{Origin: msg.From(), GasPrice: big.NewInt(0)}, state, chainConfig, vmConfig)
 	// Apply the transaction to the current state (included in the env)
 	ret, _, err = vmenv.Call(
 		vm.AccountRef(msg.From()),
@@ -34,4 +34,8 @@ var (
 	// ErrInvalidNumber is returned if a block's number doesn't equal its parent's
 	// plus one.
 	ErrInvalidNumber = errors.New("invalid block number")
+
+	// ErrAddressDenied is returned if a transaction's sender or recipient is
+	// denied by the consensus rules (e.g. blacklisted).
+	ErrAddressDenied = errors.New("address denied")
 )
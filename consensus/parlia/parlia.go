@@ -372,6 +372,19 @@ func (p *Parlia) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*typ
 	return abort, results
 }
 
+// VerifyHeaderWithParents is similar to VerifyHeader, but takes the batch of
+// parents (ascending order) the header is verified along with. It lets an engine
+// taking over the chain from parlia verify batches straddling the switch.
+func (p *Parlia) VerifyHeaderWithParents(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	return p.verifyHeader(chain, header, parents)
+}
+
+// Snapshot retrieves the validator set snapshot at the given block, looking up
+// the headers missing from the database in parents (ascending order).
+func (p *Parlia) Snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	return p.snapshot(chain, number, hash, parents)
+}
+
 // verifyHeader checks whether a header conforms to the consensus rules.The
 // caller may optionally pass in a batch of parents (ascending order) to avoid
 // looking those up from the database. This is useful for concurrently verifying
@@ -1456,11 +1469,11 @@ func (p *Parlia) ValidateTx(tx *types.Transaction, header *types.Header, parentS
 			return err
 		}
 		if d, exist := m[from]; exist && (d != DirectionTo) {
-			return errors.New("address denied")
+			return consensus.ErrAddressDenied
 		}
 		if to := tx.To(); to != nil {
 			if d, exist := m[*to]; exist && (d != DirectionFrom) {
-				return errors.New("address denied")
+				return consensus.ErrAddressDenied
 			}
 		}
 	}
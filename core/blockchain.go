@@ -178,6 +178,7 @@ type BlockChain struct {
 	chainFeed     event.Feed
 	chainSideFeed event.Feed
 	chainHeadFeed event.Feed
+	finalizedFeed event.Feed
 	logsFeed      event.Feed
 	blockProcFeed event.Feed
 	scope         event.SubscriptionScope
@@ -187,6 +188,8 @@ type BlockChain struct {
 
 	currentBlock     atomic.Value // Current head of the block chain
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
+	finality         atomic.Value // Finalized and safe blocks derived by the engine for the last seen head
+	lastFinalized    common.Hash  // Finalized block last announced over the feed (guarded by chainmu)
 
 	stateCache    state.Database // State database to reuse between imports (contains state cache)
 	bodyCache     *lru.Cache     // Cache for the most recent block bodies
@@ -700,6 +703,67 @@ func (bc *BlockChain) CurrentFastBlock() *types.Block {
 	return bc.currentFastBlock.Load().(*types.Block)
 }
 
+// finalityMarks are the finalized and safe headers the consensus engine derived
+// for a chain head.
+type finalityMarks struct {
+	head      common.Hash
+	finalized *types.Header
+	safe      *types.Header
+}
+
+// currentFinality returns the finality marks of the current head, deriving them
+// anew if the head moved since they were last asked for. Nil is returned if the
+// consensus engine doesn't track finality.
+func (bc *BlockChain) currentFinality() *finalityMarks {
+	finality, ok := bc.engine.(consensus.Finality)
+	if !ok {
+		return nil
+	}
+	head := bc.CurrentHeader()
+	if marks, ok := bc.finality.Load().(*finalityMarks); ok && marks.head == head.Hash() {
+		return marks
+	}
+	marks := &finalityMarks{
+		head:      head.Hash(),
+		finalized: finality.FinalizedHeader(bc, head),
+		safe:      finality.SafeHeader(bc, head),
+	}
+	bc.finality.Store(marks)
+	return marks
+}
+
+// CurrentFinalizedBlock retrieves the highest block of the canonical chain the
+// consensus engine considers final, or nil if there is none.
+func (bc *BlockChain) CurrentFinalizedBlock() *types.Block {
+	marks := bc.currentFinality()
+	if marks == nil || marks.finalized == nil {
+		return nil
+	}
+	return bc.GetBlock(marks.finalized.Hash(), marks.finalized.Number.Uint64())
+}
+
+// CurrentSafeBlock retrieves the highest block of the canonical chain the
+// consensus engine considers unlikely to be reorganised, or nil if there is none.
+func (bc *BlockChain) CurrentSafeBlock() *types.Block {
+	marks := bc.currentFinality()
+	if marks == nil || marks.safe == nil {
+		return nil
+	}
+	return bc.GetBlock(marks.safe.Hash(), marks.safe.Number.Uint64())
+}
+
+// updateFinality derives the finality marks of a new chain head and fires a
+// ChainFinalizedEvent if the finalized block changed. The caller must hold the
+// chain mutex.
+func (bc *BlockChain) updateFinality() {
+	marks := bc.currentFinality()
+	if marks == nil || marks.finalized == nil || marks.finalized.Hash() == bc.lastFinalized {
+		return
+	}
+	bc.lastFinalized = marks.finalized.Hash()
+	bc.finalizedFeed.Send(ChainFinalizedEvent{Header: marks.finalized})
+}
+
 // Validator returns the current validator.
 func (bc *BlockChain) Validator() Validator {
 	return bc.validator
@@ -1622,6 +1686,7 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		// event here.
 		if emitHeadEvent {
 			bc.chainHeadFeed.Send(ChainHeadEvent{Block: block})
+			bc.updateFinality()
 		}
 	} else {
 		bc.chainSideFeed.Send(ChainSideEvent{Block: block})
@@ -1724,6 +1789,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 	defer func() {
 		if lastCanon != nil && bc.CurrentBlock().Hash() == lastCanon.Hash() {
 			bc.chainHeadFeed.Send(ChainHeadEvent{lastCanon})
+			bc.updateFinality()
 		}
 	}()
 	// Start the parallel header verifier
@@ -2526,6 +2592,11 @@ func (bc *BlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Su
 	return bc.scope.Track(bc.chainHeadFeed.Subscribe(ch))
 }
 
+// SubscribeChainFinalizedEvent registers a subscription of ChainFinalizedEvent.
+func (bc *BlockChain) SubscribeChainFinalizedEvent(ch chan<- ChainFinalizedEvent) event.Subscription {
+	return bc.scope.Track(bc.finalizedFeed.Subscribe(ch))
+}
+
 // SubscribeChainSideEvent registers a subscription of ChainSideEvent.
 func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Subscription {
 	return bc.scope.Track(bc.chainSideFeed.Subscribe(ch))
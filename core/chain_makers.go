@@ -23,6 +23,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 
 	"github.com/ethereum/go-ethereum/core/types"
@@ -86,7 +87,7 @@ func (b *BlockGen) SetDifficulty(diff *big.Int) {
 // the protocol-imposed limitations (gas limit, etc.), there are some
 // further limitations on the content of transactions that can be
 // added. Notably, contract code relying on the BLOCKHASH instruction
-// will panic during execution.
+// will only see the parent hash, any older block hash is zero.
 func (b *BlockGen) AddTx(tx *types.Transaction) {
 	b.AddTxWithChain(nil, tx)
 }
@@ -103,8 +104,14 @@ func (b *BlockGen) AddTxWithChain(bc *BlockChain, tx *types.Transaction) {
 	if b.gasPool == nil {
 		b.SetCoinbase(common.Address{})
 	}
+	// Without a backing chain, still let the engine take part in the execution
+	// (e.g. contract creation rules), only the block hashes are unavailable.
+	var chain ChainContext = bc
+	if bc == nil {
+		chain = &fakeChainReader{config: b.config, engine: b.engine}
+	}
 	b.statedb.Prepare(tx.Hash(), common.Hash{}, len(b.txs))
-	receipt, err := ApplyTransaction(b.config, bc, &b.header.Coinbase, b.gasPool, b.statedb, b.header, tx, &b.header.GasUsed, vm.Config{})
+	receipt, err := ApplyTransaction(b.config, chain, &b.header.Coinbase, b.gasPool, b.statedb, b.header, tx, &b.header.GasUsed, vm.Config{})
 	if err != nil {
 		panic(err)
 	}
@@ -196,7 +203,7 @@ func GenerateChain(config *params.ChainConfig, parent *types.Block, engine conse
 		config = params.TestChainConfig
 	}
 	blocks, receipts := make(types.Blocks, n), make([]types.Receipts, n)
-	chainreader := &fakeChainReader{config: config}
+	chainreader := &fakeChainReader{config: config, db: db, blocks: blocks}
 	genblock := func(i int, parent *types.Block, statedb *state.StateDB) (*types.Block, types.Receipts) {
 		b := &BlockGen{i: i, chain: blocks, parent: parent, statedb: statedb, config: config, engine: engine}
 		b.header = makeHeader(chainreader, parent, statedb, b.engine)
@@ -299,6 +306,8 @@ func makeBlockChain(parent *types.Block, n int, engine consensus.Engine, db ethd
 type fakeChainReader struct {
 	config *params.ChainConfig
 	engine consensus.Engine
+	db     ethdb.Database // Database holding the ancestors of the generated chain, if any
+	blocks types.Blocks   // Blocks generated so far, if any
 }
 
 // Config returns the chain configuration.
@@ -310,8 +319,55 @@ func (cr *fakeChainReader) Engine() consensus.Engine {
 	return cr.engine
 }
 
-func (cr *fakeChainReader) CurrentHeader() *types.Header                            { return nil }
-func (cr *fakeChainReader) GetHeaderByNumber(number uint64) *types.Header           { return nil }
-func (cr *fakeChainReader) GetHeaderByHash(hash common.Hash) *types.Header          { return nil }
-func (cr *fakeChainReader) GetHeader(hash common.Hash, number uint64) *types.Header { return nil }
-func (cr *fakeChainReader) GetBlock(hash common.Hash, number uint64) *types.Block   { return nil }
+func (cr *fakeChainReader) CurrentHeader() *types.Header                          { return nil }
+func (cr *fakeChainReader) GetBlock(hash common.Hash, number uint64) *types.Block { return nil }
+
+// GetHeaderByNumber retrieves a header of the generated chain or of its
+// committed ancestors by number.
+func (cr *fakeChainReader) GetHeaderByNumber(number uint64) *types.Header {
+	for _, block := range cr.blocks {
+		if block != nil && block.NumberU64() == number {
+			return block.Header()
+		}
+	}
+	if cr.db == nil {
+		return nil
+	}
+	hash := rawdb.ReadCanonicalHash(cr.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadHeader(cr.db, hash, number)
+}
+
+// GetHeaderByHash retrieves a header of the generated chain or of its committed
+// ancestors by hash.
+func (cr *fakeChainReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, block := range cr.blocks {
+		if block != nil && block.Hash() == hash {
+			return block.Header()
+		}
+	}
+	if cr.db == nil {
+		return nil
+	}
+	number := rawdb.ReadHeaderNumber(cr.db, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadHeader(cr.db, hash, *number)
+}
+
+// GetHeader retrieves a header of the generated chain or of its committed
+// ancestors by hash and number.
+func (cr *fakeChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	for _, block := range cr.blocks {
+		if block != nil && block.Hash() == hash {
+			return block.Header()
+		}
+	}
+	if cr.db == nil {
+		return nil
+	}
+	return rawdb.ReadHeader(cr.db, hash, number)
+}
@@ -41,3 +41,6 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// ChainFinalizedEvent is posted when the finalized block of the chain advances.
+type ChainFinalizedEvent struct{ Header *types.Header }
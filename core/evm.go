@@ -47,6 +47,7 @@ func NewEVMBlockContext(header *types.Header, chain ChainContext, author *common
 	return vm.BlockContext{
 		CanTransfer: CanTransfer,
 		Transfer:    Transfer,
+		CanCreate:   GetCanCreateFn(chain),
 		GetHash:     GetHashFn(header, chain),
 		Coinbase:    beneficiary,
 		BlockNumber: new(big.Int).Set(header.Number),
@@ -64,7 +65,6 @@ func NewEVMTxContext(msg Message) vm.TxContext {
 	}
 }
 
-
 // GetHashFn returns a GetHashFunc which retrieves header hashes by number
 func GetHashFn(ref *types.Header, chain ChainContext) func(n uint64) common.Hash {
 	// Cache will initially contain [refHash.parent],
@@ -110,20 +110,23 @@ func Transfer(db vm.StateDB, sender, recipient common.Address, amount *big.Int)
 	db.SubBalance(sender, amount)
 	db.AddBalance(recipient, amount)
 }
-//
-//func GetCanCreateFn(chain ChainContext) vm.CanCreateFunc {
-//	if chain.Engine() == nil {
-//		return func(db vm.StateDB, address common.Address, height *big.Int) bool {
-//			return true
-//		}
-//	}
-//	posa, isPoSA := chain.Engine().(consensus.PoSA)
-//	if isPoSA {
-//		return func(db vm.StateDB, address common.Address, height *big.Int) bool {
-//			return posa.CanCreate(db, address, height)
-//		}
-//	}
-//	return func(db vm.StateDB, address common.Address, height *big.Int) bool {
-//		return true
-//	}
-//}
+
+// GetCanCreateFn returns a CanCreateFunc which consults the consensus engine
+// whether an address is allowed to deploy contracts. Engines that don't
+// restrict contract creation get a nil function, as do missing chains.
+func GetCanCreateFn(chain ChainContext) vm.CanCreateFunc {
+	if chain == nil {
+		return nil
+	}
+	// Callers holding a nil *BlockChain pass it on as a non-nil interface
+	if bc, ok := chain.(*BlockChain); ok && bc == nil {
+		return nil
+	}
+	posa, isPoSA := chain.Engine().(consensus.PoSA)
+	if !isPoSA {
+		return nil
+	}
+	return func(db vm.StateDB, address common.Address, height *big.Int) bool {
+		return posa.CanCreate(db, address, height)
+	}
+}
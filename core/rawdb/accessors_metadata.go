@@ -138,3 +138,29 @@ func PopUncleanShutdownMarker(db ethdb.KeyValueStore) {
 		log.Warn("Failed to clear unclean-shutdown marker", "err", err)
 	}
 }
+
+// ReadValidatorKeys retrieves the dpos validator keys the node seals with, nil
+// if the set was never stored.
+func ReadValidatorKeys(db ethdb.KeyValueReader) []common.Address {
+	data, _ := db.Get(validatorKeysKey)
+	if len(data) == 0 {
+		return nil
+	}
+	keys := []common.Address{}
+	if err := rlp.DecodeBytes(data, &keys); err != nil {
+		log.Error("Invalid validator keys RLP", "err", err)
+		return nil
+	}
+	return keys
+}
+
+// WriteValidatorKeys stores the dpos validator keys the node seals with.
+func WriteValidatorKeys(db ethdb.KeyValueWriter, keys []common.Address) {
+	data, err := rlp.EncodeToBytes(keys)
+	if err != nil {
+		log.Crit("Failed to encode validator keys", "err", err)
+	}
+	if err := db.Put(validatorKeysKey, data); err != nil {
+		log.Crit("Failed to store validator keys", "err", err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -243,6 +244,78 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+const (
+	dbPebble  = "pebble"
+	dbLeveldb = "leveldb"
+)
+
+// PreexistingDatabase checks the given data directory whether a database is already
+// instantiated at that location, and if so, returns the type of database (or the
+// empty string).
+func PreexistingDatabase(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return "" // No pre-existing db
+	}
+	// Pebble keeps its options in OPTIONS-<num> files, leveldb doesn't have any
+	if matches, _ := filepath.Glob(filepath.Join(path, "OPTIONS*")); len(matches) > 0 {
+		return dbPebble
+	}
+	return dbLeveldb
+}
+
+// OpenOptions contains the options to apply when opening a database. If the
+// AncientsDirectory is empty, no freezer is attached to the database.
+type OpenOptions struct {
+	Type              string // "leveldb" | "pebble", empty to detect or default to leveldb
+	Directory         string // the datadir
+	AncientsDirectory string // the ancients-dir
+	Namespace         string // the namespace for database relevant metrics
+	Cache             int    // the capacity(in megabytes) of the data caching
+	Handles           int    // number of files to be open simultaneously
+	ReadOnly          bool
+}
+
+// openKeyValueDatabase opens a disk-based key-value database, e.g. leveldb or
+// pebble. Without an explicit type, an existing database is opened with the
+// engine it was created with and a new one defaults to leveldb. With a type, the
+// existing database must have been created with that same engine.
+func openKeyValueDatabase(o OpenOptions) (ethdb.KeyValueStore, error) {
+	existingDb := PreexistingDatabase(o.Directory)
+	if len(existingDb) != 0 && len(o.Type) != 0 && o.Type != existingDb {
+		return nil, fmt.Errorf("db.engine choice was %v but found pre-existing %v database in specified data directory", o.Type, existingDb)
+	}
+	if o.Type == dbPebble || existingDb == dbPebble {
+		log.Info("Using pebble as the backing database")
+		return newPebbleDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	}
+	if len(o.Type) != 0 && o.Type != dbLeveldb {
+		return nil, fmt.Errorf("unknown db.engine %v", o.Type)
+	}
+	// Use leveldb, either as default (no explicit choice), or pre-existing, or chosen explicitly
+	log.Info("Using leveldb as the backing database")
+	return leveldb.New(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+}
+
+// Open opens a disk-based key-value database such as leveldb or pebble, also
+// attaching a chain freezer to it if the AncientsDirectory option is set. A
+// database already existing in the directory is opened with the engine it was
+// created with, refusing an explicit choice of another one.
+func Open(o OpenOptions) (ethdb.Database, error) {
+	kvdb, err := openKeyValueDatabase(o)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.AncientsDirectory) == 0 {
+		return NewDatabase(kvdb), nil
+	}
+	frdb, err := NewDatabaseWithFreezer(kvdb, o.AncientsDirectory, o.Namespace, o.ReadOnly)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -361,7 +434,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			cliqueSnaps.Add(size)
 		case bytes.HasPrefix(key, []byte("parlia-")) && len(key) == 7+common.HashLength:
 			parliaSnaps.Add(size)
-		case bytes.HasPrefix(key, []byte("dpos-")) && len(key) == 7+common.HashLength:
+		case bytes.HasPrefix(key, []byte("dpos-")) && len(key) == 5+common.HashLength:
 			dposSnaps.Add(size)
 
 		case bytes.HasPrefix(key, []byte("cht-")) ||
@@ -380,7 +453,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
 				fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
 				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badBlockKey,
+				uncleanShutdownKey, badBlockKey, validatorKeysKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
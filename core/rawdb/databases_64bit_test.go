@@ -0,0 +1,71 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build arm64 amd64
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that an existing database is reopened with the engine it was created
+// with, and that an explicit choice of another engine is refused.
+func TestOpenDBEngine(t *testing.T) {
+	for _, engine := range []string{dbLeveldb, dbPebble} {
+		dir, err := ioutil.TempDir("", "dbengine")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if have := PreexistingDatabase(dir); have != "" {
+			t.Fatalf("%s: empty directory detected as %q", engine, have)
+		}
+		db, err := Open(OpenOptions{Type: engine, Directory: dir, AncientsDirectory: filepath.Join(dir, "ancient")})
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engine, err)
+		}
+		if err := db.Put([]byte("key"), []byte("value")); err != nil {
+			t.Fatalf("%s: failed to write: %v", engine, err)
+		}
+		db.Close()
+
+		if have := PreexistingDatabase(dir); have != engine {
+			t.Fatalf("engine mismatch: have %q, want %q", have, engine)
+		}
+		other := dbPebble
+		if engine == dbPebble {
+			other = dbLeveldb
+		}
+		if _, err := Open(OpenOptions{Type: other, Directory: dir}); err == nil {
+			t.Fatalf("%s: opened as %s", engine, other)
+		}
+		// Reopen without an explicit choice, picking the existing engine
+		db, err = Open(OpenOptions{Directory: dir})
+		if err != nil {
+			t.Fatalf("%s: failed to reopen database: %v", engine, err)
+		}
+		if blob, err := db.Get([]byte("key")); err != nil || !bytes.Equal(blob, []byte("value")) {
+			t.Errorf("%s: value mismatch: have %q, %v", engine, blob, err)
+		}
+		db.Close()
+	}
+}
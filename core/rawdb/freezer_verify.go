@@ -0,0 +1,440 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// freezerTables lists the freezer tables in the order the items of a block are
+// appended to them.
+var freezerTables = []string{freezerHashTable, freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerDifficultyTable}
+
+// FreezerTableReport describes a freezer table as stored on disk.
+type FreezerTableReport struct {
+	Name       string
+	Compressed bool   // Whether the table is stored snappy compressed
+	Items      uint64 // Number of items indexed, including the ones deleted from the tail
+	Size       uint64 // Total size of the index and data files
+}
+
+// FreezerReport is the result of verifying the tables of a freezer.
+type FreezerReport struct {
+	Tables []*FreezerTableReport // Tables in the order blocks are appended to them
+	Items  uint64                // Number of items stored in all the tables, the freezer drops the others
+	Valid  uint64                // Number of leading items found intact in all the tables
+	Head   common.Hash           // Hash of the last intact item, if any
+	Err    error                 // Problem found with the first broken item, nil if all are intact
+}
+
+// freezerTableReader reads the items of a freezer table sequentially, straight
+// from its files, validating the index along the way. Unlike opening the table,
+// it doesn't repair anything, so truncated files are found out.
+type freezerTableReader struct {
+	path       string
+	name       string
+	compressed bool
+
+	index  *os.File
+	buffer *bufio.Reader
+	files  map[uint32]*os.File
+	sizes  map[uint32]int64
+
+	items uint64     // Number of items indexed, including the ones deleted from the tail
+	tail  uint64     // Number of items deleted from the tail
+	size  uint64     // Total size of the index and data files
+	prev  indexEntry // Index entry of the last item read
+}
+
+// freezerTableFiles returns the name of the index file and the extension of the
+// data files of a freezer table stored in the given format.
+func freezerTableFiles(name string, compressed bool) (string, string) {
+	if compressed {
+		return name + ".cidx", "cdat"
+	}
+	return name + ".ridx", "rdat"
+}
+
+// newFreezerTableReader opens the files of a freezer table, in the configured
+// format if stored so, or else in the other one. A missing table has no items.
+func newFreezerTableReader(path, name string, compressed bool) (*freezerTableReader, error) {
+	r := &freezerTableReader{
+		path:       path,
+		name:       name,
+		compressed: compressed,
+		files:      make(map[uint32]*os.File),
+		sizes:      make(map[uint32]int64),
+	}
+	idxName, _ := freezerTableFiles(name, compressed)
+	if _, err := os.Stat(filepath.Join(path, idxName)); os.IsNotExist(err) {
+		other, _ := freezerTableFiles(name, !compressed)
+		if _, err := os.Stat(filepath.Join(path, other)); err != nil {
+			return r, nil
+		}
+		r.compressed, idxName = !compressed, other
+	}
+	index, err := os.Open(filepath.Join(path, idxName))
+	if err != nil {
+		return nil, err
+	}
+	r.index, r.buffer = index, bufio.NewReader(index)
+
+	stat, err := index.Stat()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.size = uint64(stat.Size())
+	_, ext := freezerTableFiles(name, r.compressed)
+	files, _ := filepath.Glob(filepath.Join(path, name+".*."+ext))
+	for _, file := range files {
+		if stat, err := os.Stat(file); err == nil {
+			r.size += uint64(stat.Size())
+		}
+	}
+	// The first index entry holds the earliest data file and the number of items
+	// deleted from the tail, a partial last entry is dropped on open
+	entries := stat.Size() / indexEntrySize
+	if entries == 0 {
+		return r, nil
+	}
+	buffer := make([]byte, indexEntrySize)
+	if _, err := io.ReadFull(r.buffer, buffer); err != nil {
+		r.Close()
+		return nil, err
+	}
+	var first indexEntry
+	first.unmarshalBinary(buffer)
+
+	r.tail = uint64(first.offset)
+	r.items = r.tail + uint64(entries-1)
+	r.prev = indexEntry{filenum: first.filenum}
+	return r, nil
+}
+
+// read retrieves the next item of the table, decompressed if need be.
+func (r *freezerTableReader) read() ([]byte, error) {
+	buffer := make([]byte, indexEntrySize)
+	if _, err := io.ReadFull(r.buffer, buffer); err != nil {
+		return nil, err
+	}
+	var entry indexEntry
+	entry.unmarshalBinary(buffer)
+
+	// Items are appended to the data files in order, crossing to the next file
+	// in one piece
+	start := r.prev.offset
+	switch {
+	case entry.filenum == r.prev.filenum && entry.offset <= r.prev.offset:
+		return nil, fmt.Errorf("index offset %d not after %d in data file %d", entry.offset, r.prev.offset, entry.filenum)
+	case entry.filenum == r.prev.filenum+1:
+		start = 0
+	case entry.filenum != r.prev.filenum:
+		return nil, fmt.Errorf("index skips from data file %d to %d", r.prev.filenum, entry.filenum)
+	}
+	file, exist := r.files[entry.filenum]
+	if !exist {
+		_, ext := freezerTableFiles(r.name, r.compressed)
+		name := filepath.Join(r.path, fmt.Sprintf("%s.%04d.%s", r.name, entry.filenum, ext))
+
+		var err error
+		if file, err = os.Open(name); err != nil {
+			return nil, err
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.files[entry.filenum], r.sizes[entry.filenum] = file, stat.Size()
+	}
+	if size := r.sizes[entry.filenum]; int64(entry.offset) > size {
+		return nil, fmt.Errorf("data file %d truncated: item ends at %d, file has %d bytes", entry.filenum, entry.offset, size)
+	}
+	blob := make([]byte, entry.offset-start)
+	if _, err := file.ReadAt(blob, int64(start)); err != nil {
+		return nil, err
+	}
+	r.prev = entry
+
+	if !r.compressed {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// Close closes the files of the table.
+func (r *freezerTableReader) Close() {
+	if r.index != nil {
+		r.index.Close()
+	}
+	for _, file := range r.files {
+		file.Close()
+	}
+}
+
+// VerifyFreezer checks the freezer tables stored in the given directory. The
+// index of every table must point to increasing offsets within the data files,
+// each item must decode, and the headers must chain up with their hashes. The
+// freezer must not be in use.
+func VerifyFreezer(datadir string) (*FreezerReport, error) {
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	var (
+		report  = &FreezerReport{Items: math.MaxUint64}
+		readers = make([]*freezerTableReader, len(freezerTables))
+	)
+	for i, name := range freezerTables {
+		r, err := newFreezerTableReader(datadir, name, !FreezerNoSnappy[name])
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		readers[i] = r
+		report.Tables = append(report.Tables, &FreezerTableReport{
+			Name:       name,
+			Compressed: r.compressed,
+			Items:      r.items,
+			Size:       r.size,
+		})
+		if r.items < report.Items {
+			report.Items = r.items
+		}
+	}
+	tail := readers[0].tail
+	for _, r := range readers[1:] {
+		if r.tail != tail {
+			report.Valid = tail
+			report.Err = fmt.Errorf("tables start at different items: %s at %d, %s at %d", readers[0].name, tail, r.name, r.tail)
+			return report, nil
+		}
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		blobs  = make([][]byte, len(readers))
+		parent common.Hash
+	)
+	for number := tail; number < report.Items; number++ {
+		for i, r := range readers {
+			if blobs[i], err = r.read(); err != nil {
+				err = fmt.Errorf("%s #%d: %v", r.name, number, err)
+				break
+			}
+		}
+		if err == nil {
+			err = verifyAncientBlock(number, parent, blobs)
+		}
+		if err != nil {
+			report.Valid, report.Err = number, err
+			break
+		}
+		parent = common.BytesToHash(blobs[0])
+		report.Valid = number + 1
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying ancient database", "number", number, "items", report.Items, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if report.Valid > tail {
+		report.Head = parent
+	}
+	return report, nil
+}
+
+// verifyAncientBlock checks that the items of an ancient block decode, and that
+// its header matches its hash and links to the parent one.
+func verifyAncientBlock(number uint64, parent common.Hash, blobs [][]byte) error {
+	if len(blobs[0]) != common.HashLength {
+		return fmt.Errorf("%s #%d: invalid hash length %d", freezerHashTable, number, len(blobs[0]))
+	}
+	hash := common.BytesToHash(blobs[0])
+
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(blobs[1], header); err != nil {
+		return fmt.Errorf("%s #%d: %v", freezerHeaderTable, number, err)
+	}
+	switch {
+	case header.Number.Uint64() != number:
+		return fmt.Errorf("%s #%d: header of block #%d", freezerHeaderTable, number, header.Number)
+	case header.Hash() != hash:
+		return fmt.Errorf("%s #%d: header hash %x, indexed as %x", freezerHeaderTable, number, header.Hash(), hash)
+	case parent != (common.Hash{}) && header.ParentHash != parent:
+		return fmt.Errorf("%s #%d: parent hash %x, want %x", freezerHeaderTable, number, header.ParentHash, parent)
+	}
+	if err := rlp.DecodeBytes(blobs[2], new(types.Body)); err != nil {
+		return fmt.Errorf("%s #%d: %v", freezerBodiesTable, number, err)
+	}
+	if err := rlp.DecodeBytes(blobs[3], new([]*types.ReceiptForStorage)); err != nil {
+		return fmt.Errorf("%s #%d: %v", freezerReceiptTable, number, err)
+	}
+	if err := rlp.DecodeBytes(blobs[4], new(big.Int)); err != nil {
+		return fmt.Errorf("%s #%d: %v", freezerDifficultyTable, number, err)
+	}
+	return nil
+}
+
+// checkFreezerFormat ensures the freezer tables are stored in their configured
+// format, since opening a table stored otherwise creates an empty one, to which
+// the other tables are then truncated.
+func checkFreezerFormat(datadir string) error {
+	for _, name := range freezerTables {
+		r, err := newFreezerTableReader(datadir, name, !FreezerNoSnappy[name])
+		if err != nil {
+			return err
+		}
+		r.Close()
+		if r.compressed == FreezerNoSnappy[name] {
+			return fmt.Errorf("ancient table %s stored with another compression, recompress it first", name)
+		}
+	}
+	return nil
+}
+
+// RepairFreezer truncates the freezer tables stored in the given directory to
+// the given number of items, dropping the broken ones found by VerifyFreezer.
+func RepairFreezer(datadir string, items uint64) error {
+	if err := checkFreezerFormat(datadir); err != nil {
+		return err
+	}
+	f, err := newFreezer(datadir, "", false)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.TruncateAncients(items); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// RecompressFreezer rewrites the freezer tables stored in the given directory
+// with another compression than configured into the configured one, keeping at
+// most the given number of items. The freezer must not be in use.
+func RecompressFreezer(datadir string, items uint64) error {
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	for _, name := range freezerTables {
+		if err := recompressFreezerTable(datadir, name, items); err != nil {
+			return fmt.Errorf("failed to recompress ancient table %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// recompressFreezerTable rewrites a freezer table into its configured format in
+// a temporary directory, then swaps the files in place of the original ones.
+func recompressFreezerTable(datadir, name string, items uint64) error {
+	noSnappy := FreezerNoSnappy[name]
+	r, err := newFreezerTableReader(datadir, name, !noSnappy)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if r.compressed != noSnappy {
+		return nil // Stored as configured already
+	}
+	if r.tail != 0 {
+		return errors.New("tables with deleted tail items are not supported")
+	}
+	if r.items < items {
+		items = r.items
+	}
+	tmpdir := filepath.Join(datadir, "recompress")
+	if err := os.RemoveAll(tmpdir); err != nil {
+		return err
+	}
+	table, err := newTable(tmpdir, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, noSnappy)
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := uint64(0); number < items; number++ {
+		blob, err := r.read()
+		if err == nil {
+			err = table.Append(number, blob)
+		}
+		if err != nil {
+			table.Close()
+			return fmt.Errorf("item #%d: %v", number, err)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Recompressing ancient table", "table", name, "number", number, "items", items, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	size, err := table.size()
+	if err == nil {
+		err = table.Sync()
+	}
+	if cerr := table.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// Move the new files in place first, so an interruption leaves a table in
+	// the configured format, then delete the old ones
+	idxName, ext := freezerTableFiles(name, !noSnappy)
+	files, _ := filepath.Glob(filepath.Join(tmpdir, name+".*."+ext))
+	for _, file := range append(files, filepath.Join(tmpdir, idxName)) {
+		if err := os.Rename(file, filepath.Join(datadir, filepath.Base(file))); err != nil {
+			return err
+		}
+	}
+	idxName, ext = freezerTableFiles(name, noSnappy)
+	files, _ = filepath.Glob(filepath.Join(datadir, name+".*."+ext))
+	for _, file := range append(files, filepath.Join(datadir, idxName)) {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	log.Info("Recompressed ancient table", "table", name, "items", items, "compressed", !noSnappy,
+		"before", common.StorageSize(r.size), "after", common.StorageSize(size), "elapsed", common.PrettyDuration(time.Since(start)))
+	return os.RemoveAll(tmpdir)
+}
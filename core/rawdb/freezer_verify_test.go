@@ -0,0 +1,181 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// newTestFreezer fills a freezer in a temporary directory with a chain of the
+// given number of blocks.
+func newTestFreezer(t *testing.T, blocks int) string {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	defer f.Close()
+
+	var parent common.Hash
+	for i := 0; i < blocks; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), ParentHash: parent, Difficulty: big.NewInt(2), Extra: make([]byte, 64)}
+		hash := header.Hash()
+		headerBlob, _ := rlp.EncodeToBytes(header)
+		bodyBlob, _ := rlp.EncodeToBytes(&types.Body{})
+		receiptsBlob, _ := rlp.EncodeToBytes([]*types.ReceiptForStorage{})
+		tdBlob, _ := rlp.EncodeToBytes(big.NewInt(int64(2 * (i + 1))))
+		if err := f.AppendAncient(uint64(i), hash[:], headerBlob, bodyBlob, receiptsBlob, tdBlob); err != nil {
+			t.Fatalf("failed to append block %d: %v", i, err)
+		}
+		parent = hash
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("failed to sync freezer: %v", err)
+	}
+	return dir
+}
+
+// verifyTestFreezer verifies the freezer, checking the number of items intact.
+func verifyTestFreezer(t *testing.T, dir string, items, valid uint64, broken bool) *FreezerReport {
+	report, err := VerifyFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if report.Items != items || report.Valid != valid || (report.Err != nil) != broken {
+		t.Fatalf("report mismatch: have items %d, valid %d, error %v; want items %d, valid %d, broken %v", report.Items, report.Valid, report.Err, items, valid, broken)
+	}
+	return report
+}
+
+// Tests that truncated data files are found out and repaired.
+func TestVerifyFreezerTruncatedData(t *testing.T) {
+	dir := newTestFreezer(t, 100)
+	defer os.RemoveAll(dir)
+
+	report := verifyTestFreezer(t, dir, 100, 100, false)
+	if len(report.Tables) != len(freezerTables) {
+		t.Fatalf("table count mismatch: have %d, want %d", len(report.Tables), len(freezerTables))
+	}
+	// Cut the bodies data file amid item #60, which opening the freezer would
+	// silently drop along with the items after it
+	r, err := newFreezerTableReader(dir, freezerBodiesTable, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 60; i++ {
+		if _, err := r.read(); err != nil {
+			t.Fatalf("failed to read body %d: %v", i, err)
+		}
+	}
+	cut := int64(r.prev.offset) + 1
+	r.Close()
+	if err := os.Truncate(filepath.Join(dir, "bodies.0000.cdat"), cut); err != nil {
+		t.Fatal(err)
+	}
+	report = verifyTestFreezer(t, dir, 100, 60, true)
+
+	if err := RepairFreezer(dir, report.Valid); err != nil {
+		t.Fatalf("failed to repair freezer: %v", err)
+	}
+	verifyTestFreezer(t, dir, 60, 60, false)
+}
+
+// Tests that broken index entries and mismatching hashes are found out.
+func TestVerifyFreezerBrokenIndex(t *testing.T) {
+	dir := newTestFreezer(t, 50)
+	defer os.RemoveAll(dir)
+
+	// Point the index entry of header #20 back to the start of its data file
+	index, err := os.OpenFile(filepath.Join(dir, "headers.cidx"), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := indexEntry{filenum: 0, offset: 1}
+	if _, err := index.WriteAt(entry.marshallBinary(), 21*indexEntrySize); err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+	verifyTestFreezer(t, dir, 50, 20, true)
+
+	// Overwrite hash #10, breaking the chain there
+	hashes, err := os.OpenFile(filepath.Join(dir, "hashes.0000.rdat"), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hashes.WriteAt(common.HexToHash("0x01").Bytes(), 10*common.HashLength); err != nil {
+		t.Fatal(err)
+	}
+	hashes.Close()
+	report := verifyTestFreezer(t, dir, 50, 10, true)
+
+	if err := RepairFreezer(dir, report.Valid); err != nil {
+		t.Fatalf("failed to repair freezer: %v", err)
+	}
+	report = verifyTestFreezer(t, dir, 10, 10, false)
+	if report.Head == (common.Hash{}) {
+		t.Errorf("missing head hash")
+	}
+}
+
+// Tests that tables stored with another compression than configured are
+// recompressed, and refused to be repaired before.
+func TestRecompressFreezer(t *testing.T) {
+	dir := newTestFreezer(t, 100)
+	defer os.RemoveAll(dir)
+
+	// Store the headers uncompressed, as if configured so
+	FreezerNoSnappy[freezerHeaderTable] = true
+	err := RecompressFreezer(dir, math.MaxUint64)
+	FreezerNoSnappy[freezerHeaderTable] = false
+	if err != nil {
+		t.Fatalf("failed to decompress freezer: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "headers.cidx")); !os.IsNotExist(err) {
+		t.Fatalf("compressed headers left behind: %v", err)
+	}
+	report := verifyTestFreezer(t, dir, 100, 100, false)
+	if report.Tables[1].Compressed {
+		t.Fatalf("headers stored compressed")
+	}
+	if err := RepairFreezer(dir, 50); err == nil {
+		t.Fatalf("repaired freezer with uncompressed headers")
+	}
+	// Recompress the headers, keeping the leading items only
+	if err := RecompressFreezer(dir, 80); err != nil {
+		t.Fatalf("failed to recompress freezer: %v", err)
+	}
+	report = verifyTestFreezer(t, dir, 80, 80, false)
+	if !report.Tables[1].Compressed {
+		t.Fatalf("headers stored uncompressed")
+	}
+	if err := RepairFreezer(dir, 80); err != nil {
+		t.Fatalf("failed to repair freezer: %v", err)
+	}
+	verifyTestFreezer(t, dir, 80, 80, false)
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// migrationProgress is the checkpoint of a database migration, stored in the
+// destination database along with the data it accounts for.
+type migrationProgress struct {
+	Last  []byte // Last key copied from the source database
+	Count uint64 // Number of keys copied
+	Done  bool   // Whether all the keys have been copied
+}
+
+// readMigrationProgress retrieves the checkpoint of the migration into the given
+// database, nil if none was started.
+func readMigrationProgress(db ethdb.KeyValueReader) (*migrationProgress, error) {
+	blob, err := db.Get(migrationProgressKey)
+	if err != nil || len(blob) == 0 {
+		return nil, nil
+	}
+	progress := new(migrationProgress)
+	if err := rlp.DecodeBytes(blob, progress); err != nil {
+		return nil, fmt.Errorf("invalid migration progress: %v", err)
+	}
+	return progress, nil
+}
+
+// writeMigrationProgress stores the checkpoint of the migration into the given
+// database.
+func writeMigrationProgress(db ethdb.KeyValueWriter, progress *migrationProgress) error {
+	blob, err := rlp.EncodeToBytes(progress)
+	if err != nil {
+		return err
+	}
+	return db.Put(migrationProgressKey, blob)
+}
+
+// DeleteMigrationProgress removes the checkpoint of a completed migration from
+// the destination database.
+func DeleteMigrationProgress(db ethdb.KeyValueWriter) error {
+	return db.Delete(migrationProgressKey)
+}
+
+// MigrateDatabase copies every key of the source key-value store into the
+// destination one in batches, each of them checkpointing the progress in the
+// destination, so an interrupted migration resumes where it stopped. It returns
+// the number of keys copied in total.
+func MigrateDatabase(src ethdb.KeyValueStore, dst ethdb.KeyValueStore) (uint64, error) {
+	progress, err := readMigrationProgress(dst)
+	if err != nil {
+		return 0, err
+	}
+	if progress == nil {
+		// Refuse to mix the source into a database which isn't a migration
+		it := dst.NewIterator(nil, nil)
+		exists := it.Next()
+		it.Release()
+		if exists {
+			return 0, errors.New("destination database is not empty")
+		}
+		progress = new(migrationProgress)
+	}
+	if progress.Done {
+		log.Info("Database already migrated", "keys", progress.Count)
+		return progress.Count, nil
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		batch  = dst.NewBatch()
+		it     = src.NewIterator(nil, progress.Last)
+	)
+	defer it.Release()
+
+	if progress.Count > 0 {
+		log.Info("Resuming database migration", "keys", progress.Count, "last", common.Bytes2Hex(progress.Last))
+	}
+	for it.Next() {
+		key := it.Key()
+		if progress.Count > 0 && bytes.Equal(key, progress.Last) {
+			continue // The iterator starts at the last key copied
+		}
+		if err := batch.Put(key, it.Value()); err != nil {
+			return progress.Count, err
+		}
+		progress.Last = common.CopyBytes(key)
+		progress.Count++
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := writeMigrationProgress(batch, progress); err != nil {
+				return progress.Count, err
+			}
+			if err := batch.Write(); err != nil {
+				return progress.Count, err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Migrating database", "keys", progress.Count, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return progress.Count, err
+	}
+	progress.Done = true
+	if err := writeMigrationProgress(batch, progress); err != nil {
+		return progress.Count, err
+	}
+	if err := batch.Write(); err != nil {
+		return progress.Count, err
+	}
+	log.Info("Migrated database", "keys", progress.Count, "elapsed", common.PrettyDuration(time.Since(start)))
+	return progress.Count, nil
+}
+
+// VerifyMigration checks a completed migration, comparing the number of keys in
+// the source and destination key-value stores, and the hashes of the values of
+// one out of every sampleRate keys of the source against the destination ones.
+func VerifyMigration(src ethdb.KeyValueStore, dst ethdb.KeyValueStore, sampleRate uint64) error {
+	progress, err := readMigrationProgress(dst)
+	if err != nil {
+		return err
+	}
+	if progress == nil || !progress.Done {
+		return errors.New("migration not completed")
+	}
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+	var (
+		start   = time.Now()
+		logged  = time.Now()
+		srcKeys uint64
+		dstKeys uint64
+		sampled uint64
+	)
+	it := src.NewIterator(nil, nil)
+	for it.Next() {
+		srcKeys++
+		if srcKeys%sampleRate == 0 {
+			blob, err := dst.Get(it.Key())
+			if err != nil {
+				it.Release()
+				return fmt.Errorf("key %#x missing from destination: %v", it.Key(), err)
+			}
+			if have, want := crypto.Keccak256Hash(blob), crypto.Keccak256Hash(it.Value()); have != want {
+				it.Release()
+				return fmt.Errorf("value hash mismatch for key %#x: have %x, want %x", it.Key(), have, want)
+			}
+			sampled++
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying source database", "keys", srcKeys, "sampled", sampled, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	it = dst.NewIterator(nil, nil)
+	for it.Next() {
+		if !bytes.Equal(it.Key(), migrationProgressKey) {
+			dstKeys++
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying destination database", "keys", dstKeys, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if srcKeys != dstKeys {
+		return fmt.Errorf("key count mismatch: have %d, want %d", dstKeys, srcKeys)
+	}
+	log.Info("Verified database migration", "keys", srcKeys, "sampled", sampled, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// failingStore is a key-value store whose batches fail to be written after a
+// number of successful writes, to interrupt migrations.
+type failingStore struct {
+	ethdb.KeyValueStore
+	writes int
+}
+
+type failingBatch struct {
+	ethdb.Batch
+	store *failingStore
+}
+
+func (s *failingStore) NewBatch() ethdb.Batch {
+	return &failingBatch{Batch: s.KeyValueStore.NewBatch(), store: s}
+}
+
+func (b *failingBatch) Write() error {
+	if b.store.writes == 0 {
+		return errors.New("interrupted")
+	}
+	b.store.writes--
+	return b.Batch.Write()
+}
+
+// Tests that a migration interrupted midway resumes from its checkpoint and
+// copies every key once verified.
+func TestMigrateDatabase(t *testing.T) {
+	src := memorydb.New()
+	for i := uint64(0); i < 10000; i++ {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, i)
+		if err := src.Put(key, bytes.Repeat(key, 4)); err != nil {
+			t.Fatalf("failed to write source key %d: %v", i, err)
+		}
+	}
+	dst := memorydb.New()
+
+	count, err := MigrateDatabase(src, &failingStore{KeyValueStore: dst, writes: 2})
+	if err == nil {
+		t.Fatalf("interrupted migration succeeded")
+	}
+	progress, _ := readMigrationProgress(dst)
+	if progress == nil || progress.Done || progress.Count == 0 || progress.Count >= count {
+		t.Fatalf("checkpoint mismatch: have %+v, copied %d", progress, count)
+	}
+	if err := VerifyMigration(src, dst, 1); err == nil {
+		t.Fatalf("incomplete migration verified")
+	}
+	// Resume the migration, which must not copy the checkpointed keys again
+	if count, err = MigrateDatabase(src, dst); err != nil {
+		t.Fatalf("failed to resume migration: %v", err)
+	}
+	if count != 10000 {
+		t.Fatalf("migrated key count mismatch: have %d, want %d", count, 10000)
+	}
+	if err := VerifyMigration(src, dst, 100); err != nil {
+		t.Fatalf("failed to verify migration: %v", err)
+	}
+	// Corrupt a sampled value and add a stray key, both to be detected
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, 99)
+	dst.Put(key, []byte("corrupt"))
+	if err := VerifyMigration(src, dst, 100); err == nil {
+		t.Errorf("corrupt value verified")
+	}
+	dst.Put(key, bytes.Repeat(key, 4))
+	dst.Put([]byte("stray"), nil)
+	if err := VerifyMigration(src, dst, 100); err == nil {
+		t.Errorf("stray key verified")
+	}
+	dst.Delete([]byte("stray"))
+
+	if err := DeleteMigrationProgress(dst); err != nil {
+		t.Fatalf("failed to delete migration progress: %v", err)
+	}
+	if dst.Len() != src.Len() {
+		t.Errorf("destination key count mismatch: have %d, want %d", dst.Len(), src.Len())
+	}
+	// Migrating into a database which isn't empty is refused
+	if _, err := MigrateDatabase(src, dst); err == nil {
+		t.Errorf("migrated into a non-empty database")
+	}
+}
@@ -75,6 +75,13 @@ var (
 	// uncleanShutdownKey tracks the list of local crashes
 	uncleanShutdownKey = []byte("unclean-shutdown") // config prefix for the db
 
+	// validatorKeysKey tracks the dpos validator keys the node seals with.
+	validatorKeysKey = []byte("DposValidatorKeys")
+
+	// migrationProgressKey tracks the progress of a database being migrated into
+	// from another engine, removed once the migration is complete.
+	migrationProgressKey = []byte("DatabaseMigrationProgress")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
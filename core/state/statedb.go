@@ -1074,9 +1074,17 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 			taskResults := make(chan error, len(s.stateObjectsDirty))
 			tasksNum := 0
 			finishCh := make(chan struct{})
-			defer close(finishCh)
+			// Wait for the code batches to be flushed, the database may be
+			// closed as soon as the commit returns
+			var writers sync.WaitGroup
+			defer func() {
+				close(finishCh)
+				writers.Wait()
+			}()
 			for i := 0; i < runtime.NumCPU(); i++ {
+				writers.Add(1)
 				go func() {
+					defer writers.Done()
 					codeWriter := s.db.TrieDB().DiskDB().NewBatch()
 					for {
 						select {
@@ -32,6 +32,8 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -915,3 +917,61 @@ func TestStateDBAccessList(t *testing.T) {
 		t.Fatalf("expected empty, got %d", got)
 	}
 }
+
+// closingDB is a database dropping the batches written after it was closed.
+type closingDB struct {
+	ethdb.Database
+	lock   sync.Mutex
+	closed bool
+}
+
+func (db *closingDB) NewBatch() ethdb.Batch {
+	return &closingBatch{Batch: db.Database.NewBatch(), db: db}
+}
+
+func (db *closingDB) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.closed = true
+	return nil
+}
+
+type closingBatch struct {
+	ethdb.Batch
+	db *closingDB
+}
+
+func (b *closingBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	if b.db.closed {
+		return nil
+	}
+	return b.Batch.Write()
+}
+
+// Tests that contract codes are flushed by the time the state is committed, so
+// that none is lost if the database is closed right afterwards.
+func TestCommitFlushesCode(t *testing.T) {
+	db := &closingDB{Database: rawdb.NewMemoryDatabase()}
+	state, _ := New(common.Hash{}, NewDatabase(db), nil)
+
+	var codes [][]byte
+	for i := byte(0); i < 64; i++ {
+		code := []byte{i, i, i}
+		state.SetCode(common.BytesToAddress([]byte{i}), code)
+		codes = append(codes, code)
+	}
+	if _, err := state.Commit(false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	db.Close()
+
+	for i, code := range codes {
+		if stored := rawdb.ReadCode(db.Database, crypto.Keccak256Hash(code)); !bytes.Equal(stored, code) {
+			t.Errorf("code %d lost: have %x, want %x", i, stored, code)
+		}
+	}
+}
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"crypto/ecdsa"
 	"math/big"
 	"testing"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -119,7 +121,7 @@ func GenerateBadBlock(parent *types.Block, engine consensus.Engine, txs types.Tr
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Coinbase:   parent.Coinbase(),
-		Difficulty: engine.CalcDifficulty(&fakeChainReader{params.TestChainConfig, engine}, parent.Time()+10, &types.Header{
+		Difficulty: engine.CalcDifficulty(&fakeChainReader{config: params.TestChainConfig, engine: engine}, parent.Time()+10, &types.Header{
 			Number:     parent.Number(),
 			Time:       parent.Time(),
 			Difficulty: parent.Difficulty(),
@@ -150,3 +152,123 @@ func GenerateBadBlock(parent *types.Block, engine consensus.Engine, txs types.Tr
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil))
 }
+
+// posaEngine is a fake PoSA engine which only permits the configured developer
+// to deploy contracts and refuses transactions touching blacklisted accounts.
+type posaEngine struct {
+	consensus.Engine
+	developer common.Address
+	blacklist map[common.Address]bool
+}
+
+func (e *posaEngine) PreHandle(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
+	return nil
+}
+
+func (e *posaEngine) CanCreate(state consensus.StateReader, addr common.Address, height *big.Int) bool {
+	return addr == e.developer
+}
+
+func (e *posaEngine) ValidateTx(tx *types.Transaction, header *types.Header, parentState *state.StateDB) error {
+	from, err := types.Sender(types.HomesteadSigner{}, tx)
+	if err != nil {
+		return err
+	}
+	if e.blacklist[from] || (tx.To() != nil && e.blacklist[*tx.To()]) {
+		return consensus.ErrAddressDenied
+	}
+	return nil
+}
+
+func (e *posaEngine) IsSystemTransaction(tx *types.Transaction, header *types.Header) (bool, error) {
+	return false, nil
+}
+
+func (e *posaEngine) IsSystemContract(to *common.Address) bool { return false }
+
+func (e *posaEngine) EnoughDistance(chain consensus.ChainReader, header *types.Header) bool {
+	return true
+}
+
+func (e *posaEngine) IsLocalBlock(header *types.Header) bool { return false }
+
+// Tests that a PoSA engine refusing contract creations is consulted both when
+// generating and when importing blocks, and that the refused creation ends up
+// as a failed receipt.
+func TestStateProcessorCanCreate(t *testing.T) {
+	var (
+		signer      = types.HomesteadSigner{}
+		devKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		otherKey, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		developer   = crypto.PubkeyToAddress(devKey.PublicKey)
+		stranger    = crypto.PubkeyToAddress(otherKey.PublicKey)
+		engine      = &posaEngine{Engine: ethash.NewFaker(), developer: developer}
+		db          = rawdb.NewMemoryDatabase()
+		funds       = big.NewInt(1000000000000000)
+		initCode    = common.Hex2Bytes("60006000f3") // Deploys an empty contract
+		deploy      = func(key *ecdsa.PrivateKey) *types.Transaction {
+			tx, _ := types.SignTx(types.NewContractCreation(0, new(big.Int), 100000, big.NewInt(1), initCode), signer, key)
+			return tx
+		}
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{developer: {Balance: funds}, stranger: {Balance: funds}},
+		}
+		genesis = gspec.MustCommit(db)
+	)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, engine, db, 1, func(i int, b *BlockGen) {
+		b.AddTx(deploy(devKey))
+		b.AddTx(deploy(otherKey))
+	})
+	if have, want := receipts[0][0].Status, types.ReceiptStatusSuccessful; have != want {
+		t.Errorf("developer receipt status mismatch: have %d, want %d", have, want)
+	}
+	if have, want := receipts[0][1].Status, types.ReceiptStatusFailed; have != want {
+		t.Errorf("stranger receipt status mismatch: have %d, want %d", have, want)
+	}
+	// Import the generated block to ensure the processor agrees on the outcome
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	blockchain, _ := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	defer blockchain.Stop()
+
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block: %v", err)
+	}
+	statedb, _ := blockchain.State()
+	if nonce := statedb.GetNonce(stranger); nonce != 1 {
+		t.Errorf("stranger nonce mismatch: have %d, want %d", nonce, 1)
+	}
+	if addr := crypto.CreateAddress(stranger, 0); statedb.Exist(addr) {
+		t.Errorf("refused contract %x exists", addr)
+	}
+	if addr := crypto.CreateAddress(developer, 0); !statedb.Exist(addr) {
+		t.Errorf("developer contract %x missing", addr)
+	}
+}
+
+// Tests that contract creations are only guarded with a PoSA engine at hand,
+// missing chains and engines leaving them unrestricted.
+func TestGetCanCreateFn(t *testing.T) {
+	var nilChain *BlockChain
+	if GetCanCreateFn(nil) != nil {
+		t.Errorf("nil chain guarded")
+	}
+	if GetCanCreateFn(nilChain) != nil {
+		t.Errorf("nil blockchain guarded")
+	}
+	if GetCanCreateFn(&fakeChainReader{config: params.TestChainConfig}) != nil {
+		t.Errorf("missing engine guarded")
+	}
+	if GetCanCreateFn(&fakeChainReader{config: params.TestChainConfig, engine: ethash.NewFaker()}) != nil {
+		t.Errorf("non-PoSA engine guarded")
+	}
+	guard := GetCanCreateFn(&fakeChainReader{config: params.TestChainConfig, engine: &posaEngine{Engine: ethash.NewFaker()}})
+	if guard == nil {
+		t.Fatalf("PoSA engine not consulted")
+	}
+	if guard(nil, common.Address{1}, big.NewInt(1)) {
+		t.Errorf("non developer allowed to create contracts")
+	}
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/prque"
+	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/event"
@@ -104,6 +105,9 @@ var (
 	queuedNofundsMeter   = metrics.NewRegisteredMeter("txpool/queued/nofunds", nil)   // Dropped due to out-of-funds
 	queuedEvictionMeter  = metrics.NewRegisteredMeter("txpool/queued/eviction", nil)  // Dropped due to lifetime
 
+	// Metrics for transactions dropped by the consensus engine
+	deniedEvictionMeter = metrics.NewRegisteredMeter("txpool/denied/eviction", nil) // Dropped due to consensus rules (e.g. blacklist)
+
 	// General tx metrics
 	knownTxMeter       = metrics.NewRegisteredMeter("txpool/known", nil)
 	validTxMeter       = metrics.NewRegisteredMeter("txpool/valid", nil)
@@ -133,6 +137,7 @@ type blockChain interface {
 	CurrentBlock() *types.Block
 	GetBlock(hash common.Hash, number uint64) *types.Block
 	StateAt(root common.Hash) (*state.StateDB, error)
+	Engine() consensus.Engine
 
 	SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription
 }
@@ -235,6 +240,10 @@ type TxPool struct {
 	pendingNonces *txNoncer      // Pending state tracking virtual nonces
 	currentMaxGas uint64         // Current gas limit for transaction caps
 
+	posa       consensus.PoSA // Consensus engine validating transactions, nil if not PoSA
+	posaHeader *types.Header  // Pending block header the consensus validation is done against
+	posaState  *state.StateDB // Private copy of the head state for the consensus validation
+
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
 
@@ -282,6 +291,9 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		reorgShutdownCh: make(chan struct{}),
 		gasPrice:        new(big.Int).SetUint64(config.PriceLimit),
 	}
+	if posa, ok := chain.Engine().(consensus.PoSA); ok {
+		pool.posa = posa
+	}
 	pool.locals = newAccountSet(pool.signer)
 	for _, addr := range config.Locals {
 		log.Info("Setting new local account", "address", addr)
@@ -566,7 +578,17 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if tx.Gas() < intrGas {
 		return ErrIntrinsicGas
 	}
-	return nil
+	// Ensure the consensus engine accepts the transaction (e.g. blacklist)
+	return pool.validateTxByEngine(tx)
+}
+
+// validateTxByEngine runs the consensus-related validation of the engine, if
+// any, on the given transaction against the pending block of the current head.
+func (pool *TxPool) validateTxByEngine(tx *types.Transaction) error {
+	if pool.posa == nil || pool.posaHeader == nil {
+		return nil
+	}
+	return pool.posa.ValidateTx(tx, pool.posaHeader, pool.posaState)
 }
 
 // add validates a transaction and inserts it into the non-executable queue for later
@@ -1088,6 +1110,7 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	// because of another transaction (e.g. higher gas price).
 	if reset != nil {
 		pool.demoteUnexecutables()
+		pool.removeDenied()
 	}
 	// Ensure pool.queue and pool.pending sizes stay within the configured limits.
 	pool.truncatePending()
@@ -1196,6 +1219,20 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.pendingNonces = newTxNoncer(statedb)
 	pool.currentMaxGas = newHead.GasLimit
 
+	// Consensus validation executes calls against the state, give it its own
+	// copy so the pool's view of the head is never touched.
+	if pool.posa != nil {
+		pool.posaState = statedb.Copy()
+		pool.posaHeader = &types.Header{
+			ParentHash: newHead.Hash(),
+			Coinbase:   newHead.Coinbase,
+			Difficulty: new(big.Int),
+			Number:     new(big.Int).Add(newHead.Number, big.NewInt(1)),
+			GasLimit:   newHead.GasLimit,
+			Time:       newHead.Time,
+		}
+	}
+
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
 	senderCacher.recover(pool.signer, reinject)
@@ -1462,6 +1499,27 @@ func (pool *TxPool) demoteUnexecutables() {
 	}
 }
 
+// removeDenied drops all transactions which the consensus engine refuses at the
+// current head, e.g. because the sender or recipient got blacklisted.
+func (pool *TxPool) removeDenied() {
+	if pool.posa == nil {
+		return
+	}
+	var denied []common.Hash
+	pool.all.Range(func(hash common.Hash, tx *types.Transaction, local bool) bool {
+		if err := pool.validateTxByEngine(tx); err != nil {
+			log.Trace("Removing denied transaction", "hash", hash, "err", err)
+			denied = append(denied, hash)
+		}
+		return true
+	}, true, true)
+
+	for _, hash := range denied {
+		pool.removeTx(hash, true)
+	}
+	deniedEvictionMeter.Mark(int64(len(denied)))
+}
+
 // addressByHeartbeat is an account address tagged with its last activity timestamp.
 type addressByHeartbeat struct {
 	address   common.Address
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -66,6 +67,10 @@ func (bc *testBlockChain) StateAt(common.Hash) (*state.StateDB, error) {
 	return bc.statedb, nil
 }
 
+func (bc *testBlockChain) Engine() consensus.Engine {
+	return nil
+}
+
 func (bc *testBlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription {
 	return bc.chainHeadFeed.Subscribe(ch)
 }
@@ -2052,3 +2057,63 @@ func BenchmarkInsertRemoteWithAllLocals(b *testing.B) {
 		pool.Stop()
 	}
 }
+
+// posaBlockChain is a testBlockChain backed by a PoSA consensus engine.
+type posaBlockChain struct {
+	*testBlockChain
+	engine consensus.Engine
+}
+
+func (bc *posaBlockChain) Engine() consensus.Engine {
+	return bc.engine
+}
+
+// Tests that transactions refused by the PoSA engine are rejected on admission,
+// and that pooled ones are evicted once the engine starts refusing them.
+func TestTransactionDenied(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	engine := &posaEngine{blacklist: make(map[common.Address]bool)}
+	blockchain := &posaBlockChain{&testBlockChain{statedb, 1000000, new(event.Feed)}, engine}
+
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+
+	// Blacklisted senders and recipients are refused
+	engine.blacklist[from] = true
+	if err := pool.AddRemote(transaction(0, 100000, key)); !errors.Is(err, consensus.ErrAddressDenied) {
+		t.Errorf("denied sender: error mismatch: have %v, want %v", err, consensus.ErrAddressDenied)
+	}
+	delete(engine.blacklist, from)
+
+	engine.blacklist[common.Address{}] = true
+	if err := pool.AddRemote(transaction(0, 100000, key)); !errors.Is(err, consensus.ErrAddressDenied) {
+		t.Errorf("denied recipient: error mismatch: have %v, want %v", err, consensus.ErrAddressDenied)
+	}
+	delete(engine.blacklist, common.Address{})
+
+	// Pooled transactions are evicted when the sender is blacklisted later on
+	if err := pool.addRemoteSync(transaction(0, 100000, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(transaction(2, 100000, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Fatalf("pool stats mismatch: have %d pending %d queued, want 1 pending 1 queued", pending, queued)
+	}
+	engine.blacklist[from] = true
+	<-pool.requestReset(nil, nil)
+
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Errorf("pool stats mismatch: have %d pending %d queued, want none", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
@@ -34,6 +34,7 @@ var (
 	ErrWriteProtection          = errors.New("write protection")
 	ErrReturnDataOutOfBounds    = errors.New("return data out of bounds")
 	ErrGasUintOverflow          = errors.New("gas uint64 overflow")
+	ErrUnauthorizedDeveloper    = errors.New("unauthorized developer")
 )
 
 // ErrStackUnderflow wraps an evm error when the items on the stack less
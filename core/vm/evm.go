@@ -44,6 +44,8 @@ type (
 	CanTransferFunc func(StateDB, common.Address, *big.Int) bool
 	// TransferFunc is the signature of a transfer function
 	TransferFunc func(StateDB, common.Address, common.Address, *big.Int)
+	// CanCreateFunc is the signature of a contract creation guard function
+	CanCreateFunc func(StateDB, common.Address, *big.Int) bool
 	// GetHashFunc returns the n'th block hash in the blockchain
 	// and is used by the BLOCKHASH EVM op code.
 	GetHashFunc func(uint64) common.Hash
@@ -91,6 +93,9 @@ type BlockContext struct {
 	CanTransfer CanTransferFunc
 	// Transfer transfers ether from one account to the other
 	Transfer TransferFunc
+	// CanCreate returns whether the transaction origin is allowed to
+	// create a new contract, nil means there is no restriction
+	CanCreate CanCreateFunc
 	// GetHash returns the hash corresponding to n
 	GetHash GetHashFunc
 
@@ -438,6 +443,11 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	}
 	nonce := evm.StateDB.GetNonce(caller.Address())
 	evm.StateDB.SetNonce(caller.Address(), nonce+1)
+	// Ensure the origin of the transaction is allowed to deploy contracts, the
+	// nonce is bumped regardless so a rejected creation can't be replayed
+	if evm.chainRules.IsDevVerify && evm.Context.CanCreate != nil && !evm.Context.CanCreate(evm.StateDB, evm.Origin, evm.Context.BlockNumber) {
+		return nil, common.Address{}, gas, ErrUnauthorizedDeveloper
+	}
 	// We add this to the access list _before_ taking a snapshot. Even if the creation fails,
 	// the access-list change should not be rolled back
 	if evm.chainRules.IsBerlin {
@@ -0,0 +1,96 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// Tests that contract creations are refused when the block context denies the
+// transaction origin once the devVerify fork is active, both for CREATE and
+// CREATE2.
+func TestCreateCanCreate(t *testing.T) {
+	var (
+		developer = common.BytesToAddress([]byte("developer"))
+		stranger  = common.BytesToAddress([]byte("stranger"))
+		// PUSH1 0x00 PUSH1 0x00 RETURN, deploys an empty contract
+		initCode = common.Hex2Bytes("60006000f3")
+	)
+	tests := []struct {
+		origin  common.Address
+		guarded bool
+		fork    *big.Int
+		failure error
+	}{
+		{developer, true, big.NewInt(0), nil},
+		{stranger, true, big.NewInt(0), ErrUnauthorizedDeveloper},
+		{stranger, false, big.NewInt(0), nil},
+		{stranger, true, big.NewInt(2), nil},
+		{stranger, true, nil, nil},
+	}
+	for i, tt := range tests {
+		for _, create2 := range []bool{false, true} {
+			statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+			vmctx := BlockContext{
+				CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+				Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+				BlockNumber: big.NewInt(1),
+			}
+			if tt.guarded {
+				vmctx.CanCreate = func(db StateDB, addr common.Address, height *big.Int) bool {
+					return addr == developer
+				}
+			}
+			config := *params.AllEthashProtocolChanges
+			config.DevVerifyBlock = tt.fork
+			vmenv := NewEVM(vmctx, TxContext{Origin: tt.origin}, statedb, &config, Config{})
+
+			var (
+				addr common.Address
+				gas  uint64
+				err  error
+			)
+			if create2 {
+				_, addr, gas, err = vmenv.Create2(AccountRef(tt.origin), initCode, 100000, new(big.Int), uint256.NewInt())
+			} else {
+				_, addr, gas, err = vmenv.Create(AccountRef(tt.origin), initCode, 100000, new(big.Int))
+			}
+			if err != tt.failure {
+				t.Errorf("test %d (create2 %v): failure mismatch: have %v, want %v", i, create2, err, tt.failure)
+			}
+			if tt.failure != nil {
+				if addr != (common.Address{}) {
+					t.Errorf("test %d (create2 %v): contract address mismatch: have %x, want empty", i, create2, addr)
+				}
+				if gas != 100000 {
+					t.Errorf("test %d (create2 %v): gas mismatch: have %d, want %d", i, create2, gas, 100000)
+				}
+			}
+			if nonce := statedb.GetNonce(tt.origin); nonce != 1 {
+				t.Errorf("test %d (create2 %v): nonce mismatch: have %d, want %d", i, create2, nonce, 1)
+			}
+		}
+	}
+}
@@ -139,6 +139,24 @@ func (api *PrivateMinerAPI) SetEtherbase(etherbase common.Address) bool {
 	return true
 }
 
+// AddValidatorKey starts sealing blocks with the given dpos validator key,
+// available in the keystore or an external signer, without restarting the
+// miner.
+func (api *PrivateMinerAPI) AddValidatorKey(val common.Address) error {
+	return api.e.AddValidatorKey(val)
+}
+
+// RemoveValidatorKey stops sealing blocks with the given dpos validator key.
+func (api *PrivateMinerAPI) RemoveValidatorKey(val common.Address) error {
+	return api.e.RemoveValidatorKey(val)
+}
+
+// ListValidatorKeys returns the dpos validator keys the node seals with, along
+// with the blocks they sealed and the turns they missed.
+func (api *PrivateMinerAPI) ListValidatorKeys() ([]*ValidatorKeyStats, error) {
+	return api.e.ValidatorKeys()
+}
+
 // SetRecommitInterval updates the interval for miner sealing work recommitting.
 func (api *PrivateMinerAPI) SetRecommitInterval(interval int) {
 	api.e.Miner().SetRecommitInterval(time.Duration(interval) * time.Millisecond)
@@ -71,6 +71,13 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
 	}
+	if number == rpc.FinalizedBlockNumber || number == rpc.SafeBlockNumber {
+		block, err := b.BlockByNumber(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		return block.Header(), nil
+	}
 	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
 }
 
@@ -105,6 +112,21 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
 	}
+	// Finalized and safe blocks are derived from the validator seals
+	if number == rpc.FinalizedBlockNumber {
+		block := b.eth.blockchain.CurrentFinalizedBlock()
+		if block == nil {
+			return nil, errors.New("finalized block not found")
+		}
+		return block, nil
+	}
+	if number == rpc.SafeBlockNumber {
+		block := b.eth.blockchain.CurrentSafeBlock()
+		if block == nil {
+			return nil, errors.New("safe block not found")
+		}
+		return block, nil
+	}
 	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
 }
 
@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/dpos/por"
 	"github.com/ethereum/go-ethereum/consensus/parlia"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
@@ -73,9 +74,13 @@ type Ethereum struct {
 	handler            *handler
 	ethDialCandidates  enode.Iterator
 	snapDialCandidates enode.Iterator
+	porHandler         *por.Handler         // Proof-of-Resources protocol handler, nil if disabled
+	porChallenger      *por.Challenger      // Proof-of-Resources challenger, nil if disabled
+	keyTracker         *validatorKeyTracker // Sealing activity of the validator keys, nil if not dpos
 
 	// DB interfaces
-	chainDb ethdb.Database // Block chain database
+	chainDb    ethdb.Database // Block chain database
+	slashingDb ethdb.Database // Dpos slashing protection database, nil if not dpos
 
 	eventMux       *event.TypeMux
 	engine         consensus.Engine
@@ -155,7 +160,7 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		bloomRequests:     make(chan chan *bloombits.Retrieval),
 		bloomIndexer:      core.NewBloomIndexer(chainDb, params.BloomBitsBlocks, params.BloomConfirms),
 		p2pServer:         stack.Server(),
-		posEtherbase:      append(make([]common.Address, len(config.Miner.PosEtherbase)), config.Miner.PosEtherbase...),
+		posEtherbase:      append(make([]common.Address, 0, len(config.Miner.PosEtherbase)), config.Miner.PosEtherbase...),
 	}
 
 	eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), stack.Config().AllowUnprotectedTxs, eth, nil}
@@ -228,6 +233,47 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		dposEngine.SetStateFn(eth.blockchain.StateAt)
 		// set consensus-related transaction validator
 
+		// set up the slashing protection, kept apart from the chain data so
+		// that it survives resyncs
+		eth.slashingDb, err = stack.OpenDatabase("slashing", 0, 0, "eth/db/slashing/", false)
+		if err != nil {
+			return nil, err
+		}
+		dposEngine.SetSlashingProtection(dpos.NewSlashingProtection(eth.slashingDb, genesisHash))
+
+		// restore the validator keys added at runtime, next to the configured ones
+		for _, key := range rawdb.ReadValidatorKeys(chainDb) {
+			known := false
+			for _, v := range eth.posEtherbase {
+				if v == key {
+					known = true
+					break
+				}
+			}
+			if !known {
+				eth.posEtherbase = append(eth.posEtherbase, key)
+			}
+		}
+		eth.keyTracker = newValidatorKeyTracker()
+
+		// set up the Proof-of-Resources challenge protocol
+		if config.PoR != nil {
+			var responder *por.Responder
+			if provider := config.PoR.Provider; provider != (common.Address{}) {
+				wallet, err := eth.accountManager.Find(accounts.Account{Address: provider})
+				if wallet == nil || err != nil {
+					log.Error("PoR provider account unavailable locally", "err", err)
+					return nil, fmt.Errorf("provider missing: %v", err)
+				}
+				isValidator := func(val common.Address) bool {
+					return dposEngine.IsPorValidator(eth.blockchain, val)
+				}
+				responder = por.NewResponder(provider, wallet.SignData, isValidator, config.PoR)
+			}
+			eth.porHandler = por.NewHandler(enode.PubkeyToIDV4(&stack.Config().NodeKey().PublicKey), responder)
+			eth.porChallenger = por.NewChallenger(eth.porHandler, config.PoR)
+			dposEngine.SetChallenger(eth.porChallenger)
+		}
 	}
 
 	// Permit the downloader to use the trie cache allowance during fast sync
@@ -253,7 +299,15 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}
 
 	eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock)
+	if dposEngine, ok := eth.engine.(*dpos.Dpos); ok {
+		dposEngine.SetPendingFn(eth.miner.Pending)
+	}
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
+	if _, ok := eth.engine.(*dpos.Dpos); ok {
+		for _, key := range eth.posEtherbase {
+			eth.miner.AddPosEtherbase(key)
+		}
+	}
 
 	gpoParams := config.GPO
 	if gpoParams.Default == nil {
@@ -544,13 +598,18 @@ func (s *Ethereum) StartMining(threads int) error {
 		}
 		if dpos, ok := s.engine.(*dpos.Dpos); ok {
 			for _, v := range s.posEtherbase {
+				// Validator keys may live in the local keystore or in an external
+				// signer (clef), both are backends of the account manager
 				wallet, err := s.accountManager.Find(accounts.Account{Address: v})
 				if wallet == nil || err != nil {
-					log.Error("Etherbase account unavailable locally", "err", err)
-					return fmt.Errorf("signer missing: %v", err)
+					log.Error("Validator account unavailable in keystore and external signer", "validator", v, "err", err)
+					return fmt.Errorf("signer missing for validator %v: %v", v, err)
 				}
 
 				dpos.Authorize(v, wallet.SignData, wallet.SignTx)
+				if s.porChallenger != nil {
+					s.porChallenger.Authorize(v, wallet.SignData)
+				}
 			}
 
 		}
@@ -600,6 +659,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 	if s.config.SnapshotCache > 0 {
 		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates)...)
 	}
+	if s.porHandler != nil {
+		protos = append(protos, s.porHandler.MakeProtocols()...)
+	}
 	return protos
 }
 
@@ -621,6 +683,15 @@ func (s *Ethereum) Start() error {
 	}
 	// Start the networking layer and the light server if requested
 	s.handler.Start(maxPeers)
+
+	// Start scheduling the Proof-of-Resources challenges
+	if s.porChallenger != nil {
+		s.porChallenger.Start(s.blockchain, s.engine.(*dpos.Dpos))
+	}
+	// Start tracking the sealing activity of the validator keys
+	if s.keyTracker != nil {
+		s.keyTracker.start(s, s.engine.(*dpos.Dpos))
+	}
 	return nil
 }
 
@@ -631,6 +702,12 @@ func (s *Ethereum) Stop() error {
 	s.ethDialCandidates.Close()
 	s.snapDialCandidates.Close()
 	s.handler.Stop()
+	if s.porChallenger != nil {
+		s.porChallenger.Stop()
+	}
+	if s.keyTracker != nil {
+		s.keyTracker.stop()
+	}
 
 	// Then stop everything else.
 	s.bloomIndexer.Close()
@@ -644,6 +721,9 @@ func (s *Ethereum) Stop() error {
 	s.engine.Close()
 	rawdb.PopUncleanShutdownMarker(s.chainDb)
 	s.chainDb.Close()
+	if s.slashingDb != nil {
+		s.slashingDb.Close()
+	}
 	s.eventMux.Stop()
 
 	return nil
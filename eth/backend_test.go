@@ -0,0 +1,54 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the service starts with exactly the configured pos etherbases.
+func TestConfiguredPosEtherbase(t *testing.T) {
+	stack, err := node.New(&node.Config{})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	defer stack.Close()
+
+	bases := []common.Address{{0x01}, {0x02}}
+	config := &ethconfig.Config{
+		Genesis: &core.Genesis{Config: params.AllEthashProtocolChanges, GasLimit: 8000000, Difficulty: big.NewInt(1)},
+		Ethash:  ethash.Config{PowMode: ethash.ModeFake},
+	}
+	config.Miner.PosEtherbase = bases
+
+	eth, err := New(stack, config)
+	if err != nil {
+		t.Fatalf("failed to create eth service: %v", err)
+	}
+	if !reflect.DeepEqual(eth.posEtherbase, bases) {
+		t.Errorf("pos etherbase mismatch: have %x, want %x", eth.posEtherbase, bases)
+	}
+}
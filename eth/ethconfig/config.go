@@ -19,6 +19,7 @@ package ethconfig
 
 import (
 	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/consensus/dpos/por"
 	"math/big"
 	"os"
 	"os/user"
@@ -176,6 +177,9 @@ type Config struct {
 	// Ethash options
 	Ethash ethash.Config `toml:",omitempty"`
 
+	// Proof-of-Resources options, nil if the challenge protocol is disabled
+	PoR *por.Config `toml:",omitempty"`
+
 	// Transaction pool options
 	TxPool core.TxPoolConfig
 
@@ -217,6 +221,13 @@ func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, co
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
 	}
+	// Chains migrating from parlia to dpos are sealed by dpos, which hands the
+	// blocks before the switch over to parlia
+	if chainConfig.Parlia != nil && chainConfig.Dpos != nil {
+		engine := dpos.New(chainConfig, db, ee, genesisHash)
+		engine.SetPredecessor(parlia.New(chainConfig, db, ee, genesisHash))
+		return engine
+	}
 	if chainConfig.Parlia != nil {
 		return parlia.New(chainConfig, db, ee, genesisHash)
 	}
@@ -148,6 +148,21 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	if f.end == -1 {
 		end = head
 	}
+	// Finalized and safe limits are resolved by the backend
+	if f.begin == rpc.FinalizedBlockNumber.Int64() || f.begin == rpc.SafeBlockNumber.Int64() {
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
+		if err != nil {
+			return nil, err
+		}
+		f.begin = header.Number.Int64()
+	}
+	if f.end == rpc.FinalizedBlockNumber.Int64() || f.end == rpc.SafeBlockNumber.Int64() {
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.end))
+		if err != nil {
+			return nil, err
+		}
+		end = header.Number.Uint64()
+	}
 	if f.rangeLimit && (int64(end)-f.begin) > maxFilterBlockRange {
 		return nil, fmt.Errorf("exceed maximum block range: %d", maxFilterBlockRange)
 	}
@@ -199,6 +199,13 @@ func (es *EventSystem) SubscribeLogs(crit ethereum.FilterQuery, logs chan []*typ
 	} else {
 		to = rpc.BlockNumber(crit.ToBlock.Int64())
 	}
+	// Finalized and safe blocks trail the head, live logs are delivered as mined
+	if from == rpc.FinalizedBlockNumber || from == rpc.SafeBlockNumber {
+		from = rpc.LatestBlockNumber
+	}
+	if to == rpc.FinalizedBlockNumber || to == rpc.SafeBlockNumber {
+		to = rpc.LatestBlockNumber
+	}
 
 	// only interested in pending logs
 	if from == rpc.PendingBlockNumber && to == rpc.PendingBlockNumber {
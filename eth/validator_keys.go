@@ -0,0 +1,245 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	errNotDpos               = errors.New("validator keys are only supported by the dpos engine")
+	errValidatorKeyKnown     = errors.New("validator key already added")
+	errValidatorKeyUnknown   = errors.New("unknown validator key")
+	errLastValidatorKeyInUse = errors.New("cannot remove the last validator key while mining")
+)
+
+// ValidatorKeyStats is the sealing activity of a validator key since the node
+// started, or since the key was added if later.
+type ValidatorKeyStats struct {
+	Address         common.Address `json:"address"`
+	BlocksSealed    hexutil.Uint64 `json:"blocksSealed"`    // Blocks imported that were sealed by the key
+	LastSealedBlock hexutil.Uint64 `json:"lastSealedBlock"` // Number of the last block sealed by the key
+	LastInTurnBlock hexutil.Uint64 `json:"lastInTurnBlock"` // Number of the last block the key was in turn for
+	MissedTurns     hexutil.Uint64 `json:"missedTurns"`     // In-turn blocks sealed by another validator instead
+}
+
+// validatorKeyTracker accumulates the sealing activity of the local validator
+// keys from the blocks imported into the chain.
+type validatorKeyTracker struct {
+	stats map[common.Address]*ValidatorKeyStats
+	lock  sync.Mutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newValidatorKeyTracker() *validatorKeyTracker {
+	return &validatorKeyTracker{
+		stats: make(map[common.Address]*ValidatorKeyStats),
+		quit:  make(chan struct{}),
+	}
+}
+
+// start tracks the blocks imported into the chain until stopped, crediting them
+// to the validator keys currently in use by the node.
+func (t *validatorKeyTracker) start(s *Ethereum, engine *dpos.Dpos) {
+	events := make(chan core.ChainEvent, 16)
+	sub := s.blockchain.SubscribeChainEvent(events)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				header := ev.Block.Header()
+				inturn, err := engine.InTurnValidator(s.blockchain, header)
+				if err != nil {
+					log.Debug("Failed to retrieve in-turn validator", "number", header.Number, "err", err)
+					continue
+				}
+				keys, _ := s.PosEtherbase()
+				t.track(keys, header.Number.Uint64(), header.Coinbase, inturn)
+
+			case <-sub.Err():
+				return
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+}
+
+// stop terminates the block tracking.
+func (t *validatorKeyTracker) stop() {
+	close(t.quit)
+	t.wg.Wait()
+}
+
+// track credits a block sealed by sealer while inturn was expected to the given
+// validator keys.
+func (t *validatorKeyTracker) track(keys []common.Address, number uint64, sealer, inturn common.Address) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, key := range keys {
+		if key != sealer && key != inturn {
+			continue
+		}
+		stats := t.statsOf(key)
+		if key == sealer {
+			stats.BlocksSealed++
+			stats.LastSealedBlock = hexutil.Uint64(number)
+		}
+		if key == inturn {
+			stats.LastInTurnBlock = hexutil.Uint64(number)
+			if key != sealer {
+				stats.MissedTurns++
+			}
+		}
+	}
+}
+
+// statsOf returns the live stats of a key, creating them if missing. The lock
+// must be held.
+func (t *validatorKeyTracker) statsOf(key common.Address) *ValidatorKeyStats {
+	stats, ok := t.stats[key]
+	if !ok {
+		stats = &ValidatorKeyStats{Address: key}
+		t.stats[key] = stats
+	}
+	return stats
+}
+
+// report returns a copy of the stats of the given keys.
+func (t *validatorKeyTracker) report(keys []common.Address) []*ValidatorKeyStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	report := make([]*ValidatorKeyStats, 0, len(keys))
+	for _, key := range keys {
+		stats := *t.statsOf(key)
+		report = append(report, &stats)
+	}
+	return report
+}
+
+// forget drops the stats of a removed key.
+func (t *validatorKeyTracker) forget(key common.Address) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.stats, key)
+}
+
+// AddValidatorKey starts sealing blocks with the given validator key, which
+// must be available in the keystore or an external signer. The key is kept
+// across restarts.
+func (s *Ethereum) AddValidatorKey(val common.Address) error {
+	engine, ok := s.engine.(*dpos.Dpos)
+	if !ok {
+		return errNotDpos
+	}
+	wallet, err := s.accountManager.Find(accounts.Account{Address: val})
+	if wallet == nil || err != nil {
+		return fmt.Errorf("signer missing for validator %v: %v", val, err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, key := range s.posEtherbase {
+		if key == val {
+			return errValidatorKeyKnown
+		}
+	}
+	// Authorize the key everywhere before the miner may pick it
+	engine.Authorize(val, wallet.SignData, wallet.SignTx)
+	if s.porChallenger != nil {
+		s.porChallenger.Authorize(val, wallet.SignData)
+	}
+	s.posEtherbase = append(s.posEtherbase, val)
+	s.miner.AddPosEtherbase(val)
+	rawdb.WriteValidatorKeys(s.chainDb, s.posEtherbase)
+
+	log.Info("Added validator key", "validator", val)
+	return nil
+}
+
+// RemoveValidatorKey stops sealing blocks with the given validator key. The
+// last key can only be removed while the node is not mining.
+func (s *Ethereum) RemoveValidatorKey(val common.Address) error {
+	engine, ok := s.engine.(*dpos.Dpos)
+	if !ok {
+		return errNotDpos
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	index := -1
+	for i, key := range s.posEtherbase {
+		if key == val {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return errValidatorKeyUnknown
+	}
+	if len(s.posEtherbase) == 1 && s.IsMining() {
+		return errLastValidatorKeyInUse
+	}
+	// Withdraw the key from the miner before dropping its signer
+	s.miner.RemovePosEtherbase(val)
+	engine.Deauthorize(val)
+	if s.porChallenger != nil {
+		s.porChallenger.Deauthorize(val)
+	}
+	s.posEtherbase = append(s.posEtherbase[:index:index], s.posEtherbase[index+1:]...)
+	if s.etherbase == val {
+		s.etherbase = common.Address{}
+		if len(s.posEtherbase) > 0 {
+			s.etherbase = s.posEtherbase[0]
+		}
+	}
+	rawdb.WriteValidatorKeys(s.chainDb, s.posEtherbase)
+	s.keyTracker.forget(val)
+
+	log.Info("Removed validator key", "validator", val)
+	return nil
+}
+
+// ValidatorKeys returns the validator keys the node seals with, along with
+// their sealing activity.
+func (s *Ethereum) ValidatorKeys() ([]*ValidatorKeyStats, error) {
+	if _, ok := s.engine.(*dpos.Dpos); !ok {
+		return nil, errNotDpos
+	}
+	keys, _ := s.PosEtherbase()
+	return s.keyTracker.report(keys), nil
+}
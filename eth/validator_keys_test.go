@@ -0,0 +1,53 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests that sealed blocks and missed turns are credited to the local validator
+// keys only.
+func TestValidatorKeyTracker(t *testing.T) {
+	var (
+		keyA   = common.HexToAddress("0x000000000000000000000000000000000000000a")
+		keyB   = common.HexToAddress("0x000000000000000000000000000000000000000b")
+		remote = common.HexToAddress("0x00000000000000000000000000000000000000ff")
+		keys   = []common.Address{keyA, keyB}
+	)
+	tracker := newValidatorKeyTracker()
+	tracker.track(keys, 1, keyA, keyA)   // in turn
+	tracker.track(keys, 2, keyA, keyB)   // out of turn, B missed
+	tracker.track(keys, 3, remote, keyA) // A missed
+	tracker.track(keys, 4, keyB, remote) // out of turn
+	tracker.track(keys, 5, remote, remote)
+
+	want := []*ValidatorKeyStats{
+		{Address: keyA, BlocksSealed: 2, LastSealedBlock: 2, LastInTurnBlock: 3, MissedTurns: 1},
+		{Address: keyB, BlocksSealed: 1, LastSealedBlock: 4, LastInTurnBlock: 2, MissedTurns: 1},
+	}
+	if have := tracker.report(keys); !reflect.DeepEqual(have, want) {
+		t.Errorf("stats mismatch:\nhave %+v %+v\nwant %+v %+v", have[0], have[1], want[0], want[1])
+	}
+	tracker.forget(keyB)
+	if have := tracker.report([]common.Address{keyB}); !reflect.DeepEqual(have, []*ValidatorKeyStats{{Address: keyB}}) {
+		t.Errorf("stats of removed key kept: %+v", have[0])
+	}
+}
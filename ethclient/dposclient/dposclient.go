@@ -0,0 +1,328 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dposclient provides a client for the dpos and parlia specific RPC APIs.
+package dposclient
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	extraVanity = 32                     // Fixed number of extra-data prefix bytes reserved for signer vanity
+	extraSeal   = crypto.SignatureLength // Fixed number of extra-data suffix bytes reserved for signer seal
+)
+
+// Client is a wrapper around rpc.Client that implements the dpos and parlia
+// specific APIs, along with the eth namespace extensions of the chain.
+type Client struct {
+	c         *rpc.Client
+	namespace string
+}
+
+// Dial connects a client to the given URL, serving the dpos namespace.
+func Dial(rawurl string) (*Client, error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+// DialContext connects a client to the given URL, serving the dpos namespace.
+func DialContext(ctx context.Context, rawurl string) (*Client, error) {
+	c, err := rpc.DialContext(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return New(c), nil
+}
+
+// New creates a client for the dpos namespace that uses the given RPC client.
+func New(c *rpc.Client) *Client {
+	return &Client{c: c, namespace: "dpos"}
+}
+
+// NewParlia creates a client for the parlia namespace that uses the given RPC
+// client. Only the methods shared by both engines are served by parlia nodes.
+func NewParlia(c *rpc.Client) *Client {
+	return &Client{c: c, namespace: "parlia"}
+}
+
+// Close closes the underlying RPC connection.
+func (dc *Client) Close() {
+	dc.c.Close()
+}
+
+// Snapshot is the state of the validator set at a given block, mirroring the
+// snapshot of the consensus engine.
+type Snapshot struct {
+	Number           uint64                      `json:"number"`             // Block number where the snapshot was created
+	Hash             common.Hash                 `json:"hash"`               // Block hash where the snapshot was created
+	Validators       map[common.Address]struct{} `json:"validators"`         // Set of authorized validators at this moment
+	Recents          map[uint64]common.Address   `json:"recents"`            // Set of recent validators for spam protections
+	RecentForkHashes map[uint64]string           `json:"recent_fork_hashes"` // Set of recent forkHash
+}
+
+// ValidatorList returns the authorized validators of the snapshot, sorted by
+// address.
+func (s *Snapshot) ValidatorList() []common.Address {
+	validators := make([]common.Address, 0, len(s.Validators))
+	for v := range s.Validators {
+		validators = append(validators, v)
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i][:], validators[j][:]) < 0
+	})
+	return validators
+}
+
+// Status is the signing activity of the validators over the recent blocks.
+type Status struct {
+	InturnPercent float64                `json:"inturnPercent"`
+	SigningStatus map[common.Address]int `json:"sealerActivity"`
+	NumBlocks     uint64                 `json:"numBlocks"`
+}
+
+// ValidatorInfo is the staking and punishment state of a validator.
+type ValidatorInfo struct {
+	Address      common.Address `json:"address"`
+	Stake        *hexutil.Big   `json:"stake"`
+	Commission   *hexutil.Big   `json:"commission"`
+	AccRewards   *hexutil.Big   `json:"accumulatedRewards"`
+	MissedBlocks *hexutil.Big   `json:"missedBlocks"`
+	Top          bool           `json:"top"`
+	Active       bool           `json:"active"`
+}
+
+// ValidatorSets are the top validators by stake against the active validator
+// set.
+type ValidatorSets struct {
+	Top     []common.Address `json:"top"`
+	Active  []common.Address `json:"active"`
+	Joining []common.Address `json:"joining"`
+	Leaving []common.Address `json:"leaving"`
+}
+
+// DeveloperStatus is the state of an address in the developer whitelist.
+type DeveloperStatus struct {
+	Enabled   bool `json:"verificationEnabled"`
+	Developer bool `json:"developer"`
+}
+
+// Snapshot retrieves the validator set snapshot at the given block. If number is
+// nil, the latest known block is used.
+func (dc *Client) Snapshot(ctx context.Context, number *big.Int) (*Snapshot, error) {
+	var snap *Snapshot
+	err := dc.c.CallContext(ctx, &snap, dc.namespace+"_getSnapshot", toBlockNumArg(number))
+	return snap, err
+}
+
+// SnapshotAtHash retrieves the validator set snapshot at the given block.
+func (dc *Client) SnapshotAtHash(ctx context.Context, hash common.Hash) (*Snapshot, error) {
+	var snap *Snapshot
+	err := dc.c.CallContext(ctx, &snap, dc.namespace+"_getSnapshotAtHash", hash)
+	return snap, err
+}
+
+// Validators retrieves the authorized validators at the given block. If number
+// is nil, the latest known block is used.
+func (dc *Client) Validators(ctx context.Context, number *big.Int) ([]common.Address, error) {
+	var validators []common.Address
+	err := dc.c.CallContext(ctx, &validators, dc.namespace+"_getValidators", toBlockNumArg(number))
+	return validators, err
+}
+
+// ValidatorsAtHash retrieves the authorized validators at the given block.
+func (dc *Client) ValidatorsAtHash(ctx context.Context, hash common.Hash) ([]common.Address, error) {
+	var validators []common.Address
+	err := dc.c.CallContext(ctx, &validators, dc.namespace+"_getValidatorsAtHash", hash)
+	return validators, err
+}
+
+// Status retrieves the signing activity of the validators over the recent
+// blocks.
+func (dc *Client) Status(ctx context.Context) (*Status, error) {
+	var status *Status
+	err := dc.c.CallContext(ctx, &status, dc.namespace+"_status")
+	return status, err
+}
+
+// ValidatorInfo retrieves the staking and punishment state of a validator at
+// the given block. If number is nil, the latest known block is used.
+func (dc *Client) ValidatorInfo(ctx context.Context, val common.Address, number *big.Int) (*ValidatorInfo, error) {
+	var info *ValidatorInfo
+	err := dc.c.CallContext(ctx, &info, dc.namespace+"_getValidatorInfo", val, toBlockNumArg(number))
+	return info, err
+}
+
+// ValidatorInfos retrieves the state of all the top and active validators at
+// the given block. If number is nil, the latest known block is used.
+func (dc *Client) ValidatorInfos(ctx context.Context, number *big.Int) ([]*ValidatorInfo, error) {
+	var infos []*ValidatorInfo
+	err := dc.c.CallContext(ctx, &infos, dc.namespace+"_getValidatorInfos", toBlockNumArg(number))
+	return infos, err
+}
+
+// ValidatorSets retrieves the top validators by stake against the active set at
+// the given block. If number is nil, the latest known block is used.
+func (dc *Client) ValidatorSets(ctx context.Context, number *big.Int) (*ValidatorSets, error) {
+	var sets *ValidatorSets
+	err := dc.c.CallContext(ctx, &sets, dc.namespace+"_getValidatorSets", toBlockNumArg(number))
+	return sets, err
+}
+
+// Blacklist retrieves the blacklisted addresses at the given block, along with
+// the direction of the transactions they are denied: from, to or both. If
+// number is nil, the latest known block is used.
+func (dc *Client) Blacklist(ctx context.Context, number *big.Int) (map[common.Address]string, error) {
+	var blacklist map[common.Address]string
+	err := dc.c.CallContext(ctx, &blacklist, dc.namespace+"_getBlacklist", toBlockNumArg(number))
+	return blacklist, err
+}
+
+// DeveloperStatus retrieves the state of an address in the developer whitelist
+// at the given block. If number is nil, the latest known block is used.
+func (dc *Client) DeveloperStatus(ctx context.Context, addr common.Address, number *big.Int) (*DeveloperStatus, error) {
+	var status *DeveloperStatus
+	err := dc.c.CallContext(ctx, &status, dc.namespace+"_getDeveloperStatus", addr, toBlockNumArg(number))
+	return status, err
+}
+
+// PosEtherbase retrieves the validator addresses the node mines with.
+func (dc *Client) PosEtherbase(ctx context.Context) ([]common.Address, error) {
+	var etherbases []common.Address
+	err := dc.c.CallContext(ctx, &etherbases, "eth_posEtherbase")
+	return etherbases, err
+}
+
+// TransactionReceiptsByBlockNumber retrieves the receipts of all the transactions
+// of the given canonical block.
+func (dc *Client) TransactionReceiptsByBlockNumber(ctx context.Context, number *big.Int) ([]*types.Receipt, error) {
+	var receipts []*types.Receipt
+	err := dc.c.CallContext(ctx, &receipts, "eth_getTransactionReceiptsByBlockNumber", toBlockNumArg(number))
+	return receipts, err
+}
+
+// ValidatorSetChange is a change of the validator set, announced by the
+// checkpoint header at an epoch boundary.
+type ValidatorSetChange struct {
+	Number     uint64
+	Hash       common.Hash
+	Validators []common.Address // Validator set from the checkpoint on, sorted by address
+	Added      []common.Address // Validators joining the set
+	Removed    []common.Address // Validators leaving the set
+}
+
+// checkpointValidators returns the validators listed in the extra-data of a
+// checkpoint header, nil if the header is no checkpoint.
+func checkpointValidators(header *types.Header) []common.Address {
+	size := len(header.Extra) - extraVanity - extraSeal
+	if size <= 0 || size%common.AddressLength != 0 {
+		return nil
+	}
+	validators := make([]common.Address, size/common.AddressLength)
+	for i := range validators {
+		copy(validators[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	return validators
+}
+
+// diffValidators returns the validators of next missing from prev.
+func diffValidators(next, prev []common.Address) []common.Address {
+	known := make(map[common.Address]struct{}, len(prev))
+	for _, val := range prev {
+		known[val] = struct{}{}
+	}
+	diff := []common.Address{}
+	for _, val := range next {
+		if _, ok := known[val]; !ok {
+			diff = append(diff, val)
+		}
+	}
+	return diff
+}
+
+// SubscribeValidatorSetChanges subscribes to notifications about changes of the
+// validator set at epoch boundaries. Checkpoints keeping the validator set as is
+// are not announced.
+func (dc *Client) SubscribeValidatorSetChanges(ctx context.Context, ch chan<- *ValidatorSetChange) (event.Subscription, error) {
+	heads := make(chan *types.Header)
+	sub, err := dc.c.EthSubscribe(ctx, heads, "newHeads")
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+
+		var prev []common.Address
+		for {
+			select {
+			case head := <-heads:
+				validators := checkpointValidators(head)
+				if validators == nil {
+					continue
+				}
+				if prev == nil {
+					parent, err := dc.ValidatorsAtHash(context.Background(), head.ParentHash)
+					if err != nil {
+						return err
+					}
+					prev = parent
+				}
+				change := &ValidatorSetChange{
+					Number:     head.Number.Uint64(),
+					Hash:       head.Hash(),
+					Validators: validators,
+					Added:      diffValidators(validators, prev),
+					Removed:    diffValidators(prev, validators),
+				}
+				prev = validators
+				if len(change.Added) == 0 && len(change.Removed) == 0 {
+					continue
+				}
+				select {
+				case ch <- change:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+func toBlockNumArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	pending := big.NewInt(-1)
+	if number.Cmp(pending) == 0 {
+		return "pending"
+	}
+	return hexutil.EncodeBig(number)
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dposclient
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/consensus/dpos/systemcontract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testVal    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testJoiner = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	// stubContractCode emits an empty log and returns 32 zero bytes to any call,
+	// standing in for the system contracts.
+	stubContractCode = common.FromHex("0x60006000a060206000f3")
+)
+
+// returnCode assembles a contract returning the given output to any call.
+func returnCode(output []byte) []byte {
+	var code []byte
+	for i := 0; i < len(output); i += 32 {
+		code = append(code, byte(vm.PUSH32))
+		code = append(code, common.RightPadBytes(output[i:], 32)[:32]...)
+		code = append(code, byte(vm.PUSH2), byte(i>>8), byte(i), byte(vm.MSTORE))
+	}
+	return append(code, byte(vm.PUSH2), byte(len(output)>>8), byte(len(output)), byte(vm.PUSH1), 0, byte(vm.RETURN))
+}
+
+// testBackend is an in-process dpos node sealing blocks on demand with the
+// key of its single validator.
+type testBackend struct {
+	node   *node.Node
+	eth    *eth.Ethereum
+	engine *dpos.Dpos
+	config *params.ChainConfig
+}
+
+func newTestBackend(t *testing.T) *testBackend {
+	// The factory promotes a second validator at the first epoch
+	factoryABI := systemcontract.GetInteractiveABI()[systemcontract.DposFactoryContractName]
+	top, err := factoryABI.Methods["getTopValidators"].Outputs.Pack([]common.Address{testVal, testJoiner})
+	if err != nil {
+		t.Fatalf("failed to pack top validators: %v", err)
+	}
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1337),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		RedCoastBlock:       big.NewInt(0),
+		Dpos:                &params.DposConfig{Period: 0, Epoch: 4},
+	}
+	genesis := &core.Genesis{
+		Config:    config,
+		GasLimit:  8000000,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: core.GenesisAlloc{
+			testVal:                                {Balance: big.NewInt(params.Ether)},
+			systemcontract.SysGovContractAddr:      {Balance: new(big.Int), Code: stubContractCode},
+			systemcontract.AddressListContractAddr: {Balance: new(big.Int), Code: stubContractCode},
+			systemcontract.DposFactoryContractAddr: {Balance: new(big.Int), Code: returnCode(top)},
+			systemcontract.PunishV1ContractAddr:    {Balance: new(big.Int), Code: stubContractCode},
+		},
+	}
+	copy(genesis.ExtraData[extraVanity:], testVal[:])
+
+	n, err := node.New(&node.Config{})
+	if err != nil {
+		t.Fatalf("can't create new node: %v", err)
+	}
+	ethConfig := &ethconfig.Config{Genesis: genesis}
+	ethConfig.Miner.PosEtherbase = []common.Address{testVal}
+	ethservice, err := eth.New(n, ethConfig)
+	if err != nil {
+		t.Fatalf("can't create new ethereum service: %v", err)
+	}
+	if err := n.Start(); err != nil {
+		t.Fatalf("can't start test node: %v", err)
+	}
+	engine := ethservice.Engine().(*dpos.Dpos)
+	signer := types.NewEIP155Signer(config.ChainID)
+	engine.Authorize(testVal, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), testKey)
+	}, func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		return types.SignTx(tx, signer, testKey)
+	})
+	return &testBackend{node: n, eth: ethservice, engine: engine, config: config}
+}
+
+// seal assembles, signs and imports a block with the given transactions on top
+// of the current head.
+func (b *testBackend) seal(t *testing.T, txs ...*types.Transaction) *types.Block {
+	chain := b.eth.BlockChain()
+	parent := chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+	}
+	if err := b.engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare block %d: %v", header.Number, err)
+	}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		t.Fatalf("failed to retrieve parent state: %v", err)
+	}
+	var (
+		gasPool  = new(core.GasPool).AddGas(header.GasLimit)
+		receipts []*types.Receipt
+	)
+	for i, tx := range txs {
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+		receipt, err := core.ApplyTransaction(b.config, chain, &header.Coinbase, gasPool, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to apply transaction: %v", err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	block, _, err := b.engine.FinalizeAndAssemble(chain, header, statedb, txs, nil, receipts)
+	if err != nil {
+		t.Fatalf("failed to assemble block %d: %v", header.Number, err)
+	}
+	header = block.Header()
+	sig, err := crypto.Sign(crypto.Keccak256(dpos.DposRLP(header, b.config.ChainID)), testKey)
+	if err != nil {
+		t.Fatalf("failed to sign block %d: %v", header.Number, err)
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+
+	block = block.WithSeal(header)
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to import block %d: %v", header.Number, err)
+	}
+	return block
+}
+
+func TestDposClient(t *testing.T) {
+	backend := newTestBackend(t)
+	defer backend.node.Close()
+
+	rpcClient, err := backend.node.Attach()
+	if err != nil {
+		t.Fatalf("failed to attach to node: %v", err)
+	}
+	client := New(rpcClient)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changes := make(chan *ValidatorSetChange, 1)
+	sub, err := client.SubscribeValidatorSetChanges(ctx, changes)
+	if err != nil {
+		t.Fatalf("failed to subscribe to validator set changes: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	transfer, _ := types.SignTx(types.NewTransaction(0, testJoiner, big.NewInt(1), params.TxGas, big.NewInt(params.GWei), nil), types.NewEIP155Signer(backend.config.ChainID), testKey)
+	blocks := []*types.Block{backend.seal(t), backend.seal(t, transfer), backend.seal(t), backend.seal(t)}
+
+	// Epoch boundaries announce validator set changes
+	select {
+	case change := <-changes:
+		validators := []common.Address{testVal, testJoiner}
+		if bytes.Compare(testJoiner[:], testVal[:]) < 0 {
+			validators = []common.Address{testJoiner, testVal}
+		}
+		want := &ValidatorSetChange{
+			Number:     4,
+			Hash:       blocks[3].Hash(),
+			Validators: validators,
+			Added:      []common.Address{testJoiner},
+			Removed:    []common.Address{},
+		}
+		if !reflect.DeepEqual(change, want) {
+			t.Errorf("validator set change mismatch: have %+v, want %+v", change, want)
+		}
+	case err := <-sub.Err():
+		t.Fatalf("subscription failed: %v", err)
+	case <-ctx.Done():
+		t.Fatalf("validator set change not announced")
+	}
+	// Snapshots and validator lists mirror the engine
+	snap, err := client.Snapshot(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if snap.Number != 4 || snap.Hash != blocks[3].Hash() || len(snap.ValidatorList()) != 2 {
+		t.Errorf("snapshot mismatch: have #%d [%x] %v", snap.Number, snap.Hash, snap.ValidatorList())
+	}
+	if snap, err := client.SnapshotAtHash(ctx, blocks[1].Hash()); err != nil || snap.Number != 2 {
+		t.Errorf("snapshot at hash mismatch: have %v, %v", snap, err)
+	}
+	if vals, err := client.Validators(ctx, big.NewInt(3)); err != nil || !reflect.DeepEqual(vals, []common.Address{testVal}) {
+		t.Errorf("validators mismatch: have %v, %v, want [%x]", vals, err, testVal)
+	}
+	if vals, err := client.ValidatorsAtHash(ctx, blocks[3].Hash()); err != nil || len(vals) != 2 {
+		t.Errorf("validators at hash mismatch: have %v, %v", vals, err)
+	}
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve status: %v", err)
+	}
+	if status.NumBlocks != 3 || status.SigningStatus[testVal] != 3 || status.InturnPercent != 100 {
+		t.Errorf("status mismatch: have %+v", status)
+	}
+	sets, err := client.ValidatorSets(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve validator sets: %v", err)
+	}
+	if len(sets.Top) != 2 || len(sets.Active) != 2 || len(sets.Joining) != 0 || len(sets.Leaving) != 0 {
+		t.Errorf("validator sets mismatch: have %+v", sets)
+	}
+	// Chain specific eth namespace extensions
+	if etherbases, err := client.PosEtherbase(ctx); err != nil || !reflect.DeepEqual(etherbases, []common.Address{testVal}) {
+		t.Errorf("pos etherbase mismatch: have %v, %v, want [%x]", etherbases, err, testVal)
+	}
+	receipts, err := client.TransactionReceiptsByBlockNumber(ctx, big.NewInt(2))
+	if err != nil {
+		t.Fatalf("failed to retrieve receipts: %v", err)
+	}
+	if len(receipts) != 1 || receipts[0].TxHash != transfer.Hash() || receipts[0].Status != types.ReceiptStatusSuccessful {
+		t.Errorf("receipts mismatch: have %v", receipts)
+	}
+}
+
+// Tests that only checkpoint headers are decoded as validator set changes.
+func TestCheckpointValidators(t *testing.T) {
+	val := common.HexToAddress("0x01")
+	header := &types.Header{Extra: make([]byte, extraVanity+extraSeal)}
+	if vals := checkpointValidators(header); vals != nil {
+		t.Errorf("validators decoded from plain header: %v", vals)
+	}
+	header.Extra = append(append(make([]byte, extraVanity), val[:]...), make([]byte, extraSeal)...)
+	if vals := checkpointValidators(header); !reflect.DeepEqual(vals, []common.Address{val}) {
+		t.Errorf("checkpoint validators mismatch: have %v, want [%x]", vals, val)
+	}
+}
@@ -0,0 +1,519 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build arm64 amd64
+
+// Package pebble implements the key-value database layer based on pebble.
+package pebble
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// degradationWarnInterval specifies how often warning should be printed if the
+	// pebble database cannot keep up with requested writes.
+	degradationWarnInterval = time.Minute
+
+	// minCache is the minimum amount of memory in megabytes to allocate to pebble
+	// read and write caching, split half and half.
+	minCache = 16
+
+	// minHandles is the minimum number of files handles to allocate to the open
+	// database files.
+	minHandles = 16
+
+	// metricsGatheringInterval specifies the interval to retrieve pebble database
+	// compaction, io and pause stats to report to the user.
+	metricsGatheringInterval = 3 * time.Second
+
+	// maxMemTableSize is the largest memory table pebble supports, as its
+	// offsets are 32 bits wide.
+	maxMemTableSize = 4<<30 - 1
+)
+
+// Database is a persistent key-value store based on the pebble storage engine.
+// Apart from basic data storage functionality it also supports batch writes and
+// iterating over the keyspace in binary-alphabetical order.
+type Database struct {
+	fn string     // filename for reporting
+	db *pebble.DB // Underlying pebble storage engine
+
+	compTimeMeter      metrics.Meter // Meter for measuring the total time spent in database compaction
+	compReadMeter      metrics.Meter // Meter for measuring the data read during compaction
+	compWriteMeter     metrics.Meter // Meter for measuring the data written during compaction
+	writeDelayNMeter   metrics.Meter // Meter for measuring the write delay number due to database compaction
+	writeDelayMeter    metrics.Meter // Meter for measuring the write delay duration due to database compaction
+	diskSizeGauge      metrics.Gauge // Gauge for tracking the size of all the levels in the database
+	diskWriteMeter     metrics.Meter // Meter for measuring the effective amount of data written
+	memCompGauge       metrics.Gauge // Gauge for tracking the number of memory compaction
+	level0CompGauge    metrics.Gauge // Gauge for tracking the number of table compaction in level0
+	nonlevel0CompGauge metrics.Gauge // Gauge for tracking the number of table compaction in non0 level
+	seekCompGauge      metrics.Gauge // Gauge for tracking the number of table compaction caused by read opt
+
+	quitLock sync.Mutex      // Mutex protecting the quit channel access
+	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
+	closed   bool            // Whether the database was closed, pebble panics on closing twice
+
+	log log.Logger // Contextual logger tracking the database path
+
+	activeComp    int       // Current number of active compactions
+	compStartTime time.Time // The start time of the earliest currently-active compaction
+	compTime      int64     // Total time spent in compaction in ns (atomic)
+	level0Comp    uint32    // Total number of level-zero compactions (atomic)
+	nonLevel0Comp uint32    // Total number of non level-zero compactions (atomic)
+
+	writeStallStart time.Time // The start time of the ongoing write stall
+	writeStallWarn  time.Time // The last time a write stall was warned about
+	writeDelayN     int64     // Total number of write stalls (atomic)
+	writeDelay      int64     // Total time spent in write stalls in ns (atomic)
+}
+
+// onCompactionBegin accounts a compaction, timing the span during which any is
+// ongoing.
+func (db *Database) onCompactionBegin(info pebble.CompactionInfo) {
+	if db.activeComp == 0 {
+		db.compStartTime = time.Now()
+	}
+	if len(info.Input) > 0 && info.Input[0].Level == 0 {
+		atomic.AddUint32(&db.level0Comp, 1)
+	} else {
+		atomic.AddUint32(&db.nonLevel0Comp, 1)
+	}
+	db.activeComp++
+}
+
+func (db *Database) onCompactionEnd(info pebble.CompactionInfo) {
+	if db.activeComp == 1 {
+		atomic.AddInt64(&db.compTime, int64(time.Since(db.compStartTime)))
+	}
+	if db.activeComp > 0 {
+		db.activeComp--
+	}
+}
+
+// onWriteStallBegin accounts a write stall, warning about it unless the last
+// warning is recent.
+func (db *Database) onWriteStallBegin(info pebble.WriteStallBeginInfo) {
+	db.writeStallStart = time.Now()
+	atomic.AddInt64(&db.writeDelayN, 1)
+
+	if time.Since(db.writeStallWarn) > degradationWarnInterval {
+		db.log.Warn("Database compacting, degraded performance", "reason", info.Reason)
+		db.writeStallWarn = time.Now()
+	}
+}
+
+func (db *Database) onWriteStallEnd() {
+	atomic.AddInt64(&db.writeDelay, int64(time.Since(db.writeStallStart)))
+}
+
+// New returns a wrapped pebble DB object. The namespace is the prefix that the
+// metrics reporting should use for surfacing internal stats.
+func New(file string, cache int, handles int, namespace string, readonly bool) (*Database, error) {
+	// Ensure we have some minimal caching and file guarantees
+	if cache < minCache {
+		cache = minCache
+	}
+	if handles < minHandles {
+		handles = minHandles
+	}
+	logger := log.New("database", file)
+	logCtx := []interface{}{"cache", common.StorageSize(cache * 1024 * 1024), "handles", handles}
+	if readonly {
+		logCtx = append(logCtx, "readonly", "true")
+	}
+	logger.Info("Allocated cache and file handles", logCtx...)
+
+	// Half of the cache goes to the two memory tables, a frozen and a live one,
+	// as with leveldb
+	memTableLimit := 2
+	memTableSize := cache * 1024 * 1024 / 2 / memTableLimit
+	if memTableSize > maxMemTableSize {
+		memTableSize = maxMemTableSize
+	}
+	db := &Database{
+		fn:       file,
+		log:      logger,
+		quitChan: make(chan chan error),
+	}
+	options := &pebble.Options{
+		Cache:                       pebble.NewCache(int64(cache * 1024 * 1024)),
+		MaxOpenFiles:                handles,
+		MemTableSize:                memTableSize,
+		MemTableStopWritesThreshold: memTableLimit,
+		MaxConcurrentCompactions:    func() int { return runtime.NumCPU() },
+		ReadOnly:                    readonly,
+		EventListener: &pebble.EventListener{
+			CompactionBegin: db.onCompactionBegin,
+			CompactionEnd:   db.onCompactionEnd,
+			WriteStallBegin: db.onWriteStallBegin,
+			WriteStallEnd:   db.onWriteStallEnd,
+		},
+	}
+	// Grow the tables with the levels, filtering them all with bloom filters as
+	// leveldb does
+	for i, size := 0, int64(2*1024*1024); i < 7; i, size = i+1, size*2 {
+		options.Levels = append(options.Levels, pebble.LevelOptions{
+			TargetFileSize: size,
+			FilterPolicy:   bloom.FilterPolicy(10),
+		})
+	}
+	// Disable seek compactions, as leveldb does
+	options.Experimental.ReadSamplingMultiplier = -1
+
+	inner, err := pebble.Open(file, options)
+	if err != nil {
+		return nil, err
+	}
+	db.db = inner
+
+	db.compTimeMeter = metrics.NewRegisteredMeter(namespace+"compact/time", nil)
+	db.compReadMeter = metrics.NewRegisteredMeter(namespace+"compact/input", nil)
+	db.compWriteMeter = metrics.NewRegisteredMeter(namespace+"compact/output", nil)
+	db.diskSizeGauge = metrics.NewRegisteredGauge(namespace+"disk/size", nil)
+	db.diskWriteMeter = metrics.NewRegisteredMeter(namespace+"disk/write", nil)
+	db.writeDelayMeter = metrics.NewRegisteredMeter(namespace+"compact/writedelay/duration", nil)
+	db.writeDelayNMeter = metrics.NewRegisteredMeter(namespace+"compact/writedelay/counter", nil)
+	db.memCompGauge = metrics.NewRegisteredGauge(namespace+"compact/memory", nil)
+	db.level0CompGauge = metrics.NewRegisteredGauge(namespace+"compact/level0", nil)
+	db.nonlevel0CompGauge = metrics.NewRegisteredGauge(namespace+"compact/nonlevel0", nil)
+	db.seekCompGauge = metrics.NewRegisteredGauge(namespace+"compact/seek", nil)
+
+	// Start up the metrics gathering and return
+	go db.meter(metricsGatheringInterval)
+	return db, nil
+}
+
+// Close stops the metrics collection, flushes any pending data to disk and closes
+// all io accesses to the underlying key-value store.
+func (db *Database) Close() error {
+	db.quitLock.Lock()
+	defer db.quitLock.Unlock()
+
+	if db.closed {
+		return pebble.ErrClosed
+	}
+	db.closed = true
+	if db.quitChan != nil {
+		errc := make(chan error)
+		db.quitChan <- errc
+		if err := <-errc; err != nil {
+			db.log.Error("Metrics collection failed", "err", err)
+		}
+		db.quitChan = nil
+	}
+	return db.db.Close()
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	_, closer, err := db.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	dat, closer, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	ret := common.CopyBytes(dat)
+	closer.Close()
+	return ret, nil
+}
+
+// Put inserts the given value into the key-value store.
+func (db *Database) Put(key []byte, value []byte) error {
+	return db.db.Set(key, value, pebble.NoSync)
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.db.Delete(key, pebble.NoSync)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() ethdb.Batch {
+	return &batch{
+		b: db.db.NewBatch(),
+	}
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (db *Database) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	iter := db.db.NewIter(&pebble.IterOptions{
+		LowerBound: append(common.CopyBytes(prefix), start...),
+		UpperBound: upperBound(prefix),
+	})
+	iter.First()
+	return &pebbleIterator{iter: iter, moved: true}
+}
+
+// Stat returns a particular internal stat of the database. Pebble only reports
+// its metrics table, which is also returned for the leveldb stats property the
+// existing tooling asks for.
+func (db *Database) Stat(property string) (string, error) {
+	switch property {
+	case "pebble.stats", "leveldb.stats":
+		return db.db.Metrics().String(), nil
+	}
+	return "", errors.New("unknown property")
+}
+
+// Compact flattens the underlying data store for the given key range. In essence,
+// deleted and overwritten versions are discarded, and the data is rearranged to
+// reduce the cost of operations needed to access them.
+//
+// A nil start is treated as a key before all keys in the data store; a nil limit
+// is treated as a key after all keys in the data store. If both is nil then it
+// will compact entire data store.
+func (db *Database) Compact(start []byte, limit []byte) error {
+	// Pebble has no open ended ranges, so a nil limit is replaced with a key
+	// ordered after all the others: 32 bytes of 0xff can only be reached by a
+	// trie node hash collision
+	if limit == nil {
+		limit = bytes.Repeat([]byte{0xff}, common.HashLength)
+	}
+	return db.db.Compact(start, limit, true)
+}
+
+// Path returns the path to the database directory.
+func (db *Database) Path() string {
+	return db.fn
+}
+
+// meter periodically retrieves internal pebble counters and reports them to
+// the metrics subsystem.
+func (db *Database) meter(refresh time.Duration) {
+	var errc chan error
+	timer := time.NewTimer(refresh)
+	defer timer.Stop()
+
+	// Create storage for the counters, the current and previous values
+	var (
+		compTimes   [2]int64
+		compReads   [2]int64
+		compWrites  [2]int64
+		diskWrites  [2]int64
+		delayNs     [2]int64
+		delayCounts [2]int64
+	)
+	// Iterate ad infinitum and collect the stats
+	for i := 1; errc == nil; i++ {
+		stats := db.db.Metrics()
+
+		var compRead, compWrite, diskWrite int64
+		for _, level := range stats.Levels {
+			compRead += int64(level.BytesRead)
+			compWrite += int64(level.BytesCompacted)
+			diskWrite += int64(level.BytesCompacted + level.BytesFlushed)
+		}
+		diskWrite += int64(stats.WAL.BytesWritten)
+
+		compTimes[i%2] = atomic.LoadInt64(&db.compTime)
+		compReads[i%2], compWrites[i%2], diskWrites[i%2] = compRead, compWrite, diskWrite
+		delayNs[i%2] = atomic.LoadInt64(&db.writeDelay)
+		delayCounts[i%2] = atomic.LoadInt64(&db.writeDelayN)
+
+		// Update all the requested meters
+		if db.diskSizeGauge != nil {
+			db.diskSizeGauge.Update(int64(stats.DiskSpaceUsage()))
+		}
+		if db.compTimeMeter != nil {
+			db.compTimeMeter.Mark(compTimes[i%2] - compTimes[(i-1)%2])
+		}
+		if db.compReadMeter != nil {
+			db.compReadMeter.Mark(compReads[i%2] - compReads[(i-1)%2])
+		}
+		if db.compWriteMeter != nil {
+			db.compWriteMeter.Mark(compWrites[i%2] - compWrites[(i-1)%2])
+		}
+		if db.diskWriteMeter != nil {
+			db.diskWriteMeter.Mark(diskWrites[i%2] - diskWrites[(i-1)%2])
+		}
+		if db.writeDelayNMeter != nil {
+			db.writeDelayNMeter.Mark(delayCounts[i%2] - delayCounts[(i-1)%2])
+		}
+		if db.writeDelayMeter != nil {
+			db.writeDelayMeter.Mark(delayNs[i%2] - delayNs[(i-1)%2])
+		}
+		if db.memCompGauge != nil {
+			db.memCompGauge.Update(stats.Flush.Count)
+		}
+		if db.level0CompGauge != nil {
+			db.level0CompGauge.Update(int64(atomic.LoadUint32(&db.level0Comp)))
+		}
+		if db.nonlevel0CompGauge != nil {
+			db.nonlevel0CompGauge.Update(int64(atomic.LoadUint32(&db.nonLevel0Comp)))
+		}
+		if db.seekCompGauge != nil {
+			db.seekCompGauge.Update(stats.Compact.ReadCount)
+		}
+		// Sleep a bit, then repeat the stats collection
+		select {
+		case errc = <-db.quitChan:
+			// Quit requesting, stop hammering the database
+		case <-timer.C:
+			timer.Reset(refresh)
+			// Timeout, gather a new set of stats
+		}
+	}
+	errc <- nil
+}
+
+// batch is a write-only pebble batch that commits changes to its host database
+// when Write is called. A batch cannot be used concurrently.
+type batch struct {
+	b    *pebble.Batch
+	size int
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	b.b.Set(key, value, nil)
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.b.Delete(key, nil)
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to disk.
+func (b *batch) Write() error {
+	return b.b.Commit(pebble.NoSync)
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *batch) Replay(w ethdb.KeyValueWriter) error {
+	reader := b.b.Reader()
+	for {
+		kind, key, value, ok := reader.Next()
+		if !ok {
+			return nil
+		}
+		var err error
+		switch kind {
+		case pebble.InternalKeyKindSet:
+			err = w.Put(key, value)
+		case pebble.InternalKeyKindDelete:
+			err = w.Delete(key)
+		default:
+			err = fmt.Errorf("unhandled batch operation %v", kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pebbleIterator is a wrapper of underlying iterator in storage engine.
+// The purpose of this structure is to implement the missing APIs.
+type pebbleIterator struct {
+	iter     *pebble.Iterator
+	moved    bool
+	released bool
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (iter *pebbleIterator) Next() bool {
+	if iter.moved {
+		iter.moved = false
+		return iter.iter.Valid()
+	}
+	return iter.iter.Next()
+}
+
+// Error returns any accumulated error. Exhausting all the key/value pairs
+// is not considered to be an error.
+func (iter *pebbleIterator) Error() error {
+	return iter.iter.Error()
+}
+
+// Key returns the key of the current key/value pair, or nil if done. The caller
+// should not modify the contents of the returned slice, and its contents may
+// change on the next call to Next.
+func (iter *pebbleIterator) Key() []byte {
+	return iter.iter.Key()
+}
+
+// Value returns the value of the current key/value pair, or nil if done. The
+// caller should not modify the contents of the returned slice, and its contents
+// may change on the next call to Next.
+func (iter *pebbleIterator) Value() []byte {
+	return iter.iter.Value()
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (iter *pebbleIterator) Release() {
+	if !iter.released {
+		iter.iter.Close()
+		iter.released = true
+	}
+}
+
+// upperBound returns the smallest key ordered after all the ones with the given
+// prefix, or nil if there's none.
+func upperBound(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] == 0xff {
+			continue
+		}
+		limit := common.CopyBytes(prefix[:i+1])
+		limit[i]++
+		return limit
+	}
+	return nil
+}
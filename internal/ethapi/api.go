@@ -1058,6 +1058,10 @@ func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash
 			}
 			return true, nil, err // Bail out
 		}
+		// The creation is refused regardless of the gas allowance, don't bother searching
+		if errors.Is(result.Err, vm.ErrUnauthorizedDeveloper) {
+			return true, result, result.Err
+		}
 		return result.Failed(), result, nil
 	}
 	// Execute the binary search and hone in on an executable gas limit
@@ -63,6 +63,9 @@ func (b *LesApiBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
 		return b.eth.blockchain.CurrentHeader(), nil
 	}
+	if number == rpc.FinalizedBlockNumber || number == rpc.SafeBlockNumber {
+		return nil, errors.New("finalized and safe blocks are not tracked by light clients")
+	}
 	return b.eth.blockchain.GetHeaderByNumberOdr(ctx, uint64(number))
 }
 func (b *LesApiBackend) PosEtherbase() []common.Address {
@@ -18,6 +18,7 @@
 package les
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -132,6 +134,12 @@ func New(stack *node.Node, config *ethconfig.Config) (*LightEthereum, error) {
 	leth.bloomTrieIndexer = light.NewBloomTrieIndexer(chainDb, leth.odr, params.BloomBitsBlocksClient, params.BloomTrieFrequency, config.LightNoPrune)
 	leth.odr.SetIndexers(leth.chtIndexer, leth.bloomTrieIndexer, leth.bloomIndexer)
 
+	// Dpos can't read the validators from the state, it follows the ones listed
+	// in the epoch headers instead
+	if engine, ok := leth.engine.(*dpos.Dpos); ok {
+		engine.SetLightMode(leth.dposHeader, leth.dposValidatorProof)
+	}
+
 	checkpoint := config.Checkpoint
 	if checkpoint == nil {
 		checkpoint = params.TrustedCheckpoints[genesisHash]
@@ -282,6 +290,32 @@ func (s *LightDummyAPI) Mining() bool {
 	return false
 }
 
+// dposRetrievalTimeout is the time the dpos engine waits for the chain data it
+// retrieves from the network.
+const dposRetrievalTimeout = 10 * time.Second
+
+// dposHeader retrieves a canonical header proven by the trusted CHTs, from which
+// the dpos engine picks up the validators of the epoch a checkpoint sync starts in.
+func (s *LightEthereum) dposHeader(number uint64) (*types.Header, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dposRetrievalTimeout)
+	defer cancel()
+
+	return light.GetHeaderByNumber(ctx, s.odr, number)
+}
+
+// dposValidatorProof retrieves the proof of the validators listed in a dpos epoch
+// header.
+func (s *LightEthereum) dposValidatorProof(header *types.Header) (*dpos.ValidatorProof, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dposRetrievalTimeout)
+	defer cancel()
+
+	req := &ValidatorProofRequest{Header: header}
+	if err := s.odr.RetrieveValidatorProof(ctx, req); err != nil {
+		return nil, err
+	}
+	return req.Proof, nil
+}
+
 // APIs returns the collection of RPC services the ethereum package offers.
 // NOTE, some of these services probably need to be moved to somewhere else.
 func (s *LightEthereum) APIs() []rpc.API {
@@ -92,6 +92,7 @@ const (
 	MsgProofsV2
 	MsgHelperTrieProofs
 	MsgTxStatus
+	MsgValidatorProofs
 )
 
 // Msg encodes a LES message that delivers reply data for a request
@@ -197,9 +198,28 @@ func (odr *LesOdr) RetrieveTxStatus(ctx context.Context, req *light.TxStatusRequ
 // for most of the LES requests except for the TxStatusRequest which needs
 // the additional retry mechanism.
 // If the network retrieval was successful, it stores the object in local db.
-func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err error) {
-	lreq := LesRequest(req)
+func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	if err := odr.retrieve(ctx, LesRequest(req)); err != nil {
+		return err
+	}
+	req.StoreResult(odr.db)
+	return nil
+}
+
+// RetrieveValidatorProof retrieves the proof of the validators listed in a dpos
+// epoch header. Only the servers holding the state of the epoch's parent can
+// prove them, so it fails right away if none is connected.
+func (odr *LesOdr) RetrieveValidatorProof(ctx context.Context, req *ValidatorProofRequest) error {
+	for _, peer := range odr.peers.allPeers() {
+		if !peer.onlyAnnounce && req.CanSend(peer) {
+			return odr.retrieve(ctx, req)
+		}
+	}
+	return errNoValidatorProofServer
+}
 
+// retrieve sends a request to the LES network, waiting for a valid reply.
+func (odr *LesOdr) retrieve(ctx context.Context, lreq LesOdrRequest) (err error) {
 	reqID := genReqID()
 	rq := &distReq{
 		getCost: func(dp distPeer) uint64 {
@@ -227,9 +247,5 @@ func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err erro
 		requestRTT.Update(time.Duration(mclock.Now() - sent))
 	}(mclock.Now())
 
-	if err := odr.retriever.retrieve(ctx, reqID, rq, func(p distPeer, msg *Msg) error { return lreq.Validate(odr.db, msg) }, odr.stop); err != nil {
-		return err
-	}
-	req.StoreResult(odr.db)
-	return nil
+	return odr.retriever.retrieve(ctx, reqID, rq, func(p distPeer, msg *Msg) error { return lreq.Validate(odr.db, msg) }, odr.stop)
 }
@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -43,6 +44,8 @@ var (
 	errCHTHashMismatch     = errors.New("cht hash mismatch")
 	errCHTNumberMismatch   = errors.New("cht number mismatch")
 	errUselessNodes        = errors.New("useless nodes in merkle proof nodeset")
+
+	errNoValidatorProofServer = errors.New("no server can prove the validators")
 )
 
 type LesOdrRequest interface {
@@ -534,3 +537,46 @@ func (db *readTraceDB) Has(key []byte) (bool, error) {
 	_, err := db.Get(key)
 	return err == nil, nil
 }
+
+// ValidatorProofRequest is the request type for the proof of the validators
+// listed in a dpos epoch header. The proof is checked by the engine, against
+// the state of the epoch's parent.
+type ValidatorProofRequest struct {
+	Header *types.Header
+	Proof  *dpos.ValidatorProof
+}
+
+// GetCost returns the cost of the given request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *ValidatorProofRequest) GetCost(peer *serverPeer) uint64 {
+	return peer.getRequestCost(GetValidatorProofsMsg, 1)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *ValidatorProofRequest) CanSend(peer *serverPeer) bool {
+	return peer.version >= lpv5 && peer.HasBlock(r.Header.ParentHash, r.Header.Number.Uint64()-1, true)
+}
+
+// Request sends a request to the LES network (implementation of LesOdrRequest)
+func (r *ValidatorProofRequest) Request(reqID uint64, peer *serverPeer) error {
+	peer.Log().Debug("Requesting validator proof", "number", r.Header.Number, "hash", r.Header.Hash())
+	return peer.requestValidatorProofs(reqID, []common.Hash{r.Header.Hash()})
+}
+
+// Validate processes a request reply message from the LES network, storing the
+// proof if the message was a valid reply to the request (implementation of
+// LesOdrRequest)
+func (r *ValidatorProofRequest) Validate(db ethdb.Database, msg *Msg) error {
+	log.Debug("Validating validator proof", "number", r.Header.Number, "hash", r.Header.Hash())
+
+	// Ensure we have a correct message with a single proof
+	if msg.MsgType != MsgValidatorProofs {
+		return errInvalidMessageType
+	}
+	proofs := msg.Obj.([]*dpos.ValidatorProof)
+	if len(proofs) != 1 {
+		return errInvalidEntryCount
+	}
+	r.Proof = proofs[0]
+	return nil
+}
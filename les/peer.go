@@ -29,6 +29,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
 	"github.com/ethereum/go-ethereum/core/forkid"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/les/flowcontrol"
@@ -474,6 +475,12 @@ func (p *serverPeer) requestHelperTrieProofs(reqID uint64, reqs []HelperTrieReq)
 	return p.sendRequest(GetHelperTrieProofsMsg, reqID, reqs, len(reqs))
 }
 
+// requestValidatorProofs fetches a batch of dpos validator proofs from a remote node.
+func (p *serverPeer) requestValidatorProofs(reqID uint64, hashes []common.Hash) error {
+	p.Log().Debug("Fetching batch of validator proofs", "count", len(hashes))
+	return p.sendRequest(GetValidatorProofsMsg, reqID, hashes, len(hashes))
+}
+
 // requestTxStatus fetches a batch of transaction status records from a remote node.
 func (p *serverPeer) requestTxStatus(reqID uint64, txHashes []common.Hash) error {
 	p.Log().Debug("Requesting transaction status", "count", len(txHashes))
@@ -665,6 +672,10 @@ func (p *serverPeer) Handshake(genesis common.Hash, forkid forkid.ID, forkFilter
 
 		if !p.onlyAnnounce {
 			for msgCode := range reqAvgTimeCost {
+				// Requests introduced by later versions can't be served
+				if msgCode >= ProtocolLengths[uint(p.version)] {
+					continue
+				}
 				if p.fcCosts[msgCode] == nil {
 					return errResp(ErrUselessPeer, "peer does not support message %d", msgCode)
 				}
@@ -923,6 +934,12 @@ func (p *clientPeer) replyTxStatus(reqID uint64, stats []light.TxStatus) *reply
 	return &reply{p.rw, TxStatusMsg, reqID, data}
 }
 
+// replyValidatorProofs creates a reply with a batch of dpos validator proofs, corresponding to the ones requested.
+func (p *clientPeer) replyValidatorProofs(reqID uint64, proofs []*dpos.ValidatorProof) *reply {
+	data, _ := rlp.EncodeToBytes(proofs)
+	return &reply{p.rw, ValidatorProofsMsg, reqID, data}
+}
+
 // sendAnnounce announces the availability of a number of blocks through
 // a hash notification.
 func (p *clientPeer) sendAnnounce(request announceData) error {
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -63,7 +64,8 @@ type RequestType struct {
 // by the protocol handler when calling the send function of the returned reply struct.
 type serveRequestFn func(backend serverBackend, peer *clientPeer, waitOrStop func() bool) *reply
 
-// Les3 contains the request types supported by les/2 and les/3
+// Les3 contains the request types supported by les/2 and les/3, along with the
+// dpos validator proofs introduced in les/5
 var Les3 = map[uint64]RequestType{
 	GetBlockHeadersMsg: {
 		Name:             "block header request",
@@ -145,6 +147,16 @@ var Les3 = map[uint64]RequestType{
 		ServingTimeMeter: miscServingTimeTxStatusTimer,
 		Handle:           handleGetTxStatus,
 	},
+	GetValidatorProofsMsg: {
+		Name:             "dpos validator proof request",
+		MaxCount:         MaxValidatorProofsFetch,
+		InPacketsMeter:   miscInValProofPacketsMeter,
+		InTrafficMeter:   miscInValProofTrafficMeter,
+		OutPacketsMeter:  miscOutValProofPacketsMeter,
+		OutTrafficMeter:  miscOutValProofTrafficMeter,
+		ServingTimeMeter: miscServingTimeValProofTimer,
+		Handle:           handleGetValidatorProofs,
+	},
 }
 
 // handleGetBlockHeaders handles a block header request
@@ -551,6 +563,67 @@ func handleGetTxStatus(msg Decoder) (serveRequestFn, uint64, uint64, error) {
 	}, r.ReqID, uint64(len(r.Hashes)), nil
 }
 
+// handleGetValidatorProofs handles a dpos validator proof request
+func handleGetValidatorProofs(msg Decoder) (serveRequestFn, uint64, uint64, error) {
+	var r GetValidatorProofsPacket
+	if err := msg.Decode(&r); err != nil {
+		return nil, 0, 0, err
+	}
+	return func(backend serverBackend, p *clientPeer, waitOrStop func() bool) *reply {
+		var (
+			bytes  int
+			proofs []*dpos.ValidatorProof
+		)
+		bc := backend.BlockChain()
+		engine, isDpos := bc.Engine().(*dpos.Dpos)
+		for i, hash := range r.Hashes {
+			if i != 0 && !waitOrStop() {
+				return nil
+			}
+			if bytes >= softResponseLimit {
+				break
+			}
+			// Retrieve the requested epoch header, skipping if unknown to us
+			header := bc.GetHeaderByHash(hash)
+			if !isDpos || header == nil || header.Number.Uint64() == 0 {
+				p.bumpInvalid()
+				continue
+			}
+			// Refuse to prove from stale states, as for the other proofs
+			local := bc.CurrentHeader().Number.Uint64()
+			if !backend.ArchiveMode() && header.Number.Uint64()+bc.TriesInMemory() <= local {
+				p.Log().Debug("Reject stale validator proof request", "number", header.Number.Uint64(), "head", local)
+				p.bumpInvalid()
+				continue
+			}
+			parent := bc.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+			if parent == nil {
+				p.bumpInvalid()
+				continue
+			}
+			statedb, err := bc.StateAt(parent.Root)
+			if err != nil {
+				p.Log().Warn("Failed to retrieve state for validator proof", "number", parent.Number, "hash", parent.Hash(), "err", err)
+				continue
+			}
+			proof, err := engine.ProveValidators(bc, header, statedb)
+			if err != nil {
+				p.Log().Debug("Failed to prove validators", "number", header.Number, "hash", hash, "err", err)
+				p.bumpInvalid()
+				continue
+			}
+			proofs = append(proofs, proof)
+			for _, code := range proof.Code {
+				bytes += len(code)
+			}
+			for _, node := range proof.Nodes {
+				bytes += len(node)
+			}
+		}
+		return p.replyValidatorProofs(r.ReqID, proofs)
+	}, r.ReqID, uint64(len(r.Hashes)), nil
+}
+
 // txStatus returns the status of a specified transaction.
 func txStatus(b serverBackend, hash common.Hash) light.TxStatus {
 	var stat light.TxStatus
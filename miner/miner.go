@@ -235,6 +235,17 @@ func (miner *Miner) SetEtherbase(addr common.Address) {
 	miner.worker.setEtherbase(addr)
 }
 
+// AddPosEtherbase adds a validator to the ones blocks are sealed with.
+func (miner *Miner) AddPosEtherbase(addr common.Address) {
+	miner.worker.addPosCoinbase(addr)
+}
+
+// RemovePosEtherbase drops a validator from the ones blocks are sealed with. If
+// it was the etherbase, the first remaining validator takes its place.
+func (miner *Miner) RemovePosEtherbase(addr common.Address) {
+	miner.worker.removePosCoinbase(addr)
+}
+
 // EnablePreseal turns on the preseal mining feature. It's enabled by default.
 // Note this function shouldn't be exposed to API, it's unnecessary for users
 // (miners) to actually know the underlying detail. It's only for outside project
@@ -263,6 +263,35 @@ func (w *worker) setEtherbase(addr common.Address) {
 	}
 }
 
+// addPosCoinbase adds a validator to the ones blocks are sealed with in turns.
+func (w *worker) addPosCoinbase(addr common.Address) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, v := range w.posCoinbase {
+		if v == addr {
+			return
+		}
+	}
+	w.posCoinbase = append(w.posCoinbase, addr)
+}
+
+// removePosCoinbase drops a validator from the ones blocks are sealed with.
+func (w *worker) removePosCoinbase(addr common.Address) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, v := range w.posCoinbase {
+		if v == addr {
+			w.posCoinbase = append(w.posCoinbase[:i:i], w.posCoinbase[i+1:]...)
+			break
+		}
+	}
+	if w.coinbase == addr && len(w.posCoinbase) > 0 {
+		w.coinbase = w.posCoinbase[0]
+	}
+}
+
 // setExtra sets the content used to initialize the block extra field.
 func (w *worker) setExtra(extra []byte) {
 	w.mu.Lock()
@@ -944,12 +973,21 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 			header.Coinbase = w.coinbase
 		}
 		if dpos, ok := w.engine.(*dpos.Dpos); ok {
-			real_miner := w.posCoinbase[(w.minerIndex % len(w.posCoinbase))]
+			// Validator keys may be added or removed at runtime, seal with a
+			// consistent view of them
+			w.mu.RLock()
+			posCoinbase := append([]common.Address{}, w.posCoinbase...)
+			w.mu.RUnlock()
+			if len(posCoinbase) == 0 {
+				log.Error("Refusing to mine without validator keys")
+				return
+			}
+			real_miner := posCoinbase[(w.minerIndex % len(posCoinbase))]
 			w.minerIndex += 1
-			if w.minerIndex > len(w.posCoinbase) {
-				w.minerIndex = w.minerIndex % len(w.posCoinbase)
+			if w.minerIndex > len(posCoinbase) {
+				w.minerIndex = w.minerIndex % len(posCoinbase)
 			}
-			addr_res := dpos.CheckHasInTurn(w.chain, w.posCoinbase, header)
+			addr_res := dpos.CheckHasInTurn(w.chain, posCoinbase, header)
 			if addr_res != (common.Address{}) {
 				real_miner = addr_res
 			}
@@ -107,6 +107,11 @@ type Config struct {
 	// SmartCardDaemonPath is the path to the smartcard daemon's socket
 	SmartCardDaemonPath string `toml:",omitempty"`
 
+	// DBEngine is the database engine backing the node's databases, "leveldb" or
+	// "pebble". If empty, the engine of an existing database is used, defaulting
+	// to leveldb for new ones.
+	DBEngine string `toml:",omitempty"`
+
 	// IPCPath is the requested location to place the IPC endpoint. If the path is
 	// a simple file name, it is placed inside the data directory (or on the root
 	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
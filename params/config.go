@@ -18,6 +18,7 @@ package params
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -342,16 +343,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(DposConfig)}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(DposConfig)}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, nil}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil, nil, nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil, nil, nil}
 
 	TestRules = TestChainConfig.Rules(new(big.Int))
 )
@@ -418,24 +419,29 @@ type ChainConfig struct {
 	DAOForkSupport bool     `json:"daoForkSupport,omitempty" toml:",omitempty"` // Whether the nodes supports or opposes the DAO hard-fork
 
 	// EIP150 implements the Gas price changes (https://github.com/ethereum/EIPs/issues/150)
-	EIP150Block *big.Int    `json:"eip150Block,omitempty"` // EIP150 HF block (nil = no fork)
-	EIP150Hash  common.Hash `json:"eip150Hash,omitempty"`  // EIP150 HF hash (needed for header only clients as only gas pricing changed)
-
-	EIP155Block *big.Int `json:"eip155Block,omitempty"` // EIP155 HF block
-	EIP158Block *big.Int `json:"eip158Block,omitempty"` // EIP158 HF block
-
-	ByzantiumBlock      *big.Int `json:"byzantiumBlock,omitempty"`      // Byzantium switch block (nil = no fork, 0 = already on byzantium)
-	ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty"` // Constantinople switch block (nil = no fork, 0 = already activated)
-	PetersburgBlock     *big.Int `json:"petersburgBlock,omitempty"`     // Petersburg switch block (nil = same as Constantinople)
-	IstanbulBlock       *big.Int `json:"istanbulBlock,omitempty"`       // Istanbul switch block (nil = no fork, 0 = already on istanbul)
-	MuirGlacierBlock    *big.Int `json:"muirGlacierBlock,omitempty"`    // Eip-2384 (bomb delay) switch block (nil = no fork, 0 = already activated)
-	BerlinBlock         *big.Int `json:"berlinBlock,omitempty"`         // Berlin switch block (nil = no fork, 0 = already on berlin)
-
-	YoloV3Block   *big.Int `json:"yoloV3Block,omitempty"`   // YOLO v3: Gas repricings TODO @holiman add EIP references
-	EWASMBlock    *big.Int `json:"ewasmBlock,omitempty"`    // EWASM switch block (nil = no fork, 0 = already activated)	RamanujanBlock      *big.Int `json:"ramanujanBlock,omitempty" toml:",omitempty"`      // ramanujanBlock switch block (nil = no fork, 0 = already activated)
-	CatalystBlock *big.Int `json:"catalystBlock,omitempty"` // Catalyst switch block (nil = no fork, 0 = already on catalyst)
-
-	RedCoastBlock *big.Int `json:"redCoastBlock,omitempty"` // RedCoast switch block (nil = no fork, 0 = already activated)
+	EIP150Block *big.Int    `json:"eip150Block,omitempty" toml:",omitempty"` // EIP150 HF block (nil = no fork)
+	EIP150Hash  common.Hash `json:"eip150Hash,omitempty"`                    // EIP150 HF hash (needed for header only clients as only gas pricing changed)
+
+	EIP155Block *big.Int `json:"eip155Block,omitempty" toml:",omitempty"` // EIP155 HF block
+	EIP158Block *big.Int `json:"eip158Block,omitempty" toml:",omitempty"` // EIP158 HF block
+
+	ByzantiumBlock      *big.Int `json:"byzantiumBlock,omitempty" toml:",omitempty"`      // Byzantium switch block (nil = no fork, 0 = already on byzantium)
+	ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty" toml:",omitempty"` // Constantinople switch block (nil = no fork, 0 = already activated)
+	PetersburgBlock     *big.Int `json:"petersburgBlock,omitempty" toml:",omitempty"`     // Petersburg switch block (nil = same as Constantinople)
+	IstanbulBlock       *big.Int `json:"istanbulBlock,omitempty" toml:",omitempty"`       // Istanbul switch block (nil = no fork, 0 = already on istanbul)
+	MuirGlacierBlock    *big.Int `json:"muirGlacierBlock,omitempty" toml:",omitempty"`    // Eip-2384 (bomb delay) switch block (nil = no fork, 0 = already activated)
+	BerlinBlock         *big.Int `json:"berlinBlock,omitempty" toml:",omitempty"`         // Berlin switch block (nil = no fork, 0 = already on berlin)
+
+	YoloV3Block   *big.Int `json:"yoloV3Block,omitempty" toml:",omitempty"`   // YOLO v3: Gas repricings TODO @holiman add EIP references
+	EWASMBlock    *big.Int `json:"ewasmBlock,omitempty" toml:",omitempty"`    // EWASM switch block (nil = no fork, 0 = already activated)	RamanujanBlock      *big.Int `json:"ramanujanBlock,omitempty" toml:",omitempty"`      // ramanujanBlock switch block (nil = no fork, 0 = already activated)
+	CatalystBlock *big.Int `json:"catalystBlock,omitempty" toml:",omitempty"` // Catalyst switch block (nil = no fork, 0 = already on catalyst)
+
+	RedCoastBlock   *big.Int `json:"redCoastBlock,omitempty" toml:",omitempty"`   // RedCoast switch block (nil = no fork, 0 = already activated)
+	SystemTxBlock   *big.Int `json:"systemTxBlock,omitempty" toml:",omitempty"`   // Dpos system calls recorded as transactions switch block (nil = no fork, 0 = already activated)
+	DposBlock       *big.Int `json:"dposBlock,omitempty" toml:",omitempty"`       // Parlia to dpos engine switch block (nil = no switch, only with both engines configured)
+	DoubleSignBlock *big.Int `json:"doubleSignBlock,omitempty" toml:",omitempty"` // Dpos double sign evidence submission switch block (nil = no fork, 0 = already activated)
+	DevVerifyBlock  *big.Int `json:"devVerifyBlock,omitempty" toml:",omitempty"`  // Contract creation restricted to whitelisted developers switch block (nil = no fork, 0 = already activated)
+	PorBlock        *big.Int `json:"porBlock,omitempty" toml:",omitempty"`        // Dpos Proof-of-Resources results recording switch block (nil = no fork, 0 = already activated)
 
 	RamanujanBlock  *big.Int `json:"ramanujanBlock,omitempty" toml:",omitempty"`  // ramanujanBlock switch block (nil = no fork, 0 = already activated)
 	NielsBlock      *big.Int `json:"nielsBlock,omitempty" toml:",omitempty"`      // nielsBlock switch block (nil = no fork, 0 = already activated)
@@ -474,11 +480,127 @@ type ParliaConfig struct {
 	EnableDevVerification bool   `json:"enableDevVerification"` // Enable developer address verification
 }
 
-// ParliaConfig is the consensus engine configs for proof-of-staked-authority based sealing.
+// DposConfig is the consensus engine configs for delegated proof-of-stake based sealing.
 type DposConfig struct {
-	Period                uint64 `json:"period"`                // Number of seconds between blocks to enforce
-	Epoch                 uint64 `json:"epoch"`                 // Epoch length to update validatorSet
-	EnableDevVerification bool   `json:"enableDevVerification"` // Enable developer address verification
+	Period                uint64            `json:"period"`                             // Number of seconds between blocks to enforce
+	Epoch                 uint64            `json:"epoch"`                              // Epoch length to update validatorSet
+	EnableDevVerification bool              `json:"enableDevVerification"`              // Enable developer address verification
+	Reward                *DposRewardConfig `json:"reward,omitempty" toml:",omitempty"` // Block reward schedule (nil = legacy fixed subsidy)
+	Admin                 common.Address    `json:"admin,omitempty"`                    // Admin of the system contracts initialized at block 1 (zero = built-in admin)
+}
+
+// DposRewardConfig is the block reward schedule of the dpos engine. From its
+// activation block on, it replaces the legacy fixed subsidy paid since block 4.
+type DposRewardConfig struct {
+	Block           *big.Int             `json:"block"`                     // Activation block of the schedule (nil = never)
+	BaseReward      *big.Int             `json:"baseReward"`                // Block subsidy in wei
+	HalvingInterval uint64               `json:"halvingInterval,omitempty"` // Number of blocks between subsidy halvings (0 = no halving)
+	Overrides       []DposRewardOverride `json:"overrides,omitempty"`       // Subsidy overrides activated at fork heights
+	SystemPool      common.Address       `json:"systemPool,omitempty"`      // Receiver of the system share of the fees
+	SystemPoolShare uint64               `json:"systemPoolShare,omitempty"` // Percentage of the fees sent to the system pool
+}
+
+// DposRewardOverride replaces the block subsidy from a fork height on. The
+// halving schedule restarts at the override height.
+type DposRewardOverride struct {
+	Block  *big.Int `json:"block"`  // Activation block of the override
+	Reward *big.Int `json:"reward"` // Block subsidy in wei
+}
+
+// IsActive returns whether the reward schedule applies to the given block.
+func (c *DposRewardConfig) IsActive(num *big.Int) bool {
+	return c != nil && isForked(c.Block, num)
+}
+
+// checkCompatible checks whether the reward schedule can replace the stored one
+// without changing the rewards of the blocks up to head.
+func (c *DposRewardConfig) checkCompatible(newcfg *DposRewardConfig, head *big.Int) *ConfigCompatError {
+	var oldBlock, newBlock *big.Int
+	if c != nil {
+		oldBlock = c.Block
+	}
+	if newcfg != nil {
+		newBlock = newcfg.Block
+	}
+	if isForkIncompatible(oldBlock, newBlock, head) {
+		return newCompatError("dpos reward schedule block", oldBlock, newBlock)
+	}
+	if !isForked(oldBlock, head) {
+		return nil
+	}
+	// The schedule is active on both sides from the same block on
+	if !configNumEqual(c.BaseReward, newcfg.BaseReward) || c.HalvingInterval != newcfg.HalvingInterval ||
+		c.SystemPool != newcfg.SystemPool || c.SystemPoolShare != newcfg.SystemPoolShare {
+		return newCompatError("dpos reward schedule", oldBlock, newBlock)
+	}
+	for _, override := range c.Overrides {
+		if isForked(override.Block, head) && !newcfg.hasOverride(override) {
+			return newCompatError("dpos reward override", override.Block, nil)
+		}
+	}
+	for _, override := range newcfg.Overrides {
+		if isForked(override.Block, head) && !c.hasOverride(override) {
+			return newCompatError("dpos reward override", nil, override.Block)
+		}
+	}
+	return nil
+}
+
+// hasOverride returns whether the schedule contains the given subsidy override.
+func (c *DposRewardConfig) hasOverride(override DposRewardOverride) bool {
+	for _, o := range c.Overrides {
+		if configNumEqual(o.Block, override.Block) && configNumEqual(o.Reward, override.Reward) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockReward returns the block subsidy paid at the given block, the latest
+// activated override taking precedence over the base reward.
+func (c *DposRewardConfig) BlockReward(num *big.Int) *big.Int {
+	if !c.IsActive(num) {
+		return new(big.Int)
+	}
+	start, reward := c.Block, c.BaseReward
+	for _, override := range c.Overrides {
+		if isForked(override.Block, num) && override.Block.Cmp(start) >= 0 {
+			start, reward = override.Block, override.Reward
+		}
+	}
+	if reward == nil {
+		return new(big.Int)
+	}
+	if c.HalvingInterval == 0 {
+		return new(big.Int).Set(reward)
+	}
+	halvings := new(big.Int).Sub(num, start)
+	halvings.Div(halvings, new(big.Int).SetUint64(c.HalvingInterval))
+	if halvings.Cmp(big.NewInt(int64(reward.BitLen()))) >= 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Rsh(reward, uint(halvings.Uint64()))
+}
+
+// validate checks that the reward schedule is well formed.
+func (c *DposRewardConfig) validate() error {
+	if c.Block == nil {
+		return nil
+	}
+	if c.SystemPoolShare > 100 {
+		return fmt.Errorf("invalid dpos system pool share %d%%", c.SystemPoolShare)
+	}
+	if c.SystemPoolShare > 0 && c.SystemPool == (common.Address{}) {
+		return errors.New("dpos system pool share set without a system pool")
+	}
+	last := c.Block
+	for _, override := range c.Overrides {
+		if override.Block == nil || override.Block.Cmp(last) < 0 {
+			return fmt.Errorf("unsupported dpos reward override ordering: override at %v before %v", override.Block, last)
+		}
+		last = override.Block
+	}
+	return nil
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -499,6 +621,8 @@ func (c *ChainConfig) String() string {
 		engine = c.Ethash
 	case c.Clique != nil:
 		engine = c.Clique
+	case c.Parlia != nil && c.Dpos != nil:
+		engine = fmt.Sprintf("%v until %v, %v", c.Parlia, c.DposBlock, c.Dpos)
 	case c.Parlia != nil:
 		engine = c.Parlia
 	case c.Dpos != nil:
@@ -506,7 +630,7 @@ func (c *ChainConfig) String() string {
 	default:
 		engine = "unknown"
 	}
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Ramanujan: %v, Niels: %v, MirrorSync: %v, Berlin: %v, YOLO v3: %v,RedCoast: %v, Engine: %v}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Ramanujan: %v, Niels: %v, MirrorSync: %v, Berlin: %v, YOLO v3: %v,RedCoast: %v, SystemTx: %v, Dpos: %v, DoubleSign: %v, DevVerify: %v, PoR: %v, Engine: %v}",
 		c.ChainID,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -525,6 +649,11 @@ func (c *ChainConfig) String() string {
 		c.BerlinBlock,
 		c.YoloV3Block,
 		c.RedCoastBlock,
+		c.SystemTxBlock,
+		c.DposBlock,
+		c.DoubleSignBlock,
+		c.DevVerifyBlock,
+		c.PorBlock,
 		engine,
 	)
 }
@@ -621,6 +750,39 @@ func (c *ChainConfig) IsRedCoast(num *big.Int) bool {
 	return isForked(c.RedCoastBlock, num)
 }
 
+// IsSystemTx returns whether num is either equal to the fork block recording the
+// dpos system calls as system transactions or greater.
+func (c *ChainConfig) IsSystemTx(num *big.Int) bool {
+	return isForked(c.SystemTxBlock, num)
+}
+
+// IsDoubleSign returns whether num is either equal to the fork block from which
+// dpos blocks may carry double sign evidences or greater.
+func (c *ChainConfig) IsDoubleSign(num *big.Int) bool {
+	return isForked(c.DoubleSignBlock, num)
+}
+
+// IsDevVerify returns whether num is either equal to the fork block from which
+// contract creation is restricted to whitelisted developers or greater.
+func (c *ChainConfig) IsDevVerify(num *big.Int) bool {
+	return isForked(c.DevVerifyBlock, num)
+}
+
+// IsPor returns whether num is either equal to the fork block from which dpos
+// blocks may record Proof-of-Resources results or greater.
+func (c *ChainConfig) IsPor(num *big.Int) bool {
+	return isForked(c.PorBlock, num)
+}
+
+// IsDpos returns whether num is sealed by the dpos engine, either on a pure dpos
+// chain or from the switch block on for a chain migrating from parlia.
+func (c *ChainConfig) IsDpos(num *big.Int) bool {
+	if c.Dpos == nil {
+		return false
+	}
+	return c.Parlia == nil || isForked(c.DposBlock, num)
+}
+
 // IsCatalyst returns whether num is either equal to the Merge fork block or greater.
 func (c *ChainConfig) IsCatalyst(num *big.Int) bool {
 	return isForked(c.CatalystBlock, num)
@@ -680,6 +842,17 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	if c.Dpos != nil && c.Dpos.Reward != nil {
+		if err := c.Dpos.Reward.validate(); err != nil {
+			return err
+		}
+	}
+	if c.DposBlock != nil && (c.Parlia == nil || c.Dpos == nil) {
+		return fmt.Errorf("dpos switch block %v requires both parlia and dpos engine configs", c.DposBlock)
+	}
+	if c.DposBlock == nil && c.Parlia != nil && c.Dpos != nil {
+		return errors.New("both parlia and dpos engines configured without a dpos switch block")
+	}
 	return nil
 }
 
@@ -739,6 +912,30 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.MirrorSyncBlock, newcfg.MirrorSyncBlock, head) {
 		return newCompatError("mirrorSync fork block", c.MirrorSyncBlock, newcfg.MirrorSyncBlock)
 	}
+	if isForkIncompatible(c.SystemTxBlock, newcfg.SystemTxBlock, head) {
+		return newCompatError("systemTx fork block", c.SystemTxBlock, newcfg.SystemTxBlock)
+	}
+	if isForkIncompatible(c.DposBlock, newcfg.DposBlock, head) {
+		return newCompatError("dpos switch block", c.DposBlock, newcfg.DposBlock)
+	}
+	if isForkIncompatible(c.DoubleSignBlock, newcfg.DoubleSignBlock, head) {
+		return newCompatError("doubleSign fork block", c.DoubleSignBlock, newcfg.DoubleSignBlock)
+	}
+	if isForkIncompatible(c.DevVerifyBlock, newcfg.DevVerifyBlock, head) {
+		return newCompatError("devVerify fork block", c.DevVerifyBlock, newcfg.DevVerifyBlock)
+	}
+	if isForkIncompatible(c.PorBlock, newcfg.PorBlock, head) {
+		return newCompatError("por fork block", c.PorBlock, newcfg.PorBlock)
+	}
+	if c.Dpos != nil && newcfg.Dpos != nil {
+		if err := c.Dpos.Reward.checkCompatible(newcfg.Dpos.Reward, head); err != nil {
+			return err
+		}
+		// The admin is handed to the system contracts initialized at block 1
+		if c.Dpos.Admin != newcfg.Dpos.Admin && isForked(common.Big1, head) {
+			return newCompatError("dpos system contracts admin", common.Big1, common.Big1)
+		}
+	}
 	return nil
 }
 
@@ -806,7 +1003,7 @@ type Rules struct {
 	ChainID                                                 *big.Int
 	IsHomestead, IsEIP150, IsEIP155, IsEIP158               bool
 	IsByzantium, IsConstantinople, IsPetersburg, IsIstanbul bool
-	IsBerlin, IsCatalyst, IsRedCoast                        bool
+	IsBerlin, IsCatalyst, IsRedCoast, IsDevVerify           bool
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -828,5 +1025,6 @@ func (c *ChainConfig) Rules(num *big.Int) Rules {
 		IsBerlin:         c.IsBerlin(num),
 		IsCatalyst:       c.IsCatalyst(num),
 		IsRedCoast:       c.IsRedCoast(num),
+		IsDevVerify:      c.IsDevVerify(num),
 	}
 }
@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -87,6 +89,173 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     30,
 			},
 		},
+		{
+			stored:  &ChainConfig{Dpos: &DposConfig{}},
+			new:     &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(50)}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{}},
+			new:    &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(30)}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos reward schedule block",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(30), BaseReward: big.NewInt(1)}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(30), BaseReward: big.NewInt(2)}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos reward schedule",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored:  &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(50), BaseReward: big.NewInt(1)}}},
+			new:     &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(50), BaseReward: big.NewInt(2), SystemPoolShare: 10}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(30), SystemPoolShare: 10}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(30), SystemPoolShare: 20}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos reward schedule",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), HalvingInterval: 100}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), HalvingInterval: 200}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos reward schedule",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), SystemPool: common.Address{1}}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), SystemPool: common.Address{2}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos reward schedule",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), Overrides: []DposRewardOverride{{Block: big.NewInt(20), Reward: big.NewInt(1)}}}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), Overrides: []DposRewardOverride{{Block: big.NewInt(20), Reward: big.NewInt(2)}}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos reward override",
+				StoredConfig: big.NewInt(20),
+				NewConfig:    nil,
+				RewindTo:     19,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10)}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), Overrides: []DposRewardOverride{{Block: big.NewInt(35), Reward: big.NewInt(2)}}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos reward override",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(35),
+				RewindTo:     34,
+			},
+		},
+		{
+			stored:  &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10)}}},
+			new:     &ChainConfig{Dpos: &DposConfig{Reward: &DposRewardConfig{Block: big.NewInt(10), Overrides: []DposRewardOverride{{Block: big.NewInt(50), Reward: big.NewInt(2)}}}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored:  &ChainConfig{Dpos: &DposConfig{}},
+			new:     &ChainConfig{Dpos: &DposConfig{Admin: common.Address{1}}},
+			head:    0,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Admin: common.Address{1}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Admin: common.Address{2}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos system contracts admin",
+				StoredConfig: big.NewInt(1),
+				NewConfig:    big.NewInt(1),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{SystemTxBlock: big.NewInt(30)},
+			new:    &ChainConfig{SystemTxBlock: big.NewInt(50)},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "systemTx fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(50),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{DposBlock: big.NewInt(30), Parlia: &ParliaConfig{}, Dpos: &DposConfig{}},
+			new:    &ChainConfig{DposBlock: big.NewInt(50), Parlia: &ParliaConfig{}, Dpos: &DposConfig{}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "dpos switch block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(50),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{DoubleSignBlock: big.NewInt(30)},
+			new:    &ChainConfig{},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "doubleSign fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    nil,
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{},
+			new:    &ChainConfig{DevVerifyBlock: big.NewInt(20)},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "devVerify fork block",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(20),
+				RewindTo:     19,
+			},
+		},
+		{
+			stored: &ChainConfig{PorBlock: big.NewInt(30)},
+			new:    &ChainConfig{PorBlock: big.NewInt(35)},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "por fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(35),
+				RewindTo:     29,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -96,3 +265,25 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestDposSwitch(t *testing.T) {
+	config := &ChainConfig{DposBlock: big.NewInt(10), Parlia: &ParliaConfig{}, Dpos: &DposConfig{}}
+	if config.IsDpos(big.NewInt(9)) || !config.IsDpos(big.NewInt(10)) {
+		t.Errorf("switching chain: dpos activation mismatch around block 10")
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		t.Errorf("switching chain: unexpected config error: %v", err)
+	}
+	if !(&ChainConfig{Dpos: &DposConfig{}}).IsDpos(big.NewInt(0)) {
+		t.Errorf("dpos chain: dpos not active at genesis")
+	}
+	if (&ChainConfig{Parlia: &ParliaConfig{}}).IsDpos(big.NewInt(100)) {
+		t.Errorf("parlia chain: dpos active")
+	}
+	if err := (&ChainConfig{Parlia: &ParliaConfig{}, Dpos: &DposConfig{}}).CheckConfigForkOrder(); err == nil {
+		t.Errorf("both engines without switch block accepted")
+	}
+	if err := (&ChainConfig{DposBlock: big.NewInt(10), Dpos: &DposConfig{}}).CheckConfigForkOrder(); err == nil {
+		t.Errorf("switch block without parlia accepted")
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/ethereum/go-ethereum/consensus/dpos"
 	"math/big"
 	"mime"
 	"reflect"
@@ -312,19 +311,21 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		if err != nil {
 			return nil, useEthereumV, err
 		}
-		header := &types.Header{}
+		// The incoming dpos payload carries the chain id ahead of the header, whose
+		// extradata is already shortened
+		header := &dposSigHeader{}
 		if err := rlp.DecodeBytes(dposData, header); err != nil {
 			return nil, useEthereumV, err
 		}
-		// The incoming parlia header is already truncated, sent to us with a extradata already shortened
-		if len(header.Extra) < 65 {
-			// Need to add it back, to get a suitable length for hashing
-			newExtra := make([]byte, len(header.Extra)+65)
-			copy(newExtra, header.Extra)
-			header.Extra = newExtra
+		chainId := header.ChainId
+		if chainId.Cmp(api.chainID) != 0 {
+			return nil, useEthereumV, fmt.Errorf("dpos header for chain id %v, signer configured for %v", chainId, api.chainID)
+		}
+		if header.Coinbase != addr.Address() {
+			return nil, useEthereumV, fmt.Errorf("dpos header coinbase %v doesn't match signer %v", header.Coinbase, addr.Address())
 		}
 		// Get back the rlp data, encoded by us
-		sighash, dposRlp, err := dposHeaderHashAndRlp(header, api.chainID)
+		sighash, dposRlp, err := dposHeaderHashAndRlp(header)
 		if err != nil {
 			return nil, useEthereumV, err
 		}
@@ -332,10 +333,30 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 			{
 				Name:  "Dpos header",
 				Typ:   "dpos",
-				Value: fmt.Sprintf("dpos header %d [0x%x]", header.Number, header.Hash()),
+				Value: fmt.Sprintf("dpos header %d [0x%x]", header.Number, sighash),
+			},
+			{
+				Name:  "chainId",
+				Typ:   "uint256",
+				Value: chainId.String(),
+			},
+			{
+				Name:  "number",
+				Typ:   "uint256",
+				Value: header.Number.String(),
+			},
+			{
+				Name:  "parentHash",
+				Typ:   "bytes32",
+				Value: header.ParentHash.Hex(),
+			},
+			{
+				Name:  "inturn",
+				Typ:   "bool",
+				Value: header.Difficulty.Cmp(dposDiffInTurn) == 0,
 			},
 		}
-		// Parlia uses V on the form 0 or 1
+		// Dpos uses V on the form 0 or 1
 		useEthereumV = false
 		req = &SignDataRequest{ContentType: mediaType, Rawdata: dposRlp, Messages: messages, Hash: sighash}
 	default: // also case TextPlain.Mime:
@@ -400,14 +421,37 @@ func parliaHeaderHashAndRlp(header *types.Header, chainId *big.Int) (hash, rlp [
 	return hash, rlp, err
 }
 
-func dposHeaderHashAndRlp(header *types.Header, chainId *big.Int) (hash, rlp []byte, err error) {
-	if len(header.Extra) < 65 {
-		err = fmt.Errorf("clique header extradata too short, %d < 65", len(header.Extra))
-		return
+// dposDiffInTurn is the difficulty of dpos headers sealed by the in-turn
+// validator.
+var dposDiffInTurn = big.NewInt(2)
+
+// dposSigHeader is the dpos header payload sealed by validators: the chain id
+// followed by the header fields, with the extradata already shortened by the
+// seal length.
+type dposSigHeader struct {
+	ChainId     *big.Int
+	ParentHash  common.Hash
+	UncleHash   common.Hash
+	Coinbase    common.Address
+	Root        common.Hash
+	TxHash      common.Hash
+	ReceiptHash common.Hash
+	Bloom       types.Bloom
+	Difficulty  *big.Int
+	Number      *big.Int
+	GasLimit    uint64
+	GasUsed     uint64
+	Time        uint64
+	Extra       []byte
+	MixDigest   common.Hash
+	Nonce       types.BlockNonce
+}
+
+func dposHeaderHashAndRlp(header *dposSigHeader) (hash, rlpData []byte, err error) {
+	if rlpData, err = rlp.EncodeToBytes(header); err != nil {
+		return nil, nil, err
 	}
-	rlp = dpos.DposRLP(header, chainId)
-	hash = dpos.SealHash(header, chainId).Bytes()
-	return hash, rlp, err
+	return crypto.Keccak256(rlpData), rlpData, nil
 }
 
 // SignTypedData signs EIP-712 conformant typed data
@@ -18,10 +18,16 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"math/big"
+	"strings"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/dpos"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 func TestBytesPadding(t *testing.T) {
@@ -143,3 +149,56 @@ func TestParseInteger(t *testing.T) {
 		}
 	}
 }
+
+// Tests that dpos headers are only signed for the configured chain and by their
+// own coinbase, with the seal hash of the engine.
+func TestDposSignatureFormat(t *testing.T) {
+	var (
+		signer   = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		stranger = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		api      = &SignerAPI{chainID: big.NewInt(1)}
+	)
+	header := &types.Header{
+		ParentHash: common.HexToHash("0x01"),
+		Coinbase:   signer,
+		Difficulty: big.NewInt(2),
+		Number:     big.NewInt(100),
+		GasLimit:   8000000,
+		Time:       1000,
+		Extra:      make([]byte, 32+65),
+	}
+	encode := func(chainID int64) string {
+		return hexutil.Encode(dpos.DposRLP(header, big.NewInt(chainID)))
+	}
+	tests := []struct {
+		addr common.Address
+		data string
+		err  string
+	}{
+		{signer, encode(1), ""},
+		{signer, encode(2), "chain id 2"},
+		{stranger, encode(1), "doesn't match signer"},
+		{signer, "0xc0ffee", "rlp"},
+	}
+	for i, tt := range tests {
+		req, legacyV, err := api.determineSignatureFormat(context.Background(), accounts.MimetypeDpos, common.NewMixedcaseAddress(tt.addr), tt.data)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("test %d: error mismatch: have %v, want %q", i, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to decode dpos header: %v", i, err)
+		}
+		if legacyV {
+			t.Errorf("test %d: legacy V requested for dpos signature", i)
+		}
+		if want := dpos.SealHash(header, api.chainID); !bytes.Equal(req.Hash, want.Bytes()) {
+			t.Errorf("test %d: seal hash mismatch: have %x, want %x", i, req.Hash, want)
+		}
+		if want := dpos.DposRLP(header, api.chainID); !bytes.Equal(req.Rawdata, want) {
+			t.Errorf("test %d: signed payload mismatch: have %x, want %x", i, req.Rawdata, want)
+		}
+	}
+}
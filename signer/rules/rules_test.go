@@ -625,3 +625,72 @@ function ApproveSignData(r){
 		t.Fatalf("Expected approved")
 	}
 }
+
+// TestDposHeaderRules tests the dpos validator ruleset from the documentation
+func TestDposHeaderRules(t *testing.T) {
+	js := `
+var chainId = "176";
+var allowOutOfTurn = false;
+
+function field(r, name) {
+	for (var i = 0; i < r.messages.length; i++) {
+		if (r.messages[i].name == name) {
+			return r.messages[i].value
+		}
+	}
+}
+
+function ApproveSignData(r) {
+	if (r.content_type != "application/x-dpos-header") {
+		return
+	}
+	if (field(r, "chainId") != chainId) {
+		return "Reject"
+	}
+	if (!field(r, "inturn") && !allowOutOfTurn) {
+		return "Reject"
+	}
+	var number = parseInt(field(r, "number"))
+	var last = parseInt(storage.get("dpos-last-number") || "0")
+	if (number <= last) {
+		return "Reject"
+	}
+	storage.put("dpos-last-number", String(number))
+	return "Approve"
+}`
+	r, err := initRuleEngine(js)
+	if err != nil {
+		t.Fatalf("Couldn't create evaluator %v", err)
+	}
+	addr, _ := mixAddr("0x694267f14675d7e1b9494fd8d72fefe1755710fa")
+
+	tests := []struct {
+		chainId string
+		number  string
+		inturn  bool
+		want    bool
+	}{
+		{"176", "10", true, true},
+		{"176", "10", true, false}, // same height signed twice
+		{"176", "9", true, false},  // lower height
+		{"772", "11", true, false}, // other chain
+		{"176", "11", false, false},
+		{"176", "11", true, true},
+	}
+	for i, test := range tests {
+		resp, _ := r.ApproveSignData(&core.SignDataRequest{
+			ContentType: accounts.MimetypeDpos,
+			Address:     *addr,
+			Messages: []*core.NameValueType{
+				{Name: "Dpos header", Typ: "dpos", Value: "dpos header " + test.number},
+				{Name: "chainId", Typ: "uint256", Value: test.chainId},
+				{Name: "number", Typ: "uint256", Value: test.number},
+				{Name: "inturn", Typ: "bool", Value: test.inturn},
+			},
+			Meta: core.Metadata{Remote: "remoteip", Local: "localip", Scheme: "inproc"},
+		})
+		if resp.Approved != test.want {
+			t.Errorf("test %d: approval mismatch: have %v, want %v", i, resp.Approved, test.want)
+		}
+	}
+}